@@ -0,0 +1,70 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// explainDenial logs explanation of denied request (failed check, route requirement, token aud/iss/exp) when
+// debug logging is enabled. In dev mode explanation is returned in error description as well.
+func explainDenial(r *http.Request, err *ServerErrorData, userInfo *UserInfo, reason string, requirement string) *ServerErrorData {
+	a, _ := r.Context().Value(contextTypeAuthorizationMiddleware).(*authorization)
+	logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+	if a != nil && a.logger != nil {
+		logger = a.logger
+	}
+	explain := a != nil && a.explain
+	debug := logger != nil && logger.IsLevelEnabled(logrus.DebugLevel)
+	if !explain && !debug {
+		return err
+	}
+
+	fields := logrus.Fields{
+		"reason": reason,
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"route":  RouteTemplate(r),
+	}
+	parts := []string{reason}
+	if requirement != "" {
+		fields["requirement"] = requirement
+		parts = append(parts, "route requires "+requirement)
+	}
+	switch userInfo {
+	case nil, unauthenticatedUser:
+		parts = append(parts, "request has no credentials")
+	case userWithInvalidToken:
+		parts = append(parts, "credentials of request are invalid")
+	default:
+		fields["user"] = userInfo.UserID
+		fields["scopes"] = userInfo.Scopes
+		fields["groups"] = userInfo.Groups
+		parts = append(parts, fmt.Sprintf("user has scopes %v and groups %v", userInfo.Scopes, userInfo.Groups))
+		var token []string
+		for _, claim := range []string{"aud", "iss"} {
+			if value, ok := userInfo.Claim(claim); ok {
+				fields[claim] = value
+				token = append(token, fmt.Sprintf("%s=%v", claim, value))
+			}
+		}
+		if exp := userInfo.ClaimTime("exp"); !exp.IsZero() {
+			fields["exp"] = exp.UTC().Format(time.RFC3339)
+			token = append(token, "exp="+exp.UTC().Format(time.RFC3339))
+		}
+		if len(token) > 0 {
+			parts = append(parts, "token "+strings.Join(token, " "))
+		}
+	}
+
+	if debug {
+		logger.WithFields(fields).Debug("access denied")
+	}
+	if explain {
+		err.Description = strings.Join(parts, "; ")
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package webservice
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Adaptive concurrency limit algorithms
+const (
+	LimitAlgorithmAIMD     = "aimd"
+	LimitAlgorithmGradient = "gradient"
+)
+
+// AdaptiveLimitOptions is a configuration container for adaptive concurrency limit. Limit of in-flight requests is
+// adjusted by observed latency - it grows while latency is stable and shrinks when latency rises.
+type AdaptiveLimitOptions struct {
+	// aimd (additive increase, multiplicative decrease on latency over Tolerance or 5xx) or gradient
+	// (limit follows ratio of long-term and current latency), default is gradient
+	Algorithm string
+	// Initial limit, default is 20
+	InitialLimit int
+	// Bounds of limit, defaults are 1 and 1000
+	MinLimit int
+	MaxLimit int
+	// Latency considered as overload by aimd, default is 1 second
+	Tolerance time.Duration
+	// Multiplier of limit on overload by aimd, default is 0.9
+	BackoffRatio float64
+}
+
+// AdaptiveLimitOptionsFromViper reads adaptive limit options, nil is returned if adaptive limit is not enabled
+func AdaptiveLimitOptionsFromViper(prefix string) *AdaptiveLimitOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &AdaptiveLimitOptions{
+		Algorithm:    viper.GetString(prefix + "algorithm"),
+		InitialLimit: viper.GetInt(prefix + "initial_limit"),
+		MinLimit:     viper.GetInt(prefix + "min_limit"),
+		MaxLimit:     viper.GetInt(prefix + "max_limit"),
+		Tolerance:    viper.GetDuration(prefix + "tolerance"),
+		BackoffRatio: viper.GetFloat64(prefix + "backoff_ratio"),
+	}
+}
+
+// adaptiveLimiter object
+type adaptiveLimiter struct {
+	options  AdaptiveLimitOptions
+	logger   *logrus.Logger
+	mutex    sync.Mutex
+	limit    float64
+	longRTT  float64
+	inFlight int64
+	// enforce is false when load shedding enforces the limit with priority classes
+	enforce  bool
+	gauge    prometheus.Gauge
+	rejected prometheus.Counter
+}
+
+// newAdaptiveLimiter creates adaptive concurrency limiter
+func newAdaptiveLimiter(options *AdaptiveLimitOptions, logger *logrus.Logger) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		options: *options,
+		logger:  logger,
+		enforce: true,
+	}
+	if l.options.Algorithm == "" {
+		l.options.Algorithm = LimitAlgorithmGradient
+	}
+	if l.options.InitialLimit <= 0 {
+		l.options.InitialLimit = 20
+	}
+	if l.options.MinLimit <= 0 {
+		l.options.MinLimit = 1
+	}
+	if l.options.MaxLimit <= 0 {
+		l.options.MaxLimit = 1000
+	}
+	if l.options.Tolerance <= 0 {
+		l.options.Tolerance = time.Second
+	}
+	if l.options.BackoffRatio <= 0 || l.options.BackoffRatio >= 1 {
+		l.options.BackoffRatio = 0.9
+	}
+	l.limit = float64(l.options.InitialLimit)
+
+	l.gauge = registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_concurrency_limit",
+		Help: "Current adaptive limit of in-flight requests.",
+	})).(prometheus.Gauge)
+	l.rejected = registerCollector(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_requests_limited_total",
+		Help: "Number of requests rejected by adaptive concurrency limit.",
+	})).(prometheus.Counter)
+	l.gauge.Set(l.limit)
+	return l
+}
+
+// Limit returns current limit
+func (l *adaptiveLimiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.limit)
+}
+
+// sample updates limit with latency of finished request
+func (l *adaptiveLimiter) sample(rtt time.Duration, inFlight int64, failed bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	switch l.options.Algorithm {
+	case LimitAlgorithmAIMD:
+		if failed || rtt > l.options.Tolerance {
+			l.limit *= l.options.BackoffRatio
+		} else if float64(inFlight)*2 >= l.limit {
+			// Limit grows only when it is actually used
+			l.limit += 1 / math.Max(1, math.Sqrt(l.limit))
+		}
+	default:
+		// Long-term latency is exponential moving average, current sample is compared to it
+		current := float64(rtt)
+		if l.longRTT == 0 {
+			l.longRTT = current
+		}
+		l.longRTT = l.longRTT*0.99 + current*0.01
+		gradient := math.Max(0.5, math.Min(1, l.longRTT/current))
+		newLimit := l.limit*gradient + math.Sqrt(l.limit)
+		l.limit = l.limit*0.8 + newLimit*0.2
+	}
+	l.limit = math.Max(float64(l.options.MinLimit), math.Min(float64(l.options.MaxLimit), l.limit))
+	l.gauge.Set(l.limit)
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (l *adaptiveLimiter) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight := atomic.AddInt64(&l.inFlight, 1)
+		defer atomic.AddInt64(&l.inFlight, -1)
+
+		if l.enforce && inFlight > int64(l.Limit()) {
+			l.rejected.Inc()
+			logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+			err := ServerErrorWithoutStack(fmt.Errorf("concurrency limit: %d requests in flight", inFlight), http.StatusServiceUnavailable, "Server is overloaded").WithRetryAfter(time.Second)
+			processHTTPError(err, w, r, logger, nil)
+			return
+		}
+
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+		l.sample(time.Since(start), inFlight, rec.Status() >= http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,65 @@
+package webservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// API dump formats
+const (
+	APIDumpMarkdown = "markdown"
+	APIDumpJSON     = "json"
+)
+
+// ErrGeneratorModeDone is returned from Start() and StartAsync() when service ran in generator mode (--dump-api, --print-config),
+// output is written and service did not listen. Caller should exit with success.
+var ErrGeneratorModeDone = errors.New("generator mode done")
+
+// APIDump is routes summary printed by --dump-api
+type APIDump struct {
+	Service string                `json:"service"`
+	Routes  []*RouteAuthorization `json:"routes"`
+}
+
+// dumpAPI writes summary of registered routes, their methods and authorization in given format
+func (s *webservice) dumpAPI(router *mux.Router, format string, out io.Writer) (err error) {
+	dump := &APIDump{Service: buildServiceName(), Routes: s.resolvedRouteAuthorizationReport(router)}
+	switch format {
+	case APIDumpJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(dump)
+	case APIDumpMarkdown:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "# %s API\n\n", dump.Service)
+		sb.WriteString("| Method | Path | Access | Scopes | Groups | Rule |\n")
+		sb.WriteString("|---|---|---|---|---|---|\n")
+		for _, ra := range dump.Routes {
+			methods := strings.Join(ra.Methods, ", ")
+			if methods == "" {
+				methods = "any"
+			}
+			fmt.Fprintf(&sb, "| %s | `%s` | %s | %s | %s | %s |\n", methods, ra.Path, ra.Policy,
+				markdownList(ra.Scopes), markdownList(ra.Groups), markdownList([]string{ra.Rule}))
+		}
+		_, err = io.WriteString(out, sb.String())
+		return
+	}
+	return fmt.Errorf("unknown API dump format %q, use %s or %s", format, APIDumpMarkdown, APIDumpJSON)
+}
+
+// markdownList formats values as inline code separated by commas
+func markdownList(values []string) string {
+	var items []string
+	for _, value := range values {
+		if value != "" {
+			items = append(items, "`"+strings.ReplaceAll(value, "|", "\\|")+"`")
+		}
+	}
+	return strings.Join(items, ", ")
+}
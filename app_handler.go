@@ -1,7 +1,9 @@
 package webservice
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -13,6 +15,9 @@ type apphandler struct {
 	allowAnonymous          *bool
 	invalidTokenIsAnonymous *bool
 	invalidScopeIsAnonymous *bool
+	allowedQueryParams      *[]string
+	allowedGroups           *[]string
+	timeWindows             []TimeWindow
 }
 
 // WithRequiredScope implements AppHandlerBuilder
@@ -41,12 +46,34 @@ func (ah *apphandler) InvalidScopeIsAnonymous() Handler {
 	return ah
 }
 
+// AllowGroups restricts route to members of any of given groups
+func (ah *apphandler) AllowGroups(groups ...string) Handler {
+	ah.allowedGroups = &groups
+	return ah
+}
+
+// AllowDuring restricts route to given time windows (see ParseTimeWindow), requests outside of windows
+// are denied with 403
+func (ah *apphandler) AllowDuring(windows ...TimeWindow) Handler {
+	ah.timeWindows = windows
+	return ah
+}
+
+// AllowQueryParams declares query parameters of the route - other parameters are rejected in strict mode
+func (ah *apphandler) AllowQueryParams(params ...string) Handler {
+	ah.allowedQueryParams = &params
+	return ah
+}
+
 type Handler interface {
 	http.Handler
 	AllowScopes(allowedScopes ...string) Handler
 	AllowAnonymous() Handler
 	InvalidTokenIsAnonymous() Handler
 	InvalidScopeIsAnonymous() Handler
+	AllowQueryParams(params ...string) Handler
+	AllowGroups(groups ...string) Handler
+	AllowDuring(windows ...TimeWindow) Handler
 }
 
 // AppHandler is handler that will fail if user is not authorized (based on token + required scope)
@@ -58,7 +85,8 @@ func AppHandler(fn HandlerFn) Handler {
 
 // Satisfies the http.Handler interface
 func (ah apphandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	// Shared header values avoid allocation per request (http.Header.Set allocates new slice)
+	w.Header()["Content-Type"] = jsonContentType
 	var err error
 
 	logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
@@ -91,7 +119,10 @@ func (ah apphandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			invalidScopeIsAnonymous = *ah.invalidScopeIsAnonymous
 		}
 
-		allowedScopes := []string{a.requiredScope}
+		allowedScopes := []string{a.requiredScopeOf(r)}
+		if mountScopes, ok := r.Context().Value(contextTypeMountScopes).([]string); ok {
+			allowedScopes = mountScopes
+		}
 		if ah.allowedScopes != nil {
 			allowedScopes = *ah.allowedScopes
 		}
@@ -105,23 +136,34 @@ func (ah apphandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			unauthorized := false
+			denial := ""
 			if userInfo == unauthenticatedUser {
 				if allowAnonymous {
 					userInfo = nil
 				} else {
 					unauthorized = true
+					denial = "anonymous access is not allowed"
 				}
 			} else if userInfo == userWithInvalidToken {
 				if invalidTokenIsAnonymous {
 					userInfo = nil
 				} else {
 					unauthorized = true
+					denial = "invalid token"
 				}
 			} else {
 
 				// Check permissions
 
+				if !a.emailAllowed(userInfo) {
+					err = explainDenial(r, ServerError(nil, http.StatusForbidden, "Email not allowed"), userInfo,
+						"email is not verified or its domain is not allowed", fmt.Sprintf("email domains %v", a.allowedEmailDomains))
+					processHTTPError(err, w, r, logger, nil)
+					return
+				}
+
 				hasValidScope := false
+				requirement := fmt.Sprintf("any of scopes %v", allowedScopes)
 
 				for _, scp := range allowedScopes {
 					if scp == "" || scp == "*" || userInfo.HasScope(scp) {
@@ -130,11 +172,22 @@ func (ah apphandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 
+				if hasValidScope && ah.allowedGroups != nil {
+					hasValidScope = false
+					requirement = fmt.Sprintf("any of groups %v", *ah.allowedGroups)
+					for _, group := range *ah.allowedGroups {
+						if userInfo.HasGroup(group) {
+							hasValidScope = true
+							break
+						}
+					}
+				}
+
 				if !hasValidScope {
 					if invalidScopeIsAnonymous {
 						userInfo = nil
 					} else {
-						err = ServerError(nil, http.StatusForbidden, "Forbidden")
+						err = explainDenial(r, ServerError(nil, http.StatusForbidden, "Forbidden"), userInfo, "missing scope or group", requirement)
 						processHTTPError(err, w, r, logger, nil)
 						return
 					}
@@ -143,12 +196,23 @@ func (ah apphandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if unauthorized {
-				err = ServerError(nil, http.StatusUnauthorized, "Unauthorized")
+				err = explainDenial(r, ServerError(nil, http.StatusUnauthorized, "Unauthorized"), userInfo, denial, "authenticated user")
 				processHTTPError(err, w, r, logger, nil)
 				return
 			}
 		}
 	}
+	if len(ah.timeWindows) > 0 {
+		if err = checkTimeWindows(ah.timeWindows, time.Now()); err != nil {
+			processHTTPError(err, w, r, logger, nil)
+			return
+		}
+	}
+	if err = validateStrictInput(r, ah.allowedQueryParams); err != nil {
+		processHTTPError(err, w, r, logger, nil)
+		return
+	}
+
 	err = ah.fn(w, r, userInfo)
 	processHTTPError(err, w, r, logger, ah.fn)
 }
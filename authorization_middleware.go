@@ -2,12 +2,10 @@ package webservice
 
 import (
 	"context"
-	"crypto/rsa"
 	"fmt"
 	"net/http"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/spf13/viper"
 
 	"github.com/lestrrat-go/jwx/jwk"
@@ -19,7 +17,11 @@ type UserInfo struct {
 	UserID string                 `json:"uid,omitempty"`
 	Email  string                 `json:"email,omitempty"`
 	Scopes []string               `json:"scopes,omitempty"`
+	Groups []string               `json:"groups,omitempty"`
 	Claims map[string]interface{} `json:"claims,omitempty"`
+
+	// authScheme is set by authentication which doesn't use tokens (e.g. HMACAuthScheme), it can't be set by claims
+	authScheme string
 }
 
 var userWithInvalidToken = &UserInfo{UserID: "_invalid_token_"}
@@ -35,12 +37,41 @@ func (ui *UserInfo) HasScope(scope string) bool {
 	return false
 }
 
+// HasGroup returns if user is member of given group
+func (ui *UserInfo) HasGroup(group string) bool {
+	for idx := range ui.Groups {
+		if ui.Groups[idx] == group {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultGroupsClaims are claims with group membership of common identity providers (Keycloak/Okta, Cognito, Azure AD)
+var defaultGroupsClaims = []string{"groups", "cognito:groups", "wids"}
+
 type contextType int
 
 const (
 	contextTypeUserInfo contextType = iota
 	contextTypeAuthorizationMiddleware
 	contextTypeLogger
+	contextTypeRouteTemplate
+	contextTypeMountScopes
+	contextTypeStripPath
+	contextTypePathParam
+	contextTypeJobManager
+	contextTypeResolvedUserInfo
+	contextTypeEventBus
+	contextTypeGeoInfo
+	contextTypeStrictOptions
+	contextTypeBlobStorage
+	contextTypeMailer
+	contextTypeAudience
+	contextTypeTenant
+	contextTypeJSONOptions
+	contextTypeMQTT
+	contextTypeClientAddress
 )
 
 type HandlerFn func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) (err error)
@@ -51,11 +82,23 @@ type authorization struct {
 	jwks                    jwk.Set
 	jwksURL                 string
 	autoRefresh             *jwk.AutoRefresh
+	devKeys                 func() jwk.Set
 	requiredScope           string
 	allowAnonymous          bool
 	invalidTokenIsAnonymous bool
 	invalidScopeIsAnonymous bool
 	disabled                bool
+	hmac                    *HMACOptions
+	groupsClaim             string
+	requireVerifiedEmail    bool
+	allowedEmailDomains     []string
+	seenUsers               *seenUsers
+	claimHeaders            map[string]string
+	audiences               []AudienceOptions
+	trustedHeaders          *TrustedHeaderOptions
+	trustedHeadersErr       error
+	sources                 []IdentitySource
+	explain                 bool
 }
 
 // Middleware returns middleware function that can be used in router.Use()
@@ -65,90 +108,26 @@ func (a *authorization) Middleware(h http.Handler) (handler http.Handler) {
 
 		ctx := context.WithValue(r.Context(), contextTypeAuthorizationMiddleware, a)
 
-		var userInfo *UserInfo = unauthenticatedUser
-
-		tokenString := r.Header.Get("Authorization")
-		if tokenString != "" {
-			userInfo = userWithInvalidToken
-
-			splitToken := strings.Split(tokenString, "Bearer")
-			if len(splitToken) != 2 {
-				if a.logger != nil {
-					a.logger.Errorf("wrong Authorization header")
-				}
-			} else {
-
-				tokenString = strings.Trim(splitToken[1], " ")
-				token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-
-					keyID, ok := token.Header["kid"].(string)
-					if !ok {
-						return nil, fmt.Errorf("no key ID in token header")
-					}
-
-					jwks := a.jwks
-					var err error
-					if a.autoRefresh != nil {
-						jwks, err = a.autoRefresh.Fetch(context.Background(), a.jwksURL)
-						if err != nil {
-							return nil, err
-						}
-					}
-
-					if jwks == nil {
-						return nil, fmt.Errorf("jwks not available")
-					}
-
-					key, keyFound := jwks.LookupKeyID(keyID)
-
-					if keyFound {
-						var publicKey rsa.PublicKey
-						err := key.Raw(&publicKey)
-						return &publicKey, err
-					}
-
-					return nil, fmt.Errorf("unable to find key with id: %s", keyID)
-				})
-
-				if err == nil {
-					if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-
-						if a.logger != nil {
-							a.logger.Tracef("auth: User claims: %+v", claims)
-						}
-						var uid string
-						var mail string
-						var scopes []string
-
-						if v, ok := claims["sub"].(string); ok {
-							uid = v
-						}
-
-						if v, ok := claims["email"].(string); ok {
-							mail = v
-						}
-
-						if v, ok := claims["scope"].(string); ok {
-							scopes = strings.Fields(v)
-						}
-
-						if uid != "" {
-							userInfo = &UserInfo{
-								UserID: uid,
-								Email:  mail,
-								Scopes: scopes,
-								Claims: claims,
-							}
-						}
-					}
-				} else {
-					if a.logger != nil {
-						a.logger.WithError(err).Errorf("error decoding token")
-					}
-				}
+		userInfo, err := a.identify(r)
+		if err != nil {
+			processHTTPError(err, w, r, a.logger, nil)
+			return
+		}
+		if audience, ok := a.tokenAudience(userInfo); ok {
+			ctx = contextWithAudience(ctx, audience)
+		}
+
+		if a.seenUsers != nil && userInfo != unauthenticatedUser && userInfo != userWithInvalidToken {
+			if err := a.seenUsers.provision(r.Context(), userInfo); err != nil {
+				processHTTPError(ServerError(err, http.StatusInternalServerError, "Unable to provision user"), w, r, a.logger, nil)
+				return
 			}
 		}
 
+		if len(a.claimHeaders) > 0 {
+			a.setClaimHeaders(r, userInfo)
+		}
+
 		if userInfo != nil {
 			ctx = context.WithValue(ctx, contextTypeUserInfo, userInfo)
 		}
@@ -165,6 +144,9 @@ type AuthorizationOptions struct {
 	// As alternative to Jwks, JwksURL can be provided. Middleware will fetch Jwks and auto refresh.
 	// If Jwks is provided, JwksURL will be ignored.
 	JwksURL string
+	// File where Jwks fetched from JwksURL is persisted. It is used for conditional refresh and when JwksURL
+	// is not available.
+	JwksCacheFile string
 	// Required scope that needs to be present in token. If given scope is not present
 	// request will be denied. Scope '*' can be set and means any - only key must match.
 	RequiredScope string
@@ -176,17 +158,68 @@ type AuthorizationOptions struct {
 	InvalidScopeIsAnonymous bool
 	// Disable authorization - it will allow all requests and UserInfo will be always nil
 	Disabled bool
+	// HMAC request signing as alternative to tokens for machine-to-machine calls
+	HMAC *HMACOptions
+	// Scope requirements of routes declared in configuration (see AuthorizationRule)
+	Rules []AuthorizationRule
+	// Fail startup if any route has no authorization declaration (AppHandler or configuration rule)
+	Strict bool
+	// Claim with group membership (path like "realm_access.groups" is supported). Default are groups,
+	// cognito:groups and wids claims.
+	GroupsClaim string
+	// Deny users without email_verified=true claim
+	RequireVerifiedEmail bool
+	// Deny users with email outside of given domains (e.g. example.com), empty means all domains
+	AllowedEmailDomains []string
+	// Project user info and claims into request headers (header name -> uid, email, scopes, groups or claim path)
+	// for legacy handlers and upstreams reading headers. Headers sent by client are removed. See DefaultClaimHeaders.
+	ClaimHeaders map[string]string
+	// Delegate authorization decisions to external policy decision point
+	ExternalAuthorizer *ExternalAuthorizerOptions
+	// Trust identity headers set by upstream authenticating proxy (e.g. oauth2-proxy)
+	TrustedHeaders *TrustedHeaderOptions
+	// Additional sources of user identity (API keys, sessions, client certificates, ...) asked before
+	// trusted headers, HMAC signature and token
+	IdentitySources []IdentitySource
+	// Verification settings selected by aud claim of token. If set, tokens without any of the audiences
+	// are invalid.
+	Audiences []AudienceOptions
+	// Return explanation of denied access in error description (dev mode only)
+	ExplainDenials bool
 }
 
 func AuthorizationOptionsFromViper(prefix string) (options *AuthorizationOptions) {
-	return &AuthorizationOptions{
+	options = &AuthorizationOptions{
 		JwksURL:                 viper.GetString(prefix + "jwks"),
+		JwksCacheFile:           viper.GetString(prefix + "jwks_cache_file"),
 		Disabled:                viper.GetBool(prefix + "disabled"),
 		RequiredScope:           viper.GetString(prefix + "scope"),
 		AllowAnonymous:          viper.GetBool(prefix + "allow_anonymous"),
 		InvalidTokenIsAnonymous: viper.GetBool(prefix + "invalid_token_is_anonymous"),
 		InvalidScopeIsAnonymous: viper.GetBool(prefix + "invalid_scope_is_anonymous"),
+		HMAC:                    HMACOptionsFromViper(prefix + "hmac."),
+		Strict:                  viper.GetBool(prefix + "strict"),
+		GroupsClaim:             viper.GetString(prefix + "groups_claim"),
+		RequireVerifiedEmail:    viper.GetBool(prefix + "require_verified_email"),
+		AllowedEmailDomains:     viper.GetStringSlice(prefix + "allowed_email_domains"),
+		ClaimHeaders:            viper.GetStringMapString(prefix + "claim_headers"),
+		ExternalAuthorizer:      ExternalAuthorizerOptionsFromViper(prefix + "external."),
+		TrustedHeaders:          TrustedHeaderOptionsFromViper(prefix + "trusted_headers."),
+		ExplainDenials:          viper.GetBool(prefix + "explain_denials"),
+	}
+	if viper.GetBool(prefix + "forward_user_headers") {
+		claimHeaders := map[string]string{}
+		for header, claim := range DefaultClaimHeaders {
+			claimHeaders[header] = claim
+		}
+		for header, claim := range options.ClaimHeaders {
+			claimHeaders[header] = claim
+		}
+		options.ClaimHeaders = claimHeaders
 	}
+	viper.UnmarshalKey(prefix+"rules", &options.Rules)
+	viper.UnmarshalKey(prefix+"audiences", &options.Audiences)
+	return
 }
 
 // New create new AuthMiddleware object
@@ -200,6 +233,16 @@ func newAuthorizationMiddleware(options *AuthorizationOptions, logger *logrus.Lo
 		invalidTokenIsAnonymous: options.InvalidTokenIsAnonymous,
 		invalidScopeIsAnonymous: options.InvalidScopeIsAnonymous,
 		disabled:                options.Disabled,
+		hmac:                    options.HMAC,
+		groupsClaim:             options.GroupsClaim,
+		requireVerifiedEmail:    options.RequireVerifiedEmail,
+		allowedEmailDomains:     options.AllowedEmailDomains,
+		claimHeaders:            options.ClaimHeaders,
+		audiences:               options.Audiences,
+	}
+	if options.TrustedHeaders != nil {
+		trustedHeaders := *options.TrustedHeaders
+		a.trustedHeaders = &trustedHeaders
 	}
 
 	if a.requiredScope == "" {
@@ -209,19 +252,76 @@ func newAuthorizationMiddleware(options *AuthorizationOptions, logger *logrus.Lo
 	if a.disabled {
 		a.jwks = nil
 		a.jwksURL = ""
+		a.hmac = nil
+		a.trustedHeaders = nil
+	}
+
+	if a.trustedHeaders != nil {
+		a.trustedHeadersErr = a.trustedHeaders.init()
 	}
 
 	if a.jwks == nil && a.jwksURL != "" {
 		a.autoRefresh = jwk.NewAutoRefresh(context.TODO())
-		a.autoRefresh.Configure(a.jwksURL)
+		if options.JwksCacheFile != "" {
+			client := &http.Client{Transport: newJWKSCacheTransport(options.JwksCacheFile, logger)}
+			a.autoRefresh.Configure(a.jwksURL, jwk.WithHTTPClient(client))
+		} else {
+			a.autoRefresh.Configure(a.jwksURL)
+		}
+	}
+
+	if !a.disabled {
+		a.sources = a.identitySources(options.IdentitySources)
 	}
 	return
 }
 
+// groups returns group membership from configured or default groups claim
+func (a *authorization) groups(userInfo *UserInfo) []string {
+	if a.groupsClaim != "" {
+		return userInfo.ClaimStringSlice(a.groupsClaim)
+	}
+	for _, claim := range defaultGroupsClaims {
+		if groups := userInfo.ClaimStringSlice(claim); len(groups) > 0 {
+			return groups
+		}
+	}
+	return nil
+}
+
+// emailAllowed checks verified email and allowed email domains of token users (signed requests are not affected)
+func (a *authorization) emailAllowed(userInfo *UserInfo) bool {
+	if userInfo.authScheme == HMACAuthScheme {
+		return true
+	}
+	if a.requireVerifiedEmail && !userInfo.ClaimBool("email_verified") {
+		return false
+	}
+	if len(a.allowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(userInfo.Email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := userInfo.Email[at+1:]
+	for _, allowed := range a.allowedEmailDomains {
+		if strings.EqualFold(domain, strings.TrimPrefix(allowed, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *authorization) Validate() (err error) {
 
-	if !a.disabled && a.autoRefresh == nil && a.jwks == nil {
-		err = fmt.Errorf("authorization is enabled, but not configured - Jwks or JwksURL are required")
+	if !a.disabled && len(a.sources) == 0 {
+		err = fmt.Errorf("authorization is enabled, but not configured - Jwks, JwksURL, HMAC keys, trusted headers or identity sources are required")
+		return
+	}
+
+	if a.trustedHeadersErr != nil {
+		err = a.trustedHeadersErr
 		return
 	}
 
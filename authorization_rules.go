@@ -0,0 +1,127 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthorizationRule declares scopes required for paths and methods. Rules are evaluated in order, the first
+// matching rule applies. Requests not matching any rule are authorized by handlers as usual.
+type AuthorizationRule struct {
+	// Path pattern relative to strip path - * matches one segment, ** matches any number of segments
+	// (e.g. /admin/**, /users/*/orders)
+	Path string `mapstructure:"path"`
+	// HTTP methods, empty means all methods
+	Methods []string `mapstructure:"methods"`
+	// User needs at least one of scopes, empty means any authenticated user
+	Scopes []string `mapstructure:"scopes"`
+	// Allow anonymous access (and invalid token as anonymous)
+	Anonymous bool `mapstructure:"anonymous"`
+}
+
+// matchPathPattern matches slash separated path against pattern with * and ** wildcards
+func matchPathPattern(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for idx := 0; idx <= len(segments); idx++ {
+			if matchPathPattern(pattern[1:], segments[idx:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchPathPattern(pattern[1:], segments[1:])
+}
+
+// matches returns if rule applies to request with given path
+func (rule *AuthorizationRule) matches(method string, requestPath string) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return matchPathPattern(strings.Split(strings.Trim(rule.Path, "/"), "/"), strings.Split(strings.Trim(requestPath, "/"), "/"))
+}
+
+// trimPathPrefix removes prefix from path on segment boundary, e.g. /api is removed from /api/admin, but not from
+// /apiadmin
+func trimPathPrefix(requestPath string, prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return requestPath
+	}
+	if requestPath == prefix {
+		return "/"
+	}
+	if strings.HasPrefix(requestPath, prefix+"/") {
+		return requestPath[len(prefix):]
+	}
+	return requestPath
+}
+
+// authorizationRulesMiddleware enforces authorization rules from configuration. It runs in router, after
+// authorization middleware resolved user info.
+func authorizationRulesMiddleware(rules []AuthorizationRule, stripPath string, logger *logrus.Logger) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userInfo, ok := r.Context().Value(contextTypeUserInfo).(*UserInfo)
+			if !ok || userInfo == nil {
+				// Authorization is disabled
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			requestPath := trimPathPrefix(r.URL.Path, stripPath)
+			for idx := range rules {
+				rule := &rules[idx]
+				if !rule.matches(r.Method, requestPath) {
+					continue
+				}
+
+				var err *ServerErrorData
+				if userInfo == unauthenticatedUser || userInfo == userWithInvalidToken {
+					if !rule.Anonymous {
+						err = ServerError(nil, http.StatusUnauthorized, "Unauthorized")
+					}
+				} else if len(rule.Scopes) > 0 {
+					err = ServerError(nil, http.StatusForbidden, "Forbidden")
+					for _, scope := range rule.Scopes {
+						if userInfo.HasScope(scope) {
+							err = nil
+							break
+						}
+					}
+				}
+				if err != nil {
+					requirement := fmt.Sprintf("any of scopes %v (rule %s)", rule.Scopes, rule.Path)
+					if len(rule.Scopes) == 0 {
+						requirement = fmt.Sprintf("authenticated user (rule %s)", rule.Path)
+					}
+					processHTTPError(explainDenial(r, err, userInfo, "denied by authorization rule", requirement), w, r, logger, nil)
+					return
+				}
+				break
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package webservice
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matched bool
+	}{
+		{"/users", "/users", true},
+		{"/users", "/users/1", false},
+		{"/users/*", "/users/1", true},
+		{"/users/*", "/users", false},
+		{"/users/*", "/users/1/orders", false},
+		{"/users/*/orders", "/users/1/orders", true},
+		{"/users/*/orders", "/users/1/invoices", false},
+		{"/admin/**", "/admin", true},
+		{"/admin/**", "/admin/users/1", true},
+		{"/admin/**", "/administrator", false},
+		{"/**/orders", "/users/1/orders", true},
+		{"/**/orders", "/users/1/orders/2", false},
+		{"/**", "/", true},
+		{"/files/*.pdf", "/files/report.pdf", true},
+		{"/files/*.pdf", "/files/report.txt", false},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			rule := &AuthorizationRule{Path: test.pattern}
+			if matched := rule.matches(http.MethodGet, test.path); matched != test.matched {
+				t.Fatalf("expected matched %v, got %v", test.matched, matched)
+			}
+		})
+	}
+}
+
+func TestAuthorizationRulesMiddleware(t *testing.T) {
+	rules := []AuthorizationRule{
+		{Path: "/public/**", Anonymous: true},
+		{Path: "/admin/**", Scopes: []string{"admin", "root"}},
+		{Path: "/items/*", Methods: []string{"post", "DELETE"}, Scopes: []string{"write"}},
+		{Path: "/items/**", Scopes: []string{"read"}},
+		{Path: "/items/special", Anonymous: true},
+	}
+	user := &UserInfo{UserID: "user", Scopes: []string{"read"}}
+	admin := &UserInfo{UserID: "admin", Scopes: []string{"root"}}
+
+	tests := []struct {
+		name      string
+		stripPath string
+		method    string
+		path      string
+		userInfo  *UserInfo
+		status    int
+	}{
+		{"anonymous rule", "", http.MethodGet, "/public/docs", unauthenticatedUser, http.StatusOK},
+		{"anonymous rule with invalid token", "", http.MethodGet, "/public/docs", userWithInvalidToken, http.StatusOK},
+		{"unauthenticated", "", http.MethodGet, "/admin/users", unauthenticatedUser, http.StatusUnauthorized},
+		{"invalid token", "", http.MethodGet, "/admin/users", userWithInvalidToken, http.StatusUnauthorized},
+		{"missing scope", "", http.MethodGet, "/admin/users", user, http.StatusForbidden},
+		{"any of scopes", "", http.MethodGet, "/admin/users", admin, http.StatusOK},
+		{"method filter matches", "", http.MethodPost, "/items/1", user, http.StatusForbidden},
+		{"method filter is case insensitive", "", http.MethodDelete, "/items/1", user, http.StatusForbidden},
+		{"method filter does not match", "", http.MethodGet, "/items/1", user, http.StatusOK},
+		{"first matching rule wins", "", http.MethodGet, "/items/special", unauthenticatedUser, http.StatusUnauthorized},
+		{"no matching rule", "", http.MethodGet, "/other", unauthenticatedUser, http.StatusOK},
+		{"behind strip path", "/api", http.MethodGet, "/api/admin/users", user, http.StatusForbidden},
+		{"behind strip path with slash", "/api/", http.MethodGet, "/api/admin/users", user, http.StatusForbidden},
+		{"strip path root", "/api", http.MethodGet, "/api", unauthenticatedUser, http.StatusOK},
+		{"strip path is not segment prefix", "/api", http.MethodGet, "/apiadmin/users", user, http.StatusOK},
+		{"strip path is not segment prefix of rule", "/ad", http.MethodGet, "/admin/users", user, http.StatusForbidden},
+		{"authorization disabled", "", http.MethodGet, "/admin/users", nil, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			handler := authorizationRulesMiddleware(rules, test.stripPath, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(test.method, test.path, nil)
+			if test.userInfo != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextTypeUserInfo, test.userInfo))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, rec.Code)
+			}
+		})
+	}
+}
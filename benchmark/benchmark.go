@@ -0,0 +1,3 @@
+// Package benchmark contains benchmarks of the framework (run by go test -bench, e.g. go test -run '^$' -bench .
+// ./benchmark, or by cmd/webservice-bench) and sample service with load test scenarios.
+package benchmark
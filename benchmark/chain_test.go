@@ -0,0 +1,61 @@
+package benchmark
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+var (
+	chainSample *Sample
+	chainErr    error
+	chainOnce   sync.Once
+)
+
+// sharedSample returns sample service on in-memory listener shared by chain benchmarks
+func sharedSample(b *testing.B) *Sample {
+	chainOnce.Do(func() {
+		chainSample, chainErr = StartSample(NewPipeListener())
+	})
+	if chainErr != nil {
+		b.Fatal(chainErr)
+	}
+	return chainSample
+}
+
+// request sends scenario request b.N times through complete middleware chain
+func request(b *testing.B, name string, expectedStatus int) {
+	sample := sharedSample(b)
+	var scenario Scenario
+	for _, s := range sample.Scenarios() {
+		if s.Name == name {
+			scenario = s
+		}
+	}
+	if scenario.Name == "" {
+		scenario = Scenario{Name: name, Method: http.MethodGet, Path: "/" + name}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := sample.Client.Do(scenario.request(sample.URL))
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			b.Fatalf("%s: unexpected status %d", name, resp.StatusCode)
+		}
+	}
+}
+
+// BenchmarkChain measures requests through complete middleware chain - anonymous route, route verifying JWT,
+// route returning error and request without route
+func BenchmarkChain(b *testing.B) {
+	b.Run("Anonymous", func(b *testing.B) { request(b, "anonymous", http.StatusOK) })
+	b.Run("JWT", func(b *testing.B) { request(b, "jwt", http.StatusOK) })
+	b.Run("Error", func(b *testing.B) { request(b, "error", http.StatusNotFound) })
+	b.Run("NotFound", func(b *testing.B) { request(b, "missing", http.StatusNotFound) })
+}
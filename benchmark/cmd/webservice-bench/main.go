@@ -0,0 +1,76 @@
+// Command webservice-bench runs framework benchmarks (e.g. webservice-bench -run Chain) or load test scenarios of
+// sample service (e.g. webservice-bench -load -rate 1000 -duration 30s). Benchmarks are run by go test -bench, so
+// go toolchain and module source are required and output can be compared by benchstat.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/beanox/webservice/benchmark"
+)
+
+// benchmarkPackage is package with framework benchmarks
+const benchmarkPackage = "github.com/beanox/webservice/benchmark"
+
+func main() {
+	run := flag.String("run", "", "Regular expression selecting benchmarks or load scenarios")
+	load := flag.Bool("load", false, "Run load test scenarios against sample service instead of benchmarks")
+	target := flag.String("target", "", "Base URL of already running service for load test (sample routes /anonymous, /jwt and /error)")
+	token := flag.String("token", "", "Bearer token of jwt scenario when target is set")
+	rate := flag.Int("rate", 0, "Requests per second, zero means as fast as possible")
+	duration := flag.Duration("duration", time.Second*10, "Duration of each load scenario")
+	connections := flag.Int("connections", 10, "Concurrent connections")
+	benchtime := flag.String("benchtime", "1s", "Run time or iterations of each benchmark (go test -benchtime)")
+	count := flag.Int("count", 1, "Number of runs of each benchmark (go test -count)")
+	flag.Parse()
+
+	filter := regexp.MustCompile(*run)
+	if !*load {
+		bench := *run
+		if bench == "" {
+			bench = "."
+		}
+		cmd := exec.Command("go", "test", "-run", "^$", "-bench", bench, "-benchmem",
+			"-benchtime", *benchtime, "-count", fmt.Sprint(*count), benchmarkPackage)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var sample *benchmark.Sample
+	if *target == "" {
+		var err error
+		sample, err = benchmark.StartSample(nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		sample = &benchmark.Sample{URL: *target, Token: *token, Client: &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *connections}}}
+	}
+
+	options := benchmark.LoadOptions{Rate: *rate, Duration: *duration, Connections: *connections}
+	failed := false
+	for _, scenario := range sample.Scenarios() {
+		if !filter.MatchString(scenario.Name) {
+			continue
+		}
+		result := benchmark.Load(context.Background(), sample.Client, sample.URL, scenario, options)
+		fmt.Println(result)
+		failed = failed || result.Errors > 0
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
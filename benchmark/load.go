@@ -0,0 +1,170 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scenario is request sent repeatedly by load test
+type Scenario struct {
+	Name   string
+	Method string
+	Path   string
+	Header http.Header
+}
+
+// request creates request of scenario
+func (s Scenario) request(baseURL string) *http.Request {
+	r, _ := http.NewRequest(s.Method, baseURL+s.Path, nil)
+	for key, values := range s.Header {
+		r.Header[key] = values
+	}
+	return r
+}
+
+// LoadOptions configures load test. With Rate requests are sent at constant rate regardless of latency
+// (like vegeta), otherwise each of Connections sends next request when previous one is done (like wrk).
+type LoadOptions struct {
+	// Requests per second, zero means as fast as possible
+	Rate int
+	// Duration of the test, default is 10 seconds
+	Duration time.Duration
+	// Number of concurrent workers, default is 10
+	Connections int
+}
+
+// LoadResult is result of load test
+type LoadResult struct {
+	Scenario string
+	Requests int
+	// Transport errors and responses with status >= 500
+	Errors   int
+	Duration time.Duration
+	Latency  struct {
+		Mean time.Duration
+		P50  time.Duration
+		P90  time.Duration
+		P99  time.Duration
+		Max  time.Duration
+	}
+	// Number of responses by status code
+	StatusCodes map[int]int
+}
+
+// RPS returns achieved requests per second
+func (r *LoadResult) RPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// String formats result on single line
+func (r *LoadResult) String() string {
+	return fmt.Sprintf("%-12s %8d req %10.1f req/s  errors %d  mean %v  p50 %v  p90 %v  p99 %v  max %v  codes %v",
+		r.Scenario, r.Requests, r.RPS(), r.Errors, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99,
+		r.Latency.Max, r.StatusCodes)
+}
+
+// Load sends scenario requests to service at baseURL and measures latency
+func Load(ctx context.Context, client *http.Client, baseURL string, scenario Scenario, options LoadOptions) *LoadResult {
+	if options.Duration <= 0 {
+		options.Duration = time.Second * 10
+	}
+	if options.Connections <= 0 {
+		options.Connections = 10
+	}
+	ctx, cancel := context.WithTimeout(ctx, options.Duration)
+	defer cancel()
+
+	// Rate limited tests get tickets from pacer, otherwise workers send requests back to back
+	var tickets chan struct{}
+	if options.Rate > 0 {
+		tickets = make(chan struct{}, options.Connections)
+		go func() {
+			defer close(tickets)
+			interval := time.Second / time.Duration(options.Rate)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					select {
+					case tickets <- struct{}{}:
+					default:
+						// All workers are busy - request is dropped like missed deadline of vegeta
+					}
+				}
+			}
+		}()
+	}
+
+	result := &LoadResult{Scenario: scenario.Name, StatusCodes: map[int]int{}}
+	var mutex sync.Mutex
+	var latencies []time.Duration
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < options.Connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tickets != nil {
+					if _, ok := <-tickets; !ok {
+						return
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				sent := time.Now()
+				resp, err := client.Do(scenario.request(baseURL).WithContext(ctx))
+				status := 0
+				if err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					status = resp.StatusCode
+				} else if ctx.Err() != nil {
+					return
+				}
+				latency := time.Since(sent)
+
+				mutex.Lock()
+				result.Requests++
+				if err != nil || status >= http.StatusInternalServerError {
+					result.Errors++
+				}
+				if status != 0 {
+					result.StatusCodes[status]++
+				}
+				latencies = append(latencies, latency)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var total time.Duration
+		for _, latency := range latencies {
+			total += latency
+		}
+		percentile := func(p float64) time.Duration {
+			return latencies[int(float64(len(latencies)-1)*p)]
+		}
+		result.Latency.Mean = total / time.Duration(len(latencies))
+		result.Latency.P50 = percentile(0.5)
+		result.Latency.P90 = percentile(0.9)
+		result.Latency.P99 = percentile(0.99)
+		result.Latency.Max = latencies[len(latencies)-1]
+	}
+	return result
+}
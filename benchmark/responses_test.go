@@ -0,0 +1,62 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beanox/webservice"
+	"github.com/sirupsen/logrus"
+)
+
+// discardWriter is response writer without allocations
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// serve runs handler b.N times
+func serve(b *testing.B, handler http.Handler) {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// BenchmarkErrorResponse measures AppHandler returning server error
+func BenchmarkErrorResponse(b *testing.B) {
+	serve(b, webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return webservice.ServerErrorWithoutStack(nil, http.StatusNotFound, "Not found").WithErrorCode("ITEM_NOT_FOUND")
+	}))
+}
+
+// BenchmarkJSONResponse measures AppHandler writing JSON by pooled WriteJSON
+func BenchmarkJSONResponse(b *testing.B) {
+	serve(b, webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return webservice.WriteJSON(w, r, items)
+	}))
+}
+
+// BenchmarkJSONResponseUnpooled is baseline of BenchmarkJSONResponse with new encoder per request
+func BenchmarkJSONResponseUnpooled(b *testing.B) {
+	serve(b, webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return json.NewEncoder(w).Encode(items)
+	}))
+}
+
+// BenchmarkErrorResponseLogged measures server error logged by logging middleware at info level
+func BenchmarkErrorResponseLogged(b *testing.B) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	serve(b, webservice.NewLoggingMiddleware(logger).Middleware(webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return webservice.ServerErrorWithoutStack(nil, http.StatusNotFound, "Not found").WithErrorCode("ITEM_NOT_FOUND")
+	})))
+}
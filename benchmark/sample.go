@@ -0,0 +1,198 @@
+package benchmark
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/beanox/webservice"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// sampleScope is scope required by JWT route of sample service
+const sampleScope = "bench"
+
+// item is typical small API response
+type item struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+var items = []item{
+	{ID: "1", Name: "first", Count: 10, Tags: []string{"a", "b"}},
+	{ID: "2", Name: "second", Count: 20, Tags: []string{"c"}},
+}
+
+// sampleService is service object of sample service - anonymous, JWT and error routes
+type sampleService struct{}
+
+// ConfigureRouter implements webservice.ConfigureRouterHandler
+func (sampleService) ConfigureRouter(router *mux.Router) (http.Handler, error) {
+	router.Handle("/anonymous", webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return webservice.WriteJSON(w, r, items)
+	}).AllowAnonymous()).Methods(http.MethodGet)
+	router.Handle("/jwt", webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return webservice.WriteJSON(w, r, items)
+	}).AllowScopes(sampleScope)).Methods(http.MethodGet)
+	router.Handle("/error", webservice.AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *webservice.UserInfo) error {
+		return webservice.ServerErrorWithoutStack(nil, http.StatusNotFound, "Not found").WithErrorCode("ITEM_NOT_FOUND")
+	}).AllowAnonymous()).Methods(http.MethodGet)
+	return router, nil
+}
+
+// Sample is running sample service with typical middleware chain (logging, authorization, metrics)
+type Sample struct {
+	Service webservice.WebService
+	// Base URL of the service
+	URL string
+	// Token accepted by JWT route
+	Token string
+	// Client connected to the service
+	Client *http.Client
+}
+
+// StartSample starts sample service on listener, loopback TCP listener is used if listener is nil
+func StartSample(listener net.Listener) (sample *Sample, err error) {
+	issuer, err := newSampleIssuer()
+	if err != nil {
+		return
+	}
+	token, err := issuer.SignToken(jwt.MapClaims{"sub": "bench", "scope": sampleScope}, time.Hour*24)
+	if err != nil {
+		return
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var options []webservice.Option
+	if listener != nil {
+		options = append(options, webservice.WithListener(listener))
+	}
+	svc := webservice.New(sampleService{}, options...)
+	svc.SetListenAddress("127.0.0.1:0")
+	svc.SetLogger(logger)
+	svc.EnablePrometheusMetrics(true)
+	svc.EnableAuthorization(&webservice.AuthorizationOptions{Jwks: issuer.PublicKeys(), RequiredScope: sampleScope})
+	if err = svc.StartAsync(); err != nil {
+		return
+	}
+	select {
+	case <-svc.Ready():
+	case <-time.After(time.Second * 10):
+		return nil, fmt.Errorf("sample service is not ready")
+	}
+
+	transport := &http.Transport{MaxIdleConnsPerHost: 1024}
+	if pipe, ok := listener.(*PipeListener); ok {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return pipe.Dial()
+		}
+	}
+	return &Sample{
+		Service: svc,
+		URL:     "http://" + svc.Addr(),
+		Token:   token,
+		Client:  &http.Client{Transport: transport},
+	}, nil
+}
+
+// newSampleIssuer creates token issuer of sample service with generated key
+func newSampleIssuer() (issuer *webservice.TokenIssuer, err error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+	file, err := os.CreateTemp("", "benchmark-key-*.pem")
+	if err != nil {
+		return
+	}
+	defer os.Remove(file.Name())
+	err = pem.Encode(file, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	config := viper.New()
+	config.Set("private_key_file", file.Name())
+	issuer = webservice.NewTokenIssuer("benchmark", nil)
+	err = issuer.Configure(config)
+	return
+}
+
+// Scenarios returns load scenarios of sample service
+func (s *Sample) Scenarios() []Scenario {
+	return []Scenario{
+		{Name: "anonymous", Method: http.MethodGet, Path: "/anonymous"},
+		{Name: "jwt", Method: http.MethodGet, Path: "/jwt", Header: http.Header{"Authorization": {"Bearer " + s.Token}}},
+		{Name: "error", Method: http.MethodGet, Path: "/error"},
+	}
+}
+
+// PipeListener is in-memory listener, connections are created by Dial. Benchmarks using it measure the framework
+// without TCP stack.
+type PipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewPipeListener creates in-memory listener
+func NewPipeListener() *PipeListener {
+	return &PipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+// Dial connects to listener
+func (l *PipeListener) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Accept implements net.Listener
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener
+func (l *PipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr implements net.Listener
+func (l *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// pipeAddr is address of in-memory listener
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe:80" }
@@ -0,0 +1,376 @@
+package webservice
+
+import (
+	"encoding"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamError is invalid request parameter
+type ParamError struct {
+	// Source of parameter (path, query, form)
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ParamErrors are all invalid parameters of request, they are description of 400 error returned by BindParams
+type ParamErrors []ParamError
+
+func (e ParamErrors) Error() string {
+	messages := make([]string, len(e))
+	for idx, pe := range e {
+		messages[idx] = fmt.Sprintf("%s parameter %s: %s", pe.Source, pe.Name, pe.Reason)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// paramSource returns values of parameter, ok is false if parameter is not present
+type paramSource func(name string) (values []string, ok bool)
+
+// taggedParamSource is parameter source of fields with given struct tag
+type taggedParamSource struct {
+	tag string
+	get paramSource
+}
+
+// BindParams fills struct fields tagged with path:"name" and query:"name" from path parameters and query of
+// request. Supported field types are strings, booleans, numbers, time.Duration, time.Time (RFC 3339),
+// encoding.TextUnmarshaler, pointers (nil if parameter is missing) and slices of them (repeated or comma separated
+// values). Tag default:"value" sets value of missing parameter and tag validate:"required,min=1,max=100,oneof=a|b"
+// validates it (min and max limit length of strings and slices). Invalid parameters are returned as 400 error
+// with INVALID_PARAMETERS code, all of them are listed in description.
+func BindParams(r *http.Request, dst interface{}) error {
+	return bind(dst, requestParamSources(r), nil)
+}
+
+// defaultMaxFormMemory is memory used for multipart form, larger files are stored in temporary files
+const defaultMaxFormMemory = 32 << 20
+
+// BindForm fills struct like BindParams and in addition fields tagged with form:"name" from
+// application/x-www-form-urlencoded or multipart/form-data body. Uploaded files are bound to fields of type
+// *multipart.FileHeader or []*multipart.FileHeader. Other content types are rejected with 415 error. Field with
+// several tags is bound from the first present parameter in order path, query, form.
+// Multipart form over 32 MB is stored in temporary files, returned cleanup removes them and it has to be called when
+// uploaded files are not needed anymore (defer cleanup()) - net/http removes them only for original request, but
+// handlers get its copy. Cleanup is never nil.
+func BindForm(r *http.Request, dst interface{}) (cleanup func(), err error) {
+	cleanup = func() {}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err = r.ParseForm(); err != nil {
+			return cleanup, ServerErrorWithoutStack(err, http.StatusBadRequest, "Malformed form")
+		}
+	case "multipart/form-data":
+		err = r.ParseMultipartForm(defaultMaxFormMemory)
+		if r.MultipartForm != nil {
+			form := r.MultipartForm
+			cleanup = func() { form.RemoveAll() }
+		}
+		if err != nil {
+			return cleanup, ServerErrorWithoutStack(err, http.StatusBadRequest, "Malformed form")
+		}
+	default:
+		return cleanup, ServerErrorWithoutStack(nil, http.StatusUnsupportedMediaType, "Form content type is expected").WithErrorCode("UNSUPPORTED_MEDIA_TYPE")
+	}
+
+	sources := append(requestParamSources(r), taggedParamSource{tag: "form", get: func(name string) ([]string, bool) {
+		values, ok := r.PostForm[name]
+		return values, ok
+	}})
+	files := func(name string) []*multipart.FileHeader {
+		if r.MultipartForm == nil {
+			return nil
+		}
+		return r.MultipartForm.File[name]
+	}
+	return cleanup, bind(dst, sources, files)
+}
+
+// requestParamSources returns sources of path and query parameters
+func requestParamSources(r *http.Request) []taggedParamSource {
+	query := r.URL.Query()
+	return []taggedParamSource{
+		{tag: "path", get: func(name string) ([]string, bool) {
+			value := PathParam(r, name)
+			return []string{value}, value != ""
+		}},
+		{tag: "query", get: func(name string) ([]string, bool) {
+			values, ok := query[name]
+			return values, ok
+		}},
+	}
+}
+
+// fileSource returns uploaded files of form field
+type fileSource func(name string) []*multipart.FileHeader
+
+// bind fills struct from parameter sources, files are bound to fields with form tag
+func bind(dst interface{}, sources []taggedParamSource, files fileSource) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return ServerError(nil, http.StatusInternalServerError, "Parameters can be bound only to pointer to struct")
+	}
+	var errs ParamErrors
+	bindStruct(v.Elem(), sources, files, &errs)
+	if len(errs) > 0 {
+		return ServerErrorWithoutStack(errs, http.StatusBadRequest, "Invalid request parameters").WithErrorCode("INVALID_PARAMETERS")
+	}
+	return nil
+}
+
+// bindStruct fills fields of struct value, embedded structs are filled recursively
+func bindStruct(v reflect.Value, sources []taggedParamSource, files fileSource, errs *ParamErrors) {
+	t := v.Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			bindStruct(v.Field(idx), sources, files, errs)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		bindField(field, v.Field(idx), sources, files, errs)
+	}
+}
+
+// bindField fills field from the first source in which its parameter is present, missing parameter is reported for
+// the first source with tag of the field
+func bindField(field reflect.StructField, value reflect.Value, sources []taggedParamSource, files fileSource, errs *ParamErrors) {
+	if field.Type == fileHeaderType || field.Type == fileHeadersType {
+		name, ok := field.Tag.Lookup("form")
+		if !ok || name == "-" || files == nil {
+			return
+		}
+		uploaded := files(name)
+		if len(uploaded) > 0 {
+			if field.Type == fileHeaderType {
+				value.Set(reflect.ValueOf(uploaded[0]))
+			} else {
+				value.Set(reflect.ValueOf(uploaded))
+			}
+		}
+		if reason := validateField(value, len(uploaded) > 0, field.Tag.Get("validate")); reason != "" {
+			*errs = append(*errs, ParamError{Source: "form", Name: name, Reason: reason})
+		}
+		return
+	}
+
+	var source, name string
+	var values []string
+	var present bool
+	for _, tagged := range sources {
+		tagName, ok := field.Tag.Lookup(tagged.tag)
+		if !ok || tagName == "-" {
+			continue
+		}
+		if source == "" {
+			source, name = tagged.tag, tagName
+		}
+		if values, present = tagged.get(tagName); present {
+			source, name = tagged.tag, tagName
+			break
+		}
+	}
+	if source == "" {
+		return
+	}
+	if !present {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			values, present = []string{def}, true
+		}
+	}
+	if present {
+		if err := setField(value, values); err != nil {
+			*errs = append(*errs, ParamError{Source: source, Name: name, Reason: err.Error()})
+			return
+		}
+	}
+	if reason := validateField(value, present, field.Tag.Get("validate")); reason != "" {
+		*errs = append(*errs, ParamError{Source: source, Name: name, Reason: reason})
+	}
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// setField converts values to field type
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !field.Type().Implements(textUnmarshalerType) &&
+		!reflect.PtrTo(field.Type()).Implements(textUnmarshalerType) {
+		// Comma separated values are split
+		var items []string
+		for _, value := range values {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for idx, item := range items {
+			if err := setValue(slice.Index(idx), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return setValue(field, values[len(values)-1])
+}
+
+// setValue converts single value to field type
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if field.CanAddr() {
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(value))
+		}
+	}
+	switch field.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid time %q, RFC 3339 is expected", value)
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// validateField checks rules of validate tag, reason of failure is returned
+func validateField(field reflect.Value, present bool, rules string) string {
+	if rules == "" {
+		return ""
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			if !present {
+				return "is required"
+			}
+			continue
+		}
+		if !present {
+			continue
+		}
+		value := field
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Sprintf("invalid rule %s", rule)
+			}
+			var actual float64
+			what := "value"
+			switch value.Kind() {
+			case reflect.String, reflect.Slice:
+				actual, what = float64(value.Len()), "length"
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				actual = float64(value.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				actual = float64(value.Uint())
+			case reflect.Float32, reflect.Float64:
+				actual = value.Float()
+			default:
+				continue
+			}
+			if name == "min" && actual < limit {
+				return fmt.Sprintf("%s must be at least %s", what, arg)
+			}
+			if name == "max" && actual > limit {
+				return fmt.Sprintf("%s must be at most %s", what, arg)
+			}
+		case "oneof":
+			allowed := strings.Split(arg, "|")
+			items := []reflect.Value{value}
+			if value.Kind() == reflect.Slice {
+				items = items[:0]
+				for idx := 0; idx < value.Len(); idx++ {
+					items = append(items, value.Index(idx))
+				}
+			}
+			for _, item := range items {
+				actual := fmt.Sprint(item.Interface())
+				found := false
+				for _, a := range allowed {
+					if a == actual {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package webservice
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBindFormSourceOrder(t *testing.T) {
+	type params struct {
+		ID string `path:"id" query:"id" form:"id"`
+	}
+	tests := []struct {
+		name  string
+		path  string
+		query string
+		form  string
+		want  string
+	}{
+		{"path first", "p", "id=q", "id=f", "p"},
+		{"query before form", "", "id=q", "id=f", "q"},
+		{"form last", "", "", "id=f", "f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Map iteration order is random, so binding is repeated
+			for i := 0; i < 20; i++ {
+				r := httptest.NewRequest(http.MethodPost, "/items?"+tt.query, strings.NewReader(tt.form))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				if tt.path != "" {
+					r = mux.SetURLVars(r, map[string]string{"id": tt.path})
+				}
+				var p params
+				cleanup, err := BindForm(r, &p)
+				cleanup()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.ID != tt.want {
+					t.Fatalf("got %q, want %q", p.ID, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBindFormCleanupRemovesTemporaryFiles(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("upload", "large.bin")
+	part.Write(bytes.Repeat([]byte{'x'}, defaultMaxFormMemory+1024))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	var p struct {
+		Upload *multipart.FileHeader `form:"upload"`
+	}
+	cleanup, err := BindForm(r, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := p.Upload.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	osFile, ok := file.(*os.File)
+	file.Close()
+	if !ok {
+		t.Fatal("expected upload stored in temporary file")
+	}
+	cleanup()
+	if _, err = os.Stat(osFile.Name()); !os.IsNotExist(err) {
+		t.Fatalf("temporary file was not removed: %v", err)
+	}
+}
+
+func TestBindFormUnsupportedMediaType(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(url.Values{"id": {"1"}}.Encode()))
+	r.Header.Set("Content-Type", "application/json")
+	var p struct {
+		ID string `form:"id"`
+	}
+	cleanup, err := BindForm(r, &p)
+	cleanup()
+	if !hasStatus(err, http.StatusUnsupportedMediaType) {
+		t.Fatalf("expected 415, got %v", err)
+	}
+}
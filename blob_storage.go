@@ -0,0 +1,346 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// BlobStorage is S3 compatible object storage client (AWS S3, MinIO, ...). It is a Component configured from
+// blob_storage.* keys (endpoint, region, bucket, path_style) and it is available to handlers with
+// BlobStorageFromContext(). Credentials are not part of configuration, they are resolved by AWS SDK default
+// credential chain (AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY, shared credentials file, web identity, instance role)
+// unless Credentials are set.
+type BlobStorage struct {
+	Endpoint    string
+	Region      string
+	Bucket      string
+	Credentials aws.CredentialsProvider
+	// Bucket in path (MinIO) instead of virtual host
+	PathStyle bool
+	Client    *http.Client
+	signer    *v4.Signer
+	logger    *logrus.Logger
+}
+
+// errBlobSizeUnknown is returned by Put when size of object is not known
+var errBlobSizeUnknown = errors.New("blob storage: size of object has to be known, use multipart upload for streams of unknown size")
+
+// CompletedPart is uploaded part of multipart upload
+type CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// NewBlobStorage creates object storage component
+func NewBlobStorage(logger *logrus.Logger) *BlobStorage {
+	return &BlobStorage{
+		Region: "us-east-1",
+		Client: &http.Client{Timeout: time.Minute * 5},
+		// object keys are escaped by objectURL, path must not be escaped again
+		signer: v4.NewSigner(func(options *v4.SignerOptions) { options.DisableURIPathEscaping = true }),
+		logger: logger,
+	}
+}
+
+// BlobStorageFromContext returns object storage registered in service (nil if not available)
+func BlobStorageFromContext(ctx context.Context) *BlobStorage {
+	storage, _ := ctx.Value(contextTypeBlobStorage).(*BlobStorage)
+	return storage
+}
+
+// Name implements Component
+func (b *BlobStorage) Name() string {
+	return "blob_storage"
+}
+
+// Configure implements Component
+func (b *BlobStorage) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("endpoint") {
+		b.Endpoint = config.GetString("endpoint")
+	}
+	if config.IsSet("region") {
+		b.Region = config.GetString("region")
+	}
+	if config.IsSet("bucket") {
+		b.Bucket = config.GetString("bucket")
+	}
+	if config.IsSet("path_style") {
+		b.PathStyle = config.GetBool("path_style")
+	}
+	if b.Endpoint == "" {
+		b.Endpoint = "https://s3." + b.Region + ".amazonaws.com"
+	}
+	if b.Bucket == "" {
+		return fmt.Errorf("blob storage bucket is not configured")
+	}
+	if b.Credentials == nil {
+		b.Credentials, err = defaultAWSCredentials(b.Region)
+	}
+	return
+}
+
+// defaultAWSCredentials returns credentials of AWS SDK default credential chain
+func defaultAWSCredentials(region string) (credentials aws.CredentialsProvider, err error) {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load blob storage credentials: %w", err)
+	}
+	return cfg.Credentials, nil
+}
+
+// Routes implements Component - storage is added to request context
+func (b *BlobStorage) Routes(router *mux.Router) (err error) {
+	router.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextTypeBlobStorage, b)))
+		})
+	})
+	return
+}
+
+// Start implements Component - bucket availability is checked
+func (b *BlobStorage) Start(ctx context.Context) (err error) {
+	if err := b.HealthCheck(ctx); err != nil && b.logger != nil {
+		b.logger.WithError(err).WithField("bucket", b.Bucket).Warn("blob storage is not available")
+	}
+	return
+}
+
+// Stop implements Component
+func (b *BlobStorage) Stop(ctx context.Context) (err error) {
+	return
+}
+
+// HealthCheck checks that bucket is accessible
+func (b *BlobStorage) HealthCheck(ctx context.Context) (err error) {
+	resp, err := b.do(ctx, http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+// Put uploads object of given size, size has to be known (streams of unknown size are uploaded with
+// CreateMultipartUpload() and UploadPart())
+func (b *BlobStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (err error) {
+	if size < 0 {
+		return errBlobSizeUnknown
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	resp, err := b.do(ctx, http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+// Get downloads object, caller has to close returned body
+func (b *BlobStorage) Get(ctx context.Context, key string) (body io.ReadCloser, err error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return
+	}
+	return resp.Body, nil
+}
+
+// Delete deletes object
+func (b *BlobStorage) Delete(ctx context.Context, key string) (err error) {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+// PresignGet returns URL for downloading object without credentials, valid for expires
+func (b *BlobStorage) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return b.presign(ctx, http.MethodGet, key, expires)
+}
+
+// PresignPut returns URL for uploading object without credentials, valid for expires
+func (b *BlobStorage) PresignPut(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return b.presign(ctx, http.MethodPut, key, expires)
+}
+
+// CreateMultipartUpload starts multipart upload of large object and returns upload ID
+func (b *BlobStorage) CreateMultipartUpload(ctx context.Context, key string, contentType string) (uploadID string, err error) {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	return result.UploadID, err
+}
+
+// UploadPart uploads part (1-10000, at least 5 MiB except the last one) of multipart upload
+func (b *BlobStorage) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, data []byte) (part CompletedPart, err error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	header := http.Header{"Content-Length": {strconv.Itoa(len(data))}}
+	resp, err := b.do(ctx, http.MethodPut, key, query, header, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return CompletedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")}, nil
+}
+
+// CompleteMultipartUpload assembles uploaded parts into object
+func (b *BlobStorage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []CompletedPart) (err error) {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return
+	}
+	header := http.Header{"Content-Length": {strconv.Itoa(len(body))}}
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, header, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+// AbortMultipartUpload aborts multipart upload and deletes uploaded parts
+func (b *BlobStorage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) (err error) {
+	resp, err := b.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+// objectURL returns URL of object in bucket
+func (b *BlobStorage) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(b.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if b.PathStyle {
+		u.Path = "/" + b.Bucket + "/" + key
+	} else {
+		u.Host = b.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = awsURIEncode(u.Path, false)
+	return u, nil
+}
+
+// do sends signed request, non 2xx responses are returned as error
+func (b *BlobStorage) do(ctx context.Context, method string, key string, query url.Values, header http.Header, body io.Reader) (resp *http.Response, err error) {
+	u, err := b.objectURL(key)
+	if err != nil {
+		return
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if length := req.Header.Get("Content-Length"); length != "" {
+		req.ContentLength, _ = strconv.ParseInt(length, 10, 64)
+		req.Header.Del("Content-Length")
+	}
+	credentials, err := b.credentials(ctx)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Amz-Content-Sha256", blobUnsignedPayload)
+	if err = b.signer.SignHTTP(ctx, credentials, req, blobUnsignedPayload, "s3", b.Region, time.Now()); err != nil {
+		return
+	}
+
+	resp, err = b.Client.Do(req)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("blob storage %s %s: status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return
+}
+
+// blobUnsignedPayload is payload hash of requests - body is not part of signature, so it can be streamed
+const blobUnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// credentials returns current credentials (refreshed by provider when they expire)
+func (b *BlobStorage) credentials(ctx context.Context) (credentials aws.Credentials, err error) {
+	if b.Credentials == nil {
+		return credentials, fmt.Errorf("blob storage credentials are not configured")
+	}
+	credentials, err = b.Credentials.Retrieve(ctx)
+	if err != nil {
+		err = fmt.Errorf("unable to retrieve blob storage credentials: %w", err)
+	}
+	return
+}
+
+// presign returns presigned URL (query string authentication)
+func (b *BlobStorage) presign(ctx context.Context, method string, key string, expires time.Duration) (signed string, err error) {
+	u, err := b.objectURL(key)
+	if err != nil {
+		return
+	}
+	u.RawQuery = url.Values{"X-Amz-Expires": {strconv.Itoa(int(expires.Seconds()))}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return
+	}
+	credentials, err := b.credentials(ctx)
+	if err != nil {
+		return
+	}
+	signed, _, err = b.signer.PresignHTTP(ctx, credentials, req, blobUnsignedPayload, "s3", b.Region, time.Now())
+	return
+}
+
+// awsURIEncode encodes string as required by Signature Version 4 (RFC 3986 unreserved characters are kept)
+func awsURIEncode(s string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,87 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestBlobStoragePut(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer server.Close()
+	storage := NewBlobStorage(nil)
+	storage.Endpoint = server.URL
+	storage.Bucket = "bucket"
+	storage.PathStyle = true
+	storage.Credentials = credentials.NewStaticCredentialsProvider("AKID", "SECRET", "TOKEN")
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		size       int64
+		wantErr    error
+		wantLength int64
+	}{
+		{"known size", "data/file.txt", "content", 7, nil, 7},
+		{"empty object", "empty", "", 0, nil, 0},
+		{"escaped key", "dir/file name+1.txt", "x", 1, nil, 1},
+		{"unknown size", "stream", "content", -1, errBlobSizeUnknown, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			err := storage.Put(context.Background(), tt.key, strings.NewReader(tt.body), tt.size, "text/plain")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if received != nil {
+					t.Fatal("request was sent")
+				}
+				return
+			}
+			if received.ContentLength != tt.wantLength {
+				t.Fatalf("got content length %d, want %d", received.ContentLength, tt.wantLength)
+			}
+			if received.URL.EscapedPath() != "/bucket/"+awsURIEncode(tt.key, false) {
+				t.Fatalf("unexpected path %s", received.URL.EscapedPath())
+			}
+			auth := received.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "x-amz-security-token") {
+				t.Fatalf("unexpected authorization %s", auth)
+			}
+			if received.Header.Get("X-Amz-Content-Sha256") != blobUnsignedPayload {
+				t.Fatal("payload is not marked as unsigned")
+			}
+		})
+	}
+}
+
+func TestBlobStoragePresign(t *testing.T) {
+	storage := NewBlobStorage(nil)
+	storage.Endpoint = "https://s3.example.com"
+	storage.Bucket = "bucket"
+	storage.Credentials = credentials.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	signed, err := storage.PresignGet(context.Background(), "file.txt", time.Minute*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "bucket.s3.example.com" || u.Query().Get("X-Amz-Signature") == "" || u.Query().Get("X-Amz-Expires") == "" {
+		t.Fatalf("unexpected presigned URL %s", signed)
+	}
+}
@@ -0,0 +1,137 @@
+package webservice
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Actions applied to detected bot/scanner requests
+const (
+	BotActionLog      = "log"
+	BotActionNotFound = "404"
+	BotActionTooMany  = "429"
+)
+
+// DefaultBotUserAgents contains user-agent fragments of common vulnerability scanners
+var DefaultBotUserAgents = []string{
+	"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei", "dirbuster", "gobuster", "wpscan", "acunetix",
+	"nessus", "openvas", "w3af", "netsparker", "censysinspect",
+}
+
+// DefaultBotPaths contains path fragments probed by scanners
+var DefaultBotPaths = []string{
+	"/wp-login.php", "/wp-admin", "/xmlrpc.php", "/phpmyadmin", "/.env", "/.git/", "/cgi-bin/", "/vendor/phpunit",
+	"/boaform", "/actuator/", "/.aws/", "/server-status",
+}
+
+// BotOptions configures bot and scanner detection
+type BotOptions struct {
+	// User-agent fragments (case insensitive). Empty means DefaultBotUserAgents.
+	UserAgents []string
+	// Path fragments (case insensitive). Empty means DefaultBotPaths.
+	Paths []string
+	// Action applied to detected requests - log (default), 404 or 429
+	Action string
+	// Requests without User-Agent are detected too. It is off by default, health checkers and probes often don't
+	// send User-Agent.
+	BlockEmptyUserAgent bool
+}
+
+// BotOptionsFromViper reads bot detection options (user_agents, paths, action, block_empty_user_agent), nil is
+// returned if detection is not enabled
+func BotOptionsFromViper(prefix string) *BotOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &BotOptions{
+		UserAgents: viper.GetStringSlice(prefix + "user_agents"),
+		Paths:      viper.GetStringSlice(prefix + "paths"),
+		Action:     viper.GetString(prefix + "action"),
+
+		BlockEmptyUserAgent: viper.GetBool(prefix + "block_empty_user_agent"),
+	}
+}
+
+// bot object
+type bot struct {
+	options  BotOptions
+	logger   *logrus.Logger
+	detected *prometheus.CounterVec
+}
+
+// newBotMiddleware creates bot detection middleware
+func newBotMiddleware(options *BotOptions, logger *logrus.Logger) *bot {
+	b := &bot{
+		options: *options,
+		logger:  logger,
+	}
+	if len(b.options.UserAgents) == 0 {
+		b.options.UserAgents = DefaultBotUserAgents
+	}
+	if len(b.options.Paths) == 0 {
+		b.options.Paths = DefaultBotPaths
+	}
+	if b.options.Action == "" {
+		b.options.Action = BotActionLog
+	}
+	b.detected = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_bot_requests_total",
+		Help: "Number of requests detected as bot/scanner traffic.",
+	}, []string{"reason", "action"})).(*prometheus.CounterVec)
+	return b
+}
+
+// detect returns reason of detection or empty string for regular traffic
+func (b *bot) detect(r *http.Request) string {
+	userAgent := strings.ToLower(r.UserAgent())
+	if userAgent == "" && b.options.BlockEmptyUserAgent {
+		return "empty_user_agent"
+	}
+	for _, fragment := range b.options.UserAgents {
+		if strings.Contains(userAgent, strings.ToLower(fragment)) {
+			return "user_agent"
+		}
+	}
+	path := strings.ToLower(r.URL.Path)
+	for _, fragment := range b.options.Paths {
+		if strings.Contains(path, strings.ToLower(fragment)) {
+			return "path"
+		}
+	}
+	return ""
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (b *bot) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason := b.detect(r)
+		if reason == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		b.detected.WithLabelValues(reason, b.options.Action).Inc()
+		if b.logger != nil {
+			b.logger.WithFields(logrus.Fields{
+				"reason":     reason,
+				"action":     b.options.Action,
+				"path":       r.RequestURI,
+				"user_agent": r.UserAgent(),
+				"remote":     r.RemoteAddr,
+			}).Infof("bot request detected")
+		}
+
+		switch b.options.Action {
+		case BotActionNotFound:
+			processHTTPError(ServerErrorWithoutStack(nil, http.StatusNotFound, "Not Found"), w, r, nil, nil)
+		case BotActionTooMany:
+			processHTTPError(ServerErrorWithoutStack(nil, http.StatusTooManyRequests, "Too Many Requests").WithErrorCode("TOO_MANY_REQUESTS"), w, r, nil, nil)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
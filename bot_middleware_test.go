@@ -0,0 +1,41 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBotMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    BotOptions
+		userAgent  string
+		path       string
+		wantStatus int
+	}{
+		{"regular request", BotOptions{Action: BotActionNotFound}, "Mozilla/5.0", "/items", http.StatusOK},
+		{"empty user agent allowed by default", BotOptions{Action: BotActionNotFound}, "", "/healthz", http.StatusOK},
+		{"empty user agent blocked", BotOptions{Action: BotActionNotFound, BlockEmptyUserAgent: true}, "", "/items", http.StatusNotFound},
+		{"scanner user agent", BotOptions{Action: BotActionTooMany}, "sqlmap/1.7", "/items", http.StatusTooManyRequests},
+		{"scanner path", BotOptions{Action: BotActionNotFound}, "curl/8.0", "/wp-login.php", http.StatusNotFound},
+		{"log action", BotOptions{}, "nikto", "/items", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			handler := newBotMiddleware(&options, nil).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK && !strings.HasPrefix(w.Body.String(), `{"code":`) {
+				t.Fatalf("error response is not JSON: %s", w.Body.String())
+			}
+		})
+	}
+}
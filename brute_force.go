@@ -0,0 +1,304 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// AuthFailureStore is storage of authentication failures and blocked clients (e.g. in memory, Redis)
+type AuthFailureStore interface {
+	// Fail records failure of key and returns number of failures within window
+	Fail(ctx context.Context, key string, window time.Duration) (failures int64, err error)
+	// Block blocks key for given duration
+	Block(ctx context.Context, key string, duration time.Duration) (err error)
+	// Blocked returns remaining block time of key, zero if key is not blocked
+	Blocked(ctx context.Context, key string) (remaining time.Duration, err error)
+}
+
+// Brute-force protection actions
+const (
+	BruteForceBlock  = "block"
+	BruteForceTarpit = "tarpit"
+)
+
+// BruteForceOptions is a configuration container for protection against repeated authentication failures
+// (401 responses) of single client IP address (see ClientIP()) or user. Forbidden responses (403) are not counted,
+// authenticated users would be blocked for visiting routes they have no access to.
+type BruteForceOptions struct {
+	// Number of failures within window which blocks the client, default is 10
+	Threshold int64
+	// Window of counted failures, default is 1 minute
+	Window time.Duration
+	// How long client stays blocked, default is 5 minutes
+	BlockDuration time.Duration
+	// Action on blocked client: block (429, default) or tarpit (delay responses)
+	Action string
+	// Delay of requests of blocked client with tarpit action, default is 5 seconds
+	TarpitDelay time.Duration
+	// Storage of failures, default is in-memory store (not shared between replicas)
+	Store AuthFailureStore
+}
+
+// BruteForceOptionsFromViper reads brute-force protection options, nil is returned if it is not enabled
+func BruteForceOptionsFromViper(prefix string) *BruteForceOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &BruteForceOptions{
+		Threshold:     viper.GetInt64(prefix + "threshold"),
+		Window:        viper.GetDuration(prefix + "window"),
+		BlockDuration: viper.GetDuration(prefix + "block_duration"),
+		Action:        viper.GetString(prefix + "action"),
+		TarpitDelay:   viper.GetDuration(prefix + "tarpit_delay"),
+	}
+}
+
+// bruteForceProtection object
+type bruteForceProtection struct {
+	options  BruteForceOptions
+	logger   *logrus.Logger
+	failures *prometheus.CounterVec
+	blocked  *prometheus.CounterVec
+}
+
+// newBruteForceProtection creates brute-force protection middleware
+func newBruteForceProtection(options *BruteForceOptions, logger *logrus.Logger) *bruteForceProtection {
+	bf := &bruteForceProtection{
+		options: *options,
+		logger:  logger,
+	}
+	if bf.options.Threshold <= 0 {
+		bf.options.Threshold = 10
+	}
+	if bf.options.Window <= 0 {
+		bf.options.Window = time.Minute
+	}
+	if bf.options.BlockDuration <= 0 {
+		bf.options.BlockDuration = time.Minute * 5
+	}
+	if bf.options.Action == "" {
+		bf.options.Action = BruteForceBlock
+	}
+	if bf.options.TarpitDelay <= 0 {
+		bf.options.TarpitDelay = time.Second * 5
+	}
+	if bf.options.Store == nil {
+		bf.options.Store = NewMemoryAuthFailureStore()
+	}
+	bf.failures = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_auth_failures_total",
+		Help: "Number of 401 responses by key type (ip, user).",
+	}, []string{"key_type"})).(*prometheus.CounterVec)
+	bf.blocked = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_auth_blocked_requests_total",
+		Help: "Number of requests of clients blocked after repeated authentication failures.",
+	}, []string{"key_type", "action"})).(*prometheus.CounterVec)
+	return bf
+}
+
+// keys returns keys of request client - IP address and ID of authenticated user
+func (bf *bruteForceProtection) keys(r *http.Request) map[string]string {
+	keys := map[string]string{"ip": "ip:" + ClientIP(r)}
+	if userInfo, ok := r.Context().Value(contextTypeUserInfo).(*UserInfo); ok && userInfo != nil &&
+		userInfo != unauthenticatedUser && userInfo != userWithInvalidToken {
+		keys["user"] = "user:" + userInfo.UserID
+	}
+	return keys
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (bf *bruteForceProtection) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := bf.keys(r)
+
+		var blockedFor time.Duration
+		blockedType := ""
+		for keyType, key := range keys {
+			remaining, err := bf.options.Store.Blocked(r.Context(), key)
+			if err != nil {
+				if bf.logger != nil {
+					bf.logger.WithError(err).Error("brute-force protection: unable to check blocked client")
+				}
+				continue
+			}
+			if remaining > blockedFor {
+				blockedFor, blockedType = remaining, keyType
+			}
+		}
+
+		if blockedFor > 0 {
+			bf.blocked.WithLabelValues(blockedType, bf.options.Action).Inc()
+			if bf.options.Action == BruteForceTarpit {
+				select {
+				case <-time.After(bf.options.TarpitDelay):
+				case <-r.Context().Done():
+					return
+				}
+			} else {
+				logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+				err := ServerErrorWithoutStack(nil, http.StatusTooManyRequests, "Too many failed attempts").
+					WithErrorCode("TOO_MANY_FAILED_ATTEMPTS").
+					WithRetryAfter(blockedFor)
+				processHTTPError(err, w, r, logger, nil)
+				return
+			}
+		}
+
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+		if rec.Status() != http.StatusUnauthorized {
+			return
+		}
+
+		// Request context may be cancelled already
+		ctx := context.Background()
+		for keyType, key := range keys {
+			bf.failures.WithLabelValues(keyType).Inc()
+			failures, err := bf.options.Store.Fail(ctx, key, bf.options.Window)
+			if err != nil {
+				if bf.logger != nil {
+					bf.logger.WithError(err).Error("brute-force protection: unable to record failure")
+				}
+				continue
+			}
+			if failures == bf.options.Threshold {
+				if err = bf.options.Store.Block(ctx, key, bf.options.BlockDuration); err != nil {
+					if bf.logger != nil {
+						bf.logger.WithError(err).Error("brute-force protection: unable to block client")
+					}
+				} else if bf.logger != nil {
+					bf.logger.WithFields(logrus.Fields{"key": key, "failures": failures, "duration": bf.options.BlockDuration.String()}).Warn("client blocked after repeated authentication failures")
+				}
+			}
+		}
+	})
+}
+
+// memoryAuthFailureStore is in-memory AuthFailureStore
+type memoryAuthFailureStore struct {
+	mutex    sync.Mutex
+	failures map[string]*memoryQuotaEntry
+	blocked  map[string]time.Time
+	cleanup  time.Time
+}
+
+// NewMemoryAuthFailureStore creates in-memory store of authentication failures. Failures are not shared between
+// replicas and they are lost on restart.
+func NewMemoryAuthFailureStore() AuthFailureStore {
+	return &memoryAuthFailureStore{
+		failures: make(map[string]*memoryQuotaEntry),
+		blocked:  make(map[string]time.Time),
+	}
+}
+
+// Fail implements AuthFailureStore
+func (m *memoryAuthFailureStore) Fail(_ context.Context, key string, window time.Duration) (failures int64, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(m.cleanup) {
+		for k, entry := range m.failures {
+			if now.After(entry.expires) {
+				delete(m.failures, k)
+			}
+		}
+		for k, until := range m.blocked {
+			if now.After(until) {
+				delete(m.blocked, k)
+			}
+		}
+		m.cleanup = now.Add(time.Minute)
+	}
+
+	entry, ok := m.failures[key]
+	if !ok || now.After(entry.expires) {
+		entry = &memoryQuotaEntry{windowStart: now, expires: now.Add(window)}
+		m.failures[key] = entry
+	}
+	entry.usage++
+	return entry.usage, nil
+}
+
+// Block implements AuthFailureStore
+func (m *memoryAuthFailureStore) Block(_ context.Context, key string, duration time.Duration) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.blocked[key] = time.Now().Add(duration)
+	delete(m.failures, key)
+	return
+}
+
+// Blocked implements AuthFailureStore
+func (m *memoryAuthFailureStore) Blocked(_ context.Context, key string) (remaining time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if until, ok := m.blocked[key]; ok {
+		if remaining = time.Until(until); remaining < 0 {
+			remaining = 0
+		}
+	}
+	return
+}
+
+// redisAuthFailureStore is AuthFailureStore shared by all instances in Redis
+type redisAuthFailureStore struct {
+	redis  RedisEvaler
+	prefix string
+}
+
+// NewRedisAuthFailureStore creates Redis based store of authentication failures, keys are prefixed with prefix
+func NewRedisAuthFailureStore(redis RedisEvaler, prefix string) AuthFailureStore {
+	return &redisAuthFailureStore{redis: redis, prefix: prefix}
+}
+
+const redisFailScript = `
+local failures = redis.call("INCR", KEYS[1])
+if failures == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return failures`
+
+const redisBlockScript = `
+redis.call("SET", KEYS[1], "1", "PX", ARGV[1])
+redis.call("DEL", KEYS[2])
+return 1`
+
+const redisBlockedScript = `
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	return 0
+end
+return ttl`
+
+// Fail implements AuthFailureStore
+func (s *redisAuthFailureStore) Fail(ctx context.Context, key string, window time.Duration) (failures int64, err error) {
+	result, err := s.redis.Eval(ctx, redisFailScript, []string{s.prefix + "failures:" + key}, window.Milliseconds())
+	if err != nil {
+		return
+	}
+	failures, _ = result.(int64)
+	return
+}
+
+// Block implements AuthFailureStore
+func (s *redisAuthFailureStore) Block(ctx context.Context, key string, duration time.Duration) (err error) {
+	_, err = s.redis.Eval(ctx, redisBlockScript, []string{s.prefix + "blocked:" + key, s.prefix + "failures:" + key}, duration.Milliseconds())
+	return
+}
+
+// Blocked implements AuthFailureStore
+func (s *redisAuthFailureStore) Blocked(ctx context.Context, key string) (remaining time.Duration, err error) {
+	result, err := s.redis.Eval(ctx, redisBlockedScript, []string{s.prefix + "blocked:" + key})
+	if err != nil {
+		return
+	}
+	ms, _ := result.(int64)
+	return time.Duration(ms) * time.Millisecond, nil
+}
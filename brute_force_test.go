@@ -0,0 +1,42 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBruteForceBlocksClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		forwarded func(i int) string
+		blocked   bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, nil, true},
+		{"forbidden is not counted", http.StatusForbidden, nil, false},
+		{"spoofed X-Forwarded-For", http.StatusUnauthorized, func(i int) string { return fmt.Sprintf("198.51.100.%d", i) }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bf := newBruteForceProtection(&BruteForceOptions{Threshold: 3}, nil)
+			handler := clientAddressMiddleware(nil)(bf.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			})))
+			status := 0
+			for i := 0; i < 5; i++ {
+				req := httptest.NewRequest("GET", "/", nil)
+				if test.forwarded != nil {
+					req.Header.Set("X-Forwarded-For", test.forwarded(i))
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				status = w.Code
+			}
+			if blocked := status == http.StatusTooManyRequests; blocked != test.blocked {
+				t.Fatalf("expected blocked %v, last status %d", test.blocked, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package webservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Cache is local cache that can be invalidated with InvalidateCache()
+type Cache interface {
+	Get(key string) (value interface{}, ok bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+}
+
+// memoryCache is in-memory Cache with TTL
+type memoryCache struct {
+	mutex   sync.RWMutex
+	entries map[string]memoryCacheEntry
+	cleanup time.Time
+}
+
+type memoryCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewMemoryCache creates in-memory cache
+func NewMemoryCache() Cache {
+	return &memoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+// Get implements Cache
+func (c *memoryCache) Get(key string) (value interface{}, ok bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set implements Cache, zero ttl means no expiration
+func (c *memoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if now.After(c.cleanup) {
+		for k, entry := range c.entries {
+			if !entry.expires.IsZero() && now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.cleanup = now.Add(time.Minute)
+	}
+	entry := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	c.entries[key] = entry
+}
+
+// Delete implements Cache
+func (c *memoryCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, key)
+}
+
+// cacheRegistry holds caches purged by InvalidateCache()
+var cacheRegistry = struct {
+	sync.RWMutex
+	caches      map[string]Cache
+	invalidator *CacheInvalidator
+}{
+	caches: make(map[string]Cache),
+}
+
+// RegisterCache registers cache, so its entries are purged by InvalidateCache()
+func RegisterCache(name string, cache Cache) {
+	cacheRegistry.Lock()
+	defer cacheRegistry.Unlock()
+	cacheRegistry.caches[name] = cache
+}
+
+// invalidateLocal removes key from all registered caches of this process
+func invalidateLocal(key string) {
+	cacheRegistry.RLock()
+	defer cacheRegistry.RUnlock()
+	for _, cache := range cacheRegistry.caches {
+		cache.Delete(key)
+	}
+}
+
+// InvalidateCache removes key from all registered caches. If CacheInvalidator is registered,
+// invalidation is broadcast to other replicas.
+func InvalidateCache(key string) (err error) {
+	invalidateLocal(key)
+
+	cacheRegistry.RLock()
+	invalidator := cacheRegistry.invalidator
+	cacheRegistry.RUnlock()
+	if invalidator != nil {
+		err = invalidator.broadcast(key)
+	}
+	return
+}
+
+// InvalidationTransport is pub/sub channel between replicas (e.g. NewRedisInvalidationTransport())
+type InvalidationTransport interface {
+	Publish(ctx context.Context, channel string, message string) (err error)
+	// Subscribe blocks and calls handler for every message until ctx is done
+	Subscribe(ctx context.Context, channel string, handler func(message string)) (err error)
+}
+
+// invalidationMessage is message sent over transport
+type invalidationMessage struct {
+	Origin string `json:"origin"`
+	Key    string `json:"key"`
+}
+
+// CacheInvalidator broadcasts cache invalidations to other replicas. It is a Component, register it with svc.Register().
+type CacheInvalidator struct {
+	transport InvalidationTransport
+	channel   string
+	origin    string
+	logger    *logrus.Logger
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewCacheInvalidator creates distributed cache invalidator. Channel can be changed with configuration key "cache_invalidation.channel".
+func NewCacheInvalidator(transport InvalidationTransport, logger *logrus.Logger) *CacheInvalidator {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &CacheInvalidator{
+		transport: transport,
+		channel:   "webservice:cache_invalidation",
+		origin:    hex.EncodeToString(b),
+		logger:    logger,
+	}
+}
+
+// broadcast publishes invalidation of key
+func (ci *CacheInvalidator) broadcast(key string) (err error) {
+	msg, err := json.Marshal(&invalidationMessage{Origin: ci.origin, Key: key})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err = ci.transport.Publish(ctx, ci.channel, string(msg))
+	if err != nil {
+		err = fmt.Errorf("unable to broadcast cache invalidation: %w", err)
+	}
+	return
+}
+
+// Name implements Component
+func (ci *CacheInvalidator) Name() string {
+	return "cache_invalidation"
+}
+
+// Configure implements Component
+func (ci *CacheInvalidator) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("channel") {
+		ci.channel = config.GetString("channel")
+	}
+	return
+}
+
+// Routes implements Component
+func (ci *CacheInvalidator) Routes(router *mux.Router) (err error) {
+	return
+}
+
+// Start implements Component - subscribes to invalidations of other replicas
+func (ci *CacheInvalidator) Start(ctx context.Context) (err error) {
+	ctx, ci.cancel = context.WithCancel(ctx)
+	ci.done = make(chan struct{})
+
+	cacheRegistry.Lock()
+	cacheRegistry.invalidator = ci
+	cacheRegistry.Unlock()
+
+	go func() {
+		defer close(ci.done)
+		retry := time.NewTimer(0)
+		defer retry.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-retry.C:
+			}
+			err := ci.transport.Subscribe(ctx, ci.channel, ci.onMessage)
+			if ctx.Err() != nil {
+				return
+			}
+			// Subscription ended without ctx being done (with or without error), it is renewed after delay
+			if ci.logger != nil {
+				ci.logger.WithError(err).Error("cache invalidation: subscription ended, retrying")
+			}
+			retry.Reset(time.Second * 5)
+		}
+	}()
+	return
+}
+
+// onMessage purges key invalidated by other replica
+func (ci *CacheInvalidator) onMessage(message string) {
+	var msg invalidationMessage
+	if err := json.Unmarshal([]byte(message), &msg); err != nil {
+		if ci.logger != nil {
+			ci.logger.WithError(err).Warn("cache invalidation: invalid message")
+		}
+		return
+	}
+	if msg.Origin != ci.origin {
+		invalidateLocal(msg.Key)
+	}
+}
+
+// Stop implements Component
+func (ci *CacheInvalidator) Stop(ctx context.Context) (err error) {
+	cacheRegistry.Lock()
+	if cacheRegistry.invalidator == ci {
+		cacheRegistry.invalidator = nil
+	}
+	cacheRegistry.Unlock()
+
+	if ci.cancel != nil {
+		ci.cancel()
+		select {
+		case <-ci.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisInvalidationTransport is InvalidationTransport based on Redis pub/sub
+type redisInvalidationTransport struct {
+	client redis.UniversalClient
+}
+
+// NewRedisInvalidationTransport creates InvalidationTransport based on Redis pub/sub
+func NewRedisInvalidationTransport(client redis.UniversalClient) InvalidationTransport {
+	return &redisInvalidationTransport{client: client}
+}
+
+// Publish implements InvalidationTransport
+func (t *redisInvalidationTransport) Publish(ctx context.Context, channel string, message string) (err error) {
+	return t.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe implements InvalidationTransport
+func (t *redisInvalidationTransport) Subscribe(ctx context.Context, channel string, handler func(message string)) (err error) {
+	pubsub := t.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	// wait for confirmation, so subscription errors are returned
+	if _, err = pubsub.Receive(ctx); err != nil {
+		return
+	}
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("redis subscription closed")
+			}
+			handler(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testInvalidationTransport delivers published messages to subscribers of the same transport
+type testInvalidationTransport struct {
+	mutex       sync.Mutex
+	handlers    []func(message string)
+	subscribe   func(ctx context.Context) error
+	subscribers int32
+}
+
+// Publish implements InvalidationTransport
+func (t *testInvalidationTransport) Publish(ctx context.Context, channel string, message string) (err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, handler := range t.handlers {
+		handler(message)
+	}
+	return
+}
+
+// Subscribe implements InvalidationTransport
+func (t *testInvalidationTransport) Subscribe(ctx context.Context, channel string, handler func(message string)) (err error) {
+	atomic.AddInt32(&t.subscribers, 1)
+	if t.subscribe != nil {
+		return t.subscribe(ctx)
+	}
+	t.mutex.Lock()
+	t.handlers = append(t.handlers, handler)
+	t.mutex.Unlock()
+	<-ctx.Done()
+	return
+}
+
+func TestCacheInvalidatorResubscribes(t *testing.T) {
+	tests := []struct {
+		name      string
+		subscribe func(ctx context.Context) error
+	}{
+		{"subscription ends without error", func(ctx context.Context) error { return nil }},
+		{"subscription fails", func(ctx context.Context) error { return errors.New("connection refused") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &testInvalidationTransport{subscribe: tt.subscribe}
+			invalidator := NewCacheInvalidator(transport, nil)
+			if err := invalidator.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond * 200)
+			if err := invalidator.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := atomic.LoadInt32(&transport.subscribers); n != 1 {
+				t.Fatalf("subscribed %d times, want 1 (retry without delay)", n)
+			}
+		})
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	cache := NewMemoryCache()
+	RegisterCache("test", cache)
+	transport := &testInvalidationTransport{}
+	local := NewCacheInvalidator(transport, nil)
+	remote := NewCacheInvalidator(transport, nil)
+	for _, ci := range []*CacheInvalidator{remote, local} {
+		if err := ci.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer ci.Stop(context.Background())
+	}
+	for atomic.LoadInt32(&transport.subscribers) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cache.Set("key", 1, 0)
+	if err := InvalidateCache("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Fatal("key was not invalidated locally")
+	}
+
+	cache.Set("key", 1, 0)
+	local.onMessage(`{"origin":"` + local.origin + `","key":"key"}`)
+	if _, ok := cache.Get("key"); !ok {
+		t.Fatal("own invalidation was applied again")
+	}
+	local.onMessage(`{"origin":"` + remote.origin + `","key":"key"}`)
+	if _, ok := cache.Get("key"); ok {
+		t.Fatal("invalidation of other replica was not applied")
+	}
+}
@@ -0,0 +1,101 @@
+package webservice
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ChaosOptions is a configuration container for fault injection. It is applied only in dev mode.
+type ChaosOptions struct {
+	// Artificial latency added to requests
+	Latency time.Duration
+	// Random part of latency added to Latency (0 - LatencyJitter)
+	LatencyJitter time.Duration
+	// Rate of requests (0-1) failing with ErrorCode
+	ErrorRate float64
+	// HTTP status code of injected errors. Default is 503.
+	ErrorCode int
+	// Route templates or path prefixes affected by fault injection. Empty means all routes.
+	Routes []string
+}
+
+// ChaosOptionsFromViper reads fault injection options, nil is returned if chaos is not enabled
+func ChaosOptionsFromViper(prefix string) (options *ChaosOptions) {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &ChaosOptions{
+		Latency:       time.Duration(viper.GetInt64(prefix+"latency_ms")) * time.Millisecond,
+		LatencyJitter: time.Duration(viper.GetInt64(prefix+"latency_jitter_ms")) * time.Millisecond,
+		ErrorRate:     viper.GetFloat64(prefix + "error_rate"),
+		ErrorCode:     viper.GetInt(prefix + "error_code"),
+		Routes:        viper.GetStringSlice(prefix + "routes"),
+	}
+}
+
+// chaos object
+type chaos struct {
+	options ChaosOptions
+	logger  *logrus.Logger
+}
+
+// newChaosMiddleware creates fault injection middleware
+func newChaosMiddleware(options *ChaosOptions, logger *logrus.Logger) *chaos {
+	c := &chaos{
+		options: *options,
+		logger:  logger,
+	}
+	if c.options.ErrorCode == 0 {
+		c.options.ErrorCode = http.StatusServiceUnavailable
+	}
+	return c
+}
+
+// affects returns if request is affected by fault injection
+func (c *chaos) affects(r *http.Request) bool {
+	if len(c.options.Routes) == 0 {
+		return true
+	}
+	route := RouteTemplate(r)
+	for _, affected := range c.options.Routes {
+		if affected == route || strings.HasPrefix(r.URL.Path, affected) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (c *chaos) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.affects(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		latency := c.options.Latency
+		if c.options.LatencyJitter > 0 {
+			latency += time.Duration(rand.Int63n(int64(c.options.LatencyJitter)))
+		}
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if c.options.ErrorRate > 0 && rand.Float64() < c.options.ErrorRate {
+			err := ServerErrorWithoutStack(nil, c.options.ErrorCode, "Injected failure")
+			processHTTPError(err, w, r, c.logger, nil)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,202 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// CircuitBreakerOptions is a configuration container for per-route circuit breaker
+type CircuitBreakerOptions struct {
+	// Number of consecutive 5xx responses which opens the breaker, default is 5
+	Threshold int
+	// How long breaker stays open before route is probed, default is 30 seconds
+	OpenDuration time.Duration
+	// Route templates or path prefixes protected by breaker. Empty means all routes.
+	Routes []string
+	// Probe checks in background if route recovered, breaker is closed when it returns nil. Requests are
+	// rejected until probe succeeds. Without probe the first request after OpenDuration is let through as probe
+	// (it may fail) and other requests fail fast until its response is recorded.
+	Probe func(ctx context.Context, route string) error
+}
+
+// CircuitBreakerOptionsFromViper reads circuit breaker options, nil is returned if breaker is not enabled
+func CircuitBreakerOptionsFromViper(prefix string) *CircuitBreakerOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &CircuitBreakerOptions{
+		Threshold:    viper.GetInt(prefix + "threshold"),
+		OpenDuration: viper.GetDuration(prefix + "open_duration"),
+		Routes:       viper.GetStringSlice(prefix + "routes"),
+	}
+}
+
+// Circuit breaker states (value of circuit_breaker_state metric)
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// routeBreaker is state of breaker of single route
+type routeBreaker struct {
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// circuitBreaker object
+type circuitBreaker struct {
+	options  CircuitBreakerOptions
+	logger   *logrus.Logger
+	mutex    sync.Mutex
+	breakers map[string]*routeBreaker
+	state    *prometheus.GaugeVec
+}
+
+// newCircuitBreaker creates circuit breaker middleware
+func newCircuitBreaker(options *CircuitBreakerOptions, logger *logrus.Logger) *circuitBreaker {
+	cb := &circuitBreaker{
+		options:  *options,
+		logger:   logger,
+		breakers: map[string]*routeBreaker{},
+	}
+	if cb.options.Threshold <= 0 {
+		cb.options.Threshold = 5
+	}
+	if cb.options.OpenDuration <= 0 {
+		cb.options.OpenDuration = time.Second * 30
+	}
+	cb.state = registerCollector(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of route circuit breaker (0 closed, 1 open, 2 half-open).",
+	}, []string{"route"})).(*prometheus.GaugeVec)
+	return cb
+}
+
+// protects returns if route is protected by breaker
+func (cb *circuitBreaker) protects(r *http.Request, route string) bool {
+	if len(cb.options.Routes) == 0 {
+		return true
+	}
+	for _, protected := range cb.options.Routes {
+		if protected == route || strings.HasPrefix(r.URL.Path, protected) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow returns if request can pass. In open state requests are rejected until open duration elapses, then
+// route is probed (half-open) - by background Probe if it is configured, otherwise by single request which is let
+// through. Result of probe closes or reopens the breaker.
+func (cb *circuitBreaker) allow(route string) (allowed bool, retryAfter time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	b, ok := cb.breakers[route]
+	if !ok {
+		return true, 0
+	}
+	switch b.state {
+	case breakerOpen:
+		elapsed := time.Since(b.openedAt)
+		if elapsed < cb.options.OpenDuration {
+			return false, cb.options.OpenDuration - elapsed
+		}
+		cb.setState(route, b, breakerHalfOpen)
+		if cb.options.Probe != nil {
+			go cb.probe(route)
+			return false, time.Second
+		}
+		return true, 0
+	case breakerHalfOpen:
+		// Probe is running
+		return false, time.Second
+	}
+	return true, 0
+}
+
+// record updates breaker state with response status
+func (cb *circuitBreaker) record(route string, status int) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	b, ok := cb.breakers[route]
+	if !ok {
+		b = &routeBreaker{}
+		cb.breakers[route] = b
+	}
+	if status < http.StatusInternalServerError {
+		b.failures = 0
+		if b.state != breakerClosed {
+			cb.setState(route, b, breakerClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= cb.options.Threshold {
+		b.openedAt = time.Now()
+		cb.setState(route, b, breakerOpen)
+	}
+}
+
+// probe runs background probe of route and closes or reopens the breaker
+func (cb *circuitBreaker) probe(route string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cb.options.OpenDuration)
+	defer cancel()
+	err := cb.options.Probe(ctx, route)
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	b := cb.breakers[route]
+	if b.state != breakerHalfOpen {
+		// State was changed by response of request in flight
+		return
+	}
+	if err != nil {
+		if cb.logger != nil {
+			cb.logger.WithError(err).WithField("route", route).Debug("circuit breaker probe failed")
+		}
+		b.openedAt = time.Now()
+		cb.setState(route, b, breakerOpen)
+		return
+	}
+	b.failures = 0
+	cb.setState(route, b, breakerClosed)
+}
+
+// setState changes state of breaker
+func (cb *circuitBreaker) setState(route string, b *routeBreaker, state int) {
+	if cb.logger != nil && b.state != state {
+		cb.logger.WithFields(logrus.Fields{"route": route, "state": state, "failures": b.failures}).Warn("circuit breaker state changed")
+	}
+	b.state = state
+	cb.state.WithLabelValues(route).Set(float64(state))
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (cb *circuitBreaker) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := RouteTemplate(r)
+		if !cb.protects(r, route) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if allowed, retryAfter := cb.allow(route); !allowed {
+			logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+			err := ServerErrorWithoutStack(fmt.Errorf("circuit breaker of route %s is open", route), http.StatusServiceUnavailable, "Service temporarily unavailable").WithRetryAfter(retryAfter)
+			processHTTPError(err, w, r, logger, nil)
+			return
+		}
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+		cb.record(route, rec.Status())
+	})
+}
@@ -0,0 +1,63 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		probe         func(ctx context.Context, route string) error
+		wantFirst     bool
+		wantState     int
+		wantAfterward bool
+	}{
+		{"request probe", nil, true, breakerHalfOpen, false},
+		{"background probe succeeds", func(ctx context.Context, route string) error { return nil }, false, breakerClosed, true},
+		{"background probe fails", func(ctx context.Context, route string) error { return errors.New("down") }, false, breakerOpen, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probed := make(chan struct{})
+			options := &CircuitBreakerOptions{Threshold: 1, OpenDuration: time.Millisecond * 50}
+			if tt.probe != nil {
+				options.Probe = func(ctx context.Context, route string) error {
+					defer close(probed)
+					return tt.probe(ctx, route)
+				}
+			}
+			cb := newCircuitBreaker(options, nil)
+			cb.record("/items", 500)
+			if allowed, _ := cb.allow("/items"); allowed {
+				t.Fatal("open breaker let request through")
+			}
+			time.Sleep(options.OpenDuration)
+
+			if allowed, _ := cb.allow("/items"); allowed != tt.wantFirst {
+				t.Fatalf("first request after open duration allowed: %v, want %v", allowed, tt.wantFirst)
+			}
+			if tt.probe != nil {
+				select {
+				case <-probed:
+				case <-time.After(time.Second * 5):
+					t.Fatal("probe was not run")
+				}
+			}
+			for i := 0; i < 100; i++ {
+				cb.mutex.Lock()
+				state := cb.breakers["/items"].state
+				cb.mutex.Unlock()
+				if state == tt.wantState {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if allowed, _ := cb.allow("/items"); allowed != tt.wantAfterward {
+				t.Fatalf("request after probe allowed: %v, want %v", allowed, tt.wantAfterward)
+			}
+		})
+	}
+}
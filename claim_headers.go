@@ -0,0 +1,54 @@
+package webservice
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Values of AuthorizationOptions.ClaimHeaders with user info fields, other values are claim paths
+const (
+	ClaimHeaderUserID = "uid"
+	ClaimHeaderEmail  = "email"
+	ClaimHeaderScopes = "scopes"
+	ClaimHeaderGroups = "groups"
+)
+
+// DefaultClaimHeaders project user ID, email and scopes into X-User-* headers
+var DefaultClaimHeaders = map[string]string{
+	"X-User-Id":     ClaimHeaderUserID,
+	"X-User-Email":  ClaimHeaderEmail,
+	"X-User-Scopes": ClaimHeaderScopes,
+}
+
+// claimHeaderValue returns header value for user info field or claim
+func claimHeaderValue(userInfo *UserInfo, claim string) string {
+	switch claim {
+	case ClaimHeaderUserID:
+		return userInfo.UserID
+	case ClaimHeaderEmail:
+		return userInfo.Email
+	case ClaimHeaderScopes:
+		return strings.Join(userInfo.Scopes, " ")
+	case ClaimHeaderGroups:
+		return strings.Join(userInfo.Groups, ",")
+	}
+	if value := userInfo.ClaimString(claim); value != "" {
+		return value
+	}
+	return strings.Join(userInfo.ClaimStringSlice(claim), ",")
+}
+
+// setClaimHeaders replaces claim headers of request by values of authenticated user. Headers sent by client
+// are always removed, so they can't be spoofed.
+func (a *authorization) setClaimHeaders(r *http.Request, userInfo *UserInfo) {
+	authenticated := userInfo != nil && userInfo != unauthenticatedUser && userInfo != userWithInvalidToken
+	for header, claim := range a.claimHeaders {
+		r.Header.Del(header)
+		if !authenticated {
+			continue
+		}
+		if value := claimHeaderValue(userInfo, claim); value != "" {
+			r.Header.Set(header, value)
+		}
+	}
+}
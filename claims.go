@@ -0,0 +1,113 @@
+package webservice
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Claim returns claim value. Path can address nested claims separated by dots (e.g. "realm_access.roles"),
+// claim names containing dots (e.g. namespaced "https://example.com/roles") are matched first.
+func (ui *UserInfo) Claim(path string) (value interface{}, ok bool) {
+	if ui == nil || ui.Claims == nil {
+		return nil, false
+	}
+	return lookupClaim(ui.Claims, path)
+}
+
+// lookupClaim finds value in nested claims map
+func lookupClaim(claims map[string]interface{}, path string) (value interface{}, ok bool) {
+	if value, ok = claims[path]; ok {
+		return
+	}
+	// Try the longest prefix being claim name and the rest being nested path
+	for idx := strings.LastIndex(path, "."); idx > 0; idx = strings.LastIndex(path[:idx], ".") {
+		nested, found := claims[path[:idx]].(map[string]interface{})
+		if !found {
+			continue
+		}
+		if value, ok = lookupClaim(nested, path[idx+1:]); ok {
+			return
+		}
+	}
+	return nil, false
+}
+
+// ClaimString returns string claim, empty string is returned if claim does not exist or it is not a string
+func (ui *UserInfo) ClaimString(path string) string {
+	value, _ := ui.Claim(path)
+	s, _ := value.(string)
+	return s
+}
+
+// ClaimStringSlice returns list claim. Space separated string (e.g. scope) is split into list.
+func (ui *UserInfo) ClaimStringSlice(path string) []string {
+	value, _ := ui.Claim(path)
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		return strings.Fields(v)
+	}
+	return nil
+}
+
+// ClaimInt returns integer claim (JSON numbers and numeric strings are converted), 0 is returned if claim
+// does not exist or it is not a number
+func (ui *UserInfo) ClaimInt(path string) int64 {
+	value, _ := ui.Claim(path)
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// ClaimBool returns boolean claim ("true" string is accepted too)
+func (ui *UserInfo) ClaimBool(path string) bool {
+	value, _ := ui.Claim(path)
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+// ClaimTime returns time claim - numeric claims are Unix seconds (exp, iat, auth_time), strings are RFC 3339.
+// Zero time is returned if claim does not exist or it is not a time.
+func (ui *UserInfo) ClaimTime(path string) time.Time {
+	value, _ := ui.Claim(path)
+	switch v := value.(type) {
+	case string:
+		t, _ := time.Parse(time.RFC3339, v)
+		return t
+	case nil:
+		return time.Time{}
+	}
+	if seconds := ui.ClaimInt(path); seconds != 0 {
+		return time.Unix(seconds, 0)
+	}
+	return time.Time{}
+}
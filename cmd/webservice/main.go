@@ -0,0 +1,208 @@
+// Command webservice generates skeleton of new service - webservice new <name> writes main.go, service.go with
+// handler examples, config.yaml, Dockerfile and go.mod into directory of the service. webservice replay re-sends
+// traffic captured by recorder (HAR files) against running build and reports differences of responses.
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/beanox/webservice"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// validName is name of service usable as directory, binary and scope prefix
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// templateData are values of templates
+type templateData struct {
+	Name      string
+	Module    string
+	GoVersion string
+}
+
+// headerFlags are repeated -header "Name: value" flags
+type headerFlags http.Header
+
+// String implements flag.Value
+func (h headerFlags) String() string {
+	return ""
+}
+
+// Set implements flag.Value
+func (h headerFlags) Set(value string) error {
+	name, value, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("header %q is not in format Name: value", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "new":
+		newService()
+	case "replay":
+		replay()
+	default:
+		usage()
+	}
+}
+
+// usage prints usage and exits
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:\n  webservice new [-module path] [-dir directory] <name>\n  webservice replay -target URL [-ignore paths] [-header 'Name: value'] <har file or directory>...")
+	os.Exit(2)
+}
+
+// newService generates skeleton of new service
+func newService() {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	module := flags.String("module", "", "Go module path of service, default is name")
+	dir := flags.String("dir", "", "Output directory, default is name")
+	goVersion := flags.String("go", "1.22", "Go version of go.mod and Dockerfile")
+	args := os.Args[2:]
+	// Name can be written before flags too
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	flags.Parse(args)
+	if name == "" && flags.NArg() == 1 {
+		name = flags.Arg(0)
+	} else if flags.NArg() > 0 {
+		usage()
+	}
+	if !validName.MatchString(name) {
+		fmt.Fprintf(os.Stderr, "invalid service name %q, lower case letters, digits, - and _ are allowed\n", name)
+		os.Exit(2)
+	}
+
+	data := templateData{Name: name, Module: *module, GoVersion: *goVersion}
+	if data.Module == "" {
+		data.Module = name
+	}
+	if *dir == "" {
+		*dir = name
+	}
+	if err := generate(*dir, data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Service %s created in %s, next steps:\n  cd %s\n  go mod tidy\n  go run .\n", name, *dir, *dir)
+}
+
+// replay re-sends recorded requests to target, exit status is 1 if any response differs
+func replay() {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	target := flags.String("target", "http://localhost:8080", "Base URL of tested service")
+	ignore := flags.String("ignore", "", "Comma separated ignored JSON paths of response body, e.g. id,items.*.created_at")
+	timeout := flags.Duration("timeout", 30*time.Second, "Timeout of single request")
+	verbose := flags.Bool("v", false, "Print passed requests too")
+	header := headerFlags{}
+	flags.Var(header, "header", "Header added to requests, e.g. 'Authorization: Bearer ...' (repeatable)")
+	flags.Parse(os.Args[2:])
+	if flags.NArg() == 0 {
+		usage()
+	}
+
+	options := &webservice.ReplayOptions{
+		Target: *target,
+		Header: http.Header(header),
+		Client: &http.Client{Timeout: *timeout},
+	}
+	if *ignore != "" {
+		options.IgnorePaths = strings.Split(*ignore, ",")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results, err := webservice.Replay(ctx, flags.Args(), options)
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			if *verbose {
+				fmt.Printf("PASS %s %s (%d, %s)\n", result.Method, result.Path, result.Status, result.Duration.Round(time.Millisecond))
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s %s\n", result.Method, result.Path)
+		if result.Err != nil {
+			fmt.Printf("    %v\n", result.Err)
+		}
+		for _, difference := range result.Differences {
+			fmt.Printf("    %s\n", difference)
+		}
+	}
+	fmt.Printf("%d requests replayed, %d passed, %d failed\n", len(results), len(results)-failed, failed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// generate writes files of all templates into dir, existing files are not overwritten
+func generate(dir string, data templateData) error {
+	entries, err := templates.ReadDir("templates")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		tmpl, err := template.ParseFS(templates, "templates/"+entry.Name())
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		content := buf.Bytes()
+		filename := strings.TrimSuffix(entry.Name(), ".tmpl")
+		if strings.HasSuffix(filename, ".go") {
+			if content, err = format.Source(content); err != nil {
+				return fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+		if err = writeNewFile(filepath.Join(dir, filename), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNewFile creates file with content, it fails if file exists
+func writeNewFile(filename string, content []byte) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,87 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// Component is a cross-cutting part of the service (db, cache, queue consumer, ...) that shares service lifecycle
+type Component interface {
+	// Name of the component - it is used as configuration key (e.g. "db" -> db.host)
+	Name() string
+	// Configure is called when configuration is loaded with configuration subtree of the component
+	Configure(config *viper.Viper) (err error)
+	// Routes can register component specific routes
+	Routes(router *mux.Router) (err error)
+	// Start is called when listener is bound, ctx is cancelled when service shuts down
+	Start(ctx context.Context) (err error)
+	// Stop is called after server shutdown, components are stopped in reverse order
+	Stop(ctx context.Context) (err error)
+}
+
+// Register adds components to the service. Components are configured, started and stopped in order of registration.
+func (s *webservice) Register(components ...Component) {
+	s.components = append(s.components, components...)
+}
+
+// devModeComponent is component with development only behavior (e.g. generated keys)
+type devModeComponent interface {
+	setDevMode(enable bool)
+}
+
+// configureComponents calls Configure() and Routes() of all registered components
+func (s *webservice) configureComponents(router *mux.Router) (err error) {
+	for _, component := range s.components {
+		if c, ok := component.(devModeComponent); ok {
+			c.setDevMode(s.devMode)
+		}
+		config := viper.Sub(component.Name())
+		if config == nil {
+			config = viper.New()
+		}
+		err = component.Configure(config)
+		if err != nil {
+			err = fmt.Errorf("component %s: unable to configure: %w", component.Name(), err)
+			return
+		}
+		err = component.Routes(router)
+		if err != nil {
+			err = fmt.Errorf("component %s: unable to configure routes: %w", component.Name(), err)
+			return
+		}
+	}
+	return
+}
+
+// startComponents calls Start() of all registered components. If any of components fails, already started ones are stopped.
+func (s *webservice) startComponents(ctx context.Context) (err error) {
+	for idx, component := range s.components {
+		err = component.Start(ctx)
+		if err != nil {
+			err = fmt.Errorf("component %s: unable to start: %w", component.Name(), err)
+			s.stopComponents(ctx, s.components[:idx])
+			return
+		}
+		if s.logger != nil {
+			s.logger.WithField("component", component.Name()).Debug("component started")
+		}
+	}
+	return
+}
+
+// stopComponents calls Stop() of given components in reverse order
+func (s *webservice) stopComponents(ctx context.Context, components []Component) {
+	for idx := len(components) - 1; idx >= 0; idx-- {
+		component := components[idx]
+		if err := component.Stop(ctx); err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).WithField("component", component.Name()).Errorf("unable to stop component")
+			}
+		} else if s.logger != nil {
+			s.logger.WithField("component", component.Name()).Debug("component stopped")
+		}
+	}
+}
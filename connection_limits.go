@@ -0,0 +1,175 @@
+package webservice
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// ConnectionOptions is a configuration container for keep-alive and connection limits (for small instances
+// falling over under connection floods)
+type ConnectionOptions struct {
+	// Close connections after each response
+	DisableKeepAlives bool
+	// Max number of open connections, further connections wait until a connection is closed. Zero means unlimited.
+	MaxConnections int
+	// Max number of open connections of single IP address (client address from PROXY header if PROXY protocol is
+	// enabled, peer of TCP connection otherwise), further connections are closed. Zero means unlimited.
+	MaxConnectionsPerIP int
+}
+
+// ConnectionOptionsFromViper reads connection options (disable_keep_alives, max_connections,
+// max_connections_per_ip), nil is returned if nothing is configured
+func ConnectionOptionsFromViper(prefix string) *ConnectionOptions {
+	options := &ConnectionOptions{
+		DisableKeepAlives:   viper.GetBool(prefix + "disable_keep_alives"),
+		MaxConnections:      viper.GetInt(prefix + "max_connections"),
+		MaxConnectionsPerIP: viper.GetInt(prefix + "max_connections_per_ip"),
+	}
+	if !options.DisableKeepAlives && options.MaxConnections <= 0 && options.MaxConnectionsPerIP <= 0 {
+		return nil
+	}
+	return options
+}
+
+// errTooManyConnections is returned from read of connection exceeding per IP limit
+var errTooManyConnections = errors.New("too many connections from IP address")
+
+// limitListener limits number of open connections in total and per IP address
+type limitListener struct {
+	net.Listener
+	options   ConnectionOptions
+	slots     chan struct{}
+	mutex     sync.Mutex
+	perIP     map[string]int
+	open      prometheus.Gauge
+	rejected  prometheus.Counter
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newLimitListener wraps listener with connection limits
+func newLimitListener(listener net.Listener, options *ConnectionOptions) net.Listener {
+	l := &limitListener{
+		Listener: listener,
+		options:  *options,
+		perIP:    map[string]int{},
+		done:     make(chan struct{}),
+	}
+	if options.MaxConnections > 0 {
+		l.slots = make(chan struct{}, options.MaxConnections)
+	}
+	l.open = registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_connections_open",
+		Help: "Number of open connections.",
+	})).(prometheus.Gauge)
+	l.rejected = registerCollector(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_connections_rejected_total",
+		Help: "Number of connections closed because of per IP connection limit.",
+	})).(prometheus.Counter)
+	return l
+}
+
+// connectionIP returns IP address of connection peer
+func connectionIP(conn net.Conn) string {
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return host
+}
+
+// Accept implements net.Listener, it waits for free slot until listener is closed
+func (l *limitListener) Accept() (net.Conn, error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.releaseSlot()
+		return nil, err
+	}
+	l.open.Inc()
+	return &limitedConn{Conn: conn, listener: l}, nil
+}
+
+// Close implements net.Listener
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// releaseSlot frees slot of closed connection
+func (l *limitListener) releaseSlot() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// limitedConn releases its slot when closed
+type limitedConn struct {
+	net.Conn
+	listener  *limitListener
+	ip        string
+	checkOnce sync.Once
+	checkErr  error
+	closeOnce sync.Once
+}
+
+// check counts connection of its IP address. It runs on first read in connection goroutine, so PROXY header
+// (client address) doesn't block accepting of other connections.
+func (c *limitedConn) check() error {
+	c.checkOnce.Do(func() {
+		l := c.listener
+		if l.options.MaxConnectionsPerIP <= 0 {
+			return
+		}
+		ip := connectionIP(c.Conn)
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		if l.perIP[ip] >= l.options.MaxConnectionsPerIP {
+			c.checkErr = errTooManyConnections
+			l.rejected.Inc()
+			return
+		}
+		l.perIP[ip]++
+		c.ip = ip
+	})
+	return c.checkErr
+}
+
+// Read implements net.Conn, connection exceeding per IP limit is closed
+func (c *limitedConn) Read(b []byte) (int, error) {
+	if err := c.check(); err != nil {
+		c.Close()
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// Close implements net.Conn
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	// Connection closed before first read is not counted
+	c.checkOnce.Do(func() {})
+	c.closeOnce.Do(func() {
+		l := c.listener
+		if c.ip != "" {
+			l.mutex.Lock()
+			if l.perIP[c.ip]--; l.perIP[c.ip] <= 0 {
+				delete(l.perIP, c.ip)
+			}
+			l.mutex.Unlock()
+		}
+		l.open.Dec()
+		l.releaseSlot()
+	})
+	return err
+}
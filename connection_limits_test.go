@@ -0,0 +1,85 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitListenerAcceptReturnsAfterClose(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLimitListener(inner, &ConnectionOptions{MaxConnections: 1})
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err = l.Accept(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Slots are full, Accept waits until listener is closed
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		accepted <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+	l.Close()
+	select {
+	case err := <-accepted:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected net.ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Accept is blocked after Close")
+	}
+}
+
+func TestLimitListenerCountsProxyProtocolClients(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, err := newProxyProtocolListener(inner, &ProxyProtocolOptions{TrustedProxies: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLimitListener(proxied, &ConnectionOptions{MaxConnectionsPerIP: 1})
+	defer l.Close()
+
+	tests := []struct {
+		name     string
+		clientIP string
+		allowed  bool
+	}{
+		{"first client", "192.0.2.1", true},
+		{"second client", "192.0.2.2", true},
+		{"first client again", "192.0.2.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			fmt.Fprintf(client, "PROXY TCP4 %s 192.0.2.100 50000 80\r\nping", test.clientIP)
+			conn, err := l.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			if allowed := err == nil; allowed != test.allowed {
+				t.Fatalf("expected allowed %v, got error %v", test.allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package webservice
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// consoleTokenTTL is lifetime of tokens minted by console
+const consoleTokenTTL = time.Hour
+
+// consoleTokenIssuerName is iss and aud claim of tokens minted by console, they are not accepted by other services
+const consoleTokenIssuerName = "urn:webservice:console"
+
+// consoleTokenRequest are claims of token minted by console
+type consoleTokenRequest struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email"`
+	Scopes  []string `json:"scopes"`
+}
+
+// consoleHandler serves API console page (dev mode only). Routes are loaded from /debug/routes, calls are sent
+// from browser with bearer token pasted by user or minted by /console/token.
+func consoleHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, err := w.Write([]byte(consolePage))
+	return err
+}
+
+// newConsoleTokenIssuer creates issuer of console tokens with ephemeral key generated in memory. Key is never
+// published, so tokens are accepted only by the instance which minted them.
+func newConsoleTokenIssuer() (*TokenIssuer, error) {
+	issuer := NewTokenIssuer(consoleTokenIssuerName, nil)
+	return issuer, issuer.generateKey()
+}
+
+// trustDevKeys makes authorization accept tokens signed by keys in addition to configured JWKS, tokens signed by
+// them must have consoleTokenIssuerName as issuer and audience
+func (a *authorization) trustDevKeys(keys func() jwk.Set) {
+	verifiesTokens := a.jwks != nil || a.autoRefresh != nil
+	a.devKeys = keys
+	if !a.disabled && !verifiesTokens {
+		a.sources = append(a.sources, IdentitySourceFunc(a.tokenUser))
+	}
+}
+
+// consoleTokenHandler mints test token signed by ephemeral console key, authorization trusts it in dev mode
+func (s *webservice) consoleTokenHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+	var req consoleTokenRequest
+	if err := BindBody(r, &req); err != nil {
+		return err
+	}
+	if req.Subject == "" {
+		req.Subject = "console"
+	}
+	claims := jwt.MapClaims{"sub": req.Subject, "aud": consoleTokenIssuerName, "scope": strings.Join(req.Scopes, " ")}
+	if req.Email != "" {
+		claims["email"] = req.Email
+	}
+	token, err := s.consoleIssuer.SignToken(claims, consoleTokenTTL)
+	if err != nil {
+		return ServerError(err, http.StatusInternalServerError, "Unable to sign token")
+	}
+	return WriteJSON(w, r, map[string]interface{}{
+		"token":      token,
+		"expires_in": int(consoleTokenTTL.Seconds()),
+	})
+}
+
+// consolePage is single page UI of API console, paths are relative so it works behind strip_path prefix
+const consolePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API console</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#routes { width: 32%; overflow: auto; border-right: 1px solid #ccc; padding: 8px; }
+#routes div { padding: 4px; cursor: pointer; font-family: monospace; }
+#routes div:hover { background: #eef; }
+#routes small { color: #666; }
+main { flex: 1; overflow: auto; padding: 8px; }
+input, textarea, select, button { font-family: monospace; margin: 2px 0; }
+textarea { width: 100%; }
+pre { background: #f6f6f6; padding: 8px; white-space: pre-wrap; word-break: break-all; }
+</style>
+</head>
+<body>
+<div id="routes"><b>Routes</b></div>
+<main>
+<fieldset>
+<legend>Token</legend>
+<textarea id="token" rows="3" placeholder="Bearer token"></textarea><br>
+sub <input id="sub" value="console"> scopes <input id="scopes" size="40" placeholder="space separated">
+<button id="mint">Mint token</button>
+</fieldset>
+<fieldset>
+<legend>Request</legend>
+<select id="method"><option>GET</option><option>POST</option><option>PUT</option><option>PATCH</option><option>DELETE</option></select>
+<input id="path" size="60" value="/status">
+<button id="send">Send</button><br>
+Content-Type <input id="contentType" value="application/json"><br>
+<textarea id="body" rows="8" placeholder="Request body"></textarea>
+</fieldset>
+<pre id="response"></pre>
+</main>
+<script>
+const $ = (id) => document.getElementById(id);
+const base = location.pathname.replace(/console\/?$/, "");
+function show(text) { $("response").textContent = text; }
+
+fetch(base + "debug/routes").then((r) => r.json()).then((routes) => {
+  for (const route of routes) {
+    const item = document.createElement("div");
+    item.textContent = (route.methods || ["*"]).join(",") + " " + route.path + " ";
+    const policy = document.createElement("small");
+    policy.textContent = route.policy + (route.scopes ? " [" + route.scopes.join(" ") + "]" : "");
+    item.appendChild(policy);
+    item.onclick = () => {
+      if (route.methods && route.methods.length) { $("method").value = route.methods[0]; }
+      $("path").value = route.path;
+      if (route.scopes) { $("scopes").value = route.scopes.join(" "); }
+    };
+    $("routes").appendChild(item);
+  }
+}).catch((err) => show("Unable to load routes: " + err));
+
+$("mint").onclick = async () => {
+  const scopes = $("scopes").value.split(/\s+/).filter((s) => s);
+  const resp = await fetch(base + "console/token", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ sub: $("sub").value, scopes: scopes }),
+  });
+  const data = await resp.json();
+  if (resp.ok) { $("token").value = data.token; show("Token minted, expires in " + data.expires_in + "s"); }
+  else { show(JSON.stringify(data, null, 2)); }
+};
+
+$("send").onclick = async () => {
+  const headers = {};
+  const token = $("token").value.trim();
+  if (token) { headers["Authorization"] = "Bearer " + token; }
+  const method = $("method").value;
+  const init = { method: method, headers: headers };
+  if (method !== "GET" && method !== "DELETE" && $("body").value) {
+    headers["Content-Type"] = $("contentType").value;
+    init.body = $("body").value;
+  }
+  const started = performance.now();
+  try {
+    const resp = await fetch(base + $("path").value.replace(/^\//, ""), init);
+    let text = resp.status + " " + resp.statusText + " (" + Math.round(performance.now() - started) + " ms)\n";
+    resp.headers.forEach((value, name) => { text += name + ": " + value + "\n"; });
+    const body = await resp.text();
+    try { text += "\n" + JSON.stringify(JSON.parse(body), null, 2); } catch (e) { text += "\n" + body; }
+    show(text);
+  } catch (err) {
+    show("Request failed: " + err);
+  }
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,56 @@
+package webservice
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestConsoleTokensAreTrustedOnlyWithConsoleKey(t *testing.T) {
+	console, err := newConsoleTokenIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherConsole, err := newConsoleTokenIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	production := NewTokenIssuer("https://auth.example.com", nil)
+	if err = production.generateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newAuthorizationMiddleware(&AuthorizationOptions{}, nil)
+	a.trustDevKeys(console.PublicKeys)
+
+	sign := func(issuer *TokenIssuer, claims jwt.MapClaims) string {
+		token, err := issuer.SignToken(claims, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	tests := []struct {
+		name     string
+		token    string
+		accepted bool
+	}{
+		{"console token", sign(console, jwt.MapClaims{"sub": "dev", "aud": consoleTokenIssuerName, "scope": "admin"}), true},
+		{"console key without console audience", sign(console, jwt.MapClaims{"sub": "dev", "scope": "admin"}), false},
+		{"console key with other audience", sign(console, jwt.MapClaims{"sub": "dev", "aud": "api", "scope": "admin"}), false},
+		{"console token of other instance", sign(otherConsole, jwt.MapClaims{"sub": "dev", "aud": consoleTokenIssuerName}), false},
+		{"production issuer", sign(production, jwt.MapClaims{"sub": "dev", "aud": consoleTokenIssuerName}), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			userInfo, err := a.tokenUser(req)
+			if accepted := err == nil && userInfo != nil; accepted != test.accepted {
+				t.Fatalf("expected accepted %v, got %v (%v)", test.accepted, accepted, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestTimeoutHeader carries remaining time budget of the request
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// parseRequestTimeout parses X-Request-Timeout (Go duration or milliseconds) or grpc-timeout (e.g. 100m, 5S) header
+func parseRequestTimeout(r *http.Request) (timeout time.Duration, ok bool) {
+	if value := strings.TrimSpace(r.Header.Get(RequestTimeoutHeader)); value != "" {
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return d, true
+		}
+	}
+	if value := strings.TrimSpace(r.Header.Get("Grpc-Timeout")); len(value) > 1 {
+		amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return
+		}
+		units := map[byte]time.Duration{
+			'H': time.Hour,
+			'M': time.Minute,
+			'S': time.Second,
+			'm': time.Millisecond,
+			'u': time.Microsecond,
+			'n': time.Nanosecond,
+		}
+		if unit, found := units[value[len(value)-1]]; found {
+			return time.Duration(amount) * unit, true
+		}
+	}
+	return
+}
+
+// deadlineMiddleware sets context deadline from request timeout header. maxTimeout caps the budget (zero means no cap).
+func deadlineMiddleware(maxTimeout time.Duration) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout, ok := parseRequestTimeout(r)
+			if maxTimeout > 0 && (!ok || timeout > maxTimeout) {
+				timeout, ok = maxTimeout, true
+			}
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if timeout <= 0 {
+				logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+				processHTTPError(ServerErrorWithoutStack(nil, http.StatusGatewayTimeout, "Request deadline exceeded"), w, r, logger, nil)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// deadlineTransport propagates remaining deadline of request context to outbound requests
+type deadlineTransport struct {
+	base http.RoundTripper
+}
+
+// NewDeadlineTransport creates round tripper that sets X-Request-Timeout header from deadline of request context,
+// so downstream services get remaining time budget. Nil base means http.DefaultTransport.
+func NewDeadlineTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &deadlineTransport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if deadline, ok := req.Context().Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestTimeoutHeader, strconv.FormatInt(remaining.Milliseconds(), 10))
+	}
+	return t.base.RoundTrip(req)
+}
+
+// NewHTTPClient creates HTTP client for outbound calls that propagates request deadline. Use requests created
+// with http.NewRequestWithContext(r.Context(), ...) to pass the budget of incoming request. Base transport nil means
+// http.DefaultTransport, tests pass transport of mock upstream (see webservicetest.MockUpstream).
+func NewHTTPClient(timeout time.Duration, base http.RoundTripper) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: NewDeadlineTransport(base),
+	}
+}
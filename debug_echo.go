@@ -0,0 +1,52 @@
+package webservice
+
+import (
+	"io"
+	"net/http"
+)
+
+// debugEcho is response of /debug/echo endpoint
+type debugEcho struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Host       string      `json:"host"`
+	RemoteAddr string      `json:"remote_addr"`
+	Headers    http.Header `json:"headers"`
+	User       *UserInfo   `json:"user,omitempty"`
+	UserStatus string      `json:"user_status"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// maxDebugEchoBody limits body returned by /debug/echo
+const maxDebugEchoBody = 64 * 1024
+
+// debugEchoHandler returns request as seen by the service - it is registered only in dev mode
+func debugEchoHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) (err error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDebugEchoBody))
+	if err != nil {
+		return ServerError(err, http.StatusBadRequest, "Unable to read body")
+	}
+
+	echo := &debugEcho{
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    r.Header,
+		User:       userInfo,
+		UserStatus: "authorization_disabled",
+		Body:       string(body),
+	}
+	if resolved, ok := r.Context().Value(contextTypeUserInfo).(*UserInfo); ok {
+		switch resolved {
+		case unauthenticatedUser:
+			echo.UserStatus = "unauthenticated"
+		case userWithInvalidToken:
+			echo.UserStatus = "invalid_token"
+		default:
+			echo.UserStatus = "authenticated"
+			echo.User = resolved
+		}
+	}
+	return WriteJSON(w, r, echo)
+}
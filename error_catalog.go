@@ -0,0 +1,85 @@
+package webservice
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ErrorCatalogEntry describes registered error code
+type ErrorCatalogEntry struct {
+	// Stable machine-readable identifier, e.g. ORDER_NOT_FOUND
+	ErrorCode string
+	// Default HTTP status code
+	Code int
+	// Message template used with fmt.Sprintf
+	MessageTemplate string
+}
+
+var errorCatalog = struct {
+	sync.RWMutex
+	entries map[string]ErrorCatalogEntry
+}{
+	entries: make(map[string]ErrorCatalogEntry),
+}
+
+// RegisterErrorCode registers error code in the catalog with default HTTP status and message template.
+// Already registered code will be replaced.
+func RegisterErrorCode(errorCode string, code int, messageTemplate string) {
+	errorCatalog.Lock()
+	defer errorCatalog.Unlock()
+	errorCatalog.entries[errorCode] = ErrorCatalogEntry{
+		ErrorCode:       errorCode,
+		Code:            code,
+		MessageTemplate: messageTemplate,
+	}
+}
+
+// LookupErrorCode returns registered catalog entry
+func LookupErrorCode(errorCode string) (entry ErrorCatalogEntry, ok bool) {
+	errorCatalog.RLock()
+	defer errorCatalog.RUnlock()
+	entry, ok = errorCatalog.entries[errorCode]
+	return
+}
+
+// ErrorCatalog returns all registered error codes
+func ErrorCatalog() (entries []ErrorCatalogEntry) {
+	errorCatalog.RLock()
+	defer errorCatalog.RUnlock()
+	for _, entry := range errorCatalog.entries {
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// ServerErrorFromCode creates error object from registered error code. Args are used to format message template.
+// Unknown error code results in internal server error with given code.
+func ServerErrorFromCode(Parent error, errorCode string, args ...interface{}) *ServerErrorData {
+	entry, ok := LookupErrorCode(errorCode)
+	if !ok {
+		entry = ErrorCatalogEntry{
+			Code:            500,
+			MessageTemplate: "Internal Server Error",
+		}
+	}
+
+	e := new(ServerErrorData)
+	e.Parent = Parent
+	e.Code = entry.Code
+	e.ErrorCode = errorCode
+	e.Message = entry.MessageTemplate
+	if len(args) > 0 {
+		e.Message = fmt.Sprintf(entry.MessageTemplate, args...)
+	}
+	e.FunctionInfo = getCurrentFunctionInfo(1)
+	if e.Code >= 500 {
+		e.stack = captureStack(1)
+	}
+	return e
+}
+
+// WithErrorCode sets machine-readable error code
+func (e *ServerErrorData) WithErrorCode(errorCode string) *ServerErrorData {
+	e.ErrorCode = errorCode
+	return e
+}
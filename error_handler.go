@@ -1,19 +1,42 @@
 package webservice
 
 import (
-	"encoding/json"
+	"bytes"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
 
-// processHTTPError writes formated error response to w
-func processHTTPError(err error, w http.ResponseWriter, _ *http.Request, logger *logrus.Logger, fn interface{}) {
+// Header values shared by all responses, they must not be modified
+var (
+	jsonContentType = []string{"application/json; charset=UTF-8"}
+	xmlContentType  = []string{"application/xml; charset=UTF-8"}
+	noSniff         = []string{"nosniff"}
+)
+
+// encodeHTTPError encodes error response as XML or JSON
+func encodeHTTPError(r *http.Request, serverError *ServerErrorData, asXML bool) ([]byte, error) {
+	if asXML {
+		return xml.Marshal(serverError)
+	}
+	buf, err := encodeJSON(r, serverError)
+	defer putJSONBuffer(buf)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// processHTTPError writes formated error response to w, as XML if request prefers it
+func processHTTPError(err error, w http.ResponseWriter, r *http.Request, logger *logrus.Logger, fn interface{}) {
 	if err != nil {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header()["X-Content-Type-Options"] = noSniff
 
 		var serverError *ServerErrorData
 
@@ -38,6 +61,10 @@ func processHTTPError(err error, w http.ResponseWriter, _ *http.Request, logger
 				logEntry = logEntry.WithField("func", funcInfo)
 			}
 
+			if len(serverError.stack) > 0 && logger.IsLevelEnabled(logrus.DebugLevel) {
+				logEntry = logEntry.WithField("stack", serverError.Stack())
+			}
+
 			if serverError.Code >= 500 {
 				logEntry.Error("server error")
 
@@ -53,11 +80,30 @@ func processHTTPError(err error, w http.ResponseWriter, _ *http.Request, logger
 			serverError.Description = serverError.Parent.Error()
 		}
 
-		b, _ := json.Marshal(serverError)
-		if logger != nil {
+		asXML := prefersXML(r)
+		if asXML {
+			w.Header()["Content-Type"] = xmlContentType
+		}
+		b, encodeErr := encodeHTTPError(r, serverError, asXML)
+		if encodeErr != nil {
+			// Details can't be encoded (e.g. map in XML), error is sent without them
+			if logger != nil {
+				logger.WithError(encodeErr).Warn("unable to encode error details")
+			}
+			withoutDetails := *serverError
+			withoutDetails.Details = nil
+			b, _ = encodeHTTPError(r, &withoutDetails, asXML)
+		}
+		if logger != nil && logger.IsLevelEnabled(logrus.TraceLevel) {
 			logger.WithField("response", string(b)).Trace("server response")
 		}
 
+		for key, values := range serverError.Headers {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+
 		w.WriteHeader(serverError.Code)
 		w.Write(b)
 	}
@@ -69,10 +115,60 @@ func getFunctionInfo(fn interface{}) string {
 	return fmt.Sprintf("%s:%d:%s", frame.File, frame.Line, frame.Function)
 }
 
+// stackTraceDepth is max number of frames captured for server errors, it is accessed atomically as it can be
+// changed while requests are served
+var stackTraceDepth int32 = 15
+
+// SetStackTraceDepth sets max number of frames captured by ServerError for errors >= 500. Zero disables capturing.
+func SetStackTraceDepth(depth int) {
+	if depth < 0 {
+		depth = 0
+	}
+	atomic.StoreInt32(&stackTraceDepth, int32(depth))
+}
+
+// captureStack returns program counters of the caller stack (skip = 0 is caller of captureStack)
+func captureStack(skip int) []uintptr {
+	depth := atomic.LoadInt32(&stackTraceDepth)
+	if depth == 0 {
+		return nil
+	}
+	pc := make([]uintptr, depth)
+	n := runtime.Callers(skip+2, pc)
+	return pc[:n]
+}
+
+// getCurrentFunctionInfo returns file:line:function of the caller (skip = 0 is caller of getCurrentFunctionInfo),
+// it is captured for all errors, so logs show where they come from
 func getCurrentFunctionInfo(skip int) string {
-	pc := make([]uintptr, 15)
+	pc := make([]uintptr, 1)
 	n := runtime.Callers(skip+2, pc)
-	frames := runtime.CallersFrames(pc[:n])
+	return formatFrame(pc[:n])
+}
+
+// formatFrame formats first frame of the stack as file:line:function
+func formatFrame(pc []uintptr) string {
+	if len(pc) == 0 {
+		return ""
+	}
+	frames := runtime.CallersFrames(pc[:1])
 	frame, _ := frames.Next()
 	return fmt.Sprintf("%s:%d:%s", frame.File, frame.Line, frame.Function)
 }
+
+// formatStack formats all frames of the stack, one frame per line
+func formatStack(pc []uintptr) string {
+	if len(pc) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pc)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s:%d:%s\n", frame.File, frame.Line, frame.Function)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
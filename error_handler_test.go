@@ -0,0 +1,92 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProcessHTTPErrorDetails(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  string
+		details interface{}
+		want    string
+	}{
+		{"json map", "application/json", map[string]string{"field": "name"}, `{"code":400,"error_code":"INVALID","message":"Invalid input","details":{"field":"name"}}`},
+		{"xml slice", "application/xml", []string{"name"}, `<error><code>400</code><error_code>INVALID</error_code><message>Invalid input</message><details><detail>name</detail></details></error>`},
+		{"xml map", "application/xml", map[string]string{"field": "name"}, `<error><code>400</code><error_code>INVALID</error_code><message>Invalid input</message></error>`},
+		{"json unsupported", "application/json", map[string]interface{}{"ch": make(chan int)}, `{"code":400,"error_code":"INVALID","message":"Invalid input"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			err := ServerErrorWithoutStack(nil, http.StatusBadRequest, "Invalid input").WithErrorCode("INVALID").WithDetails(tt.details)
+			processHTTPError(err, w, r, nil, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("unexpected status %d", w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerErrorFunctionInfo(t *testing.T) {
+	RegisterErrorCode("TEST_NOT_FOUND", http.StatusNotFound, "Not found")
+	RegisterErrorCode("TEST_FAILED", http.StatusInternalServerError, "Failed")
+	tests := []struct {
+		name      string
+		err       func() *ServerErrorData
+		wantStack bool
+	}{
+		{"client error", func() *ServerErrorData { return ServerError(nil, http.StatusNotFound, "Not found") }, false},
+		{"server error", func() *ServerErrorData { return ServerError(nil, http.StatusInternalServerError, "Failed") }, true},
+		{"catalog client error", func() *ServerErrorData { return ServerErrorFromCode(nil, "TEST_NOT_FOUND") }, false},
+		{"catalog server error", func() *ServerErrorData { return ServerErrorFromCode(nil, "TEST_FAILED") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err()
+			if !strings.Contains(err.FunctionInfo, "TestServerErrorFunctionInfo") {
+				t.Fatalf("function info %q does not point to creator of error", err.FunctionInfo)
+			}
+			if got := err.Stack() != ""; got != tt.wantStack {
+				t.Fatalf("stack captured: %v, want %v", got, tt.wantStack)
+			}
+		})
+	}
+}
+
+func TestSetStackTraceDepthWhileCapturing(t *testing.T) {
+	defer SetStackTraceDepth(15)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			SetStackTraceDepth(i % 4)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if n := len(captureStack(0)); n > 3 {
+			t.Fatalf("captured %d frames, max depth is 3", n)
+		}
+	}
+	wg.Wait()
+
+	SetStackTraceDepth(0)
+	if pc := captureStack(0); pc != nil {
+		t.Fatalf("stack is captured with zero depth")
+	}
+	SetStackTraceDepth(-1)
+	if pc := captureStack(0); pc != nil {
+		t.Fatalf("stack is captured with negative depth")
+	}
+}
@@ -0,0 +1,98 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// EventBus is in-process publish/subscribe bus. Subscribers are selected by Go type of the event.
+// Lifecycle events (*LifecycleEvent) of the service are published on the bus too.
+type EventBus struct {
+	mutex       sync.RWMutex
+	nextID      uint64
+	subscribers map[reflect.Type]map[uint64]func(ctx context.Context, event interface{})
+}
+
+// NewEventBus creates event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[reflect.Type]map[uint64]func(ctx context.Context, event interface{})),
+	}
+}
+
+// Subscribe registers handler of events of type T. Subscription ends when ctx is done or returned function is called.
+func Subscribe[T any](ctx context.Context, bus *EventBus, fn func(ctx context.Context, event T)) (unsubscribe func()) {
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+
+	bus.mutex.Lock()
+	bus.nextID++
+	id := bus.nextID
+	if bus.subscribers[eventType] == nil {
+		bus.subscribers[eventType] = make(map[uint64]func(ctx context.Context, event interface{}))
+	}
+	bus.subscribers[eventType][id] = func(ctx context.Context, event interface{}) {
+		fn(ctx, event.(T))
+	}
+	bus.mutex.Unlock()
+
+	var once sync.Once
+	unsubscribe = func() {
+		once.Do(func() {
+			bus.mutex.Lock()
+			delete(bus.subscribers[eventType], id)
+			bus.mutex.Unlock()
+		})
+	}
+
+	if ctx != nil && ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			unsubscribe()
+		}()
+	}
+	return
+}
+
+// Publish delivers event to all subscribers of type T. Subscribers are called synchronously in the caller goroutine.
+func Publish[T any](ctx context.Context, bus *EventBus, event T) {
+	bus.publish(ctx, reflect.TypeOf((*T)(nil)).Elem(), event)
+}
+
+// publish delivers event to subscribers of given type
+func (bus *EventBus) publish(ctx context.Context, eventType reflect.Type, event interface{}) {
+	bus.mutex.RLock()
+	handlers := make([]func(ctx context.Context, event interface{}), 0, len(bus.subscribers[eventType]))
+	for _, handler := range bus.subscribers[eventType] {
+		handlers = append(handlers, handler)
+	}
+	bus.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		if ctx != nil && ctx.Err() != nil {
+			return
+		}
+		handler(ctx, event)
+	}
+}
+
+// ContextWithEventBus returns context with event bus
+func ContextWithEventBus(ctx context.Context, bus *EventBus) context.Context {
+	return context.WithValue(ctx, contextTypeEventBus, bus)
+}
+
+// EventBusFromContext returns event bus of the service - it is available in request context and in context passed to Component.Start()
+func EventBusFromContext(ctx context.Context) *EventBus {
+	bus, _ := ctx.Value(contextTypeEventBus).(*EventBus)
+	return bus
+}
+
+// eventBusMiddleware stores event bus in request context
+func eventBusMiddleware(bus *EventBus) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(ContextWithEventBus(r.Context(), bus)))
+		})
+	}
+}
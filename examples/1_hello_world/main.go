@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/beanox/webservice"
 	"github.com/gorilla/mux"
@@ -33,5 +34,7 @@ func main() {
 	logrus.SetLevel(logrus.TraceLevel)
 
 	// Start web service
-	svc.Start()
+	if err := svc.Start(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"github.com/beanox/webservice"
 	"github.com/spf13/viper"
 )
@@ -29,5 +32,7 @@ func main() {
 	webservice.FastConfig(svc)
 
 	// Start service
-	svc.Start()
+	if err := svc.Start(); err != nil && !errors.Is(err, webservice.ErrGeneratorModeDone) {
+		os.Exit(1)
+	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"strings"
 
 	"github.com/beanox/webservice"
@@ -30,7 +31,9 @@ func main() {
 
 	svc := webservice.New(&inputParamService{})
 
-	svc.Start()
+	if err := svc.Start(); err != nil {
+		os.Exit(1)
+	}
 }
 
 func (s *inputParamService) BeforeStart() (err error) {
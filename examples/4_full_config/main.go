@@ -90,5 +90,7 @@ func main() {
 	svc.EnableAuthorization(webservice.AuthorizationOptionsFromViper("authorization."))
 
 	// Start web service
-	svc.Start()
+	if err := svc.Start(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,153 @@
+package webservice
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+	ExportFormatXML    = "xml"
+)
+
+// ExportColumn is CSV column of exported item
+type ExportColumn[T any] struct {
+	Header string
+	Value  func(item T) string
+}
+
+// ExportFormat returns format requested by ?format= query parameter or Accept header, default is JSON
+func ExportFormat(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case ExportFormatCSV:
+		return ExportFormatCSV
+	case ExportFormatNDJSON:
+		return ExportFormatNDJSON
+	case ExportFormatJSON:
+		return ExportFormatJSON
+	case ExportFormatXML:
+		return ExportFormatXML
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accepted))
+		switch mediaType {
+		case "text/csv":
+			return ExportFormatCSV
+		case "application/x-ndjson", "application/jsonl":
+			return ExportFormatNDJSON
+		case "application/json":
+			return ExportFormatJSON
+		case "application/xml", "text/xml":
+			return ExportFormatXML
+		}
+	}
+	return ExportFormatJSON
+}
+
+// Export streams items as JSON array, NDJSON, CSV (with header row) or XML (items in <items> element) based on
+// ExportFormat(). Filename without extension is used in Content-Disposition, empty filename means inline response.
+// Columns are used only for CSV.
+func Export[T any](w http.ResponseWriter, r *http.Request, filename string, columns []ExportColumn[T], next StreamIterator[T]) (err error) {
+	format := ExportFormat(r)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + "." + format}))
+	}
+
+	switch format {
+	case ExportFormatNDJSON:
+		return StreamNDJSON(w, r, next)
+	case ExportFormatCSV:
+		if len(columns) == 0 {
+			return ServerError(nil, http.StatusNotAcceptable, "CSV export is not available")
+		}
+		return writeCSV(w, r, columns, next)
+	case ExportFormatXML:
+		return writeXMLItems(w, r, next)
+	default:
+		return StreamJSON(w, r, next)
+	}
+}
+
+// writeCSV writes items as CSV with header row, quoting is done by encoding/csv
+func writeCSV[T any](w http.ResponseWriter, r *http.Request, columns []ExportColumn[T], next StreamIterator[T]) (err error) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	lastFlush := time.Now()
+	ctx := r.Context()
+
+	record := make([]string, len(columns))
+	for idx, column := range columns {
+		record[idx] = column.Header
+	}
+	if err = writer.Write(record); err != nil {
+		return
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		item, ok, nextErr := next(ctx)
+		if nextErr != nil {
+			return fmt.Errorf("csv export: %w", nextErr)
+		}
+		if !ok {
+			break
+		}
+		for idx, column := range columns {
+			record[idx] = column.Value(item)
+		}
+		if err = writer.Write(record); err != nil {
+			return
+		}
+		if flusher != nil && time.Since(lastFlush) >= streamFlushInterval {
+			writer.Flush()
+			flusher.Flush()
+			lastFlush = time.Now()
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeXMLItems writes items as elements of <items> root element, element names are given by item types
+func writeXMLItems[T any](w http.ResponseWriter, r *http.Request, next StreamIterator[T]) (err error) {
+	w.Header()["Content-Type"] = xmlContentType
+	if _, err = w.Write([]byte(xml.Header + "<items>")); err != nil {
+		return
+	}
+	encoder := xml.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	lastFlush := time.Now()
+	ctx := r.Context()
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		item, ok, nextErr := next(ctx)
+		if nextErr != nil {
+			return fmt.Errorf("xml export: %w", nextErr)
+		}
+		if !ok {
+			break
+		}
+		if err = encoder.Encode(item); err != nil {
+			return
+		}
+		if flusher != nil && time.Since(lastFlush) >= streamFlushInterval {
+			flusher.Flush()
+			lastFlush = time.Now()
+		}
+	}
+	_, err = w.Write([]byte("</items>\n"))
+	return
+}
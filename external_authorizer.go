@@ -0,0 +1,323 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ExternalAuthorizerOptions is a configuration container for delegated authorization to external
+// policy decision point (PDP, e.g. Open Policy Agent)
+type ExternalAuthorizerOptions struct {
+	// PDP endpoint, request attributes and claims are POSTed as JSON (see PolicyInput)
+	URL string
+	// Headers sent to PDP (e.g. Authorization)
+	Headers map[string]string
+	// Timeout of PDP request, default is 2 seconds
+	Timeout time.Duration
+	// How long decision is cached, 0 disables caching
+	CacheTTL time.Duration
+	// Max number of cached decisions, default is 10000
+	MaxCacheEntries int
+	// Allow requests when PDP is not available (network error or 5xx status), default is to deny them with 503.
+	// Undefined or invalid decisions are always denied.
+	FailOpen bool
+	// Route templates or path prefixes authorized by PDP. Empty means all routes except operational
+	// endpoints (status, health and metrics).
+	Routes []string
+	// HTTP client, default client is used if nil
+	Client *http.Client
+}
+
+// ExternalAuthorizerOptionsFromViper reads external authorizer options, nil is returned if url is not set
+func ExternalAuthorizerOptionsFromViper(prefix string) *ExternalAuthorizerOptions {
+	url := viper.GetString(prefix + "url")
+	if url == "" {
+		return nil
+	}
+	return &ExternalAuthorizerOptions{
+		URL:             url,
+		Headers:         viper.GetStringMapString(prefix + "headers"),
+		Timeout:         viper.GetDuration(prefix + "timeout"),
+		CacheTTL:        viper.GetDuration(prefix + "cache_ttl"),
+		MaxCacheEntries: viper.GetInt(prefix + "max_cache_entries"),
+		FailOpen:        viper.GetBool(prefix + "fail_open"),
+		Routes:          viper.GetStringSlice(prefix + "routes"),
+	}
+}
+
+// PolicyInput is request sent to policy decision point. It is wrapped in {"input": ...} object, so it can be
+// sent to OPA data API directly.
+type PolicyInput struct {
+	Method string                 `json:"method"`
+	Path   string                 `json:"path"`
+	Route  string                 `json:"route,omitempty"`
+	Query  map[string][]string    `json:"query,omitempty"`
+	User   *UserInfo              `json:"user,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// PolicyDecision is answer of policy decision point. OPA responses {"result": true} and
+// {"result": {"allow": true, "reason": "..."}} are accepted as well. Undefined decision (e.g. OPA response {}
+// for undefined rule) denies the request.
+type PolicyDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *PolicyDecision) UnmarshalJSON(data []byte) (err error) {
+	var response struct {
+		Allow  *bool           `json:"allow"`
+		Reason string          `json:"reason"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err = json.Unmarshal(data, &response); err != nil {
+		return
+	}
+	if response.Allow != nil {
+		d.Allow, d.Reason = *response.Allow, response.Reason
+		return
+	}
+	d.Allow, d.Reason = false, "Policy decision is undefined"
+	if len(response.Result) == 0 || string(response.Result) == "null" {
+		return
+	}
+	if err = json.Unmarshal(response.Result, &d.Allow); err == nil {
+		d.Reason = ""
+		return
+	}
+	var result struct {
+		Allow  *bool  `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err = json.Unmarshal(response.Result, &result); err != nil {
+		return
+	}
+	if result.Allow != nil {
+		d.Allow, d.Reason = *result.Allow, result.Reason
+	}
+	return
+}
+
+// pdpUnavailableError is error of PDP transport, only these errors are subject of FailOpen
+type pdpUnavailableError struct {
+	err error
+}
+
+func (e *pdpUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pdpUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// cachedDecision is decision with its expiration
+type cachedDecision struct {
+	decision PolicyDecision
+	expires  time.Time
+}
+
+// externalAuthorizer object
+type externalAuthorizer struct {
+	options   ExternalAuthorizerOptions
+	logger    *logrus.Logger
+	mutex     sync.Mutex
+	cache     map[string]cachedDecision
+	lastPrune time.Time
+}
+
+// newExternalAuthorizer creates external authorizer middleware
+func newExternalAuthorizer(options *ExternalAuthorizerOptions, logger *logrus.Logger) *externalAuthorizer {
+	ea := &externalAuthorizer{
+		options: *options,
+		logger:  logger,
+		cache:   map[string]cachedDecision{},
+	}
+	if ea.options.Timeout <= 0 {
+		ea.options.Timeout = time.Second * 2
+	}
+	if ea.options.Client == nil {
+		ea.options.Client = http.DefaultClient
+	}
+	if ea.options.MaxCacheEntries <= 0 {
+		ea.options.MaxCacheEntries = 10000
+	}
+	return ea
+}
+
+// operationalRoutes are not authorized by PDP unless they are listed explicitly
+var operationalRoutes = map[string]bool{"/status": true, "/healthz": true, "/readyz": true, "/metrics": true}
+
+// authorizes returns if route is authorized by PDP
+func (ea *externalAuthorizer) authorizes(r *http.Request, route string) bool {
+	if len(ea.options.Routes) == 0 {
+		return !operationalRoutes[serviceRoute(r)]
+	}
+	for _, authorized := range ea.options.Routes {
+		if authorized == route || strings.HasPrefix(r.URL.Path, authorized) {
+			return true
+		}
+	}
+	return false
+}
+
+// cached returns cached decision for key
+func (ea *externalAuthorizer) cached(key string) (decision PolicyDecision, ok bool) {
+	ea.mutex.Lock()
+	defer ea.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(ea.lastPrune) > ea.options.CacheTTL {
+		for k, entry := range ea.cache {
+			if now.After(entry.expires) {
+				delete(ea.cache, k)
+			}
+		}
+		ea.lastPrune = now
+	}
+	entry, ok := ea.cache[key]
+	if !ok || now.After(entry.expires) {
+		return decision, false
+	}
+	return entry.decision, true
+}
+
+// store caches decision, expired entries are pruned and random entry is evicted when cache is full
+func (ea *externalAuthorizer) store(key string, decision PolicyDecision) {
+	ea.mutex.Lock()
+	defer ea.mutex.Unlock()
+	now := time.Now()
+	if len(ea.cache) >= ea.options.MaxCacheEntries {
+		for k, entry := range ea.cache {
+			if now.After(entry.expires) {
+				delete(ea.cache, k)
+			}
+		}
+		ea.lastPrune = now
+	}
+	for k := range ea.cache {
+		if len(ea.cache) < ea.options.MaxCacheEntries {
+			break
+		}
+		delete(ea.cache, k)
+	}
+	ea.cache[key] = cachedDecision{decision: decision, expires: now.Add(ea.options.CacheTTL)}
+}
+
+// decide asks PDP for decision, *pdpUnavailableError is returned if PDP can't be reached
+func (ea *externalAuthorizer) decide(ctx context.Context, input *PolicyInput) (decision PolicyDecision, err error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return
+	}
+
+	var key string
+	if ea.options.CacheTTL > 0 {
+		sum := sha256.Sum256(body)
+		key = hex.EncodeToString(sum[:])
+		var ok bool
+		if decision, ok = ea.cached(key); ok {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ea.options.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ea.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for header, value := range ea.options.Headers {
+		req.Header.Set(header, value)
+	}
+	resp, err := ea.options.Client.Do(req)
+	if err != nil {
+		err = &pdpUnavailableError{err: err}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("policy decision point: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			err = &pdpUnavailableError{err: err}
+		}
+		return
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return
+	}
+
+	if key != "" {
+		ea.store(key, decision)
+	}
+	return
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (ea *externalAuthorizer) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := RouteTemplate(r)
+		if !ea.authorizes(r, route) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		input := &PolicyInput{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Route:  route,
+			Query:  r.URL.Query(),
+		}
+		if userInfo, ok := r.Context().Value(contextTypeUserInfo).(*UserInfo); ok && userInfo != nil &&
+			userInfo != unauthenticatedUser && userInfo != userWithInvalidToken {
+			input.User = &UserInfo{UserID: userInfo.UserID, Email: userInfo.Email, Scopes: userInfo.Scopes, Groups: userInfo.Groups}
+			input.Claims = userInfo.Claims
+		}
+
+		logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+		decision, err := ea.decide(r.Context(), input)
+		var unavailable *pdpUnavailableError
+		switch {
+		case errors.As(err, &unavailable):
+			if ea.logger != nil {
+				ea.logger.WithError(err).WithField("fail_open", ea.options.FailOpen).Error("policy decision point is not available")
+			}
+			if !ea.options.FailOpen {
+				processHTTPError(ServerErrorWithoutStack(err, http.StatusServiceUnavailable, "Authorization service unavailable"), w, r, logger, nil)
+				return
+			}
+			decision.Allow = true
+		case err != nil:
+			// Invalid decision is never turned into allow
+			if ea.logger != nil {
+				ea.logger.WithError(err).Error("invalid policy decision")
+			}
+			decision = PolicyDecision{Reason: "Forbidden"}
+		}
+
+		if !decision.Allow {
+			message := "Forbidden"
+			if decision.Reason != "" {
+				message = decision.Reason
+			}
+			processHTTPError(ServerErrorWithoutStack(nil, http.StatusForbidden, message), w, r, logger, nil)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
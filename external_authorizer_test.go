@@ -0,0 +1,88 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExternalAuthorizerDecisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		failOpen bool
+		expected int
+	}{
+		{"allow", http.StatusOK, `{"allow":true}`, false, http.StatusOK},
+		{"deny", http.StatusOK, `{"allow":false,"reason":"nope"}`, true, http.StatusForbidden},
+		{"OPA boolean result", http.StatusOK, `{"result":true}`, false, http.StatusOK},
+		{"OPA object result", http.StatusOK, `{"result":{"allow":true}}`, false, http.StatusOK},
+		{"OPA undefined result", http.StatusOK, `{}`, true, http.StatusForbidden},
+		{"OPA null result", http.StatusOK, `{"result":null}`, true, http.StatusForbidden},
+		{"OPA result without allow", http.StatusOK, `{"result":{"reason":"x"}}`, true, http.StatusForbidden},
+		{"invalid JSON", http.StatusOK, `allow`, true, http.StatusForbidden},
+		{"invalid result", http.StatusOK, `{"result":"yes"}`, true, http.StatusForbidden},
+		{"policy error", http.StatusBadRequest, `{"code":"invalid_parameter"}`, true, http.StatusForbidden},
+		{"unavailable", http.StatusServiceUnavailable, ``, false, http.StatusServiceUnavailable},
+		{"unavailable fail open", http.StatusServiceUnavailable, ``, true, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			}))
+			defer pdp.Close()
+			ea := newExternalAuthorizer(&ExternalAuthorizerOptions{URL: pdp.URL, FailOpen: test.failOpen}, nil)
+			if got := serveAuthorized(ea, "/items"); got != test.expected {
+				t.Fatalf("expected status %d, got %d", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestExternalAuthorizerFailOpenOnlyForTransportErrors(t *testing.T) {
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := pdp.URL
+	pdp.Close()
+	ea := newExternalAuthorizer(&ExternalAuthorizerOptions{URL: url, FailOpen: true, Timeout: time.Second}, nil)
+	if got := serveAuthorized(ea, "/items"); got != http.StatusOK {
+		t.Fatalf("expected fail open, got %d", got)
+	}
+}
+
+func TestExternalAuthorizerCacheIsBounded(t *testing.T) {
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"allow":true}`)
+	}))
+	defer pdp.Close()
+	ea := newExternalAuthorizer(&ExternalAuthorizerOptions{URL: pdp.URL, CacheTTL: time.Hour, MaxCacheEntries: 3}, nil)
+	for i := 0; i < 20; i++ {
+		serveAuthorized(ea, fmt.Sprintf("/items/%d", i))
+	}
+	if len(ea.cache) > 3 {
+		t.Fatalf("cache has %d entries", len(ea.cache))
+	}
+}
+
+func TestExternalAuthorizerSkipsOperationalRoutesBehindStripPath(t *testing.T) {
+	ea := newExternalAuthorizer(&ExternalAuthorizerOptions{URL: "http://127.0.0.1:1"}, nil)
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	ctx := context.WithValue(req.Context(), contextTypeStripPath, "/api/")
+	ctx = context.WithValue(ctx, contextTypeRouteTemplate, &requestRoute{template: "/api/status"})
+	if ea.authorizes(req.WithContext(ctx), "/api/status") {
+		t.Fatal("operational route is authorized by PDP")
+	}
+}
+
+// serveAuthorized returns status of request passed through external authorizer
+func serveAuthorized(ea *externalAuthorizer, path string) int {
+	handler := ea.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code
+}
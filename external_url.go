@@ -0,0 +1,131 @@
+package webservice
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ExternalPrefix returns path prefix under which the service is reachable from outside - combination
+// of X-Forwarded-Prefix header (set by trusted reverse proxy that strips the prefix) and configured strip path
+func ExternalPrefix(r *http.Request) string {
+	prefix := ""
+	if fromTrustedProxy(r) {
+		prefix = strings.TrimRight(r.Header.Get("X-Forwarded-Prefix"), "/")
+	}
+	if stripPath, ok := r.Context().Value(contextTypeStripPath).(string); ok {
+		prefix += strings.TrimRight(stripPath, "/")
+	}
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// ExternalURL builds absolute URL for given path as seen by the client behind reverse proxy
+// (X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix headers are respected only from trusted proxies,
+// see SetTrustedProxies() - clients could redirect users to any host otherwise).
+// Path is relative to the service root - e.g. "/users/1" -> "https://mydomain.com/api/users/1"
+func ExternalURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if fromTrustedProxy(r) {
+		if proto := firstHeaderValue(r.Header.Get("X-Forwarded-Proto")); proto != "" {
+			scheme = proto
+		}
+		if fwdHost := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+
+	return scheme + "://" + host + ExternalPath(r, path)
+}
+
+// ExternalPath returns path prefixed with external prefix (see ExternalPrefix())
+func ExternalPath(r *http.Request, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return ExternalPrefix(r) + path
+}
+
+// firstHeaderValue returns first value of comma separated header (proxies append values)
+func firstHeaderValue(value string) string {
+	if idx := strings.Index(value, ","); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
+
+// externalURLMiddleware stores strip path in request context and optionally rewrites
+// root-relative Location headers to include external prefix
+func externalURLMiddleware(stripPath string, rewriteLocation bool) func(h http.Handler) http.Handler {
+	if stripPath == "/" {
+		stripPath = ""
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), contextTypeStripPath, stripPath))
+			if rewriteLocation {
+				if prefix := ExternalPrefix(r); prefix != "" {
+					w = &locationRewriter{ResponseWriter: w, prefix: prefix}
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// locationRewriter prefixes root-relative Location header before headers are written
+type locationRewriter struct {
+	http.ResponseWriter
+	prefix      string
+	wroteHeader bool
+}
+
+func (lr *locationRewriter) rewrite() {
+	if lr.wroteHeader {
+		return
+	}
+	lr.wroteHeader = true
+	location := lr.Header().Get("Location")
+	if strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") &&
+		location != lr.prefix && !strings.HasPrefix(location, lr.prefix+"/") {
+		lr.Header().Set("Location", lr.prefix+location)
+	}
+}
+
+// WriteHeader implements http.ResponseWriter
+func (lr *locationRewriter) WriteHeader(status int) {
+	lr.rewrite()
+	lr.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (lr *locationRewriter) Write(b []byte) (int, error) {
+	lr.rewrite()
+	return lr.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if underlying writer supports it
+func (lr *locationRewriter) Flush() {
+	if f, ok := lr.ResponseWriter.(http.Flusher); ok {
+		lr.rewrite()
+		f.Flush()
+	}
+}
+
+// Unwrap returns original response writer
+func (lr *locationRewriter) Unwrap() http.ResponseWriter {
+	return lr.ResponseWriter
+}
+
+// Hijack implements http.Hijacker if underlying writer supports it
+func (lr *locationRewriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(lr.ResponseWriter).Hijack()
+}
@@ -0,0 +1,36 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternalURLTrustsForwardedHeadersOnlyFromTrustedProxies(t *testing.T) {
+	trustedNets, _ := parseTrustedProxies([]string{"10.0.0.1"})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		url        string
+	}{
+		{"client", "203.0.113.1:1234", "http://service.local/jobs/1"},
+		{"trusted proxy", "10.0.0.1:1234", "https://example.com/api/jobs/1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://service.local/", nil)
+			req.RemoteAddr = test.remoteAddr
+			req.Header.Set("X-Forwarded-Host", "example.com")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Prefix", "/api")
+			var url string
+			handler := clientAddressMiddleware(trustedNets)(externalURLMiddleware("", false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				url = ExternalURL(r, "/jobs/1")
+			})))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if url != test.url {
+				t.Fatalf("expected %s, got %s", test.url, url)
+			}
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package webservice
 
 import (
+	"encoding/json"
+	goflag "flag"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -9,24 +14,40 @@ import (
 	"github.com/spf13/viper"
 )
 
+// printConfig writes configuration settings with masked secrets as JSON
+func printConfig(settings map[string]interface{}, out io.Writer) (err error) {
+	config, err := json.MarshalIndent(MaskSecrets(settings), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to print configuration: %w", err)
+	}
+	_, err = fmt.Fprintln(out, string(config))
+	return
+}
+
 func FastConfig(s WebService) {
 
 	logger := logrus.New()
 
 	// Set default values
 	viper.SetDefault("listen_address", ":8080")
+	viper.SetDefault("operational_cache_ttl", "1s")
 
 	viper.SetConfigName("config") // name of the config file
 	viper.AddConfigPath(".")      // Path where to search for config file
 	viper.AutomaticEnv()          // merge environment variables into config
 
 	// define command line parameters
-	pflag.String("log_level", "warning", "Log level")
-	pflag.String("listen_address", ":8080", "Listen address")
+	defineFlags(pflag.CommandLine)
 
 	// Init viper and read config
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	pflag.Parse()
+	if !pflag.Parsed() {
+		// Flags of go test binary are not known to pflag
+		if goflag.Lookup("test.v") != nil {
+			pflag.CommandLine.ParseErrorsWhitelist.UnknownFlags = true
+		}
+		pflag.Parse()
+	}
 	viper.BindPFlags(pflag.CommandLine)
 	err := viper.ReadInConfig()
 
@@ -67,6 +88,11 @@ func FastConfig(s WebService) {
 		logger.WithField("config_file", viper.ConfigFileUsed()).Printf("Using config file")
 	}
 
+	AddMaskPatterns(viper.GetStringSlice("mask_patterns")...)
+	if viper.GetBool("print-config") {
+		s.SetPrintConfig(viper.AllSettings())
+	}
+
 	logLevel, _ := logrus.ParseLevel(viper.GetString("log_level"))
 	logger.WithField("log_level", logLevel).Print("Log level set")
 	logger.SetLevel(logLevel)
@@ -76,10 +102,79 @@ func FastConfig(s WebService) {
 
 	// Configure web service
 	s.SetListenAddress(viper.GetString("listen_address"))
+	if socketMode := viper.GetString("listen_socket_mode"); socketMode != "" {
+		// Octal permissions have to be quoted in YAML ("0660")
+		mode, modeErr := strconv.ParseUint(socketMode, 8, 32)
+		if modeErr != nil {
+			logger.WithError(modeErr).Error("Invalid listen_socket_mode, octal permissions are expected")
+		} else {
+			s.SetListenSocketMode(os.FileMode(mode))
+		}
+	}
 
 	s.EnableCors(CorsOptionsFromViper("cors."))
 	s.StripPath(viper.GetString("strip_path"))
+	s.RewriteRedirects(viper.GetBool("rewrite_redirects"))
 	s.SetLogger(logger)
 	s.EnablePrometheusMetrics(!viper.GetBool("disable_prometheus_metrics"))
+	s.SetRouteMetrics(RouteMetricsOptionsFromViper("metrics.routes"))
 	s.EnableAuthorization(AuthorizationOptionsFromViper("authorization."))
+	if viper.IsSet("warmup_timeout") {
+		s.SetWarmupTimeout(viper.GetDuration("warmup_timeout"))
+	}
+	s.SetShutdownDelay(viper.GetDuration("shutdown_delay"))
+	s.SetShutdownTimeout(viper.GetDuration("shutdown_timeout"))
+	s.EnableMirroring(MirrorOptionsFromViper("mirror."))
+	s.SetDevMode(viper.GetBool("dev_mode"))
+	s.EnableChaos(ChaosOptionsFromViper("chaos."))
+	s.EnableRecorder(RecorderOptionsFromViper("recorder."))
+	s.EnableQuotas(QuotaOptionsFromViper("quota."))
+	s.EnableJobs(JobOptionsFromViper("jobs."))
+	s.EnableServiceDiscovery(ServiceDiscoveryOptionsFromViper("service_discovery."))
+	s.EnableDeadlines(viper.GetBool("deadlines.enabled"), viper.GetDuration("deadlines.max_timeout"))
+	s.EnableGeo(GeoOptionsFromViper("geo."))
+	s.EnableBotDetection(BotOptionsFromViper("bot_detection."))
+	s.EnableTokenRefresh(TokenRefreshOptionsFromViper("auth_refresh."))
+	s.EnableSelfCheck(SelfCheckOptionsFromViper())
+	s.EnableStrictInput(StrictOptionsFromViper("strict_input."))
+	s.SetOperationalCacheTTL(viper.GetDuration("operational_cache_ttl"))
+	s.EnableCircuitBreaker(CircuitBreakerOptionsFromViper("circuit_breaker."))
+	s.EnableLoadShedding(QoSOptionsFromViper("qos."))
+	s.EnableAdaptiveLimit(AdaptiveLimitOptionsFromViper("adaptive_limit."))
+	s.SetUserProvisioningTTL(viper.GetDuration("user_provisioning_ttl"))
+	s.EnableBruteForceProtection(BruteForceOptionsFromViper("brute_force."))
+	s.EnableHTTP3(HTTP3OptionsFromViper("http3."))
+	s.EnableProxyProtocol(ProxyProtocolOptionsFromViper("proxy_protocol."))
+	s.SetTrustedProxies(viper.GetStringSlice("trusted_proxies"))
+	s.SetConnectionLimits(ConnectionOptionsFromViper("connections."))
+	s.SetHeaderLimits(HeaderLimitOptionsFromViper("header_limits."))
+	s.EnableTenants(TenantOptionsFromViper("tenants."))
+	s.EnableServiceManifest(ManifestOptionsFromViper("manifest."))
+	s.SetJSONOptions(JSONOptionsFromViper("json."))
+	s.EnableProfiling(ProfilingOptionsFromViper("profiling."))
+	s.EnableWatchdog(WatchdogOptionsFromViper("watchdog."))
+	s.SetAPIDump(viper.GetString("dump-api"))
+	s.EnableRouteDiff(RouteDiffOptionsFromViper("route_diff."))
+
+	emitLifecycleEvent(s, &LifecycleEvent{Stage: StageConfigLoaded})
+}
+
+// defineFlags registers command line flags of FastConfig. Flags defined already (by previous FastConfig call or
+// by application) are kept, so FastConfig can be called repeatedly, e.g. in tests.
+func defineFlags(flags *pflag.FlagSet) {
+	if flags.Lookup("log_level") == nil {
+		flags.String("log_level", "warning", "Log level")
+	}
+	if flags.Lookup("listen_address") == nil {
+		flags.String("listen_address", ":8080", "Listen address")
+	}
+	if flags.Lookup("selfcheck") == nil {
+		flags.Bool("selfcheck", false, "Start service, check its endpoints and exit with non-zero status on failure")
+	}
+	if flags.Lookup("print-config") == nil {
+		flags.Bool("print-config", false, "Print effective configuration with masked secrets and exit")
+	}
+	if flags.Lookup("dump-api") == nil {
+		flags.String("dump-api", "", "Print routes with their scope requirements (markdown or json) and exit")
+	}
 }
@@ -0,0 +1,322 @@
+package webservice
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ftpTimeout is deadline of single FTP/SFTP operation, content of file is read with this timeout per read
+const ftpTimeout = 30 * time.Second
+
+// readError returns error of aborted read - error of ctx if it is done (its deadline may be reached before ctx is
+// marked as done)
+func readError(ctx context.Context, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// operationDeadline returns deadline of operation, deadline of ctx is used if it is sooner than ftpTimeout
+func operationDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(ftpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	return deadline
+}
+
+// ftpSource is directory on FTP server (passive mode, binary transfers). Control connection is kept between
+// operations and it is re-established after error.
+type ftpSource struct {
+	addr     string
+	username string
+	password string
+	dir      string
+	mu       sync.Mutex
+	raw      net.Conn
+	conn     *textproto.Conn
+}
+
+// NewFTPSource returns file source of FTP directory, default port is 21 and default user is anonymous
+func NewFTPSource(addr string, username string, password string, dir string) FileSource {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "21")
+	}
+	if username == "" {
+		username = "anonymous"
+	}
+	return &ftpSource{addr: addr, username: username, password: password, dir: dir}
+}
+
+// List implements FileSource - MLSD is used, servers without MLSD support return names only (NLST)
+func (s *ftpSource) List(ctx context.Context) (files []RemoteFile, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetOnError(&err)
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+
+	mlsd := true
+	data, err := s.transfer(ctx, "MLSD")
+	if err != nil {
+		if protoErr, ok := err.(*textproto.Error); !ok || protoErr.Code < 500 {
+			return
+		}
+		mlsd = false
+		if data, err = s.transfer(ctx, "NLST"); err != nil {
+			return
+		}
+	}
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if !mlsd {
+			files = append(files, RemoteFile{Name: path.Base(line)})
+			continue
+		}
+		if file, ok := parseMLSDLine(line); ok {
+			files = append(files, file)
+		}
+	}
+	data.Close()
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	_, _, err = s.conn.ReadResponse(2)
+	return
+}
+
+// parseMLSDLine parses facts of MLSD entry, only files are returned
+func parseMLSDLine(line string) (file RemoteFile, ok bool) {
+	facts, name, found := strings.Cut(line, " ")
+	if !found {
+		return
+	}
+	file.Name = name
+	for _, fact := range strings.Split(facts, ";") {
+		key, value, _ := strings.Cut(fact, "=")
+		switch strings.ToLower(key) {
+		case "type":
+			ok = strings.EqualFold(value, "file")
+		case "size":
+			file.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "modify":
+			file.ModTime, _ = time.Parse("20060102150405", value[:min(len(value), 14)])
+		}
+	}
+	return
+}
+
+// Open implements FileSource - control connection is locked until content is closed
+func (s *ftpSource) Open(ctx context.Context, name string) (content io.ReadCloser, err error) {
+	s.mu.Lock()
+	defer func() {
+		if err != nil {
+			s.resetOnError(&err)
+			s.mu.Unlock()
+		}
+	}()
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+	data, err := s.transfer(ctx, "RETR %s", name)
+	if err != nil {
+		return
+	}
+	// Server may not answer until transfer is finished
+	s.raw.SetDeadline(time.Time{})
+	return &ftpReader{source: s, data: data, ctx: ctx, stop: context.AfterFunc(ctx, func() { data.Close() })}, nil
+}
+
+// Rename implements FileSource
+func (s *ftpSource) Rename(ctx context.Context, from string, to string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetOnError(&err)
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+	if dir := path.Dir(to); dir != "." {
+		// Directory may exist already
+		if _, _, err = s.cmd(2, "MKD %s", dir); err != nil {
+			if _, ok := err.(*textproto.Error); !ok {
+				return
+			}
+		}
+	}
+	if _, _, err = s.cmd(3, "RNFR %s", from); err != nil {
+		return
+	}
+	_, _, err = s.cmd(2, "RNTO %s", to)
+	return
+}
+
+// connect opens and logs in control connection if it is not open
+func (s *ftpSource) connect(ctx context.Context) (err error) {
+	if s.conn != nil {
+		return s.setDeadline(ctx)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, ftpTimeout)
+	defer cancel()
+	if s.raw, err = (&net.Dialer{}).DialContext(dialCtx, "tcp", s.addr); err != nil {
+		return
+	}
+	s.conn = textproto.NewConn(s.raw)
+	if err = s.setDeadline(ctx); err != nil {
+		return
+	}
+	if _, _, err = s.conn.ReadResponse(2); err != nil {
+		return
+	}
+	code, _, err := s.cmd(0, "USER %s", s.username)
+	if err == nil && code == 331 {
+		code, _, err = s.cmd(0, "PASS %s", s.password)
+	}
+	if err != nil {
+		return
+	}
+	if code != 230 && code != 202 {
+		return fmt.Errorf("ftp login failed (%d)", code)
+	}
+	if _, _, err = s.cmd(2, "TYPE I"); err != nil {
+		return
+	}
+	if s.dir != "" {
+		_, _, err = s.cmd(2, "CWD %s", s.dir)
+	}
+	return
+}
+
+// setDeadline sets deadline of operation on control connection
+func (s *ftpSource) setDeadline(ctx context.Context) error {
+	return s.raw.SetDeadline(operationDeadline(ctx))
+}
+
+// cmd sends command and reads response, expectCode is checked like in textproto.Conn.ReadResponse (0 accepts any
+// response code)
+func (s *ftpSource) cmd(expectCode int, format string, args ...interface{}) (code int, message string, err error) {
+	id, err := s.conn.Cmd(format, args...)
+	if err != nil {
+		return
+	}
+	s.conn.StartResponse(id)
+	defer s.conn.EndResponse(id)
+	return s.conn.ReadResponse(expectCode)
+}
+
+// transfer opens passive data connection (EPSV, PASV as fallback) and sends command with data transfer
+func (s *ftpSource) transfer(ctx context.Context, format string, args ...interface{}) (data net.Conn, err error) {
+	host, _, _ := net.SplitHostPort(s.addr)
+	var port int
+	_, message, err := s.cmd(2, "EPSV")
+	if err == nil {
+		// 229 Entering Extended Passive Mode (|||port|)
+		start := strings.Index(message, "(|||")
+		end := strings.LastIndex(message, "|)")
+		if start < 0 || end < start+4 {
+			return nil, fmt.Errorf("unexpected EPSV response: %s", message)
+		}
+		port, err = strconv.Atoi(message[start+4 : end])
+	} else if _, ok := err.(*textproto.Error); ok {
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2) - address is ignored, server may be behind NAT
+		if _, message, err = s.cmd(2, "PASV"); err != nil {
+			return
+		}
+		start := strings.Index(message, "(")
+		end := strings.LastIndex(message, ")")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("unexpected PASV response: %s", message)
+		}
+		parts := strings.Split(message[start+1:end], ",")
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("unexpected PASV response: %s", message)
+		}
+		high, _ := strconv.Atoi(parts[4])
+		low, _ := strconv.Atoi(parts[5])
+		port = high<<8 | low
+	}
+	if err != nil {
+		return
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, ftpTimeout)
+	defer cancel()
+	if data, err = (&net.Dialer{}).DialContext(dialCtx, "tcp", net.JoinHostPort(host, strconv.Itoa(port))); err != nil {
+		return
+	}
+	if _, _, err = s.cmd(1, format, args...); err != nil {
+		data.Close()
+		return nil, err
+	}
+	return
+}
+
+// resetOnError closes control connection after error, so it is re-established by next operation
+func (s *ftpSource) resetOnError(err *error) {
+	if *err == nil || s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	s.conn = nil
+}
+
+// ftpReader is content of downloaded file, closing it finishes transfer and unlocks control connection. Each read
+// has to finish within ftpTimeout (and before deadline of ctx), transfer is aborted when ctx is cancelled.
+type ftpReader struct {
+	source *ftpSource
+	data   net.Conn
+	ctx    context.Context
+	stop   func() bool
+	// err is error of aborted transfer
+	err error
+}
+
+// Read implements io.Reader
+func (r *ftpReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.data.SetReadDeadline(operationDeadline(r.ctx))
+	n, err = r.data.Read(p)
+	if err = readError(r.ctx, err); err != nil && err != io.EOF {
+		r.err = err
+	}
+	return
+}
+
+// Close implements io.Closer
+func (r *ftpReader) Close() (err error) {
+	defer r.source.mu.Unlock()
+	defer r.source.resetOnError(&err)
+	r.data.Close()
+	if !r.stop() && r.err == nil {
+		r.err = r.ctx.Err()
+	}
+	if r.err != nil {
+		// Transfer was aborted, control connection is closed
+		return r.err
+	}
+	r.source.setDeadline(context.Background())
+	_, _, err = r.source.conn.ReadResponse(2)
+	return
+}
@@ -0,0 +1,99 @@
+package webservice
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startStalledFTPServer starts FTP server which sends beginning of every file and then stalls
+func startStalledFTPServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		data.Close()
+	})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "220 ready\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command, _, _ := strings.Cut(strings.TrimSpace(line), " "); command {
+			case "USER":
+				fmt.Fprint(conn, "230 logged in\r\n")
+			case "EPSV":
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", data.Addr().(*net.TCPAddr).Port)
+			case "RETR":
+				dataConn, err := data.Accept()
+				if err != nil {
+					return
+				}
+				defer dataConn.Close()
+				fmt.Fprint(conn, "150 opening data connection\r\n")
+				fmt.Fprint(dataConn, "partial")
+			default:
+				fmt.Fprint(conn, "200 ok\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestFTPReaderHonorsContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		cancel bool
+	}{
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Millisecond*200)
+		}, false},
+		{"cancel", func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewFTPSource(startStalledFTPServer(t), "", "", "")
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			content, err := source.Open(ctx, "data.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.cancel {
+				time.AfterFunc(time.Millisecond*200, cancel)
+			}
+			start := time.Now()
+			buf := make([]byte, 100)
+			for err == nil {
+				_, err = content.Read(buf)
+			}
+			if time.Since(start) > time.Second*5 {
+				t.Fatalf("read was not aborted in time (%v)", err)
+			}
+			if content.Close() == nil {
+				t.Fatal("expected error of aborted transfer")
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// GeoInfo contains geo/ASN data of client IP
+type GeoInfo struct {
+	IP           string `json:"ip"`
+	Country      string `json:"country,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// GeoResolver resolves geo/ASN data of IP address (e.g. adapter for MaxMind GeoIP2/GeoLite2 database)
+type GeoResolver interface {
+	Resolve(ip net.IP) (*GeoInfo, error)
+}
+
+// GeoDatabaseOpener opens GeoResolver from database file - set it (e.g. to MaxMind reader adapter) to allow
+// configuring database path by GeoOptionsFromViper()
+var GeoDatabaseOpener func(path string) (GeoResolver, error)
+
+// GeoOptions for client IP enrichment, client IP is resolved by ClientIP()
+type GeoOptions struct {
+	Resolver GeoResolver
+	// Database file opened by GeoDatabaseOpener if Resolver is not set
+	Database string
+}
+
+// GeoOptionsFromViper reads geo options (database), nil is returned if database is not configured
+func GeoOptionsFromViper(prefix string) *GeoOptions {
+	path := viper.GetString(prefix + "database")
+	if path == "" {
+		return nil
+	}
+	return &GeoOptions{Database: path}
+}
+
+// Validate opens database if resolver is not set - service doesn't start without working resolver
+func (o *GeoOptions) Validate() (err error) {
+	if o.Resolver != nil {
+		return
+	}
+	if o.Database == "" {
+		return fmt.Errorf("geo resolver or database is required")
+	}
+	if GeoDatabaseOpener == nil {
+		return fmt.Errorf("geo database %s is configured, but GeoDatabaseOpener is not set", o.Database)
+	}
+	if o.Resolver, err = GeoDatabaseOpener(o.Database); err != nil {
+		return fmt.Errorf("unable to open geo database %s: %w", o.Database, err)
+	}
+	return
+}
+
+// GeoInfoFromContext returns geo info of client resolved by geo middleware (nil if not available)
+func GeoInfoFromContext(ctx context.Context) *GeoInfo {
+	geo, _ := ctx.Value(contextTypeGeoInfo).(*GeoInfo)
+	return geo
+}
+
+// geo object
+type geo struct {
+	options GeoOptions
+	logger  *logrus.Logger
+}
+
+// newGeoMiddleware creates geo middleware
+func newGeoMiddleware(options *GeoOptions, logger *logrus.Logger) *geo {
+	return &geo{
+		options: *options,
+		logger:  logger,
+	}
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (g *geo) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := ClientIP(r)
+		ip := net.ParseIP(clientIP)
+		if ip == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		info, err := g.options.Resolver.Resolve(ip)
+		if err != nil {
+			if g.logger != nil {
+				g.logger.WithError(err).WithField("ip", clientIP).Debugf("unable to resolve geo info")
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		if info != nil {
+			info.IP = clientIP
+			r = r.WithContext(context.WithValue(r.Context(), contextTypeGeoInfo, info))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
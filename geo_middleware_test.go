@@ -0,0 +1,55 @@
+package webservice
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type staticGeoResolver struct{}
+
+func (staticGeoResolver) Resolve(ip net.IP) (*GeoInfo, error) {
+	return &GeoInfo{Country: "CZ"}, nil
+}
+
+func TestGeoOptionsValidate(t *testing.T) {
+	defer func(opener func(path string) (GeoResolver, error)) { GeoDatabaseOpener = opener }(GeoDatabaseOpener)
+	tests := []struct {
+		name    string
+		options GeoOptions
+		opener  func(path string) (GeoResolver, error)
+		valid   bool
+	}{
+		{"resolver", GeoOptions{Resolver: staticGeoResolver{}}, nil, true},
+		{"nothing configured", GeoOptions{}, nil, false},
+		{"database without opener", GeoOptions{Database: "geo.mmdb"}, nil, false},
+		{"invalid database", GeoOptions{Database: "geo.mmdb"}, func(string) (GeoResolver, error) { return nil, errors.New("invalid") }, false},
+		{"database", GeoOptions{Database: "geo.mmdb"}, func(string) (GeoResolver, error) { return staticGeoResolver{}, nil }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			GeoDatabaseOpener = test.opener
+			if err := test.options.Validate(); (err == nil) != test.valid {
+				t.Fatalf("expected valid %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestGeoUsesTrustedClientIP(t *testing.T) {
+	trustedNets, _ := parseTrustedProxies([]string{"10.0.0.1"})
+	var info *GeoInfo
+	handler := clientAddressMiddleware(trustedNets)(newGeoMiddleware(&GeoOptions{Resolver: staticGeoResolver{}}, nil).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info = GeoInfoFromContext(r.Context())
+		})))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if info == nil || info.IP != "203.0.113.1" {
+		t.Fatalf("unexpected geo info %+v", info)
+	}
+}
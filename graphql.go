@@ -0,0 +1,318 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// maxGraphQLBodySize is max size of GraphQL request
+const maxGraphQLBodySize = 1 << 20
+
+// GraphQLOptions is a configuration container for GraphQL handler
+type GraphQLOptions struct {
+	// Required scopes per operation name or operation type (query, mutation, subscription).
+	// User needs at least one of listed scopes. Operation names are chosen by client, so operations are protected
+	// reliably only by scopes of operation type.
+	OperationScopes map[string][]string
+	// Max nesting depth of selection sets, zero means unlimited
+	MaxDepth int
+	// Max number of selected fields, zero means unlimited
+	MaxComplexity int
+}
+
+// GraphQLOptionsFromViper reads GraphQL options (max_depth, max_complexity, operation_scopes)
+func GraphQLOptionsFromViper(prefix string) (options *GraphQLOptions) {
+	options = &GraphQLOptions{
+		MaxDepth:      viper.GetInt(prefix + "max_depth"),
+		MaxComplexity: viper.GetInt(prefix + "max_complexity"),
+	}
+	viper.UnmarshalKey(prefix+"operation_scopes", &options.OperationScopes)
+	return
+}
+
+// graphQLRequest is body of GraphQL request
+type graphQLRequest struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// ContextWithUserInfo returns context with user info, so it can be read in places without access to request (e.g. resolvers)
+func ContextWithUserInfo(ctx context.Context, userInfo *UserInfo) context.Context {
+	return context.WithValue(ctx, contextTypeResolvedUserInfo, userInfo)
+}
+
+// UserInfoFromContext returns user info resolved by AppHandler (nil for anonymous users)
+func UserInfoFromContext(ctx context.Context) *UserInfo {
+	userInfo, _ := ctx.Value(contextTypeResolvedUserInfo).(*UserInfo)
+	return userInfo
+}
+
+// GraphQLHandler mounts GraphQL server handler (gqlgen, graphql-go, ...) with authorization of AppHandler.
+// UserInfo is available in resolvers with UserInfoFromContext(), operations are checked against scopes
+// and query depth/complexity limits before the request reaches GraphQL server.
+func GraphQLHandler(graphQLHandler http.Handler, options *GraphQLOptions) Handler {
+	if options == nil {
+		options = &GraphQLOptions{}
+	}
+	return AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		var requests []graphQLRequest
+		if r.Method == http.MethodGet {
+			requests = []graphQLRequest{{Query: r.URL.Query().Get("query"), OperationName: r.URL.Query().Get("operationName")}}
+		} else {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLBodySize+1))
+			if err != nil {
+				return ServerError(err, http.StatusBadRequest, "Unable to read request")
+			}
+			if len(body) > maxGraphQLBodySize {
+				return ServerError(nil, http.StatusRequestEntityTooLarge, "Request too large")
+			}
+			if requests, err = parseGraphQLRequests(body, r.Header.Get("Content-Type")); err != nil {
+				return ServerErrorWithoutStack(err, http.StatusBadRequest, "Invalid GraphQL request")
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		// All operations of batch are checked, batch is rejected if any of them is not allowed
+		for _, req := range requests {
+			if err := checkGraphQLRequest(req, options, userInfo); err != nil {
+				return err
+			}
+		}
+
+		graphQLHandler.ServeHTTP(w, r.WithContext(ContextWithUserInfo(r.Context(), userInfo)))
+		return nil
+	})
+}
+
+// parseGraphQLRequests parses single or batched JSON request, application/graphql body or multipart request
+// (operations field of GraphQL multipart request spec)
+func parseGraphQLRequests(body []byte, contentType string) ([]graphQLRequest, error) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/graphql":
+		return []graphQLRequest{{Query: string(body)}}, nil
+	case "multipart/form-data":
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return nil, fmt.Errorf("multipart request without operations field")
+			}
+			if part.FormName() == "operations" {
+				operations, err := io.ReadAll(part)
+				if err != nil {
+					return nil, err
+				}
+				return parseGraphQLRequests(operations, "application/json")
+			}
+		}
+	}
+
+	var requests []graphQLRequest
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &requests); err != nil {
+			return nil, err
+		}
+		if len(requests) == 0 {
+			return nil, fmt.Errorf("empty batch")
+		}
+		return requests, nil
+	}
+	var req graphQLRequest
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return nil, err
+	}
+	return []graphQLRequest{req}, nil
+}
+
+// checkGraphQLRequest checks query limits and scopes of executed operation. Requests without query (e.g. persisted
+// query hashes) are rejected, because they can't be checked.
+func checkGraphQLRequest(req graphQLRequest, options *GraphQLOptions, userInfo *UserInfo) error {
+	if strings.TrimSpace(req.Query) == "" {
+		return ServerErrorWithoutStack(nil, http.StatusBadRequest, "Missing GraphQL query")
+	}
+	stats := analyzeGraphQLQuery(req.Query)
+	operation, err := stats.operation(req.OperationName)
+	if err != nil {
+		return ServerErrorWithoutStack(err, http.StatusBadRequest, "Invalid GraphQL request")
+	}
+	if options.MaxDepth > 0 && stats.depth > options.MaxDepth {
+		return ServerError(fmt.Errorf("query depth %d exceeds limit %d", stats.depth, options.MaxDepth), http.StatusBadRequest, "Query too complex")
+	}
+	if options.MaxComplexity > 0 && stats.fields > options.MaxComplexity {
+		return ServerError(fmt.Errorf("query complexity %d exceeds limit %d", stats.fields, options.MaxComplexity), http.StatusBadRequest, "Query too complex")
+	}
+
+	for _, key := range []string{operation.operationType, operation.name} {
+		scopes, ok := options.OperationScopes[key]
+		if !ok || key == "" {
+			continue
+		}
+		if !hasAnyScope(userInfo, scopes) {
+			if userInfo == nil {
+				return ServerError(nil, http.StatusUnauthorized, "Unauthorized")
+			}
+			return ServerError(nil, http.StatusForbidden, "Forbidden")
+		}
+	}
+	return nil
+}
+
+// hasAnyScope returns if user has at least one of scopes
+func hasAnyScope(userInfo *UserInfo, scopes []string) bool {
+	for _, scope := range scopes {
+		if scope == "" || scope == "*" {
+			return true
+		}
+		if userInfo != nil && userInfo.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// graphQLOperation is operation defined in query document
+type graphQLOperation struct {
+	operationType string
+	name          string
+}
+
+// graphQLQueryStats contains result of lightweight query analysis
+type graphQLQueryStats struct {
+	operations []graphQLOperation
+	depth      int
+	fields     int
+}
+
+// operation returns operation executed for operationName - named operation has to be defined in document,
+// document without operationName has to contain single operation
+func (stats *graphQLQueryStats) operation(operationName string) (graphQLOperation, error) {
+	if operationName == "" {
+		if len(stats.operations) != 1 {
+			return graphQLOperation{}, fmt.Errorf("operationName is required for document with %d operations", len(stats.operations))
+		}
+		return stats.operations[0], nil
+	}
+	for _, operation := range stats.operations {
+		if operation.name == operationName {
+			return operation, nil
+		}
+	}
+	return graphQLOperation{}, fmt.Errorf("operation %q is not defined in query", operationName)
+}
+
+// analyzeGraphQLQuery finds operations and computes nesting depth and number of selected fields. It is lexical
+// analysis (not full parser), fragments are counted where they are defined.
+func analyzeGraphQLQuery(query string) (stats graphQLQueryStats) {
+	depth := 0
+	parens := 0
+	// names of definition (before its selection set) at top level
+	var tokens []string
+	expectAlias := false
+	lastName := ""
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(query[i+3:], `"""`)
+			if end < 0 {
+				return
+			}
+			i += end + 6
+		case c == '"':
+			i++
+			for i < len(query) && query[i] != '"' {
+				if query[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case c == '{':
+			if depth == 0 {
+				stats.addDefinition(tokens)
+				tokens = nil
+			}
+			depth++
+			if depth > stats.depth {
+				stats.depth = depth
+			}
+			i++
+		case c == '}':
+			depth--
+			i++
+		case c == '(':
+			parens++
+			i++
+		case c == ')':
+			parens--
+			i++
+		case c == ':':
+			// previous name was alias, not field
+			if depth > 0 && parens == 0 && expectAlias {
+				stats.fields--
+			}
+			i++
+		case isGraphQLNameStart(c):
+			start := i
+			for i < len(query) && isGraphQLNameChar(query[i]) {
+				i++
+			}
+			name := query[start:i]
+			if depth == 0 && parens == 0 && (start == 0 || query[start-1] != '@') {
+				tokens = append(tokens, name)
+			}
+			expectAlias = false
+			isFragmentSpread := start >= 3 && query[start-3:start] == "..."
+			isTypeCondition := lastName == "on"
+			if depth > 0 && parens == 0 && name != "on" && !isFragmentSpread && !isTypeCondition && query[start-1] != '@' {
+				stats.fields++
+				expectAlias = true
+			}
+			lastName = name
+		default:
+			i++
+		}
+	}
+	return
+}
+
+// addDefinition adds operation defined by top level names before selection set (anonymous query starts with '{'),
+// fragment definitions are skipped
+func (stats *graphQLQueryStats) addDefinition(tokens []string) {
+	if len(tokens) == 0 {
+		stats.operations = append(stats.operations, graphQLOperation{operationType: "query"})
+		return
+	}
+	switch tokens[0] {
+	case "query", "mutation", "subscription":
+		operation := graphQLOperation{operationType: tokens[0]}
+		if len(tokens) > 1 {
+			operation.name = tokens[1]
+		}
+		stats.operations = append(stats.operations, operation)
+	}
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLNameChar(c byte) bool {
+	return isGraphQLNameStart(c) || (c >= '0' && c <= '9')
+}
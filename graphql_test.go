@@ -0,0 +1,71 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLHandlerChecksEveryOperation(t *testing.T) {
+	options := &GraphQLOptions{
+		OperationScopes: map[string][]string{"mutation": {"admin"}, "DeleteUser": {"admin"}},
+		MaxDepth:        3,
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"query", "application/json", `{"query":"{ users { id } }"}`, http.StatusOK},
+		{"mutation", "application/json", `{"query":"mutation { deleteUser(id: 1) }"}`, http.StatusUnauthorized},
+		{"batched mutation", "application/json", `[{"query":"{ users { id } }"},{"query":"mutation { deleteUser(id: 1) }"}]`, http.StatusUnauthorized},
+		{"empty batch", "application/json", `[]`, http.StatusBadRequest},
+		{"application/graphql mutation", "application/graphql", `mutation { deleteUser(id: 1) }`, http.StatusUnauthorized},
+		{"multipart mutation", "multipart/form-data; boundary=b", "--b\r\nContent-Disposition: form-data; name=\"operations\"\r\n\r\n{\"query\":\"mutation { upload }\"}\r\n--b--\r\n", http.StatusUnauthorized},
+		{"non-object body", "application/json", `"mutation { deleteUser(id: 1) }"`, http.StatusBadRequest},
+		{"invalid body", "application/json", `mutation { deleteUser(id: 1) }`, http.StatusBadRequest},
+		{"missing query", "application/json", `{"extensions":{"persistedQuery":{"sha256Hash":"abc"}}}`, http.StatusBadRequest},
+		{"operation name of query", "application/json", `{"query":"query A { users { id } } mutation B { deleteUser(id: 1) }","operationName":"A"}`, http.StatusOK},
+		{"operation name of mutation", "application/json", `{"query":"query A { users { id } } mutation B { deleteUser(id: 1) }","operationName":"B"}`, http.StatusUnauthorized},
+		{"undefined operation name", "application/json", `{"query":"mutation B { deleteUser(id: 1) }","operationName":"A"}`, http.StatusBadRequest},
+		{"several operations without name", "application/json", `{"query":"query A { users { id } } mutation B { deleteUser(id: 1) }"}`, http.StatusBadRequest},
+		{"client supplied operation name", "application/json", `{"query":"query DeleteUser { users { id } }","operationName":"DeleteUser"}`, http.StatusUnauthorized},
+		{"renamed query", "application/json", `{"query":"query Users { users { id } }","operationName":"Users"}`, http.StatusOK},
+		{"variables are not operation name", "application/json", `{"query":"query ($id: ID) { user(id: $id) { id } }"}`, http.StatusOK},
+		{"depth in batch", "application/json", `[{"query":"{ a }"},{"query":"{ a { b { c { d } } } }"}]`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			called := false
+			handler := GraphQLHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}), options)
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if called != (test.status == http.StatusOK) {
+				t.Fatalf("GraphQL server called: %v", called)
+			}
+		})
+	}
+}
+
+func TestGraphQLOperationScopes(t *testing.T) {
+	options := &GraphQLOptions{OperationScopes: map[string][]string{"mutation": {"admin"}}}
+	admin := &UserInfo{UserID: "a", Scopes: []string{"admin"}}
+	user := &UserInfo{UserID: "u", Scopes: []string{"read"}}
+	req := graphQLRequest{Query: "mutation { deleteUser(id: 1) }"}
+	if err := checkGraphQLRequest(req, options, admin); err != nil {
+		t.Fatalf("admin denied: %v", err)
+	}
+	err := checkGraphQLRequest(req, options, user)
+	if serverError, ok := err.(*ServerErrorData); !ok || serverError.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// HeaderLimitOptions is a configuration container for request header limits. Requests exceeding limits are
+// rejected with JSON 431 response.
+type HeaderLimitOptions struct {
+	// Max total size of header names and values, zero means unlimited
+	MaxBytes int
+	// Max number of header values, zero means unlimited
+	MaxCount int
+	// Max size of single header value (e.g. Cookie), zero means unlimited
+	MaxValueBytes int
+}
+
+// HeaderLimitOptionsFromViper reads header limits (max_bytes, max_count, max_value_bytes), nil is returned if no
+// limit is configured
+func HeaderLimitOptionsFromViper(prefix string) *HeaderLimitOptions {
+	options := &HeaderLimitOptions{
+		MaxBytes:      viper.GetInt(prefix + "max_bytes"),
+		MaxCount:      viper.GetInt(prefix + "max_count"),
+		MaxValueBytes: viper.GetInt(prefix + "max_value_bytes"),
+	}
+	if options.MaxBytes <= 0 && options.MaxCount <= 0 && options.MaxValueBytes <= 0 {
+		return nil
+	}
+	return options
+}
+
+// strictMaxHeaderBytes is header size limit of strict input mode, it is used if header limits are not set
+const strictMaxHeaderBytes = 8 * 1024
+
+// headerLimits returns header limits of service, strict input mode limits total size of headers by default
+func (s *webservice) headerLimits() *HeaderLimitOptions {
+	if s.headerLimitOptions == nil && s.strictOptions != nil {
+		return &HeaderLimitOptions{MaxBytes: strictMaxHeaderBytes}
+	}
+	return s.headerLimitOptions
+}
+
+// serverMaxHeaderBytes returns limit of http.Server, it must be above configured limit, so oversized headers are
+// rejected by middleware with JSON response instead of plain text response of http.Server
+func (o *HeaderLimitOptions) serverMaxHeaderBytes() int {
+	limit := o.MaxBytes
+	if o.MaxValueBytes > limit {
+		limit = o.MaxValueBytes
+	}
+	if limit+4096 > http.DefaultMaxHeaderBytes {
+		return limit + 4096
+	}
+	return http.DefaultMaxHeaderBytes
+}
+
+// headerLimitMiddleware rejects requests with headers exceeding limits
+func headerLimitMiddleware(options *HeaderLimitOptions, logger *logrus.Logger) func(h http.Handler) http.Handler {
+	o := *options
+	exceeded := registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_header_limit_exceeded_total",
+		Help: "Number of requests rejected because of header limits by limit (bytes, count, value_bytes).",
+	}, []string{"limit"})).(*prometheus.CounterVec)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			size, count := 0, 0
+			var err *ServerErrorData
+			for name, values := range r.Header {
+				for _, value := range values {
+					size += len(name) + len(value)
+					count++
+					if o.MaxValueBytes > 0 && len(value) > o.MaxValueBytes && err == nil {
+						exceeded.WithLabelValues("value_bytes").Inc()
+						err = ServerErrorWithoutStack(nil, http.StatusRequestHeaderFieldsTooLarge, fmt.Sprintf("Request header %s too large", name))
+					}
+				}
+			}
+			if err == nil && o.MaxBytes > 0 && size > o.MaxBytes {
+				exceeded.WithLabelValues("bytes").Inc()
+				err = ServerErrorWithoutStack(nil, http.StatusRequestHeaderFieldsTooLarge, "Request headers too large")
+			}
+			if err == nil && o.MaxCount > 0 && count > o.MaxCount {
+				exceeded.WithLabelValues("count").Inc()
+				err = ServerErrorWithoutStack(nil, http.StatusRequestHeaderFieldsTooLarge, "Too many request headers")
+			}
+			if err != nil {
+				processHTTPError(err.WithErrorCode("REQUEST_HEADERS_TOO_LARGE"), w, r, logger, nil)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
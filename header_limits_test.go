@@ -0,0 +1,40 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderLimitsOfStrictMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		service    *webservice
+		header     int
+		wantStatus int
+	}{
+		{"strict mode default", &webservice{strictOptions: &StrictOptions{}}, 9000, http.StatusRequestHeaderFieldsTooLarge},
+		{"strict mode small headers", &webservice{strictOptions: &StrictOptions{}}, 1000, http.StatusOK},
+		{"header limits override strict mode", &webservice{strictOptions: &StrictOptions{}, headerLimitOptions: &HeaderLimitOptions{MaxBytes: 16 * 1024}}, 9000, http.StatusOK},
+		{"header limits without strict mode", &webservice{headerLimitOptions: &HeaderLimitOptions{MaxBytes: 512}}, 1000, http.StatusRequestHeaderFieldsTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := headerLimitMiddleware(tt.service.headerLimits(), nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Large", strings.Repeat("x", tt.header))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK && !strings.Contains(w.Body.String(), `"error_code":"REQUEST_HEADERS_TOO_LARGE"`) {
+				t.Fatalf("unexpected body %s", w.Body.String())
+			}
+		})
+	}
+	if (&webservice{}).headerLimits() != nil {
+		t.Fatal("header limits without strict mode and configuration")
+	}
+}
@@ -0,0 +1,99 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WebServiceWarmupHandler is an interface to implement a callback Warmup() - it is executed after listener is bound
+// but before /readyz reports ready (e.g. to preload caches)
+type WebServiceWarmupHandler interface {
+	Warmup(ctx context.Context) (err error)
+}
+
+// HealthStatus is response of /healthz and /readyz endpoints
+type HealthStatus struct {
+	Status string `json:"status"`
+}
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusReady    = "ready"
+	healthStatusNotReady = "not_ready"
+)
+
+// setReady sets readiness of the service reported by /readyz
+func (s *webservice) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// isReady returns readiness of the service
+func (s *webservice) isReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// healthzHandler reports liveness - process is running and serving requests
+func (s *webservice) healthzHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+	return WriteJSON(w, r, &HealthStatus{Status: healthStatusOK})
+}
+
+// readyzHandler reports readiness - service finished warm-up and can receive traffic
+func (s *webservice) readyzHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+	if !s.isReady() || atomic.LoadInt32(&s.watchdogUnhealthy) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return WriteJSON(w, r, &HealthStatus{Status: healthStatusNotReady})
+	}
+	return WriteJSON(w, r, &HealthStatus{Status: healthStatusReady})
+}
+
+// warmup executes Warmup() of service objects with configured timeout
+func (s *webservice) warmup() (err error) {
+	var warmupHandlers []WebServiceWarmupHandler
+	for _, obj := range s.objects() {
+		if warmupHandler, ok := obj.(WebServiceWarmupHandler); ok {
+			warmupHandlers = append(warmupHandlers, warmupHandler)
+		}
+	}
+	if len(warmupHandlers) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if s.warmupTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.warmupTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		for _, warmupHandler := range warmupHandlers {
+			if err := warmupHandler.Warmup(ctx); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("warm-up not finished in %v", s.warmupTimeout)
+	}
+	return
+}
+
+// Set warm-up timeout - zero means no timeout
+func (s *webservice) SetWarmupTimeout(timeout time.Duration) {
+	s.warmupTimeout = timeout
+}
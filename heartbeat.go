@@ -0,0 +1,171 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Heartbeat reports liveness to external monitor for services which can't be scraped (e.g. behind NAT). It pings
+// heartbeat.url (healthchecks.io style - failures are reported to url/fail) and/or pushes metrics to Prometheus
+// Pushgateway at heartbeat.pushgateway_url (job heartbeat.job, default is service name, and instance
+// heartbeat.instance, default is hostname) every heartbeat.interval (default 1 minute) and at clean shutdown.
+// It is a Component, register it with svc.Register().
+type Heartbeat struct {
+	// Optional check of service health, failing check is reported to monitor
+	CheckFn  func(ctx context.Context) error
+	url      string
+	gateway  string
+	job      string
+	instance string
+	interval time.Duration
+	timeout  time.Duration
+	client   *http.Client
+	logger   *logrus.Logger
+	stop     context.CancelFunc
+	done     chan struct{}
+	mutex    sync.Mutex
+}
+
+// NewHeartbeat creates heartbeat component
+func NewHeartbeat(logger *logrus.Logger) *Heartbeat {
+	return &Heartbeat{
+		interval: time.Minute,
+		timeout:  time.Second * 10,
+		logger:   logger,
+	}
+}
+
+// Name implements Component
+func (hb *Heartbeat) Name() string {
+	return "heartbeat"
+}
+
+// Configure implements Component
+func (hb *Heartbeat) Configure(config *viper.Viper) (err error) {
+	hb.url = strings.TrimSuffix(config.GetString("url"), "/")
+	hb.gateway = config.GetString("pushgateway_url")
+	hb.job = config.GetString("job")
+	hb.instance = config.GetString("instance")
+	if config.IsSet("interval") {
+		hb.interval = config.GetDuration("interval")
+	}
+	if config.IsSet("timeout") {
+		hb.timeout = config.GetDuration("timeout")
+	}
+	if hb.url == "" && hb.gateway == "" {
+		return fmt.Errorf("heartbeat url or pushgateway_url is required")
+	}
+	if hb.interval <= 0 {
+		return fmt.Errorf("heartbeat interval must be positive")
+	}
+	if hb.job == "" {
+		hb.job = buildServiceName()
+	}
+	if hb.instance == "" {
+		hb.instance, _ = os.Hostname()
+	}
+	hb.client = &http.Client{Timeout: hb.timeout}
+	return
+}
+
+// Routes implements Component
+func (hb *Heartbeat) Routes(router *mux.Router) (err error) {
+	return
+}
+
+// Start implements Component - the first heartbeat is sent immediately
+func (hb *Heartbeat) Start(ctx context.Context) (err error) {
+	ctx, hb.stop = context.WithCancel(ctx)
+	hb.done = make(chan struct{})
+	go func() {
+		defer close(hb.done)
+		ticker := time.NewTicker(hb.interval)
+		defer ticker.Stop()
+		for {
+			hb.beat(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return
+}
+
+// Stop implements Component - final heartbeat is sent
+func (hb *Heartbeat) Stop(ctx context.Context) (err error) {
+	if hb.stop != nil {
+		hb.stop()
+		<-hb.done
+	}
+	return hb.beat(ctx)
+}
+
+// beat reports health to monitor, errors are logged
+func (hb *Heartbeat) beat(ctx context.Context) (err error) {
+	hb.mutex.Lock()
+	defer hb.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, hb.timeout)
+	defer cancel()
+	var checkErr error
+	if hb.CheckFn != nil {
+		checkErr = hb.CheckFn(ctx)
+	}
+	if hb.url != "" {
+		if err = hb.ping(ctx, checkErr); err != nil && hb.logger != nil {
+			hb.logger.WithError(err).Warn("heartbeat: unable to ping monitor")
+		}
+	}
+	if hb.gateway != "" {
+		pushErr := push.New(hb.gateway, hb.job).
+			Grouping("instance", hb.instance).
+			Client(hb.client).
+			Gatherer(prometheus.DefaultGatherer).
+			Push()
+		if pushErr != nil {
+			err = pushErr
+			if hb.logger != nil {
+				hb.logger.WithError(err).Warn("heartbeat: unable to push metrics")
+			}
+		}
+	}
+	return
+}
+
+// ping sends heartbeat, failed check is sent to url/fail with error in body
+func (hb *Heartbeat) ping(ctx context.Context, checkErr error) (err error) {
+	url := hb.url
+	var body io.Reader
+	if checkErr != nil {
+		url += "/fail"
+		body = strings.NewReader(checkErr.Error())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return
+	}
+	resp, err := hb.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("heartbeat: unexpected status %d", resp.StatusCode)
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package webservice
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/spf13/viper"
+)
+
+// HTTP3Server is HTTP/3 (QUIC) server, default is *http3.Server of github.com/quic-go/quic-go/http3
+type HTTP3Server interface {
+	ListenAndServe() error
+	// SetQUICHeaders sets Alt-Svc header advertising HTTP/3
+	SetQUICHeaders(header http.Header) error
+	Close() error
+}
+
+// HTTP3Options is a configuration container for HTTP/3 listener running alongside TCP listener
+type HTTP3Options struct {
+	// UDP address, default is address of TCP listener
+	Addr string
+	// Certificate and key files, HTTP/3 always uses TLS
+	CertFile string
+	KeyFile  string
+	// TLS configuration used instead of certificate files
+	TLSConfig *tls.Config
+	// Function creating HTTP/3 server, default is quic-go server
+	NewServer func(addr string, tlsConfig *tls.Config, handler http.Handler) HTTP3Server
+}
+
+// HTTP3OptionsFromViper reads HTTP/3 options (addr, cert_file, key_file), nil is returned if HTTP/3 is not enabled
+func HTTP3OptionsFromViper(prefix string) *HTTP3Options {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &HTTP3Options{
+		Addr:     viper.GetString(prefix + "addr"),
+		CertFile: viper.GetString(prefix + "cert_file"),
+		KeyFile:  viper.GetString(prefix + "key_file"),
+	}
+}
+
+// newHTTP3Server creates HTTP/3 server for handler, tcpAddr is actual address of TCP listener
+func newHTTP3Server(options *HTTP3Options, tcpAddr string, handler http.Handler) (server HTTP3Server, err error) {
+	tlsConfig := options.TLSConfig
+	if tlsConfig == nil {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, fmt.Errorf("HTTP/3 requires TLS - certificate and key files or TLS configuration")
+		}
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	addr := options.Addr
+	if addr == "" {
+		if strings.HasPrefix(tcpAddr, unixSocketPrefix) {
+			return nil, fmt.Errorf("HTTP/3 requires UDP address when service listens on unix socket")
+		}
+		addr = tcpAddr
+	}
+	newServer := options.NewServer
+	if newServer == nil {
+		newServer = newQUICServer
+	}
+	return newServer(addr, tlsConfig, handler), nil
+}
+
+// newQUICServer creates quic-go HTTP/3 server
+func newQUICServer(addr string, tlsConfig *tls.Config, handler http.Handler) HTTP3Server {
+	return &http3.Server{Addr: addr, TLSConfig: http3.ConfigureTLSConfig(tlsConfig), Handler: handler}
+}
+
+// altSvcMiddleware advertises HTTP/3 in Alt-Svc header of responses sent over TLS - clients ignore alternative
+// services advertised over cleartext connection
+func altSvcMiddleware(server HTTP3Server, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 && r.TLS != nil {
+			server.SetQUICHeaders(w.Header())
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// closeHTTP3 closes HTTP/3 server if it is running
+func (s *webservice) closeHTTP3() {
+	if s.http3Server != nil {
+		s.http3Server.Close()
+		s.http3Server = nil
+	}
+}
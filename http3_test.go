@@ -0,0 +1,104 @@
+package webservice
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+type fakeHTTP3Server struct{}
+
+func (fakeHTTP3Server) ListenAndServe() error { return nil }
+func (fakeHTTP3Server) Close() error          { return nil }
+func (fakeHTTP3Server) SetQUICHeaders(header http.Header) error {
+	header.Set("Alt-Svc", `h3=":443"; ma=2592000`)
+	return nil
+}
+
+func TestAltSvcIsAdvertisedOnlyOverTLS(t *testing.T) {
+	handler := altSvcMiddleware(fakeHTTP3Server{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name      string
+		tls       bool
+		advertise bool
+	}{
+		{"cleartext", false, false},
+		{"TLS", true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if test.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if advertised := w.Header().Get("Alt-Svc") != ""; advertised != test.advertise {
+				t.Fatalf("expected Alt-Svc advertised %v, got %v", test.advertise, advertised)
+			}
+		})
+	}
+}
+
+func TestHTTP3ServesHandlerChain(t *testing.T) {
+	svc := newTestService(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	svc.EnableHTTP3(&HTTP3Options{TLSConfig: &tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}}})
+	if err := svc.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Shutdown(context.Background())
+	<-svc.Ready()
+
+	transport := &http3.RoundTripper{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport, Timeout: time.Second * 2}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 10; i++ {
+		if resp, err = client.Get("https://" + svc.Addr() + "/"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 3 || string(body) != "HTTP/3.0" {
+		t.Fatalf("unexpected response %s %q", resp.Proto, body)
+	}
+}
+
+// selfSignedCertificate returns certificate for 127.0.0.1
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,194 @@
+package webservice
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// IdentitySource tells where the user comes from (token, signed request, proxy headers, API key, session, client
+// certificate, ...). Sources are asked in order and the first one recognizing credentials of request wins.
+// Nil user and nil error is returned if request has no credentials of the source, error is returned for
+// invalid credentials - user is then treated as user with invalid token.
+type IdentitySource interface {
+	Identify(r *http.Request) (userInfo *UserInfo, err error)
+}
+
+// IdentitySourceFunc is function implementing IdentitySource
+type IdentitySourceFunc func(r *http.Request) (userInfo *UserInfo, err error)
+
+// Identify implements IdentitySource
+func (f IdentitySourceFunc) Identify(r *http.Request) (userInfo *UserInfo, err error) {
+	return f(r)
+}
+
+// identitySources returns configured sources followed by built-in ones (trusted headers, HMAC signature, JWT)
+func (a *authorization) identitySources(custom []IdentitySource) (sources []IdentitySource) {
+	sources = append(sources, custom...)
+	if a.trustedHeaders != nil {
+		sources = append(sources, IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) {
+			if r.Header.Get(a.trustedHeaders.UserHeader) == "" {
+				return nil, nil
+			}
+			return trustedHeaderUser(r, a.trustedHeaders)
+		}))
+	}
+	if a.hmac != nil {
+		sources = append(sources, IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) {
+			if !strings.HasPrefix(r.Header.Get("Authorization"), HMACAuthScheme+" ") {
+				return nil, nil
+			}
+			return verifyHMACRequest(r, a.hmac)
+		}))
+	}
+	if a.jwks != nil || a.autoRefresh != nil {
+		sources = append(sources, IdentitySourceFunc(a.tokenUser))
+	}
+	return
+}
+
+// identify asks identity sources for user of request. Error is returned only if request can't be processed at
+// all (body of signed request is too large), invalid credentials make user with invalid token.
+func (a *authorization) identify(r *http.Request) (*UserInfo, error) {
+	for _, source := range a.sources {
+		userInfo, err := source.Identify(r)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, ServerErrorWithoutStack(err, http.StatusRequestEntityTooLarge, "Request too large")
+		}
+		if err != nil {
+			if a.logger != nil {
+				a.logger.WithError(err).Errorf("error identifying user")
+			}
+			return userWithInvalidToken, nil
+		}
+		if userInfo != nil {
+			return userInfo, nil
+		}
+	}
+	return unauthenticatedUser, nil
+}
+
+// tokenUser returns user of bearer token
+func (a *authorization) tokenUser(r *http.Request) (userInfo *UserInfo, err error) {
+	tokenString := r.Header.Get("Authorization")
+	if tokenString == "" {
+		return nil, nil
+	}
+
+	splitToken := strings.Split(tokenString, "Bearer")
+	if len(splitToken) != 2 {
+		return nil, fmt.Errorf("wrong Authorization header")
+	}
+
+	tokenString = strings.Trim(splitToken[1], " ")
+	consoleToken := false
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+
+		keyID, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("no key ID in token header")
+		}
+
+		jwks := a.jwks
+		var err error
+		if a.autoRefresh != nil {
+			jwks, err = a.autoRefresh.Fetch(context.Background(), a.jwksURL)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if jwks == nil && a.devKeys == nil {
+			return nil, fmt.Errorf("jwks not available")
+		}
+
+		var key jwk.Key
+		keyFound := false
+		if jwks != nil {
+			key, keyFound = jwks.LookupKeyID(keyID)
+		}
+		if !keyFound && a.devKeys != nil {
+			// Tokens minted by API console (dev mode)
+			key, keyFound = a.devKeys().LookupKeyID(keyID)
+			consoleToken = keyFound
+		}
+
+		if keyFound {
+			var publicKey rsa.PublicKey
+			err := key.Raw(&publicKey)
+			return &publicKey, err
+		}
+
+		return nil, fmt.Errorf("unable to find key with id: %s", keyID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if a.logger != nil {
+		a.logger.Tracef("auth: User claims: %+v", claims)
+	}
+
+	userInfo = &UserInfo{Claims: claims}
+	if v, ok := claims["sub"].(string); ok {
+		userInfo.UserID = v
+	}
+	if v, ok := claims["email"].(string); ok {
+		userInfo.Email = v
+	}
+	if v, ok := claims["scope"].(string); ok {
+		userInfo.Scopes = strings.Fields(v)
+	}
+	userInfo.Groups = a.groups(userInfo)
+
+	if consoleToken {
+		// Console key is trusted only for console tokens, audiences of configured JWKS don't apply
+		if userInfo.ClaimString("iss") != consoleTokenIssuerName || userInfo.ClaimString("aud") != consoleTokenIssuerName {
+			return nil, fmt.Errorf("token signed by console key has invalid issuer or audience")
+		}
+		if userInfo.UserID == "" {
+			return nil, fmt.Errorf("no user ID in token")
+		}
+		return
+	}
+	audience, accepted := a.tokenAudience(userInfo)
+	if !accepted {
+		return nil, fmt.Errorf("token audience %v is not accepted", claims["aud"])
+	}
+	if audience != nil {
+		audience.apply(userInfo)
+	}
+	if userInfo.UserID == "" {
+		return nil, fmt.Errorf("no user ID in token")
+	}
+	return
+}
+
+// HandlerWithUserIDFn is handler function receiving ID of authenticated user only
+type HandlerWithUserIDFn func(w http.ResponseWriter, r *http.Request, userID string) (err error)
+
+// AppHandlerWithUserID is AppHandler passing user ID only, empty for anonymous users.
+//
+// Deprecated: user is resolved by identity sources (see IdentitySource and AuthorizationOptions.TrustedHeaders
+// for X-User-Id style headers), use AppHandler with UserInfo instead.
+func AppHandlerWithUserID(fn HandlerWithUserIDFn) Handler {
+	return AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		userID := ""
+		if userInfo != nil {
+			userID = userInfo.UserID
+		}
+		return fn(w, r, userID)
+	})
+}
@@ -0,0 +1,89 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdentitySourceChain(t *testing.T) {
+	user := func(id string) IdentitySource {
+		return IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) { return &UserInfo{UserID: id}, nil })
+	}
+	none := IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) { return nil, nil })
+	invalid := IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) { return nil, errors.New("invalid credentials") })
+	tooLarge := IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) {
+		return nil, fmt.Errorf("unable to read body: %w", &http.MaxBytesError{Limit: 10})
+	})
+
+	tests := []struct {
+		name       string
+		sources    []IdentitySource
+		wantUser   string
+		wantStatus int
+	}{
+		{"no sources", nil, unauthenticatedUser.UserID, 0},
+		{"no credentials", []IdentitySource{none, none}, unauthenticatedUser.UserID, 0},
+		{"first source wins", []IdentitySource{user("first"), user("second")}, "first", 0},
+		{"source without credentials is skipped", []IdentitySource{none, user("second")}, "second", 0},
+		{"invalid credentials stop the chain", []IdentitySource{invalid, user("second")}, userWithInvalidToken.UserID, 0},
+		{"invalid credentials after user are not asked", []IdentitySource{user("first"), invalid}, "first", 0},
+		{"body too large", []IdentitySource{tooLarge, user("second")}, "", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authorization{sources: tt.sources}
+			userInfo, err := a.identify(httptest.NewRequest(http.MethodGet, "/", nil))
+			if tt.wantStatus != 0 {
+				if !hasStatus(err, tt.wantStatus) {
+					t.Fatalf("got error %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userInfo.UserID != tt.wantUser {
+				t.Fatalf("got user %q, want %q", userInfo.UserID, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestIdentitySourcesOrder(t *testing.T) {
+	custom := IdentitySourceFunc(func(r *http.Request) (*UserInfo, error) {
+		if r.Header.Get("X-Api-Key") == "" {
+			return nil, nil
+		}
+		return &UserInfo{UserID: "api-key"}, nil
+	})
+	a := &authorization{trustedHeaders: &TrustedHeaderOptions{UserHeader: "X-User-Id", Secret: "secret", SecretHeader: "X-Proxy-Secret"}}
+	a.sources = a.identitySources([]IdentitySource{custom})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Api-Key", "key")
+	r.Header.Set("X-User-Id", "header-user")
+	r.Header.Set("X-Proxy-Secret", "secret")
+	userInfo, err := a.identify(r)
+	if err != nil || userInfo.UserID != "api-key" {
+		t.Fatalf("custom source is not asked first: %v %v", userInfo, err)
+	}
+	if len(a.sources) != 2 {
+		t.Fatalf("expected custom and trusted header sources, got %d", len(a.sources))
+	}
+}
+
+func TestAppHandlerWithUserID(t *testing.T) {
+	var got string
+	handler := AppHandlerWithUserID(func(w http.ResponseWriter, r *http.Request, userID string) error {
+		got = userID
+		return nil
+	}).AllowAnonymous()
+	got = "unchanged"
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got != "" {
+		t.Fatalf("anonymous user got user ID %q", got)
+	}
+}
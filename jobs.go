@@ -0,0 +1,377 @@
+package webservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// JobStatus is state of asynchronous job
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// Job is asynchronous job state returned by /jobs/{id}
+type Job struct {
+	ID        string      `json:"id"`
+	Status    JobStatus   `json:"status"`
+	Progress  float64     `json:"progress"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Owner     string      `json:"-"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// finished returns if job is in final state
+func (j *Job) finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
+
+// JobStore is storage of job states
+type JobStore interface {
+	Save(ctx context.Context, job *Job) (err error)
+	// Get returns job, nil job without error is returned if job does not exist
+	Get(ctx context.Context, id string) (job *Job, err error)
+	Delete(ctx context.Context, id string) (err error)
+}
+
+// JobFn is work executed asynchronously. Progress (0-1) can be reported with progress function.
+// Context is cancelled when job is cancelled or service shuts down.
+type JobFn func(ctx context.Context, progress func(progress float64)) (result interface{}, err error)
+
+// JobOptions is a configuration container for asynchronous jobs
+type JobOptions struct {
+	// Storage of job states, default is in-memory store
+	Store JobStore
+	// Max number of jobs running concurrently, default is 10
+	Workers int
+	// How long finished jobs are kept, default is 1 hour
+	Retention time.Duration
+}
+
+// JobOptionsFromViper reads job options, nil is returned if jobs are not enabled
+func JobOptionsFromViper(prefix string) (options *JobOptions) {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &JobOptions{
+		Workers:   viper.GetInt(prefix + "workers"),
+		Retention: viper.GetDuration(prefix + "retention"),
+	}
+}
+
+// jobManager runs jobs and serves /jobs/{id} endpoints. It is registered as component.
+type jobManager struct {
+	options JobOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	slots   chan struct{}
+	mutex   sync.Mutex
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// newJobManager creates job manager
+func newJobManager(options *JobOptions) *jobManager {
+	m := &jobManager{
+		options: *options,
+		running: make(map[string]context.CancelFunc),
+	}
+	if m.options.Store == nil {
+		m.options.Store = NewMemoryJobStore()
+	}
+	if m.options.Workers <= 0 {
+		m.options.Workers = 10
+	}
+	if m.options.Retention <= 0 {
+		m.options.Retention = time.Hour
+	}
+	m.slots = make(chan struct{}, m.options.Workers)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// jobsContext returns context of jobs, it is cancelled when service shuts down
+func (m *jobManager) jobsContext() context.Context {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.ctx
+}
+
+// Name implements Component
+func (m *jobManager) Name() string {
+	return "jobs"
+}
+
+// Configure implements Component
+func (m *jobManager) Configure(config *viper.Viper) (err error) {
+	return
+}
+
+// Routes implements Component
+func (m *jobManager) Routes(router *mux.Router) (err error) {
+	router.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextTypeJobManager, m)))
+		})
+	})
+	router.Handle("/jobs/{id}", AppHandler(m.getJobHandler)).Methods("GET")
+	router.Handle("/jobs/{id}", AppHandler(m.cancelJobHandler)).Methods("DELETE")
+	return
+}
+
+// Start implements Component - jobs context is derived from components context, so jobs of restarted service
+// don't use context cancelled by previous stop
+func (m *jobManager) Start(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	m.mutex.Unlock()
+	go m.cleanup(m.jobsContext())
+	return
+}
+
+// Stop implements Component - running jobs are cancelled
+func (m *jobManager) Stop(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	m.cancel()
+	m.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// cleanup removes finished jobs after retention time until ctx is cancelled
+func (m *jobManager) cleanup(ctx context.Context) {
+	store, ok := m.options.Store.(*memoryJobStore)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			store.removeFinished(time.Now().Add(-m.options.Retention))
+		}
+	}
+}
+
+// enqueue creates job and runs it when worker is available
+func (m *jobManager) enqueue(ctx context.Context, owner string, fn JobFn) (job *Job, err error) {
+	id, err := newJobID()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	job = &Job{
+		ID:        id,
+		Status:    JobStatusPending,
+		Owner:     owner,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = m.options.Store.Save(ctx, job); err != nil {
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(m.jobsContext())
+	m.mutex.Lock()
+	m.running[id] = cancel
+	m.mutex.Unlock()
+
+	m.wg.Add(1)
+	go m.run(jobCtx, cancel, *job, fn)
+	return
+}
+
+// run executes job function and stores its result
+func (m *jobManager) run(ctx context.Context, cancel context.CancelFunc, job Job, fn JobFn) {
+	defer m.wg.Done()
+	defer func() {
+		cancel()
+		m.mutex.Lock()
+		delete(m.running, job.ID)
+		m.mutex.Unlock()
+	}()
+
+	update := func(modify func(j *Job)) {
+		modify(&job)
+		job.UpdatedAt = time.Now()
+		m.options.Store.Save(context.Background(), &job)
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		update(func(j *Job) { j.Status = JobStatusCancelled })
+		return
+	}
+
+	update(func(j *Job) { j.Status = JobStatusRunning })
+
+	var progressMutex sync.Mutex
+	result, err := fn(ctx, func(progress float64) {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		update(func(j *Job) { j.Progress = progress })
+	})
+
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		update(func(j *Job) { j.Status = JobStatusCancelled })
+	case err != nil:
+		update(func(j *Job) {
+			j.Status = JobStatusFailed
+			j.Error = err.Error()
+		})
+	default:
+		update(func(j *Job) {
+			j.Status = JobStatusSucceeded
+			j.Progress = 1
+			j.Result = result
+		})
+	}
+}
+
+// getOwnedJob returns job if it is accessible by the user
+func (m *jobManager) getOwnedJob(r *http.Request, userInfo *UserInfo) (job *Job, err error) {
+	job, err = m.options.Store.Get(r.Context(), PathParam(r, "id"))
+	if err != nil {
+		return nil, ServerError(err, http.StatusInternalServerError, "Unable to get job")
+	}
+	if job == nil || (job.Owner != "" && (userInfo == nil || userInfo.UserID != job.Owner)) {
+		return nil, ServerError(nil, http.StatusNotFound, "Job not found")
+	}
+	return
+}
+
+// getJobHandler returns job status and result
+func (m *jobManager) getJobHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+	job, err := m.getOwnedJob(r, userInfo)
+	if err != nil {
+		return err
+	}
+	return WriteJSON(w, r, job)
+}
+
+// cancelJobHandler cancels running job
+func (m *jobManager) cancelJobHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+	job, err := m.getOwnedJob(r, userInfo)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	cancel, running := m.running[job.ID]
+	m.mutex.Unlock()
+	if running {
+		cancel()
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return WriteJSON(w, r, job)
+}
+
+// newJobID generates random job ID
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AcceptJob enqueues asynchronous job and writes 202 Accepted response with job ID and Location of status endpoint.
+// Jobs have to be enabled with EnableJobs().
+func AcceptJob(w http.ResponseWriter, r *http.Request, userInfo *UserInfo, fn JobFn) (err error) {
+	m, ok := r.Context().Value(contextTypeJobManager).(*jobManager)
+	if !ok || m == nil {
+		return ServerError(fmt.Errorf("jobs are not enabled"), http.StatusInternalServerError, "Jobs not available")
+	}
+
+	owner := ""
+	if userInfo != nil {
+		owner = userInfo.UserID
+	}
+	job, err := m.enqueue(r.Context(), owner, fn)
+	if err != nil {
+		return ServerError(err, http.StatusInternalServerError, "Unable to create job")
+	}
+
+	w.Header().Set("Location", ExternalPath(r, "/jobs/"+job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	return WriteJSON(w, r, job)
+}
+
+// memoryJobStore is in-memory JobStore
+type memoryJobStore struct {
+	mutex sync.RWMutex
+	jobs  map[string]Job
+}
+
+// NewMemoryJobStore creates in-memory job store
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{jobs: make(map[string]Job)}
+}
+
+// Save implements JobStore
+func (s *memoryJobStore) Save(_ context.Context, job *Job) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs[job.ID] = *job
+	return
+}
+
+// Get implements JobStore
+func (s *memoryJobStore) Get(_ context.Context, id string) (job *Job, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if j, ok := s.jobs[id]; ok {
+		job = &j
+	}
+	return
+}
+
+// Delete implements JobStore
+func (s *memoryJobStore) Delete(_ context.Context, id string) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.jobs, id)
+	return
+}
+
+// removeFinished removes jobs finished before given time
+func (s *memoryJobStore) removeFinished(before time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, job := range s.jobs {
+		if job.finished() && job.UpdatedAt.Before(before) {
+			delete(s.jobs, id)
+		}
+	}
+}
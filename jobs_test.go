@@ -0,0 +1,36 @@
+package webservice
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJobsRunAfterRestart(t *testing.T) {
+	m := newJobManager(&JobOptions{})
+	for i := 0; i < 2; i++ {
+		if err := m.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		job, err := m.enqueue(context.Background(), "", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+			return "done", ctx.Err()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			stored, _ := m.options.Store.Get(context.Background(), job.ID)
+			if stored.Status == JobStatusSucceeded {
+				break
+			}
+			if stored.Status == JobStatusCancelled || stored.Status == JobStatusFailed || time.Now().After(deadline) {
+				t.Fatalf("run %d: job status %s", i, stored.Status)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		if err := m.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
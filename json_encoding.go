@@ -0,0 +1,369 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// Field naming of JSON responses
+const (
+	JSONNamingSnakeCase = "snake_case"
+	JSONNamingCamelCase = "camelCase"
+)
+
+// JSONEncoder marshals values to JSON, encoding/json is used by default. Drop-in replacements (e.g. jsoniter
+// ConfigCompatibleWithStandardLibrary) implement it.
+type JSONEncoder interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// JSONEncoderFunc is function implementing JSONEncoder
+type JSONEncoderFunc func(v interface{}) ([]byte, error)
+
+// Marshal implements JSONEncoder
+func (f JSONEncoderFunc) Marshal(v interface{}) ([]byte, error) {
+	return f(v)
+}
+
+// JSONOptions is a configuration container for JSON responses of the framework (status, health, errors, jobs,
+// debug endpoints) and of handlers using WriteJSON. Protocol documents (JWKS, OAuth tokens, service manifest)
+// keep their field names.
+type JSONOptions struct {
+	// Encoder replaces encoding/json
+	Encoder JSONEncoder
+	// Field naming enforced on struct fields (JSONNamingSnakeCase or JSONNamingCamelCase), empty keeps names. Keys
+	// of maps are data, they are never renamed.
+	Naming string
+	// Omit object fields with null value
+	OmitNulls bool
+	// Indent all responses, in dev mode single response is indented with ?pretty=1
+	Pretty bool
+}
+
+// JSONOptionsFromViper reads JSON options (naming, omit_nulls, pretty), nil is returned if defaults are used
+func JSONOptionsFromViper(prefix string) *JSONOptions {
+	options := &JSONOptions{
+		Naming:    viper.GetString(prefix + "naming"),
+		OmitNulls: viper.GetBool(prefix + "omit_nulls"),
+		Pretty:    viper.GetBool(prefix + "pretty"),
+	}
+	if options.Naming == "" && !options.OmitNulls && !options.Pretty {
+		return nil
+	}
+	return options
+}
+
+// Validate checks JSON options
+func (o *JSONOptions) Validate() error {
+	switch o.Naming {
+	case "", JSONNamingSnakeCase, JSONNamingCamelCase:
+		return nil
+	}
+	return fmt.Errorf("unknown JSON field naming %q", o.Naming)
+}
+
+// jsonRequestOptions are JSON options resolved for single request
+type jsonRequestOptions struct {
+	*JSONOptions
+	pretty bool
+}
+
+// jsonOptionsMiddleware resolves JSON options of request, ?pretty=1 is accepted in dev mode only
+func jsonOptionsMiddleware(options *JSONOptions, devMode bool) func(http.Handler) http.Handler {
+	if options == nil {
+		options = &JSONOptions{}
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pretty := options.Pretty
+			if devMode && !pretty {
+				pretty, _ = strconv.ParseBool(r.URL.Query().Get("pretty"))
+			}
+			ctx := context.WithValue(r.Context(), contextTypeJSONOptions, &jsonRequestOptions{JSONOptions: options, pretty: pretty})
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// maxPooledJSONBuffer is capacity of buffer returned to pool, larger buffers are left to garbage collector
+const maxPooledJSONBuffer = 64 << 10
+
+// jsonBuffer is pooled response buffer with encoder writing into it
+type jsonBuffer struct {
+	bytes.Buffer
+	encoder *json.Encoder
+}
+
+// jsonBufferPool reuses response buffers and encoders between requests
+var jsonBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := &jsonBuffer{}
+		buf.encoder = json.NewEncoder(&buf.Buffer)
+		return buf
+	},
+}
+
+// getJSONBuffer returns empty buffer from pool
+func getJSONBuffer() *jsonBuffer {
+	return jsonBufferPool.Get().(*jsonBuffer)
+}
+
+// putJSONBuffer returns buffer to pool
+func putJSONBuffer(buf *jsonBuffer) {
+	if buf.Cap() > maxPooledJSONBuffer {
+		return
+	}
+	buf.Reset()
+	jsonBufferPool.Put(buf)
+}
+
+// encodeJSON encodes value with JSON options of request followed by newline. Returned buffer has to be released
+// by putJSONBuffer.
+func encodeJSON(r *http.Request, v interface{}) (buf *jsonBuffer, err error) {
+	var options *jsonRequestOptions
+	if r != nil {
+		options, _ = r.Context().Value(contextTypeJSONOptions).(*jsonRequestOptions)
+	}
+	buf = getJSONBuffer()
+	if options == nil || options.Encoder == nil {
+		err = buf.encoder.Encode(v)
+	} else {
+		var b []byte
+		if b, err = options.Encoder.Marshal(v); err == nil {
+			buf.Write(b)
+			buf.WriteByte('\n')
+		}
+	}
+	if err != nil || options == nil {
+		return
+	}
+	if options.Naming != "" || options.OmitNulls {
+		out := getJSONBuffer()
+		dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		dec.UseNumber()
+		_, err = rewriteJSON(dec, &out.Buffer, options.JSONOptions, reflect.ValueOf(v))
+		out.WriteByte('\n')
+		putJSONBuffer(buf)
+		buf = out
+		if err != nil {
+			return
+		}
+	}
+	if options.pretty {
+		out := getJSONBuffer()
+		err = json.Indent(&out.Buffer, buf.Bytes(), "", "  ")
+		putJSONBuffer(buf)
+		buf = out
+	}
+	return
+}
+
+// WriteJSON writes value as JSON response with configured encoder, field naming and pretty printing
+// (see JSONOptions). It can be used in AppHandler instead of json.NewEncoder(w).Encode(v).
+func WriteJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	buf, err := encodeJSON(r, v)
+	defer putJSONBuffer(buf)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// rewriteJSON copies single JSON value from decoder to buffer, it renames fields of structs and omits null fields.
+// Field order is kept. Encoded value v tells structs from maps, keys of maps and of values with unknown structure
+// (custom MarshalJSON) are kept.
+func rewriteJSON(dec *json.Decoder, buf *bytes.Buffer, options *JSONOptions, v reflect.Value) (null bool, err error) {
+	v = jsonIndirect(v)
+	token, err := dec.Token()
+	if err != nil {
+		return
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			buf.WriteByte('[')
+			for idx, first := 0, true; dec.More(); idx, first = idx+1, false {
+				if !first {
+					buf.WriteByte(',')
+				}
+				var item reflect.Value
+				if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && idx < v.Len() {
+					item = v.Index(idx)
+				}
+				if _, err = rewriteJSON(dec, buf, options, item); err != nil {
+					return
+				}
+			}
+			buf.WriteByte(']')
+		} else {
+			buf.WriteByte('{')
+			first := true
+			for dec.More() {
+				if token, err = dec.Token(); err != nil {
+					return
+				}
+				name := token.(string)
+				var field reflect.Value
+				switch v.Kind() {
+				case reflect.Struct:
+					field = jsonStructField(v, name)
+					name = renameField(name, options.Naming)
+				case reflect.Map:
+					if v.Type().Key().Kind() == reflect.String {
+						field = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+					}
+				}
+				value := getJSONBuffer()
+				var isNull bool
+				if isNull, err = rewriteJSON(dec, &value.Buffer, options, field); err != nil {
+					putJSONBuffer(value)
+					return
+				}
+				if isNull && options.OmitNulls {
+					putJSONBuffer(value)
+					continue
+				}
+				if !first {
+					buf.WriteByte(',')
+				}
+				first = false
+				key, _ := json.Marshal(name)
+				buf.Write(key)
+				buf.WriteByte(':')
+				buf.Write(value.Bytes())
+				putJSONBuffer(value)
+			}
+			buf.WriteByte('}')
+		}
+		// Closing delimiter
+		_, err = dec.Token()
+	case nil:
+		buf.WriteString("null")
+		null = true
+	case json.Number:
+		buf.WriteString(t.String())
+	default:
+		var b []byte
+		b, err = json.Marshal(t)
+		buf.Write(b)
+	}
+	return
+}
+
+// jsonMarshalerType is interface of values with custom JSON encoding
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// jsonIndirect returns value behind pointers and interfaces, invalid value is returned for values with custom JSON
+// encoding (their structure is unknown)
+func jsonIndirect(v reflect.Value) reflect.Value {
+	for v.IsValid() {
+		if v.Type().Implements(jsonMarshalerType) {
+			return reflect.Value{}
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			break
+		}
+		v = v.Elem()
+	}
+	if v.IsValid() && v.CanAddr() && v.Addr().Type().Implements(jsonMarshalerType) {
+		return reflect.Value{}
+	}
+	return v
+}
+
+// jsonStructField returns field of struct encoded with given JSON name, fields of embedded structs are included
+func jsonStructField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		tagName, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && tagName == "" {
+			embedded := v.Field(idx)
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if found := jsonStructField(embedded, name); found.IsValid() {
+					return found
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if tagName == "" {
+			tagName = field.Name
+		}
+		if tagName == name {
+			return v.Field(idx)
+		}
+	}
+	return reflect.Value{}
+}
+
+// renameField converts field name to given naming
+func renameField(name string, naming string) string {
+	switch naming {
+	case JSONNamingSnakeCase:
+		return toSnakeCase(name)
+	case JSONNamingCamelCase:
+		return toCamelCase(name)
+	}
+	return name
+}
+
+// toSnakeCase converts camelCase and PascalCase to snake_case (userID -> user_id, HTTPServer -> http_server)
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, c := range runes {
+		if c == '-' || c == ' ' {
+			sb.WriteByte('_')
+			continue
+		}
+		if unicode.IsUpper(c) {
+			if i > 0 && runes[i-1] != '_' && runes[i-1] != '-' &&
+				(!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				sb.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// toCamelCase converts snake_case to camelCase (user_id -> userId)
+func toCamelCase(name string) string {
+	parts := strings.FieldsFunc(name, func(c rune) bool { return c == '_' || c == '-' })
+	if len(parts) == 0 {
+		return name
+	}
+	var sb strings.Builder
+	for i, part := range parts {
+		runes := []rune(part)
+		if i == 0 {
+			runes[0] = unicode.ToLower(runes[0])
+		} else {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		sb.WriteString(string(runes))
+	}
+	return sb.String()
+}
@@ -0,0 +1,66 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jsonTestMeta is embedded struct of jsonTestResult
+type jsonTestMeta struct {
+	RequestID string
+}
+
+// jsonTestResult is job result with data maps
+type jsonTestResult struct {
+	jsonTestMeta
+	JobID    string            `json:"jobID"`
+	Headers  map[string]string `json:"echoHeaders"`
+	Counts   map[string]int
+	Items    []interface{}
+	Created  time.Time
+	Optional *string
+}
+
+// jsonTestItem is item of jsonTestResult
+type jsonTestItem struct {
+	ItemName string
+}
+
+func TestEncodeJSONRenamesOnlyStructFields(t *testing.T) {
+	result := jsonTestResult{
+		jsonTestMeta: jsonTestMeta{RequestID: "r1"},
+		JobID:        "j1",
+		Headers:      map[string]string{"X-Request-Id": "abc"},
+		Counts:       map[string]int{"camelKey": 1},
+		Items:        []interface{}{jsonTestItem{ItemName: "a"}, map[string]interface{}{"mapKey": jsonTestItem{ItemName: "b"}}},
+		Created:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	tests := []struct {
+		naming string
+		want   string
+	}{
+		{JSONNamingSnakeCase, `{"request_id":"r1","job_id":"j1","echo_headers":{"X-Request-Id":"abc"},"counts":{"camelKey":1},"items":[{"item_name":"a"},{"mapKey":{"item_name":"b"}}],"created":"2024-01-02T03:04:05Z"}`},
+		{JSONNamingCamelCase, `{"requestID":"r1","jobID":"j1","echoHeaders":{"X-Request-Id":"abc"},"counts":{"camelKey":1},"items":[{"itemName":"a"},{"mapKey":{"itemName":"b"}}],"created":"2024-01-02T03:04:05Z"}`},
+		{"", `{"RequestID":"r1","jobID":"j1","echoHeaders":{"X-Request-Id":"abc"},"Counts":{"camelKey":1},"Items":[{"ItemName":"a"},{"mapKey":{"ItemName":"b"}}],"Created":"2024-01-02T03:04:05Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.naming, func(t *testing.T) {
+			var got string
+			handler := jsonOptionsMiddleware(&JSONOptions{Naming: tt.naming, OmitNulls: true}, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				buf, err := encodeJSON(r, &result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = strings.TrimSpace(buf.String())
+				putJSONBuffer(buf)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
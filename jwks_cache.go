@@ -0,0 +1,130 @@
+package webservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// jwksCacheEntry is JWKS response persisted in cache file
+type jwksCacheEntry struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	Jwks         json.RawMessage `json:"jwks"`
+}
+
+// jwksCacheTransport makes conditional JWKS requests (If-None-Match/If-Modified-Since) and persists fetched key
+// set to cache file. When identity provider is not available, cached key set is served, so service restarted
+// during IdP outage can still verify tokens.
+type jwksCacheTransport struct {
+	base   http.RoundTripper
+	path   string
+	logger *logrus.Logger
+	mutex  sync.Mutex
+	entry  *jwksCacheEntry
+}
+
+// newJWKSCacheTransport creates transport with cache file, existing cache is loaded
+func newJWKSCacheTransport(path string, logger *logrus.Logger) *jwksCacheTransport {
+	t := &jwksCacheTransport{
+		base:   http.DefaultTransport,
+		path:   path,
+		logger: logger,
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		entry := &jwksCacheEntry{}
+		if err = json.Unmarshal(data, entry); err == nil && len(entry.Jwks) > 0 {
+			t.entry = entry
+		} else if logger != nil {
+			logger.WithError(err).WithField("file", path).Warn("invalid JWKS cache file")
+		}
+	}
+	return t
+}
+
+// cachedResponse returns cached key set as response
+func (t *jwksCacheTransport) cachedResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(t.entry.Jwks)),
+		ContentLength: int64(len(t.entry.Jwks)),
+		Request:       req,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *jwksCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.entry != nil {
+		req = req.Clone(req.Context())
+		if t.entry.ETag != "" {
+			req.Header.Set("If-None-Match", t.entry.ETag)
+		}
+		if t.entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", t.entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		if t.entry != nil {
+			if t.logger != nil {
+				t.logger.WithError(err).Warn("JWKS endpoint not available, using cached key set")
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return t.cachedResponse(req), nil
+		}
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && t.entry != nil {
+		resp.Body.Close()
+		return t.cachedResponse(req), nil
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if json.Valid(body) {
+			t.entry = &jwksCacheEntry{
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+				Jwks:         body,
+			}
+			t.save()
+		}
+	}
+	return resp, nil
+}
+
+// save writes cache entry to file (atomically with rename)
+func (t *jwksCacheTransport) save() {
+	data, err := json.Marshal(t.entry)
+	if err == nil {
+		tmp := t.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, t.path)
+		}
+	}
+	if err != nil && t.logger != nil {
+		t.logger.WithError(err).WithField("file", t.path).Warn("unable to write JWKS cache file")
+	}
+}
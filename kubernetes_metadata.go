@@ -0,0 +1,124 @@
+package webservice
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// downwardAPIPath is default mount path of downward API volume
+const downwardAPIPath = "/etc/podinfo/"
+
+// KubernetesMetadata contains pod metadata detected from environment variables or downward API files
+type KubernetesMetadata struct {
+	PodName   string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	NodeName  string `json:"node,omitempty"`
+}
+
+var kubernetesMetadata *KubernetesMetadata
+var kubernetesMetadataOnce sync.Once
+
+// DetectKubernetesMetadata returns pod metadata. It checks POD_NAME, POD_NAMESPACE, NODE_NAME environment variables
+// (set via downward API fieldRef), downward API files in /etc/podinfo and service account namespace.
+// Nil is returned when not running in Kubernetes.
+func DetectKubernetesMetadata() *KubernetesMetadata {
+	kubernetesMetadataOnce.Do(func() {
+		m := &KubernetesMetadata{
+			PodName:   firstNonEmpty(os.Getenv("POD_NAME"), os.Getenv("K8S_POD_NAME"), readMetadataFile(downwardAPIPath+"name")),
+			Namespace: firstNonEmpty(os.Getenv("POD_NAMESPACE"), os.Getenv("K8S_NAMESPACE"), readMetadataFile(downwardAPIPath+"namespace"), readMetadataFile(serviceAccountPath+"namespace")),
+			NodeName:  firstNonEmpty(os.Getenv("NODE_NAME"), os.Getenv("K8S_NODE_NAME"), readMetadataFile(downwardAPIPath+"nodename")),
+		}
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" && m.PodName == "" {
+			// pod hostname is pod name by default
+			m.PodName, _ = os.Hostname()
+		}
+		if m.PodName != "" || m.Namespace != "" || m.NodeName != "" {
+			kubernetesMetadata = m
+		}
+	})
+	return kubernetesMetadata
+}
+
+// readMetadataFile returns trimmed content of file or empty string
+func readMetadataFile(name string) string {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// fields returns metadata as log fields
+func (m *KubernetesMetadata) fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if m.PodName != "" {
+		fields["pod"] = m.PodName
+	}
+	if m.Namespace != "" {
+		fields["namespace"] = m.Namespace
+	}
+	if m.NodeName != "" {
+		fields["node"] = m.NodeName
+	}
+	return fields
+}
+
+// kubernetesLogHook adds pod metadata to all log entries
+type kubernetesLogHook struct {
+	fields logrus.Fields
+}
+
+// Levels implements logrus.Hook
+func (h *kubernetesLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *kubernetesLogHook) Fire(entry *logrus.Entry) error {
+	for key, value := range h.fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+var kubernetesLogHookLoggers sync.Map
+
+// addKubernetesMetadata adds pod metadata to logger and registers service_info metric
+func addKubernetesMetadata(logger *logrus.Logger, enableMetrics bool) {
+	m := DetectKubernetesMetadata()
+	if m == nil {
+		return
+	}
+	if logger != nil {
+		if _, loaded := kubernetesLogHookLoggers.LoadOrStore(logger, true); !loaded {
+			logger.AddHook(&kubernetesLogHook{fields: m.fields()})
+		}
+	}
+	if enableMetrics {
+		info := registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "service_info",
+			Help: "Kubernetes metadata of the service instance.",
+			ConstLabels: prometheus.Labels{
+				"pod":       m.PodName,
+				"namespace": m.Namespace,
+				"node":      m.NodeName,
+			},
+		})).(prometheus.Gauge)
+		info.Set(1)
+	}
+}
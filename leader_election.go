@@ -0,0 +1,405 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// LeaderLock is backend of leader election
+type LeaderLock interface {
+	// TryAcquire acquires or renews lock for holder, returns true if holder owns the lock
+	TryAcquire(ctx context.Context, name string, holder string, ttl time.Duration) (acquired bool, err error)
+	// Release releases lock if it is owned by holder
+	Release(ctx context.Context, name string, holder string) (err error)
+}
+
+// LeaderElector elects one replica as leader, so singleton tasks (schedulers, consumers) run only once.
+// It is a Component, register it with svc.Register().
+type LeaderElector struct {
+	lock      LeaderLock
+	name      string
+	holder    string
+	ttl       time.Duration
+	logger    *logrus.Logger
+	mutex     sync.Mutex
+	leader    bool
+	leaderCtx context.Context
+	cancel    context.CancelFunc
+	onElected []func(ctx context.Context)
+	onRevoked []func()
+	stop      context.CancelFunc
+	done      chan struct{}
+}
+
+// NewLeaderElector creates leader elector. Holder identity defaults to hostname (pod name in Kubernetes) with random
+// suffix - processes on the same host and replaced pod with the same name are different holders.
+// Name and ttl can be changed with configuration keys leader_election.name and leader_election.ttl, configured
+// holder (leader_election.holder) has to be unique per process.
+func NewLeaderElector(lock LeaderLock, name string, logger *logrus.Logger) *LeaderElector {
+	return &LeaderElector{
+		lock:   lock,
+		name:   name,
+		holder: defaultLeaderHolder(),
+		ttl:    time.Second * 15,
+		logger: logger,
+	}
+}
+
+// defaultLeaderHolder returns hostname with random suffix
+func defaultLeaderHolder() string {
+	suffix, _ := newJobID()
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		return suffix
+	}
+	return hostname + "-" + suffix[:8]
+}
+
+// IsLeader returns if this replica is leader
+func (le *LeaderElector) IsLeader() bool {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	return le.leader
+}
+
+// OnElected registers callback called when replica becomes leader. Context is cancelled when leadership is lost.
+func (le *LeaderElector) OnElected(fn func(ctx context.Context)) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	le.onElected = append(le.onElected, fn)
+}
+
+// OnRevoked registers callback called when replica loses leadership
+func (le *LeaderElector) OnRevoked(fn func()) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	le.onRevoked = append(le.onRevoked, fn)
+}
+
+// Name implements Component
+func (le *LeaderElector) Name() string {
+	return "leader_election"
+}
+
+// Configure implements Component
+func (le *LeaderElector) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("name") {
+		le.name = config.GetString("name")
+	}
+	if config.IsSet("ttl") {
+		le.ttl = config.GetDuration("ttl")
+	}
+	if config.IsSet("holder") {
+		le.holder = config.GetString("holder")
+	}
+	if le.name == "" {
+		return fmt.Errorf("leader election name is not configured")
+	}
+	if le.ttl < time.Second {
+		return fmt.Errorf("leader election ttl must be at least 1 second")
+	}
+	return
+}
+
+// Routes implements Component
+func (le *LeaderElector) Routes(router *mux.Router) (err error) {
+	return
+}
+
+// Start implements Component - starts election loop
+func (le *LeaderElector) Start(ctx context.Context) (err error) {
+	ctx, le.stop = context.WithCancel(ctx)
+	le.done = make(chan struct{})
+	go le.run(ctx)
+	return
+}
+
+// Stop implements Component - leadership is released
+func (le *LeaderElector) Stop(ctx context.Context) (err error) {
+	if le.stop == nil {
+		return
+	}
+	le.stop()
+	<-le.done
+	le.setLeader(ctx, false)
+	return le.lock.Release(ctx, le.name, le.holder)
+}
+
+// run tries to acquire/renew lock every third of ttl. Attempt has the same timeout, so hung backend revokes
+// leadership before the lock expires.
+func (le *LeaderElector) run(ctx context.Context) {
+	defer close(le.done)
+	interval := le.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, interval)
+		acquired, err := le.lock.TryAcquire(attemptCtx, le.name, le.holder, le.ttl)
+		cancel()
+		if err != nil {
+			if le.logger != nil && ctx.Err() == nil {
+				le.logger.WithError(err).WithField("election", le.name).Warn("leader election: unable to acquire lock")
+			}
+			acquired = false
+		}
+		le.setLeader(ctx, acquired)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setLeader changes leadership state and calls callbacks
+func (le *LeaderElector) setLeader(ctx context.Context, leader bool) {
+	le.mutex.Lock()
+	if le.leader == leader {
+		le.mutex.Unlock()
+		return
+	}
+	le.leader = leader
+	var onElected []func(ctx context.Context)
+	var onRevoked []func()
+	var leaderCtx context.Context
+	if leader {
+		le.leaderCtx, le.cancel = context.WithCancel(ctx)
+		leaderCtx = le.leaderCtx
+		onElected = append(onElected, le.onElected...)
+	} else {
+		if le.cancel != nil {
+			le.cancel()
+		}
+		onRevoked = append(onRevoked, le.onRevoked...)
+	}
+	le.mutex.Unlock()
+
+	if le.logger != nil {
+		le.logger.WithFields(logrus.Fields{"election": le.name, "holder": le.holder, "leader": leader}).Print("leader election: leadership changed")
+	}
+	for _, fn := range onElected {
+		go fn(leaderCtx)
+	}
+	for _, fn := range onRevoked {
+		fn()
+	}
+}
+
+// RedisEvaler evaluates Lua script in Redis (adapter for go-redis: client.Eval(ctx, script, keys, args...).Result())
+type RedisEvaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (result interface{}, err error)
+}
+
+// redisLeaderLock is LeaderLock based on Redis key with expiration
+type redisLeaderLock struct {
+	redis RedisEvaler
+}
+
+// NewRedisLeaderLock creates Redis based leader lock
+func NewRedisLeaderLock(redis RedisEvaler) LeaderLock {
+	return &redisLeaderLock{redis: redis}
+}
+
+const redisAcquireScript = `
+local current = redis.call("GET", KEYS[1])
+if current == false or current == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`
+
+const redisReleaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+// TryAcquire implements LeaderLock
+func (l *redisLeaderLock) TryAcquire(ctx context.Context, name string, holder string, ttl time.Duration) (acquired bool, err error) {
+	result, err := l.redis.Eval(ctx, redisAcquireScript, []string{"leader:" + name}, holder, ttl.Milliseconds())
+	if err != nil {
+		return
+	}
+	n, _ := result.(int64)
+	return n == 1, nil
+}
+
+// Release implements LeaderLock
+func (l *redisLeaderLock) Release(ctx context.Context, name string, holder string) (err error) {
+	_, err = l.redis.Eval(ctx, redisReleaseScript, []string{"leader:" + name}, holder)
+	return
+}
+
+// kubernetesLeaseLock is LeaderLock based on coordination.k8s.io/v1 Lease
+type kubernetesLeaseLock struct {
+	host      string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+const serviceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// NewKubernetesLeaseLock creates leader lock based on Kubernetes Lease in pod namespace. It uses in-cluster
+// service account, so the pod needs RBAC permissions get/create/update on leases.
+func NewKubernetesLeaseLock() (lock LeaderLock, err error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in Kubernetes cluster")
+	}
+	token, err := os.ReadFile(serviceAccountPath + "token")
+	if err != nil {
+		return
+	}
+	namespace, err := os.ReadFile(serviceAccountPath + "namespace")
+	if err != nil {
+		return
+	}
+	caCert, err := os.ReadFile(serviceAccountPath + "ca.crt")
+	if err != nil {
+		return
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+
+	return &kubernetesLeaseLock{
+		host:      "https://" + host + ":" + port,
+		namespace: strings.TrimSpace(string(namespace)),
+		token:     strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout:   time.Second * 10,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// kubernetesLease is subset of Lease object
+type kubernetesLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace,omitempty"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       *string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds *int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          *string `json:"acquireTime,omitempty"`
+		RenewTime            *string `json:"renewTime,omitempty"`
+	} `json:"spec"`
+}
+
+// leaseTimeFormat is MicroTime format used by Lease
+const leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// request calls Kubernetes API
+func (l *kubernetesLeaseLock) request(ctx context.Context, method string, path string, body interface{}) (status int, lease *kubernetesLease, err error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, l.host+path, reader)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	if status >= 200 && status < 300 {
+		lease = &kubernetesLease{}
+		err = json.NewDecoder(resp.Body).Decode(lease)
+	}
+	return
+}
+
+// TryAcquire implements LeaderLock
+func (l *kubernetesLeaseLock) TryAcquire(ctx context.Context, name string, holder string, ttl time.Duration) (acquired bool, err error) {
+	leasesPath := "/apis/coordination.k8s.io/v1/namespaces/" + l.namespace + "/leases"
+	now := time.Now().UTC().Format(leaseTimeFormat)
+	seconds := int(ttl / time.Second)
+
+	status, lease, err := l.request(ctx, http.MethodGet, leasesPath+"/"+name, nil)
+	if err != nil {
+		return
+	}
+
+	if status == http.StatusNotFound {
+		lease = &kubernetesLease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		lease.Metadata.Name = name
+		lease.Metadata.Namespace = l.namespace
+		lease.Spec.HolderIdentity = &holder
+		lease.Spec.LeaseDurationSeconds = &seconds
+		lease.Spec.AcquireTime = &now
+		lease.Spec.RenewTime = &now
+		status, _, err = l.request(ctx, http.MethodPost, leasesPath, lease)
+		return err == nil && status == http.StatusCreated, err
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d when reading lease", status)
+	}
+
+	currentHolder := ""
+	if lease.Spec.HolderIdentity != nil {
+		currentHolder = *lease.Spec.HolderIdentity
+	}
+	expired := true
+	if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+		if renewTime, err := time.Parse(time.RFC3339Nano, *lease.Spec.RenewTime); err == nil {
+			expired = time.Since(renewTime) > time.Duration(*lease.Spec.LeaseDurationSeconds)*time.Second
+		}
+	}
+	if currentHolder != holder && currentHolder != "" && !expired {
+		return false, nil
+	}
+
+	if currentHolder != holder {
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+	// Update fails with 409 Conflict if other replica changed the lease meanwhile (resourceVersion check)
+	status, _, err = l.request(ctx, http.MethodPut, leasesPath+"/"+name, lease)
+	return err == nil && status == http.StatusOK, err
+}
+
+// Release implements LeaderLock
+func (l *kubernetesLeaseLock) Release(ctx context.Context, name string, holder string) (err error) {
+	leasesPath := "/apis/coordination.k8s.io/v1/namespaces/" + l.namespace + "/leases/" + name
+	status, lease, err := l.request(ctx, http.MethodGet, leasesPath, nil)
+	if err != nil || status != http.StatusOK {
+		return
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return
+	}
+	empty := ""
+	lease.Spec.HolderIdentity = &empty
+	_, _, err = l.request(ctx, http.MethodPut, leasesPath, lease)
+	return
+}
@@ -0,0 +1,134 @@
+package webservice
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLeaderElectorConfigureValidatesTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   string
+		valid bool
+	}{
+		{"default", "", true},
+		{"zero", "0s", false},
+		{"too short", "2ns", false},
+		{"valid", "3s", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			if test.ttl != "" {
+				config.Set("ttl", test.ttl)
+			}
+			le := NewLeaderElector(nil, "test", nil)
+			if err := le.Configure(config); (err == nil) != test.valid {
+				t.Fatalf("expected valid %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+// hangingLeaderLock grants the lock once, then hangs until context is done
+type hangingLeaderLock struct {
+	calls int
+}
+
+func (l *hangingLeaderLock) TryAcquire(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	l.calls++
+	if l.calls == 1 {
+		return true, nil
+	}
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func (l *hangingLeaderLock) Release(ctx context.Context, name string, holder string) error {
+	return nil
+}
+
+func TestLeaderElectorRevokesLeadershipOfHungBackend(t *testing.T) {
+	le := NewLeaderElector(&hangingLeaderLock{}, "test", nil)
+	config := viper.New()
+	config.Set("ttl", "1500ms")
+	if err := le.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	revoked := make(chan struct{})
+	le.OnRevoked(func() { close(revoked) })
+	if err := le.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer le.Stop(context.Background())
+
+	select {
+	case <-revoked:
+	case <-time.After(time.Millisecond * 1500):
+		t.Fatal("leadership is not revoked within ttl")
+	}
+}
+
+// sharedLeaderLock is lock shared by electors - equal holder owns the lock like in Redis acquire script
+type sharedLeaderLock struct {
+	mutex  sync.Mutex
+	holder string
+}
+
+// TryAcquire implements LeaderLock
+func (l *sharedLeaderLock) TryAcquire(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.holder == "" || l.holder == holder {
+		l.holder = holder
+		return true, nil
+	}
+	return false, nil
+}
+
+// Release implements LeaderLock
+func (l *sharedLeaderLock) Release(ctx context.Context, name string, holder string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+func TestLeaderElectorsOnSameHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		holders []string
+		leaders int
+	}{
+		{"default holders", []string{"", ""}, 1},
+		{"configured unique holders", []string{"a", "b"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &sharedLeaderLock{}
+			leaders := 0
+			for _, holder := range tt.holders {
+				le := NewLeaderElector(lock, "test", nil)
+				if holder != "" {
+					config := viper.New()
+					config.Set("holder", holder)
+					if err := le.Configure(config); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if acquired, _ := lock.TryAcquire(context.Background(), le.name, le.holder, le.ttl); acquired {
+					leaders++
+				}
+			}
+			if leaders != tt.leaders {
+				t.Fatalf("got %d leaders, want %d", leaders, tt.leaders)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// LifecycleStage identifies stage of web service lifecycle
+type LifecycleStage int
+
+const (
+	// StageConfigLoaded is emitted when configuration is loaded (by FastConfig or at the beginning of Start)
+	StageConfigLoaded LifecycleStage = iota
+	// StageRouterBuilt is emitted when all routes are configured
+	StageRouterBuilt
+	// StageListenerReady is emitted when listener is bound and service is ready for requests
+	StageListenerReady
+	// StageShutdownStarted is emitted when shutdown was requested
+	StageShutdownStarted
+)
+
+func (stage LifecycleStage) String() string {
+	switch stage {
+	case StageConfigLoaded:
+		return "config_loaded"
+	case StageRouterBuilt:
+		return "router_built"
+	case StageListenerReady:
+		return "listener_ready"
+	case StageShutdownStarted:
+		return "shutdown_started"
+	}
+	return fmt.Sprintf("stage_%d", int(stage))
+}
+
+// LifecycleEvent is passed to lifecycle hooks
+type LifecycleEvent struct {
+	Stage LifecycleStage
+	// Router is available from StageRouterBuilt
+	Router *mux.Router
+	// Addr is listen address, available from StageListenerReady
+	Addr string
+}
+
+// LifecycleHook is callback registered with OnEvent(). Error returned from hook before StageListenerReady
+// (inclusive) stops the service start, errors returned later are only logged.
+type LifecycleHook func(ctx context.Context, event *LifecycleEvent) (err error)
+
+// lifecycle holds registered hooks
+type lifecycle struct {
+	mutex   sync.Mutex
+	hooks   map[LifecycleStage][]LifecycleHook
+	emitted map[LifecycleStage]bool
+}
+
+// OnEvent registers hook for given lifecycle stage. Multiple hooks can be registered for the same stage,
+// they are called in order of registration.
+func (s *webservice) OnEvent(stage LifecycleStage, hook LifecycleHook) {
+	s.lifecycle.mutex.Lock()
+	defer s.lifecycle.mutex.Unlock()
+	if s.lifecycle.hooks == nil {
+		s.lifecycle.hooks = make(map[LifecycleStage][]LifecycleHook)
+	}
+	s.lifecycle.hooks[stage] = append(s.lifecycle.hooks[stage], hook)
+}
+
+// emit calls all hooks registered for event stage, first error stops processing
+func (s *webservice) emit(ctx context.Context, event *LifecycleEvent) (err error) {
+	s.lifecycle.mutex.Lock()
+	if s.lifecycle.emitted == nil {
+		s.lifecycle.emitted = make(map[LifecycleStage]bool)
+	}
+	s.lifecycle.emitted[event.Stage] = true
+	hooks := append([]LifecycleHook(nil), s.lifecycle.hooks[event.Stage]...)
+	s.lifecycle.mutex.Unlock()
+
+	Publish(ctx, s.eventBus, event)
+
+	for _, hook := range hooks {
+		err = hook(ctx, event)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).WithField("stage", event.Stage.String()).Errorf("lifecycle hook failed")
+			}
+			return
+		}
+	}
+	return
+}
+
+// wasEmitted returns if stage was already emitted
+func (s *webservice) wasEmitted(stage LifecycleStage) bool {
+	s.lifecycle.mutex.Lock()
+	defer s.lifecycle.mutex.Unlock()
+	return s.lifecycle.emitted[stage]
+}
+
+// emitLifecycleEvent emits event on web service created by New()
+func emitLifecycleEvent(ws WebService, event *LifecycleEvent) (err error) {
+	if s, ok := ws.(*webservice); ok {
+		err = s.emit(context.Background(), event)
+	}
+	return
+}
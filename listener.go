@@ -0,0 +1,50 @@
+package webservice
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixSocketPrefix is prefix of listen address of Unix domain socket (e.g. unix:///var/run/app.sock)
+const unixSocketPrefix = "unix://"
+
+// WithListener serves requests on given listener instead of listening on listen address (e.g. listener created
+// by tests, tsnet listener or custom TLS wrapper). Framework handles everything above the socket, listener is
+// closed on shutdown.
+func WithListener(listener net.Listener) Option {
+	return func(s *webservice) {
+		s.listener = listener
+	}
+}
+
+// listen binds TCP address or Unix domain socket (unix:///path). Stale socket file left by crashed process is
+// removed and socket permissions are set to mode if it is not zero. Socket file is removed when listener is closed.
+func listen(address string, mode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, unixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err = os.Chmod(path, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
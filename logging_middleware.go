@@ -3,6 +3,7 @@ package webservice
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -23,8 +24,8 @@ func NewLoggingMiddleware(logger *logrus.Logger) *Logging {
 func (l *Logging) Middleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.WithValue(r.Context(), contextTypeLogger, l.logger)
+		user := ""
 		if l.logger != nil {
-			user := ""
 			userInfo, ok := r.Context().Value(contextTypeUserInfo).(*UserInfo)
 			if ok && userInfo != nil && userInfo != unauthenticatedUser {
 
@@ -35,8 +36,36 @@ func (l *Logging) Middleware(h http.Handler) http.Handler {
 				}
 			}
 
-			l.logger.WithFields(logrus.Fields{"method": r.Method, "path": r.RequestURI, "user": user}).Debugf("request")
+			fields := logrus.Fields{"method": r.Method, "path": r.RequestURI, "user": user}
+			if tenant := TenantFromContext(r.Context()); tenant != "" {
+				fields["tenant"] = tenant
+			}
+			if geo := GeoInfoFromContext(r.Context()); geo != nil {
+				fields["client_ip"] = geo.IP
+				fields["country"] = geo.Country
+				fields["asn"] = geo.ASN
+			}
+			l.logger.WithFields(fields).Debugf("request")
+		}
+
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		if l.logger != nil {
+			fields := logrus.Fields{
+				"method":   r.Method,
+				"path":     r.RequestURI,
+				"route":    RouteTemplate(r),
+				"user":     user,
+				"status":   rec.Status(),
+				"bytes":    rec.BytesWritten(),
+				"duration": time.Since(start).String(),
+			}
+			if tenant := TenantFromContext(r.Context()); tenant != "" {
+				fields["tenant"] = tenant
+			}
+			l.logger.WithFields(fields).Debugf("response")
 		}
-		h.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,378 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// MailMessage is rendered email
+type MailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// MailTransport delivers rendered email
+type MailTransport interface {
+	Send(ctx context.Context, message *MailMessage) (err error)
+}
+
+// smtpTransport sends email over SMTP with STARTTLS (also Amazon SES SMTP interface)
+type smtpTransport struct {
+	host string
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPTransport creates SMTP transport. Amazon SES is used with host email-smtp.<region>.amazonaws.com,
+// port 587 and SES SMTP credentials.
+func NewSMTPTransport(host string, port int, username string, password string) MailTransport {
+	t := &smtpTransport{host: host, addr: net.JoinHostPort(host, strconv.Itoa(port))}
+	if username != "" {
+		t.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return t
+}
+
+// Send implements MailTransport - same as smtp.SendMail(), but the whole conversation is bound to ctx, so stuck
+// server doesn't block the caller
+func (t *smtpTransport) Send(ctx context.Context, message *MailMessage) (err error) {
+	data, err := message.encode()
+	if err != nil {
+		return
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+			return
+		}
+	}
+	if t.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err = client.Auth(t.auth); err != nil {
+			return
+		}
+	}
+	if err = client.Mail(message.From); err != nil {
+		return
+	}
+	for _, to := range message.To {
+		if err = client.Rcpt(to); err != nil {
+			return
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(data); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	return client.Quit()
+}
+
+// encode returns MIME encoded message (multipart/alternative if both text and HTML are set)
+func (m *MailMessage) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := "localhost"
+	if at := strings.LastIndex(m.From, "@"); at >= 0 {
+		domain = strings.Trim(m.From[at+1:], ">")
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(m.Text)
+		return buf.Bytes(), nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	for _, part := range []struct{ contentType, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		if part.body == "" {
+			continue
+		}
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType + "; charset=utf-8"}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write([]byte(part.body))
+	}
+	err := writer.Close()
+	return buf.Bytes(), err
+}
+
+// Mailer renders templated emails and sends them from retry queue. Templates are read from file system (e.g.
+// embed.FS): <name>.subject.txt, <name>.txt and optional <name>.html. It is a Component configured from mailer.*
+// keys (host, port, username, password, from, retries, queue_size) and it is available to handlers with
+// MailerFromContext().
+type Mailer struct {
+	From      string
+	Transport MailTransport
+	Retries   int
+	QueueSize int
+	templates fs.FS
+	logger    *logrus.Logger
+	mutex     sync.RWMutex
+	running   bool
+	queue     chan *mailJob
+	cancel    context.CancelFunc
+	sent      *prometheus.CounterVec
+	failed    *prometheus.CounterVec
+	wg        sync.WaitGroup
+}
+
+// mailJob is queued email
+type mailJob struct {
+	template string
+	message  *MailMessage
+}
+
+// NewMailer creates mailer with templates
+func NewMailer(templates fs.FS, logger *logrus.Logger) *Mailer {
+	return &Mailer{
+		Retries:   3,
+		QueueSize: 100,
+		templates: templates,
+		logger:    logger,
+	}
+}
+
+// MailerFromContext returns mailer registered in service (nil if not available)
+func MailerFromContext(ctx context.Context) *Mailer {
+	mailer, _ := ctx.Value(contextTypeMailer).(*Mailer)
+	return mailer
+}
+
+// Name implements Component
+func (m *Mailer) Name() string {
+	return "mailer"
+}
+
+// Configure implements Component
+func (m *Mailer) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("from") {
+		m.From = config.GetString("from")
+	}
+	if config.IsSet("retries") {
+		m.Retries = config.GetInt("retries")
+	}
+	if config.IsSet("queue_size") {
+		m.QueueSize = config.GetInt("queue_size")
+	}
+	if m.Transport == nil {
+		if !config.IsSet("host") {
+			return fmt.Errorf("mailer host is not configured")
+		}
+		port := 587
+		if config.IsSet("port") {
+			port = config.GetInt("port")
+		}
+		m.Transport = NewSMTPTransport(config.GetString("host"), port, config.GetString("username"), config.GetString("password"))
+	}
+	if m.From == "" {
+		err = fmt.Errorf("mailer sender (from) is not configured")
+	}
+
+	m.sent = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mail_sent_total",
+		Help: "Number of sent emails.",
+	}, []string{"template"})).(*prometheus.CounterVec)
+	m.failed = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mail_failed_total",
+		Help: "Number of emails not delivered after all retries.",
+	}, []string{"template"})).(*prometheus.CounterVec)
+	return
+}
+
+// Routes implements Component - mailer is added to request context
+func (m *Mailer) Routes(router *mux.Router) (err error) {
+	router.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextTypeMailer, m)))
+		})
+	})
+	return
+}
+
+// Start implements Component - starts delivery worker
+func (m *Mailer) Start(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.queue = make(chan *mailJob, m.QueueSize)
+	workerCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.running = true
+	m.wg.Add(1)
+	go m.worker(workerCtx, m.queue)
+	return
+}
+
+// Stop implements Component - queued emails are delivered before stop, delivery is aborted when ctx is done
+func (m *Mailer) Stop(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	if !m.running {
+		m.mutex.Unlock()
+		return
+	}
+	m.running = false
+	close(m.queue)
+	m.mutex.Unlock()
+	defer m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// Render renders message from template
+func (m *Mailer) Render(name string, to []string, data interface{}) (message *MailMessage, err error) {
+	message = &MailMessage{From: m.From, To: to}
+	if message.Subject, err = m.renderText(name+".subject.txt", data); err != nil {
+		return
+	}
+	message.Subject = strings.TrimSpace(message.Subject)
+	if message.Text, err = m.renderText(name+".txt", data); err != nil {
+		return
+	}
+	if _, statErr := fs.Stat(m.templates, name+".html"); statErr == nil {
+		var tmpl *htmltemplate.Template
+		tmpl, err = htmltemplate.ParseFS(m.templates, name+".html")
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, data); err != nil {
+			return
+		}
+		message.HTML = buf.String()
+	}
+	return
+}
+
+// renderText renders text template
+func (m *Mailer) renderText(file string, data interface{}) (string, error) {
+	tmpl, err := template.ParseFS(m.templates, file)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	return buf.String(), err
+}
+
+// Send renders template and queues email for delivery. Error is returned if rendering fails, queue is full or
+// mailer is not running.
+func (m *Mailer) Send(ctx context.Context, name string, to []string, data interface{}) (err error) {
+	message, err := m.Render(name, to, data)
+	if err != nil {
+		return
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if !m.running {
+		return fmt.Errorf("mailer is not running")
+	}
+	select {
+	case m.queue <- &mailJob{template: name, message: message}:
+	default:
+		err = fmt.Errorf("mail queue is full")
+	}
+	return
+}
+
+// worker delivers queued emails with exponential backoff until ctx is cancelled
+func (m *Mailer) worker(ctx context.Context, queue chan *mailJob) {
+	defer m.wg.Done()
+	for job := range queue {
+		var err error
+		backoff := time.Second
+		for attempt := 0; attempt <= m.Retries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+				}
+				backoff *= 2
+			}
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+			err = m.Transport.Send(sendCtx, job.message)
+			cancel()
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			m.failed.WithLabelValues(job.template).Inc()
+			if m.logger != nil {
+				m.logger.WithError(err).WithField("template", job.template).Error("unable to send email")
+			}
+			continue
+		}
+		m.sent.WithLabelValues(job.template).Inc()
+	}
+}
@@ -0,0 +1,88 @@
+package webservice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSMTPTransportHonorsContext(t *testing.T) {
+	// Server accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	transport := NewSMTPTransport("127.0.0.1", addr.Port, "", "")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	err = transport.Send(ctx, &MailMessage{From: "a@example.com", To: []string{"b@example.com"}, Text: "hi"})
+	if err == nil || time.Since(start) > time.Second {
+		t.Fatalf("expected timeout error, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestMailerSendAfterStop(t *testing.T) {
+	templates := fstest.MapFS{
+		"hello.subject.txt": {Data: []byte("Hello")},
+		"hello.txt":         {Data: []byte("Hello {{.}}")},
+	}
+	blocked := make(chan struct{})
+	mailer := NewMailer(templates, nil)
+	mailer.From = "service@example.com"
+	mailer.Transport = mailTransportFunc(func(ctx context.Context, message *MailMessage) error {
+		<-ctx.Done()
+		close(blocked)
+		return ctx.Err()
+	})
+	if err := mailer.Configure(viper.New()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := mailer.Send(ctx, "hello", []string{"user@example.com"}, "user"); err == nil {
+		t.Fatal("expected error before start")
+	}
+	if err := mailer.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.Send(ctx, "hello", []string{"user@example.com"}, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stuck delivery is aborted when stop context is done
+	stopCtx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+	if err := mailer.Stop(stopCtx); err == nil {
+		t.Fatal("expected stop timeout")
+	}
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("delivery is not aborted")
+	}
+	if err := mailer.Send(ctx, "hello", []string{"user@example.com"}, "user"); err == nil {
+		t.Fatal("expected error after stop")
+	}
+}
+
+type mailTransportFunc func(ctx context.Context, message *MailMessage) error
+
+func (f mailTransportFunc) Send(ctx context.Context, message *MailMessage) error {
+	return f(ctx, message)
+}
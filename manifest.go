@@ -0,0 +1,235 @@
+package webservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// ManifestSchema identifies version of service manifest document, it changes only with incompatible changes
+const ManifestSchema = "webservice.service-manifest/v1"
+
+// manifestPath is location of service manifest
+const manifestPath = "/.well-known/service-manifest"
+
+// ManifestOptions is a configuration container for service manifest
+type ManifestOptions struct {
+	// Service name, default is name of main module
+	Name string
+	// Service version, default is version of main module or VCS revision
+	Version string
+	// Declared API versions, versions found in route paths (e.g. /api/v2/...) are added
+	APIVersions []string
+	// Additional free-form attributes (team, repository, ...)
+	Meta map[string]string
+}
+
+// ManifestOptionsFromViper reads manifest options (name, version, api_versions, meta), nil is returned if it is
+// not enabled
+func ManifestOptionsFromViper(prefix string) *ManifestOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &ManifestOptions{
+		Name:        viper.GetString(prefix + "name"),
+		Version:     viper.GetString(prefix + "version"),
+		APIVersions: viper.GetStringSlice(prefix + "api_versions"),
+		Meta:        viper.GetStringMapString(prefix + "meta"),
+	}
+}
+
+// ServiceManifest is self-description of service served at /.well-known/service-manifest
+type ServiceManifest struct {
+	Schema      string               `json:"schema"`
+	Name        string               `json:"name"`
+	Version     string               `json:"version,omitempty"`
+	Build       ManifestBuild        `json:"build"`
+	APIVersions []string             `json:"api_versions"`
+	RouteGroups []ManifestRouteGroup `json:"route_groups"`
+	Health      ManifestHealth       `json:"health"`
+	Meta        map[string]string    `json:"meta,omitempty"`
+}
+
+// ManifestBuild describes build of service binary
+type ManifestBuild struct {
+	Module    string `json:"module,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// ManifestRouteGroup describes routes sharing path prefix (mount prefix or first path segment with API version)
+type ManifestRouteGroup struct {
+	Prefix string   `json:"prefix"`
+	Routes int      `json:"routes"`
+	Scopes []string `json:"scopes"`
+	Groups []string `json:"groups,omitempty"`
+	// Some route of the group can be called without token
+	Anonymous bool `json:"anonymous"`
+}
+
+// ManifestHealth contains locations of operational endpoints
+type ManifestHealth struct {
+	Liveness  string `json:"liveness"`
+	Readiness string `json:"readiness"`
+	Status    string `json:"status"`
+	Metrics   string `json:"metrics,omitempty"`
+}
+
+// apiVersionSegment matches path segment with API version (v1, v2beta, ...)
+var apiVersionSegment = regexp.MustCompile(`^v[0-9]+([a-z]+[0-9]*)?$`)
+
+// manifestBuild reads build info of binary
+func manifestBuild() (build ManifestBuild, version string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	build.Module = info.Main.Path
+	build.GoVersion = info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	version = info.Main.Version
+	if version == "" || version == "(devel)" {
+		version = build.Revision
+	}
+	return
+}
+
+// routeGroupPrefix returns group of route path relative to strip path
+func (s *webservice) routeGroupPrefix(path string) string {
+	for _, m := range s.mounts {
+		if strings.HasPrefix(path, m.prefix) {
+			return m.prefix
+		}
+	}
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	if len(segments) > 1 && apiVersionSegment.MatchString(segments[1]) {
+		return "/" + segments[0] + "/" + segments[1]
+	}
+	return "/" + segments[0]
+}
+
+// serviceManifest describes service from routes registered in router
+func (s *webservice) serviceManifest(router *mux.Router, options *ManifestOptions) *ServiceManifest {
+	base := ""
+	if s.stripPath != "/" {
+		base = strings.TrimSuffix(s.stripPath, "/")
+	}
+	manifest := &ServiceManifest{
+		Schema:      ManifestSchema,
+		Name:        options.Name,
+		Version:     options.Version,
+		APIVersions: []string{},
+		RouteGroups: []ManifestRouteGroup{},
+		Health: ManifestHealth{
+			Liveness:  base + "/healthz",
+			Readiness: base + "/readyz",
+			Status:    base + "/status",
+		},
+		Meta: options.Meta,
+	}
+	var version string
+	manifest.Build, version = manifestBuild()
+	if manifest.Name == "" {
+		manifest.Name = buildServiceName()
+	}
+	if manifest.Version == "" {
+		manifest.Version = version
+	}
+	if s.enablePrometheusMetrics {
+		manifest.Health.Metrics = base + "/metrics"
+	}
+
+	versions := map[string]bool{}
+	for _, v := range options.APIVersions {
+		versions[v] = true
+	}
+	groups := map[string]*ManifestRouteGroup{}
+	scopes := map[string]map[string]bool{}
+	for _, ra := range s.resolvedRouteAuthorizationReport(router) {
+		path := strings.TrimPrefix(ra.Path, base)
+		if operationalRoutes[path] || path == manifestPath || strings.HasPrefix(path, "/debug/") || strings.HasPrefix(path, "/console") || path == "" {
+			continue
+		}
+		prefix := s.routeGroupPrefix(path)
+		group, ok := groups[prefix]
+		if !ok {
+			group = &ManifestRouteGroup{Prefix: base + prefix, Scopes: []string{}}
+			groups[prefix] = group
+			scopes[prefix] = map[string]bool{}
+		}
+		group.Routes++
+		group.Anonymous = group.Anonymous || ra.allowsAnonymous()
+		for _, scope := range ra.Scopes {
+			if scope != "" && !scopes[prefix][scope] {
+				scopes[prefix][scope] = true
+				group.Scopes = append(group.Scopes, scope)
+			}
+		}
+		group.Groups = appendMissing(group.Groups, ra.Groups...)
+		for _, segment := range strings.Split(path, "/") {
+			if apiVersionSegment.MatchString(segment) {
+				versions[segment] = true
+			}
+		}
+	}
+	for _, group := range groups {
+		sort.Strings(group.Scopes)
+		sort.Strings(group.Groups)
+		manifest.RouteGroups = append(manifest.RouteGroups, *group)
+	}
+	sort.Slice(manifest.RouteGroups, func(i, j int) bool {
+		return manifest.RouteGroups[i].Prefix < manifest.RouteGroups[j].Prefix
+	})
+	for v := range versions {
+		manifest.APIVersions = append(manifest.APIVersions, v)
+	}
+	sort.Strings(manifest.APIVersions)
+	return manifest
+}
+
+// appendMissing appends values not present in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, item := range list {
+			if item == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// manifestHandler serves service manifest, it is built on first request when all routes are registered
+func (s *webservice) manifestHandler(router *mux.Router, options *ManifestOptions) HandlerFn {
+	var once sync.Once
+	var manifest *ServiceManifest
+	return func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		once.Do(func() {
+			manifest = s.serviceManifest(router, options)
+		})
+		return json.NewEncoder(w).Encode(manifest)
+	}
+}
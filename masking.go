@@ -0,0 +1,111 @@
+package webservice
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maskedValue replaces values of secret keys
+const maskedValue = "*****"
+
+var (
+	maskMutex    sync.RWMutex
+	maskPatterns = []string{"*password*", "*secret*", "*token*", "*api_key*", "*apikey*", "*private_key*"}
+)
+
+// SetMaskPatterns replaces patterns of secret keys masked in /status, --print-config and logs. Patterns are
+// case insensitive globs (e.g. *password*).
+func SetMaskPatterns(patterns ...string) {
+	maskMutex.Lock()
+	defer maskMutex.Unlock()
+	maskPatterns = patterns
+}
+
+// AddMaskPatterns adds patterns of secret keys to default ones
+func AddMaskPatterns(patterns ...string) {
+	maskMutex.Lock()
+	defer maskMutex.Unlock()
+	maskPatterns = append(append([]string{}, maskPatterns...), patterns...)
+}
+
+// IsSecretKey returns if value of given key should be masked
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	maskMutex.RLock()
+	defer maskMutex.RUnlock()
+	for _, pattern := range maskPatterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskSecrets returns copy of value (struct, map, ...) converted to JSON types with values of secret keys masked
+func MaskSecrets(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var generic interface{}
+	if err = json.Unmarshal(data, &generic); err != nil {
+		return value
+	}
+	return maskGeneric(generic)
+}
+
+// maskGeneric masks secrets in decoded JSON or configuration values
+func maskGeneric(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if IsSecretKey(key) && item != nil && item != "" {
+				v[key] = maskedValue
+			} else {
+				v[key] = maskGeneric(item)
+			}
+		}
+	case []interface{}:
+		for idx := range v {
+			v[idx] = maskGeneric(v[idx])
+		}
+	}
+	return value
+}
+
+// maskingHook masks log fields with secret keys
+type maskingHook struct{}
+
+// Levels implements logrus.Hook
+func (maskingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (maskingHook) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		if IsSecretKey(key) {
+			if s, ok := value.(string); !ok || s != "" {
+				entry.Data[key] = maskedValue
+			}
+		}
+	}
+	return nil
+}
+
+// addMaskingHook adds masking of secret fields to logger (once)
+func addMaskingHook(logger *logrus.Logger) {
+	if logger == nil {
+		return
+	}
+	for _, hook := range logger.Hooks[logrus.InfoLevel] {
+		if _, ok := hook.(maskingHook); ok {
+			return
+		}
+	}
+	logger.AddHook(maskingHook{})
+}
@@ -0,0 +1,370 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Metering keys - what the usage is counted for
+const (
+	MeteringKeyAPIKey = "api_key"
+	MeteringKeyTenant = "tenant"
+	MeteringKeyUser   = "user"
+)
+
+// UsageRecord is usage of single key in aggregation window
+type UsageRecord struct {
+	Key         string    `json:"key"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Requests    int64     `json:"requests"`
+	Errors      int64     `json:"errors"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+}
+
+// UsageExporter exports usage of closed windows (webhook, CSV, Kafka producer adapter, ...)
+type UsageExporter interface {
+	Export(ctx context.Context, records []UsageRecord) (err error)
+}
+
+// UsageExporterFunc is function implementing UsageExporter
+type UsageExporterFunc func(ctx context.Context, records []UsageRecord) (err error)
+
+// Export implements UsageExporter
+func (f UsageExporterFunc) Export(ctx context.Context, records []UsageRecord) (err error) {
+	return f(ctx, records)
+}
+
+// Metering counts requests and bytes per API key, tenant or user, aggregates them in windows and exports closed
+// windows for billing. It is a Component, its configuration keys are metering.key (api_key, tenant or user,
+// default api_key), metering.window (default 1 hour), metering.webhook_url, metering.csv_dir and
+// metering.admin_scope (scope of GET /admin/usage, default admin). Only authenticated requests are metered - API
+// key is the key ID ("kid" claim) of identity authenticated by signed request or API key IdentitySource, secret
+// key never leaves the service.
+type Metering struct {
+	// Function returning metering key of request, it replaces key from configuration. Requests with empty key
+	// are not metered. Key must not be taken from unauthenticated input, anyone could bill usage to any key.
+	KeyFn      func(r *http.Request, userInfo *UserInfo) string
+	logger     *logrus.Logger
+	exporters  []UsageExporter
+	key        string
+	window     time.Duration
+	adminScope string
+	mutex      sync.Mutex
+	current    map[string]*UsageRecord
+	start      time.Time
+	// closed windows not delivered yet, per exporter
+	pending [][]UsageRecord
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewMetering creates metering component exporting usage by given exporters (in addition to configured ones)
+func NewMetering(logger *logrus.Logger, exporters ...UsageExporter) *Metering {
+	return &Metering{
+		logger:     logger,
+		exporters:  exporters,
+		key:        MeteringKeyAPIKey,
+		window:     time.Hour,
+		adminScope: "admin",
+		current:    map[string]*UsageRecord{},
+	}
+}
+
+// Name implements Component
+func (m *Metering) Name() string {
+	return "metering"
+}
+
+// Configure implements Component
+func (m *Metering) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("key") {
+		m.key = config.GetString("key")
+	}
+	if config.IsSet("window") {
+		m.window = config.GetDuration("window")
+	}
+	if config.IsSet("admin_scope") {
+		m.adminScope = config.GetString("admin_scope")
+	}
+	if m.window <= 0 {
+		return fmt.Errorf("metering window must be positive")
+	}
+	switch m.key {
+	case MeteringKeyAPIKey, MeteringKeyTenant, MeteringKeyUser:
+	default:
+		return fmt.Errorf("unknown metering key %q", m.key)
+	}
+	if url := config.GetString("webhook_url"); url != "" {
+		m.exporters = append(m.exporters, NewWebhookUsageExporter(url, nil))
+	}
+	if dir := config.GetString("csv_dir"); dir != "" {
+		m.exporters = append(m.exporters, NewCSVUsageExporter(dir))
+	}
+	return
+}
+
+// Routes implements Component - requests are metered and GET /admin/usage returns usage of current window
+func (m *Metering) Routes(router *mux.Router) (err error) {
+	router.Use(m.middleware)
+	router.Handle("/admin/usage", AppHandler(m.usageHandler).AllowScopes(m.adminScope)).Methods(http.MethodGet)
+	return
+}
+
+// Start implements Component - closed windows are exported in background
+func (m *Metering) Start(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	m.start = time.Now().Truncate(m.window)
+	m.mutex.Unlock()
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.run()
+	return
+}
+
+// Stop implements Component - usage of current window is exported
+func (m *Metering) Stop(ctx context.Context) (err error) {
+	close(m.stop)
+	<-m.done
+	m.rotate(time.Now())
+	return m.export(ctx)
+}
+
+// run closes windows at their end
+func (m *Metering) run() {
+	defer close(m.done)
+	for {
+		m.mutex.Lock()
+		end := m.start.Add(m.window)
+		m.mutex.Unlock()
+		select {
+		case <-m.stop:
+			return
+		case <-time.After(time.Until(end)):
+		}
+		m.rotate(time.Now())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := m.export(ctx); err != nil && m.logger != nil {
+			m.logger.WithError(err).Error("metering: unable to export usage, it is retried with next window")
+		}
+		cancel()
+	}
+}
+
+// rotate closes current window
+func (m *Metering) rotate(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	end := m.start.Add(m.window)
+	if end.After(now) {
+		end = now
+	}
+	for len(m.pending) < len(m.exporters) {
+		m.pending = append(m.pending, nil)
+	}
+	for _, record := range m.current {
+		record.WindowEnd = end
+		for idx := range m.exporters {
+			m.pending[idx] = append(m.pending[idx], *record)
+		}
+	}
+	m.current = map[string]*UsageRecord{}
+	m.start = now.Truncate(m.window)
+}
+
+// export sends closed windows to exporters. Delivery is tracked per exporter - records are kept only for
+// exporters which failed, so they are not sent twice to the other ones.
+func (m *Metering) export(ctx context.Context) (err error) {
+	m.mutex.Lock()
+	pending := m.pending
+	m.pending = make([][]UsageRecord, len(pending))
+	m.mutex.Unlock()
+
+	var errs []error
+	for idx, records := range pending {
+		if len(records) == 0 {
+			continue
+		}
+		if exportErr := m.exporters[idx].Export(ctx, records); exportErr != nil {
+			errs = append(errs, exportErr)
+			m.mutex.Lock()
+			m.pending[idx] = append(records, m.pending[idx]...)
+			m.mutex.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// meteringKey returns key of request
+func (m *Metering) meteringKey(r *http.Request) string {
+	userInfo, _ := r.Context().Value(contextTypeUserInfo).(*UserInfo)
+	if userInfo == unauthenticatedUser || userInfo == userWithInvalidToken {
+		userInfo = nil
+	}
+	if m.KeyFn != nil {
+		return m.KeyFn(r, userInfo)
+	}
+	if userInfo == nil {
+		return ""
+	}
+	switch m.key {
+	case MeteringKeyTenant:
+		return TenantFromContext(r.Context())
+	case MeteringKeyUser:
+		return userInfo.UserID
+	}
+	return userInfo.ClaimString("kid")
+}
+
+// middleware counts requests and bytes
+func (m *Metering) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := m.meteringKey(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		record, ok := m.current[key]
+		if !ok {
+			record = &UsageRecord{Key: key, WindowStart: m.start}
+			m.current[key] = record
+		}
+		record.Requests++
+		if rec.Status() >= http.StatusInternalServerError {
+			record.Errors++
+		}
+		if r.ContentLength > 0 {
+			record.BytesIn += r.ContentLength
+		}
+		record.BytesOut += int64(rec.BytesWritten())
+	})
+}
+
+// Usage returns usage of current window sorted by key
+func (m *Metering) Usage() (records []UsageRecord) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, record := range m.current {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Key < records[j].Key })
+	return
+}
+
+// usageHandler returns usage of current window, optionally of single key (?key=)
+func (m *Metering) usageHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) (err error) {
+	records := []UsageRecord{}
+	key := r.URL.Query().Get("key")
+	for _, record := range m.Usage() {
+		if key == "" || record.Key == key {
+			records = append(records, record)
+		}
+	}
+	return WriteJSON(w, r, records)
+}
+
+// webhookUsageExporter posts usage records as JSON array
+type webhookUsageExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookUsageExporter creates exporter posting usage records as JSON array to url, default client is used if
+// client is nil
+func NewWebhookUsageExporter(url string, client *http.Client) UsageExporter {
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 30}
+	}
+	return &webhookUsageExporter{url: url, client: client}
+}
+
+// Export implements UsageExporter
+func (e *webhookUsageExporter) Export(ctx context.Context, records []UsageRecord) (err error) {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("usage webhook: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return
+}
+
+// csvUsageExporter appends usage records to daily CSV files
+type csvUsageExporter struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewCSVUsageExporter creates exporter appending usage records to daily files usage-YYYY-MM-DD.csv in dir
+func NewCSVUsageExporter(dir string) UsageExporter {
+	return &csvUsageExporter{dir: dir}
+}
+
+// Export implements UsageExporter
+func (e *csvUsageExporter) Export(ctx context.Context, records []UsageRecord) (err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if err = os.MkdirAll(e.dir, 0o700); err != nil {
+		return
+	}
+	path := filepath.Join(e.dir, "usage-"+time.Now().UTC().Format("2006-01-02")+".csv")
+	_, statErr := os.Stat(path)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if os.IsNotExist(statErr) {
+		writer.Write([]string{"key", "window_start", "window_end", "requests", "errors", "bytes_in", "bytes_out"})
+	}
+	for _, record := range records {
+		writer.Write([]string{
+			record.Key,
+			record.WindowStart.UTC().Format(time.RFC3339),
+			record.WindowEnd.UTC().Format(time.RFC3339),
+			strconv.FormatInt(record.Requests, 10),
+			strconv.FormatInt(record.Errors, 10),
+			strconv.FormatInt(record.BytesIn, 10),
+			strconv.FormatInt(record.BytesOut, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
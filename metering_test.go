@@ -0,0 +1,92 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMeteringKeyIgnoresUnauthenticatedAPIKey(t *testing.T) {
+	hmacUser := &UserInfo{UserID: "partner", Claims: map[string]interface{}{"kid": "key-1", "auth": HMACAuthScheme}}
+	tests := []struct {
+		name     string
+		key      string
+		userInfo *UserInfo
+		expected string
+	}{
+		{"anonymous with API key", MeteringKeyAPIKey, unauthenticatedUser, ""},
+		{"invalid token with API key", MeteringKeyAPIKey, userWithInvalidToken, ""},
+		{"no user with API key", MeteringKeyAPIKey, nil, ""},
+		{"user without key ID", MeteringKeyAPIKey, &UserInfo{UserID: "u1"}, ""},
+		{"authenticated key", MeteringKeyAPIKey, hmacUser, "key-1"},
+		{"user", MeteringKeyUser, hmacUser, "partner"},
+		{"anonymous user", MeteringKeyUser, unauthenticatedUser, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMetering(nil)
+			m.key = test.key
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-API-Key", "victim-key")
+			if test.userInfo != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextTypeUserInfo, test.userInfo))
+			}
+			if key := m.meteringKey(req); key != test.expected {
+				t.Fatalf("expected key %q, got %q", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestMeteringExportTracksDeliveryPerExporter(t *testing.T) {
+	var delivered, attempts int
+	fail := true
+	ok := UsageExporterFunc(func(ctx context.Context, records []UsageRecord) error {
+		delivered += len(records)
+		return nil
+	})
+	flaky := UsageExporterFunc(func(ctx context.Context, records []UsageRecord) error {
+		attempts++
+		if fail {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	m := NewMetering(nil, ok, flaky)
+	m.start = time.Now().Truncate(time.Hour)
+	m.current["key-1"] = &UsageRecord{Key: "key-1", Requests: 1}
+	m.rotate(time.Now())
+
+	if err := m.export(context.Background()); err == nil {
+		t.Fatal("expected export error")
+	}
+	fail = false
+	if err := m.export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 1 {
+		t.Fatalf("successful exporter received %d records, expected 1", delivered)
+	}
+	if attempts != 2 {
+		t.Fatalf("failed exporter was called %d times, expected 2", attempts)
+	}
+	if err := m.export(context.Background()); err != nil || attempts != 2 {
+		t.Fatalf("records delivered again: %v, %d", err, attempts)
+	}
+}
+
+func TestMeteringDoesNotCountAnonymousRequests(t *testing.T) {
+	m := NewMetering(nil)
+	handler := m.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", "random")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if usage := m.Usage(); len(usage) != 0 {
+		t.Fatalf("anonymous usage recorded: %+v", usage)
+	}
+}
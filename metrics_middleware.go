@@ -0,0 +1,168 @@
+package webservice
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// unmatchedRoute is used as route label for requests without matched route
+const unmatchedRoute = "unmatched"
+
+// requestMetrics contains prometheus collectors for served requests
+type requestMetrics struct {
+	requestDuration *prometheus.HistogramVec
+	requestsTotal   *prometheus.CounterVec
+}
+
+var defaultRequestMetrics *requestMetrics
+var defaultRequestMetricsOnce sync.Once
+
+// getRequestMetrics returns request metrics registered in default prometheus registry
+func getRequestMetrics() *requestMetrics {
+	defaultRequestMetricsOnce.Do(func() {
+		m := &requestMetrics{
+			requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "http_request_duration_seconds",
+				Help:    "Duration of HTTP requests by route template.",
+				Buckets: prometheus.DefBuckets,
+			}, []string{"method", "route", "code"}),
+			requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "http_requests_total",
+				Help: "Number of HTTP requests by route template.",
+			}, []string{"method", "route", "code"}),
+		}
+		m.requestDuration = registerCollector(m.requestDuration).(*prometheus.HistogramVec)
+		m.requestsTotal = registerCollector(m.requestsTotal).(*prometheus.CounterVec)
+		defaultRequestMetrics = m
+	})
+	return defaultRequestMetrics
+}
+
+// registerCollector registers collector in default registry. If collector is already registered, existing one is returned
+func registerCollector(c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+	}
+	return c
+}
+
+// RouteMetricsOptions configures metrics of single route
+type RouteMetricsOptions struct {
+	// Histogram buckets (in seconds) of separate http_route_request_duration_seconds histogram of the route, route
+	// is still observed in http_request_duration_seconds with default buckets
+	Buckets []float64 `mapstructure:"buckets"`
+	// Target latency of the route - requests are counted as met/missed in http_request_slo_total
+	Objective time.Duration `mapstructure:"objective"`
+}
+
+// RouteMetricsOptionsFromViper reads per-route metrics options - list of {route, buckets, objective} under given key
+// (e.g. metrics.routes: [{route: "/users/{id}", buckets: [0.01, 0.05, 0.1], objective: 50ms}])
+func RouteMetricsOptionsFromViper(key string) (options map[string]*RouteMetricsOptions) {
+	var routes []struct {
+		Route               string `mapstructure:"route"`
+		RouteMetricsOptions `mapstructure:",squash"`
+	}
+	if err := viper.UnmarshalKey(key, &routes); err != nil || len(routes) == 0 {
+		return nil
+	}
+	options = make(map[string]*RouteMetricsOptions)
+	for idx := range routes {
+		o := routes[idx].RouteMetricsOptions
+		options[routes[idx].Route] = &o
+	}
+	return
+}
+
+// routeMetrics contains collectors for route with custom options
+type routeMetrics struct {
+	requestDuration *prometheus.HistogramVec
+	objective       time.Duration
+}
+
+// metricsMiddleware records request metrics labeled by route template
+type metricsMiddleware struct {
+	*requestMetrics
+	sloTotal *prometheus.CounterVec
+	routes   map[string]*routeMetrics
+}
+
+// newMetricsMiddleware creates metrics middleware with per-route options
+func newMetricsMiddleware(options map[string]*RouteMetricsOptions) *metricsMiddleware {
+	m := &metricsMiddleware{
+		requestMetrics: getRequestMetrics(),
+		routes:         make(map[string]*routeMetrics),
+	}
+
+	hasObjective := false
+	for route, o := range options {
+		if o == nil {
+			continue
+		}
+		rm := &routeMetrics{objective: o.Objective}
+		if len(o.Buckets) > 0 {
+			// Route is constant label, so buckets can differ per route
+			rm.requestDuration = registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:        "http_route_request_duration_seconds",
+				Help:        "Duration of HTTP requests of routes with custom buckets.",
+				Buckets:     o.Buckets,
+				ConstLabels: prometheus.Labels{"route": route},
+			}, []string{"method", "code"})).(*prometheus.HistogramVec)
+		}
+		if o.Objective > 0 {
+			hasObjective = true
+			objectiveGauge := registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+				Name:        "http_request_slo_objective_seconds",
+				Help:        "Target latency of the route.",
+				ConstLabels: prometheus.Labels{"route": route},
+			})).(prometheus.Gauge)
+			objectiveGauge.Set(o.Objective.Seconds())
+		}
+		m.routes[route] = rm
+	}
+
+	if hasObjective {
+		m.sloTotal = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_request_slo_total",
+			Help: "Number of HTTP requests that met or missed latency objective of the route.",
+		}, []string{"method", "route", "result"})).(*prometheus.CounterVec)
+	}
+	return m
+}
+
+// Middleware returns middleware function that records request metrics labeled by route template
+func (m *metricsMiddleware) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+		duration := time.Since(start)
+
+		route := RouteTemplate(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := strconv.Itoa(rec.Status())
+		m.requestsTotal.WithLabelValues(r.Method, route, code).Inc()
+
+		m.requestDuration.WithLabelValues(r.Method, route, code).Observe(duration.Seconds())
+		rm := m.routes[route]
+		if rm != nil && rm.requestDuration != nil {
+			rm.requestDuration.WithLabelValues(r.Method, code).Observe(duration.Seconds())
+		}
+
+		if rm != nil && rm.objective > 0 {
+			result := "met"
+			if duration > rm.objective {
+				result = "missed"
+			}
+			m.sloTotal.WithLabelValues(r.Method, route, result).Inc()
+		}
+	})
+}
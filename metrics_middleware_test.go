@@ -0,0 +1,57 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// histogramCount returns number of observations of histogram
+func histogramCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+	if err := observer.(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsRouteBuckets(t *testing.T) {
+	m := newMetricsMiddleware(map[string]*RouteMetricsOptions{
+		"/metrics-test/custom": {Buckets: []float64{0.001, 0.01}},
+	})
+	tests := []struct {
+		name       string
+		route      string
+		wantCustom bool
+	}{
+		{"route with custom buckets", "/metrics-test/custom", true},
+		{"route with default buckets", "/metrics-test/default", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global := m.requestDuration.WithLabelValues(http.MethodGet, tt.route, "200")
+			before := histogramCount(t, global)
+			var custom prometheus.Observer
+			var customBefore uint64
+			if tt.wantCustom {
+				custom = m.routes[tt.route].requestDuration.WithLabelValues(http.MethodGet, "200")
+				customBefore = histogramCount(t, custom)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, tt.route, nil)
+			r = r.WithContext(context.WithValue(r.Context(), contextTypeRouteTemplate, &requestRoute{template: tt.route}))
+			m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if histogramCount(t, global) != before+1 {
+				t.Fatal("request was not observed in global histogram")
+			}
+			if tt.wantCustom && histogramCount(t, custom) != customBefore+1 {
+				t.Fatal("request was not observed in route histogram")
+			}
+		})
+	}
+}
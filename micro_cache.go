@@ -0,0 +1,128 @@
+package webservice
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// maxMicroCacheEntries limits number of cached variants (negotiation headers are set by client)
+const maxMicroCacheEntries = 64
+
+// cachedResponse is response stored by micro cache
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// microCache caches GET responses of cheap-but-hot endpoints (/status, /metrics) for short time, so aggressive
+// monitors don't consume handler capacity. Concurrent requests for expired entry wait for single refresh of the
+// entry. Requests with query are not cached.
+type microCache struct {
+	ttl     time.Duration
+	handler http.Handler
+	mutex   sync.Mutex
+	entries map[string]*cachedResponse
+	group   singleflight.Group
+}
+
+// newMicroCache wraps handler with micro cache, zero ttl disables caching
+func newMicroCache(ttl time.Duration, handler http.Handler) http.Handler {
+	if ttl <= 0 {
+		return handler
+	}
+	return &microCache{
+		ttl:     ttl,
+		handler: handler,
+		entries: map[string]*cachedResponse{},
+	}
+}
+
+// bufferedResponse records response of handler
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// Unwrap returns cached handler
+func (c *microCache) Unwrap() http.Handler {
+	return c.handler
+}
+
+// ServeHTTP implements http.Handler
+func (c *microCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.RawQuery != "" {
+		c.handler.ServeHTTP(w, r)
+		return
+	}
+	// Response format depends on negotiation headers
+	key := r.URL.Path + "|" + r.Header.Get("Accept") + "|" + r.Header.Get("Accept-Encoding")
+
+	c.mutex.Lock()
+	entry, found := c.entries[key]
+	c.mutex.Unlock()
+	if !found || time.Now().After(entry.expires) {
+		value, _, _ := c.group.Do(key, func() (interface{}, error) {
+			return c.refresh(key, r), nil
+		})
+		entry = value.(*cachedResponse)
+	}
+
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// refresh calls handler and stores its response, expired entries are evicted
+func (c *microCache) refresh(key string, r *http.Request) *cachedResponse {
+	recorder := &bufferedResponse{header: http.Header{}}
+	c.handler.ServeHTTP(recorder, r)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	now := time.Now()
+	entry := &cachedResponse{
+		status:  recorder.status,
+		header:  recorder.header,
+		body:    recorder.body.Bytes(),
+		expires: now.Add(c.ttl),
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for k, cached := range c.entries {
+		if now.After(cached.expires) {
+			delete(c.entries, k)
+		}
+	}
+	// Errors are not cached
+	if entry.status < http.StatusInternalServerError && len(c.entries) < maxMicroCacheEntries {
+		c.entries[key] = entry
+	}
+	return entry
+}
@@ -0,0 +1,68 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMicroCacheIsBounded(t *testing.T) {
+	cache := newMicroCache(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).(*microCache)
+	for i := 0; i < 1000; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/metrics?x=%d", i), nil)
+		req.Header.Set("Accept", fmt.Sprintf("text/plain; v=%d", i))
+		cache.ServeHTTP(httptest.NewRecorder(), req)
+		req = httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", fmt.Sprintf("text/plain; v=%d", i))
+		cache.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(cache.entries) > maxMicroCacheEntries {
+		t.Fatalf("cache has %d entries", len(cache.entries))
+	}
+}
+
+func TestMicroCacheEvictsExpiredEntries(t *testing.T) {
+	cache := newMicroCache(time.Millisecond*10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).(*microCache)
+	for _, accept := range []string{"a", "b", "c"} {
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set("Accept", accept)
+		cache.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	time.Sleep(time.Millisecond * 20)
+	cache.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+	if len(cache.entries) != 1 {
+		t.Fatalf("expired entries are not evicted: %d entries", len(cache.entries))
+	}
+}
+
+func TestMicroCacheRefreshesOncePerKey(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	cache := newMicroCache(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			cache.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+			if w.Body.String() != "ok" {
+				t.Errorf("unexpected body %q", w.Body.String())
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("handler called %d times", calls)
+	}
+}
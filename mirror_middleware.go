@@ -0,0 +1,173 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// MirrorOptions is a configuration container for traffic mirroring - copies of requests are sent
+// asynchronously to shadow upstream and its responses are ignored
+type MirrorOptions struct {
+	// Shadow upstream base URL (e.g. http://my-service-canary:8080)
+	URL string
+	// Percentage of mirrored requests (0-100)
+	Percentage float64
+	// Timeout of mirrored request
+	Timeout time.Duration
+	// Requests with larger body are not mirrored. Default is 1MB.
+	MaxBodySize int64
+	// Max number of mirrored requests in flight - requests over limit are not mirrored. Default is 100.
+	MaxConcurrent int
+	// Credential headers (Authorization, Cookie, API keys, ...) are stripped from mirrored requests
+	// unless forwarding is enabled
+	ForwardCredentials bool
+}
+
+// MirrorOptionsFromViper reads mirroring options, nil is returned if mirroring is not enabled
+func MirrorOptionsFromViper(prefix string) (options *MirrorOptions) {
+	if viper.GetString(prefix+"url") == "" {
+		return nil
+	}
+	return &MirrorOptions{
+		URL:           viper.GetString(prefix + "url"),
+		Percentage:    viper.GetFloat64(prefix + "percentage"),
+		Timeout:       viper.GetDuration(prefix + "timeout"),
+		MaxBodySize:   viper.GetInt64(prefix + "max_body_size"),
+		MaxConcurrent: viper.GetInt(prefix + "max_concurrent"),
+
+		ForwardCredentials: viper.GetBool(prefix + "forward_credentials"),
+	}
+}
+
+// mirror object
+type mirror struct {
+	target      *url.URL
+	percentage  float64
+	timeout     time.Duration
+	maxBodySize int64
+	credentials bool
+	slots       chan struct{}
+	client      *http.Client
+	logger      *logrus.Logger
+}
+
+// newMirrorMiddleware creates mirroring middleware
+func newMirrorMiddleware(options *MirrorOptions, logger *logrus.Logger) (m *mirror, err error) {
+	target, err := url.Parse(options.URL)
+	if err != nil {
+		return
+	}
+	m = &mirror{
+		target:      target,
+		percentage:  options.Percentage,
+		timeout:     options.Timeout,
+		maxBodySize: options.MaxBodySize,
+		credentials: options.ForwardCredentials,
+		logger:      logger,
+		client:      &http.Client{},
+	}
+	if m.timeout <= 0 {
+		m.timeout = time.Second * 5
+	}
+	if m.maxBodySize <= 0 {
+		m.maxBodySize = 1 << 20
+	}
+	maxConcurrent := options.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 100
+	}
+	m.slots = make(chan struct{}, maxConcurrent)
+	return
+}
+
+// Middleware returns middleware function that mirrors configured percentage of requests
+func (m *mirror) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.percentage <= 0 || rand.Float64()*100 >= m.percentage || r.ContentLength > m.maxBodySize {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, m.maxBodySize+1))
+			if err != nil || int64(len(body)) > m.maxBodySize {
+				// body is not mirrored, original request gets already read part + rest of the body
+				r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+				h.ServeHTTP(w, r)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		select {
+		case m.slots <- struct{}{}:
+			go m.send(r.Method, r.URL, m.header(r.Header), body)
+		default:
+			if m.logger != nil {
+				m.logger.Trace("mirror: too many requests in flight, request is not mirrored")
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// header returns copy of header sent to shadow upstream
+func (m *mirror) header(original http.Header) http.Header {
+	header := original.Clone()
+	if m.credentials {
+		return header
+	}
+	for name := range header {
+		if recorderSecretHeaders[strings.ToLower(name)] || isSecretName(name) {
+			header.Del(name)
+		}
+	}
+	return header
+}
+
+// send sends copy of request to shadow upstream and discards response
+func (m *mirror) send(method string, original *url.URL, header http.Header, body []byte) {
+	defer func() { <-m.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	target := *m.target
+	target.Path = strings.TrimRight(m.target.Path, "/") + original.Path
+	target.RawQuery = original.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header = header
+	req.Header.Set("X-Mirrored-Request", "1")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		if m.logger != nil {
+			m.logger.WithError(err).Debug("mirror: request failed")
+		}
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// readCloser combines reader and closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,59 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMirrorStripsCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		credentials bool
+		wantHeader  bool
+	}{
+		{"authorization", "Authorization", false, false},
+		{"proxy authorization", "Proxy-Authorization", false, false},
+		{"cookie", "Cookie", false, false},
+		{"api key", "X-API-Key", false, false},
+		{"token", "X-Auth-Token", false, false},
+		{"regular header", "Accept-Language", false, true},
+		{"forwarded authorization", "Authorization", true, true},
+		{"forwarded cookie", "Cookie", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan http.Header, 1)
+			shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- r.Header.Clone()
+			}))
+			defer shadow.Close()
+
+			m, err := newMirrorMiddleware(&MirrorOptions{URL: shadow.URL, Percentage: 100, ForwardCredentials: tt.credentials}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/items", nil)
+			r.Header.Set(tt.header, "value")
+			m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(tt.header) != "value" {
+					t.Error("header was removed from original request")
+				}
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			select {
+			case header := <-received:
+				if got := header.Get(tt.header) != ""; got != tt.wantHeader {
+					t.Fatalf("header %s forwarded: %v, want %v", tt.header, got, tt.wantHeader)
+				}
+				if header.Get("X-Mirrored-Request") != "1" {
+					t.Fatal("mirrored request is not marked")
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("request was not mirrored")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Option configures web service created by New()
+type Option func(s *webservice)
+
+// mountedObject is service object mounted under own path prefix
+type mountedObject struct {
+	prefix         string
+	obj            WebserviceObject
+	requiredScopes []string
+}
+
+// Mount co-hosts another service object under given path prefix. Object can implement the same interfaces
+// as main service object (ConfigureRouter, BeforeStart, BeforeEnd, Warmup). Router passed to ConfigureRouter
+// is a subrouter for the prefix and it has to be returned as handler. Required scopes replace default scope
+// from authorization options for routes of the mounted object (AllowScopes() on handler still takes precedence).
+func Mount(prefix string, obj WebserviceObject, requiredScopes ...string) Option {
+	return func(s *webservice) {
+		s.mounts = append(s.mounts, &mountedObject{
+			prefix:         prefix,
+			obj:            obj,
+			requiredScopes: requiredScopes,
+		})
+	}
+}
+
+// objects returns main service object followed by all mounted objects
+func (s *webservice) objects() (objects []WebserviceObject) {
+	objects = append(objects, s.obj)
+	for _, m := range s.mounts {
+		objects = append(objects, m.obj)
+	}
+	return
+}
+
+// configureMounts creates subrouters for mounted objects
+func (s *webservice) configureMounts(router *mux.Router) (err error) {
+	for _, m := range s.mounts {
+		subrouter := router.PathPrefix(m.prefix).Subrouter()
+		if len(m.requiredScopes) > 0 {
+			subrouter.Use(mountScopesMiddleware(m.requiredScopes))
+		}
+
+		configureRouter, ok := m.obj.(ConfigureRouterHandler)
+		if !ok {
+			continue
+		}
+		var handler http.Handler
+		handler, err = configureRouter.ConfigureRouter(subrouter)
+		if err != nil {
+			err = fmt.Errorf("mount %s: %w", m.prefix, err)
+			return
+		}
+		if handler != nil && handler != http.Handler(subrouter) {
+			err = fmt.Errorf("mount %s: ConfigureRouter() has to return passed router - use router.Use() for middlewares", m.prefix)
+			return
+		}
+	}
+	return
+}
+
+// mountScopesMiddleware stores default required scopes of mounted object in request context
+func mountScopesMiddleware(requiredScopes []string) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextTypeMountScopes, requiredScopes)))
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package webservice
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// mqttTimeout is timeout of connect and subscribe
+const mqttTimeout = 10 * time.Second
+
+// MQTTMessage is message received from or published to MQTT broker
+type MQTTMessage struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// MQTTHandlerFn handles message of subscription. Errors are logged, message is acknowledged anyway.
+type MQTTHandlerFn func(ctx context.Context, message *MQTTMessage) error
+
+// mqttSubscription is topic filter with its handler
+type mqttSubscription struct {
+	filter  string
+	qos     byte
+	handler MQTTHandlerFn
+}
+
+// mqttIncoming is received message, it is acknowledged after its handlers are finished
+type mqttIncoming struct {
+	message *MQTTMessage
+	ack     func()
+}
+
+// MQTT is MQTT 3.1.1 client (Eclipse Paho, clean session). It is a Component configured from mqtt.* keys (url,
+// e.g. tcp://broker:1883 or ssl://broker:8883, client_id, username, password, keep_alive, tls.ca_file,
+// tls.cert_file, tls.key_file, tls.insecure_skip_verify). Handlers are registered with Handle() before service
+// is started and they are called one by one in order of messages. Connection is established in background, so
+// service starts even if broker is not available, and it is re-established with all subscriptions when it is
+// lost. Client is available to handlers and HTTP handlers with MQTTFromContext().
+type MQTT struct {
+	URL       string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	// TLS configuration of ssl://, tls:// and mqtts:// connections
+	TLSConfig     *tls.Config
+	logger        *logrus.Logger
+	subscriptions []*mqttSubscription
+	messages      chan *mqttIncoming
+	client        paho.Client
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+	received      *prometheus.CounterVec
+	failed        *prometheus.CounterVec
+}
+
+// NewMQTT creates MQTT client component
+func NewMQTT(logger *logrus.Logger) *MQTT {
+	return &MQTT{
+		KeepAlive: 30 * time.Second,
+		logger:    logger,
+	}
+}
+
+// MQTTFromContext returns MQTT client registered in service (nil if not available)
+func MQTTFromContext(ctx context.Context) *MQTT {
+	client, _ := ctx.Value(contextTypeMQTT).(*MQTT)
+	return client
+}
+
+// Handle subscribes handler to topic filter (+ and # wildcards are supported) with QoS 0, 1 or 2
+func (m *MQTT) Handle(filter string, qos byte, handler MQTTHandlerFn) {
+	m.subscriptions = append(m.subscriptions, &mqttSubscription{filter: filter, qos: qos, handler: handler})
+}
+
+// Name implements Component
+func (m *MQTT) Name() string {
+	return "mqtt"
+}
+
+// Configure implements Component
+func (m *MQTT) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("url") {
+		m.URL = config.GetString("url")
+	}
+	if config.IsSet("client_id") {
+		m.ClientID = config.GetString("client_id")
+	}
+	if config.IsSet("username") {
+		m.Username = config.GetString("username")
+	}
+	if config.IsSet("password") {
+		m.Password = config.GetString("password")
+	}
+	if config.IsSet("keep_alive") {
+		m.KeepAlive = config.GetDuration("keep_alive")
+	}
+	if m.URL == "" {
+		return fmt.Errorf("mqtt url is not configured")
+	}
+	if m.ClientID == "" {
+		hostname, _ := os.Hostname()
+		m.ClientID = buildServiceName() + "-" + hostname
+	}
+	if m.TLSConfig == nil && config.IsSet("tls") {
+		if m.TLSConfig, err = mqttTLSConfig(config); err != nil {
+			return
+		}
+	}
+	for _, subscription := range m.subscriptions {
+		if subscription.qos > 2 {
+			return fmt.Errorf("mqtt subscription %s: QoS %d is not supported", subscription.filter, subscription.qos)
+		}
+	}
+
+	m.received = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_messages_received_total",
+		Help: "Number of MQTT messages received per subscription.",
+	}, []string{"filter"})).(*prometheus.CounterVec)
+	m.failed = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_messages_failed_total",
+		Help: "Number of MQTT messages not processed by handler.",
+	}, []string{"filter"})).(*prometheus.CounterVec)
+	return
+}
+
+// mqttTLSConfig reads TLS configuration (tls.ca_file, tls.cert_file, tls.key_file, tls.insecure_skip_verify)
+func mqttTLSConfig(config *viper.Viper) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.GetBool("tls.insecure_skip_verify")}
+	if caFile := config.GetString("tls.ca_file"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mqtt CA: no certificate found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile := config.GetString("tls.cert_file"); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, config.GetString("tls.key_file"))
+		if err != nil {
+			return nil, fmt.Errorf("mqtt client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Routes implements Component - MQTT client is added to request context
+func (m *MQTT) Routes(router *mux.Router) (err error) {
+	router.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextTypeMQTT, m)))
+		})
+	})
+	return
+}
+
+// Start implements Component - starts connecting to broker in background, handlers are subscribed on every connect
+func (m *MQTT) Start(ctx context.Context) (err error) {
+	ctx, m.cancel = context.WithCancel(context.WithValue(ctx, contextTypeMQTT, m))
+	m.messages = make(chan *mqttIncoming, 100)
+	m.client = paho.NewClient(m.clientOptions(ctx))
+	m.client.Connect()
+	m.wg.Add(1)
+	go m.worker(ctx)
+	return
+}
+
+// clientOptions returns options of Paho client
+func (m *MQTT) clientOptions(ctx context.Context) *paho.ClientOptions {
+	options := paho.NewClientOptions().
+		AddBroker(m.URL).
+		SetClientID(m.ClientID).
+		SetUsername(m.Username).
+		SetPassword(m.Password).
+		SetKeepAlive(m.KeepAlive).
+		SetCleanSession(true).
+		SetConnectTimeout(mqttTimeout).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(30 * time.Second).
+		SetOrderMatters(true).
+		SetAutoAckDisabled(true)
+	if m.TLSConfig != nil {
+		options.SetTLSConfig(m.TLSConfig)
+	}
+	options.SetDefaultPublishHandler(func(client paho.Client, message paho.Message) {
+		incoming := &mqttIncoming{
+			message: &MQTTMessage{Topic: message.Topic(), Payload: message.Payload(), QoS: message.Qos(), Retained: message.Retained()},
+			ack:     message.Ack,
+		}
+		select {
+		case m.messages <- incoming:
+		case <-ctx.Done():
+		}
+	})
+	options.SetOnConnectHandler(func(client paho.Client) {
+		if m.logger != nil {
+			m.logger.WithField("broker", m.URL).Print("Connected to MQTT broker")
+		}
+		if len(m.subscriptions) == 0 {
+			return
+		}
+		filters := map[string]byte{}
+		for _, subscription := range m.subscriptions {
+			filters[subscription.filter] = max(filters[subscription.filter], subscription.qos)
+		}
+		// Messages are routed to handlers by worker
+		token := client.SubscribeMultiple(filters, nil)
+		var err error
+		if !token.WaitTimeout(mqttTimeout) {
+			err = fmt.Errorf("subscription timed out")
+		} else {
+			err = token.Error()
+		}
+		if err != nil && m.logger != nil {
+			m.logger.WithError(err).Error("Unable to subscribe to MQTT topics")
+		}
+	})
+	options.SetConnectionLostHandler(func(client paho.Client, err error) {
+		if m.logger != nil {
+			m.logger.WithError(err).Warn("MQTT connection lost")
+		}
+	})
+	return options
+}
+
+// Stop implements Component - disconnects from broker
+func (m *MQTT) Stop(ctx context.Context) (err error) {
+	m.cancel()
+	// In-flight messages are finished within 1 second
+	m.client.Disconnect(1000)
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// Publish publishes message with QoS 0, 1 or 2, QoS 1 and 2 wait for acknowledgement of broker. Messages are not
+// queued while connection is lost.
+func (m *MQTT) Publish(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error {
+	if qos > 2 {
+		return fmt.Errorf("QoS %d is not supported", qos)
+	}
+	if m.client == nil || !m.client.IsConnectionOpen() {
+		return fmt.Errorf("mqtt is not connected")
+	}
+	token := m.client.Publish(topic, qos, retained, payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// worker calls handlers of received messages and acknowledges them
+func (m *MQTT) worker(ctx context.Context) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case incoming := <-m.messages:
+			for _, subscription := range m.subscriptions {
+				if !mqttTopicMatches(subscription.filter, incoming.message.Topic) {
+					continue
+				}
+				m.received.WithLabelValues(subscription.filter).Inc()
+				if err := subscription.handler(ctx, incoming.message); err != nil {
+					m.failed.WithLabelValues(subscription.filter).Inc()
+					if m.logger != nil {
+						m.logger.WithError(err).WithField("topic", incoming.message.Topic).Error("MQTT handler failed")
+					}
+				}
+			}
+			incoming.ack()
+		}
+	}
+}
+
+// mqttTopicMatches returns true if topic matches filter with + (single level) and # (remaining levels) wildcards.
+// Topics starting with $ are not matched by wildcards on first level.
+func mqttTopicMatches(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	if strings.HasPrefix(topic, "$") && (filterLevels[0] == "+" || filterLevels[0] == "#") {
+		return false
+	}
+	for idx, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if idx >= len(topicLevels) || (level != "+" && level != topicLevels[idx]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,60 @@
+package webservice
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestMQTTStartsWithoutBroker(t *testing.T) {
+	// Nothing listens on the port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := NewMQTT(nil)
+	client.Handle("devices/+/state", 1, func(ctx context.Context, message *MQTTMessage) error { return nil })
+	config := viper.New()
+	config.Set("url", "tcp://"+addr)
+	if err = client.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Start(context.Background()); err != nil {
+		t.Fatalf("start failed without broker: %v", err)
+	}
+	if err = client.Publish(context.Background(), "devices/1/state", 1, false, []byte("on")); err == nil {
+		t.Fatal("expected error of publish without connection")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err = client.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMQTTTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"devices/+/state", "devices/1/state", true},
+		{"devices/+/state", "devices/1/2/state", false},
+		{"devices/#", "devices/1/state", true},
+		{"devices/#", "devices", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker/uptime", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+	}
+	for _, tt := range tests {
+		if got := mqttTopicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("mqttTopicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
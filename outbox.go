@@ -0,0 +1,221 @@
+package webservice
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// OutboxEvent is domain event stored in outbox table
+type OutboxEvent struct {
+	ID        int64
+	Topic     string
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// OutboxPublisher publishes events to message broker (Kafka, NATS, ...)
+type OutboxPublisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) (err error)
+}
+
+// OutboxOptions is a configuration container for transactional outbox
+type OutboxOptions struct {
+	// Outbox table name, default is "outbox". Expected schema:
+	//   id BIGINT auto increment primary key, topic VARCHAR, event_key VARCHAR, payload BLOB/BYTEA,
+	//   created_at TIMESTAMP, published_at TIMESTAMP NULL
+	Table string
+	// Placeholder style of SQL driver: "?" (MySQL, SQLite) or "$" (PostgreSQL). Default is "?".
+	Placeholder string
+	// Relay polling interval, default is 1 second
+	Interval time.Duration
+	// Max number of events published in one poll, default is 100
+	BatchSize int
+	// Relay publishes events only while this replica is leader. It is required if service runs in more than one
+	// replica - rows are not claimed, so relays of all replicas would publish the same events out of order.
+	Leader *LeaderElector
+}
+
+// Outbox stores events in the same database transaction as business data and background relay
+// publishes them - delivery is at-least-once, consumers should be idempotent. Services with more replicas
+// have to set OutboxOptions.Leader, so only one relay publishes events.
+// Outbox is a Component, register it with svc.Register().
+type Outbox struct {
+	db        *sql.DB
+	publisher OutboxPublisher
+	options   OutboxOptions
+	logger    *logrus.Logger
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewOutbox creates transactional outbox
+func NewOutbox(db *sql.DB, publisher OutboxPublisher, options *OutboxOptions, logger *logrus.Logger) *Outbox {
+	o := &Outbox{
+		db:        db,
+		publisher: publisher,
+		logger:    logger,
+	}
+	if options != nil {
+		o.options = *options
+	}
+	o.setDefaults()
+	return o
+}
+
+func (o *Outbox) setDefaults() {
+	if o.options.Table == "" {
+		o.options.Table = "outbox"
+	}
+	if o.options.Placeholder == "" {
+		o.options.Placeholder = "?"
+	}
+	if o.options.Interval <= 0 {
+		o.options.Interval = time.Second
+	}
+	if o.options.BatchSize <= 0 {
+		o.options.BatchSize = 100
+	}
+}
+
+// placeholder returns n-th (1 based) query placeholder
+func (o *Outbox) placeholder(n int) string {
+	if o.options.Placeholder == "$" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// Add stores event in outbox within given transaction
+func (o *Outbox) Add(ctx context.Context, tx *sql.Tx, topic string, key string, payload []byte) (err error) {
+	query := fmt.Sprintf("INSERT INTO %s (topic, event_key, payload, created_at) VALUES (%s, %s, %s, %s)",
+		o.options.Table, o.placeholder(1), o.placeholder(2), o.placeholder(3), o.placeholder(4))
+	_, err = tx.ExecContext(ctx, query, topic, key, payload, time.Now().UTC())
+	return
+}
+
+// Name implements Component
+func (o *Outbox) Name() string {
+	return "outbox"
+}
+
+// Configure implements Component - options not set in code are read from configuration (table, placeholder, interval, batch_size)
+func (o *Outbox) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("table") {
+		o.options.Table = config.GetString("table")
+	}
+	if config.IsSet("placeholder") {
+		o.options.Placeholder = config.GetString("placeholder")
+	}
+	if config.IsSet("interval") {
+		o.options.Interval = config.GetDuration("interval")
+	}
+	if config.IsSet("batch_size") {
+		o.options.BatchSize = config.GetInt("batch_size")
+	}
+	o.setDefaults()
+	if strings.ContainsAny(o.options.Table, " ;'\"") {
+		err = fmt.Errorf("invalid outbox table name: %s", o.options.Table)
+	}
+	return
+}
+
+// Routes implements Component
+func (o *Outbox) Routes(router *mux.Router) (err error) {
+	return
+}
+
+// Start implements Component - starts background relay
+func (o *Outbox) Start(ctx context.Context) (err error) {
+	if o.options.Leader == nil && o.logger != nil {
+		o.logger.Warn("outbox: relay runs without leader election, events are published by every replica")
+	}
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.wg.Add(1)
+	go o.relay(ctx)
+	return
+}
+
+// Stop implements Component
+func (o *Outbox) Stop(ctx context.Context) (err error) {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	o.wg.Wait()
+	return
+}
+
+// relay periodically publishes pending events
+func (o *Outbox) relay(ctx context.Context) {
+	defer o.wg.Done()
+	ticker := time.NewTicker(o.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for o.relaying() {
+				published, err := o.publishBatch(ctx)
+				if err != nil {
+					if o.logger != nil && ctx.Err() == nil {
+						o.logger.WithError(err).Error("outbox: unable to publish events")
+					}
+					break
+				}
+				if published < o.options.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// relaying returns if this replica publishes events (it is leader or leader election is not used)
+func (o *Outbox) relaying() bool {
+	return o.options.Leader == nil || o.options.Leader.IsLeader()
+}
+
+// publishBatch publishes one batch of pending events in order of creation
+func (o *Outbox) publishBatch(ctx context.Context) (published int, err error) {
+	query := fmt.Sprintf("SELECT id, topic, event_key, payload, created_at FROM %s WHERE published_at IS NULL ORDER BY id LIMIT %d",
+		o.options.Table, o.options.BatchSize)
+	rows, err := o.db.QueryContext(ctx, query)
+	if err != nil {
+		return
+	}
+	var events []*OutboxEvent
+	for rows.Next() {
+		event := &OutboxEvent{}
+		if err = rows.Scan(&event.ID, &event.Topic, &event.Key, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET published_at = %s WHERE id = %s", o.options.Table, o.placeholder(1), o.placeholder(2))
+	for _, event := range events {
+		// Events are published in order - first failure stops the batch
+		if err = o.publisher.Publish(ctx, event); err != nil {
+			return
+		}
+		if _, err = o.db.ExecContext(ctx, update, time.Now().UTC(), event.ID); err != nil {
+			return
+		}
+		published++
+	}
+	return
+}
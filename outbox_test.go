@@ -0,0 +1,154 @@
+package webservice
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// outboxTestTable is in-memory outbox table of outboxTestDriver
+type outboxTestTable struct {
+	mu        sync.Mutex
+	events    []OutboxEvent
+	published map[int64]bool
+}
+
+// outboxTestDriver is database/sql driver serving queries of outbox relay from in-memory table
+type outboxTestDriver struct {
+	table *outboxTestTable
+}
+
+// Open implements driver.Driver
+func (d *outboxTestDriver) Open(name string) (driver.Conn, error) {
+	return &outboxTestConn{table: d.table}, nil
+}
+
+// outboxTestConn is connection of outboxTestDriver
+type outboxTestConn struct {
+	table *outboxTestTable
+}
+
+func (c *outboxTestConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *outboxTestConn) Close() error { return nil }
+func (c *outboxTestConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+// QueryContext implements driver.QueryerContext - pending events are returned
+func (c *outboxTestConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT") {
+		return nil, errors.New("unexpected query " + query)
+	}
+	c.table.mu.Lock()
+	defer c.table.mu.Unlock()
+	rows := &outboxTestRows{}
+	for _, event := range c.table.events {
+		if !c.table.published[event.ID] {
+			rows.events = append(rows.events, event)
+		}
+	}
+	return rows, nil
+}
+
+// ExecContext implements driver.ExecerContext - event is marked as published
+func (c *outboxTestConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.HasPrefix(query, "UPDATE") {
+		return nil, errors.New("unexpected query " + query)
+	}
+	c.table.mu.Lock()
+	defer c.table.mu.Unlock()
+	c.table.published[args[1].Value.(int64)] = true
+	return driver.RowsAffected(1), nil
+}
+
+// outboxTestRows are rows of pending events
+type outboxTestRows struct {
+	events []OutboxEvent
+}
+
+func (r *outboxTestRows) Columns() []string {
+	return []string{"id", "topic", "event_key", "payload", "created_at"}
+}
+func (r *outboxTestRows) Close() error { return nil }
+func (r *outboxTestRows) Next(dest []driver.Value) error {
+	if len(r.events) == 0 {
+		return io.EOF
+	}
+	event := r.events[0]
+	r.events = r.events[1:]
+	dest[0], dest[1], dest[2], dest[3], dest[4] = event.ID, event.Topic, event.Key, event.Payload, event.CreatedAt
+	return nil
+}
+
+// outboxTestPublisher counts published events
+type outboxTestPublisher struct {
+	mu        sync.Mutex
+	published map[int64]int
+}
+
+// Publish implements OutboxPublisher
+func (p *outboxTestPublisher) Publish(ctx context.Context, event *OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published[event.ID]++
+	return nil
+}
+
+func TestOutboxRelayLeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas []*LeaderElector
+		want     int
+	}{
+		{"without leader election", []*LeaderElector{nil}, 1},
+		{"leader", []*LeaderElector{{leader: true}}, 1},
+		{"not leader", []*LeaderElector{{}}, 0},
+		{"leader and follower", []*LeaderElector{{leader: true}, {}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &outboxTestTable{published: map[int64]bool{}}
+			for id := int64(1); id <= 3; id++ {
+				table.events = append(table.events, OutboxEvent{ID: id, Topic: "items", Key: "key", Payload: []byte("{}"), CreatedAt: time.Now()})
+			}
+			db := sql.OpenDB(&outboxTestConnector{driver: &outboxTestDriver{table: table}})
+			defer db.Close()
+			publisher := &outboxTestPublisher{published: map[int64]int{}}
+
+			for _, leader := range tt.replicas {
+				outbox := NewOutbox(db, publisher, &OutboxOptions{Interval: time.Millisecond * 10, Leader: leader}, nil)
+				if err := outbox.Start(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				defer outbox.Stop(context.Background())
+			}
+			time.Sleep(time.Millisecond * 100)
+
+			publisher.mu.Lock()
+			defer publisher.mu.Unlock()
+			for _, event := range table.events {
+				if publisher.published[event.ID] != tt.want {
+					t.Fatalf("event %d published %d times, want %d", event.ID, publisher.published[event.ID], tt.want)
+				}
+			}
+		})
+	}
+}
+
+// outboxTestConnector opens connections of outboxTestDriver
+type outboxTestConnector struct {
+	driver *outboxTestDriver
+}
+
+func (c *outboxTestConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+func (c *outboxTestConnector) Driver() driver.Driver { return c.driver }
@@ -0,0 +1,304 @@
+package webservice
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Profile types captured by profiling hook
+const (
+	ProfileCPU       = "cpu"
+	ProfileTrace     = "trace"
+	ProfileHeap      = "heap"
+	ProfileGoroutine = "goroutine"
+	ProfileMutex     = "mutex"
+	ProfileBlock     = "block"
+)
+
+// ProfilingOptions is a configuration container for profiles captured automatically when latency or error
+// thresholds are exceeded. Captured profiles are kept in memory and served at /admin/profiles.
+type ProfilingOptions struct {
+	// Request slower than threshold triggers capture, zero disables latency trigger
+	LatencyThreshold time.Duration
+	// Ratio of 5xx responses within window (e.g. 0.2) which triggers capture, zero disables error trigger
+	ErrorRateThreshold float64
+	// Window of error rate, default is 1 minute
+	Window time.Duration
+	// Minimal number of requests in window for error trigger, default is 20
+	MinRequests int
+	// Captured profiles (cpu, trace, heap, goroutine, mutex, block), default are cpu and goroutine
+	Profiles []string
+	// Duration of CPU profile and execution trace, default is 10 seconds
+	Duration time.Duration
+	// Minimal time between captures, default is 5 minutes
+	Cooldown time.Duration
+	// Number of kept captures, the oldest one is dropped, default is 10
+	MaxCaptures int
+	// Scope required by /admin/profiles, default is admin
+	AdminScope string
+}
+
+// ProfilingOptionsFromViper reads profiling options (latency_threshold, error_rate_threshold, window,
+// min_requests, profiles, duration, cooldown, max_captures, admin_scope), nil is returned if it is not enabled
+func ProfilingOptionsFromViper(prefix string) *ProfilingOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &ProfilingOptions{
+		LatencyThreshold:   viper.GetDuration(prefix + "latency_threshold"),
+		ErrorRateThreshold: viper.GetFloat64(prefix + "error_rate_threshold"),
+		Window:             viper.GetDuration(prefix + "window"),
+		MinRequests:        viper.GetInt(prefix + "min_requests"),
+		Profiles:           viper.GetStringSlice(prefix + "profiles"),
+		Duration:           viper.GetDuration(prefix + "duration"),
+		Cooldown:           viper.GetDuration(prefix + "cooldown"),
+		MaxCaptures:        viper.GetInt(prefix + "max_captures"),
+		AdminScope:         viper.GetString(prefix + "admin_scope"),
+	}
+}
+
+// ProfileCapture is set of profiles captured after threshold was exceeded
+type ProfileCapture struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	// Size of captured profiles by type
+	Profiles map[string]int `json:"profiles"`
+	// Profiles which could not be captured (e.g. CPU profile is already running)
+	Errors map[string]string `json:"errors,omitempty"`
+	data   map[string][]byte
+}
+
+// profiler captures profiles when thresholds are exceeded
+type profiler struct {
+	options   ProfilingOptions
+	logger    *logrus.Logger
+	capturing int32
+	mutex     sync.Mutex
+	lastStart time.Time
+	window    time.Time
+	requests  int
+	errors    int
+	captures  []*ProfileCapture
+	sequence  int
+	captured  *prometheus.CounterVec
+}
+
+// newProfiler creates profiling middleware
+func newProfiler(options *ProfilingOptions, logger *logrus.Logger) *profiler {
+	p := &profiler{
+		options: *options,
+		logger:  logger,
+	}
+	if p.options.Window <= 0 {
+		p.options.Window = time.Minute
+	}
+	if p.options.MinRequests <= 0 {
+		p.options.MinRequests = 20
+	}
+	if len(p.options.Profiles) == 0 {
+		p.options.Profiles = []string{ProfileCPU, ProfileGoroutine}
+	}
+	if p.options.Duration <= 0 {
+		p.options.Duration = time.Second * 10
+	}
+	if p.options.Cooldown <= 0 {
+		p.options.Cooldown = time.Minute * 5
+	}
+	if p.options.MaxCaptures <= 0 {
+		p.options.MaxCaptures = 10
+	}
+	if p.options.AdminScope == "" {
+		p.options.AdminScope = "admin"
+	}
+	p.captured = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "profiles_captured_total",
+		Help: "Number of profile captures triggered by latency or error thresholds.",
+	}, []string{"trigger"})).(*prometheus.CounterVec)
+	return p
+}
+
+// Middleware measures requests and triggers capture
+func (p *profiler) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+		latency := time.Since(start)
+
+		if p.options.LatencyThreshold > 0 && latency > p.options.LatencyThreshold {
+			p.trigger("latency", fmt.Sprintf("%s %s took %s", r.Method, r.URL.Path, latency.Round(time.Millisecond)))
+		}
+		if p.options.ErrorRateThreshold > 0 {
+			if reason := p.countError(start, rec.Status() >= http.StatusInternalServerError); reason != "" {
+				p.trigger("error_rate", reason)
+			}
+		}
+	})
+}
+
+// countError counts request in error rate window, reason is returned if threshold is exceeded
+func (p *profiler) countError(now time.Time, failed bool) (reason string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if now.Sub(p.window) > p.options.Window {
+		p.window = now
+		p.requests = 0
+		p.errors = 0
+	}
+	p.requests++
+	if failed {
+		p.errors++
+	}
+	rate := float64(p.errors) / float64(p.requests)
+	if p.requests >= p.options.MinRequests && rate > p.options.ErrorRateThreshold {
+		return fmt.Sprintf("error rate %.2f of %d requests", rate, p.requests)
+	}
+	return ""
+}
+
+// trigger starts capture in background unless capture is running or cooldown did not pass
+func (p *profiler) trigger(trigger string, reason string) {
+	if !atomic.CompareAndSwapInt32(&p.capturing, 0, 1) {
+		return
+	}
+	p.mutex.Lock()
+	if !p.lastStart.IsZero() && time.Since(p.lastStart) < p.options.Cooldown {
+		p.mutex.Unlock()
+		atomic.StoreInt32(&p.capturing, 0)
+		return
+	}
+	p.lastStart = time.Now()
+	p.sequence++
+	capture := &ProfileCapture{
+		ID:       strconv.Itoa(p.sequence),
+		Time:     p.lastStart,
+		Reason:   reason,
+		Profiles: map[string]int{},
+		data:     map[string][]byte{},
+	}
+	p.mutex.Unlock()
+
+	p.captured.WithLabelValues(trigger).Inc()
+	if p.logger != nil {
+		p.logger.WithField("reason", reason).Warn("Profiling threshold exceeded, capturing profiles")
+	}
+	go func() {
+		defer atomic.StoreInt32(&p.capturing, 0)
+		p.capture(capture)
+	}()
+}
+
+// capture records configured profiles, CPU profile and execution trace are recorded concurrently
+func (p *profiler) capture(capture *ProfileCapture) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	store := func(name string, data []byte, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			if capture.Errors == nil {
+				capture.Errors = map[string]string{}
+			}
+			capture.Errors[name] = err.Error()
+			return
+		}
+		capture.data[name] = data
+		capture.Profiles[name] = len(data)
+	}
+
+	for _, name := range p.options.Profiles {
+		switch name {
+		case ProfileCPU, ProfileTrace:
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				var buf bytes.Buffer
+				var err error
+				if name == ProfileCPU {
+					err = pprof.StartCPUProfile(&buf)
+				} else {
+					err = trace.Start(&buf)
+				}
+				if err == nil {
+					time.Sleep(p.options.Duration)
+					if name == ProfileCPU {
+						pprof.StopCPUProfile()
+					} else {
+						trace.Stop()
+					}
+				}
+				store(name, buf.Bytes(), err)
+			}(name)
+		default:
+			// Snapshots are taken at the moment of trigger
+			profile := pprof.Lookup(name)
+			if profile == nil {
+				store(name, nil, fmt.Errorf("unknown profile"))
+				continue
+			}
+			var buf bytes.Buffer
+			err := profile.WriteTo(&buf, 0)
+			store(name, buf.Bytes(), err)
+		}
+	}
+	wg.Wait()
+
+	p.mutex.Lock()
+	p.captures = append(p.captures, capture)
+	if len(p.captures) > p.options.MaxCaptures {
+		p.captures = p.captures[len(p.captures)-p.options.MaxCaptures:]
+	}
+	p.mutex.Unlock()
+	if p.logger != nil {
+		p.logger.WithField("id", capture.ID).WithField("profiles", capture.Profiles).Info("Profiles captured")
+	}
+}
+
+// Routes registers admin API - list of captures and download of single profile
+func (p *profiler) Routes(router *mux.Router) {
+	router.Handle("/admin/profiles", AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		p.mutex.Lock()
+		captures := make([]*ProfileCapture, len(p.captures))
+		copy(captures, p.captures)
+		p.mutex.Unlock()
+		sort.Slice(captures, func(i, j int) bool { return captures[i].Time.After(captures[j].Time) })
+		return WriteJSON(w, r, captures)
+	}).AllowScopes(p.options.AdminScope)).Methods(http.MethodGet)
+
+	router.Handle("/admin/profiles/{id}/{profile}", AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		vars := mux.Vars(r)
+		var data []byte
+		p.mutex.Lock()
+		for _, capture := range p.captures {
+			if capture.ID == vars["id"] {
+				data = capture.data[vars["profile"]]
+			}
+		}
+		p.mutex.Unlock()
+		if data == nil {
+			return ServerErrorWithoutStack(nil, http.StatusNotFound, "Profile not found")
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		extension := ".pprof"
+		if vars["profile"] == ProfileTrace {
+			extension = ".trace"
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", vars["profile"]+"-"+vars["id"]+extension))
+		_, err := w.Write(data)
+		return err
+	}).AllowScopes(p.options.AdminScope)).Methods(http.MethodGet)
+}
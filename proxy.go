@@ -0,0 +1,56 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProxyOptions configures streaming reverse proxy route
+type ProxyOptions struct {
+	// Interval of flushing upstream response to client. Zero flushes only when buffer is full, negative flushes
+	// after every write (for event streams). Responses are streamed, they are never buffered whole in memory.
+	FlushInterval time.Duration
+	// Timeout of upstream request overriding server timeouts of the route, zero means no timeout
+	Timeout time.Duration
+	// Path prefix removed before request is forwarded
+	StripPrefix string
+	// Transport of upstream requests, nil means http.DefaultTransport. Remaining deadline of request is propagated
+	// to upstream in any case (see NewDeadlineTransport).
+	Transport http.RoundTripper
+}
+
+// ProxyHandler creates handler forwarding requests to upstream target. Large upstream responses are streamed
+// to client with flush interval. Note that server WriteTimeout still applies to long streams.
+func ProxyHandler(target *url.URL, options *ProxyOptions, logger *logrus.Logger) http.Handler {
+	if options == nil {
+		options = &ProxyOptions{}
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.FlushInterval = options.FlushInterval
+	proxy.Transport = NewDeadlineTransport(options.Transport)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		status := http.StatusBadGateway
+		if err == context.DeadlineExceeded {
+			status = http.StatusGatewayTimeout
+		}
+		processHTTPError(ServerError(err, status, "Upstream request failed"), w, r, logger, nil)
+	}
+
+	var handler http.Handler = proxy
+	if options.StripPrefix != "" {
+		handler = http.StripPrefix(options.StripPrefix, handler)
+	}
+	if options.Timeout <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), options.Timeout)
+		defer cancel()
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
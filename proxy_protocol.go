@@ -0,0 +1,234 @@
+package webservice
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ProxyProtocolOptions is a configuration container for PROXY protocol (v1 and v2) on the listener, e.g. behind
+// HAProxy or AWS NLB. Original client address replaces address of the proxy in request RemoteAddr.
+type ProxyProtocolOptions struct {
+	// Networks of proxies (CIDR or IP address) allowed to send PROXY header, it is required - any client could
+	// spoof its address otherwise
+	TrustedProxies []string
+	// Connections without PROXY header are rejected
+	Required bool
+	// Max time to receive PROXY header, default is 5 seconds
+	HeaderTimeout time.Duration
+}
+
+// ProxyProtocolOptionsFromViper reads PROXY protocol options (trusted_proxies, required, header_timeout), nil is
+// returned if it is not enabled
+func ProxyProtocolOptionsFromViper(prefix string) *ProxyProtocolOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &ProxyProtocolOptions{
+		TrustedProxies: viper.GetStringSlice(prefix + "trusted_proxies"),
+		Required:       viper.GetBool(prefix + "required"),
+		HeaderTimeout:  viper.GetDuration(prefix + "header_timeout"),
+	}
+}
+
+// proxyProtocolV2Signature starts binary header of PROXY protocol v2
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolListener reads PROXY header of accepted connections
+type proxyProtocolListener struct {
+	net.Listener
+	options     ProxyProtocolOptions
+	trustedNets []*net.IPNet
+}
+
+// newProxyProtocolListener wraps listener with PROXY protocol support
+func newProxyProtocolListener(listener net.Listener, options *ProxyProtocolOptions) (net.Listener, error) {
+	l := &proxyProtocolListener{
+		Listener: listener,
+		options:  *options,
+	}
+	if len(options.TrustedProxies) == 0 {
+		return nil, fmt.Errorf("PROXY protocol requires trusted proxies")
+	}
+	if l.options.HeaderTimeout <= 0 {
+		l.options.HeaderTimeout = time.Second * 5
+	}
+	trustedNets, err := parseTrustedProxies(options.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	l.trustedNets = trustedNets
+	return l, nil
+}
+
+// trusted returns if connection comes from trusted proxy
+func (l *proxyProtocolListener) trusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range l.trustedNets {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept implements net.Listener. Header is read lazily in connection goroutine, so slow clients don't block
+// accepting of other connections.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{
+		Conn:     conn,
+		reader:   bufio.NewReader(conn),
+		listener: l,
+	}, nil
+}
+
+// proxyProtocolConn is connection with PROXY header
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	listener   *proxyProtocolListener
+	once       sync.Once
+	headerErr  error
+	remoteAddr net.Addr
+}
+
+// init reads PROXY header
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.listener.options.HeaderTimeout))
+		c.remoteAddr, c.headerErr = readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.headerErr == nil && c.remoteAddr == nil && c.listener.options.Required {
+			c.headerErr = fmt.Errorf("PROXY header is required")
+		}
+		if c.headerErr != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+// Read implements net.Conn
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr implements net.Conn, address of client from PROXY header is returned
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads PROXY header v1 or v2. Nil address is returned if there is no header or proxy sent
+// LOCAL/UNKNOWN connection (e.g. health check).
+func readProxyHeader(reader *bufio.Reader) (addr net.Addr, err error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, peekErr := reader.Peek(6); peekErr != nil || string(prefix) != "PROXY " {
+			return nil, nil
+		}
+		return readProxyHeaderV1(reader)
+	case '\r':
+		if prefix, peekErr := reader.Peek(len(proxyProtocolV2Signature)); peekErr != nil || !bytes.Equal(prefix, proxyProtocolV2Signature) {
+			return nil, nil
+		}
+		return readProxyHeaderV2(reader)
+	}
+	return nil, nil
+}
+
+// readProxyHeaderV1 parses text header, e.g. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readProxyHeaderV1(reader *bufio.Reader) (addr net.Addr, err error) {
+	var line []byte
+	for len(line) < 107 {
+		b, readErr := reader.ReadByte()
+		if readErr != nil {
+			return nil, readErr
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("invalid PROXY v1 header")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, portErr := strconv.Atoi(fields[4])
+	if ip == nil || portErr != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid PROXY v1 source address")
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyHeaderV2 parses binary header
+func readProxyHeaderV2(reader *bufio.Reader) (addr net.Addr, err error) {
+	header := make([]byte, 16)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return
+	}
+	// LOCAL command - connection of proxy itself
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("invalid PROXY v2 IPv4 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 2: // IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("invalid PROXY v2 IPv6 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	// Unix sockets and unspecified family
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+package webservice
+
+import (
+	"net"
+	"testing"
+)
+
+func TestProxyProtocolRequiresTrustedProxies(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+	tests := []struct {
+		name    string
+		proxies []string
+		valid   bool
+	}{
+		{"no trusted proxies", nil, false},
+		{"invalid proxy", []string{"proxy"}, false},
+		{"IP address", []string{"10.0.0.1"}, true},
+		{"network", []string{"10.0.0.0/8", "fd00::/8"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newProxyProtocolListener(inner, &ProxyProtocolOptions{TrustedProxies: test.proxies})
+			if valid := err == nil; valid != test.valid {
+				t.Fatalf("expected valid %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolIgnoresHeaderOfUntrustedPeer(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := newProxyProtocolListener(inner, &ProxyProtocolOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.100 50000 80\r\n"))
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if ip := connectionIP(conn); ip != "127.0.0.1" {
+		t.Fatalf("spoofed client address %s", ip)
+	}
+}
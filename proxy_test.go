@@ -0,0 +1,68 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc is function implementing http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestOutboundTransportInjection(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Timeout", r.Header.Get(RequestTimeoutHeader))
+	}))
+	t.Cleanup(upstream.Close)
+	target, _ := url.Parse(upstream.URL)
+
+	tests := []struct {
+		name    string
+		handler func(transport http.RoundTripper) http.Handler
+	}{
+		{"proxy", func(transport http.RoundTripper) http.Handler {
+			return ProxyHandler(target, &ProxyOptions{Timeout: time.Second * 5, Transport: transport}, nil)
+		}},
+		{"client", func(transport http.RoundTripper) http.Handler {
+			client := NewHTTPClient(time.Second*5, transport)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+				defer cancel()
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				w.Header().Set("X-Timeout", resp.Header.Get("X-Timeout"))
+			})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			used := false
+			transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				used = true
+				return http.DefaultTransport.RoundTrip(req)
+			})
+			w := httptest.NewRecorder()
+			tt.handler(transport).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if !used {
+				t.Fatal("injected transport was not used")
+			}
+			if w.Header().Get("X-Timeout") == "" {
+				t.Fatal("deadline was not propagated to upstream")
+			}
+		})
+	}
+}
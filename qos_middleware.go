@@ -0,0 +1,137 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Priority classes of routes
+const (
+	PriorityCritical   = "critical"
+	PriorityNormal     = "normal"
+	PriorityBackground = "background"
+)
+
+// QoSOptions is a configuration container for load shedding by priority classes. When number of in-flight
+// requests reaches class threshold (fraction of MaxInFlight), requests of the class are rejected with 503.
+type QoSOptions struct {
+	// Max number of in-flight requests
+	MaxInFlight int
+	// Priority class of route templates, routes without class are normal. Health and status endpoints are critical.
+	Routes map[string]string
+	// Fraction of MaxInFlight when background requests are rejected, default is 0.5
+	BackgroundThreshold float64
+	// Fraction of MaxInFlight when normal requests are rejected, default is 0.9
+	NormalThreshold float64
+}
+
+// QoSOptionsFromViper reads load shedding options, nil is returned if max in-flight requests is not configured
+func QoSOptionsFromViper(prefix string) *QoSOptions {
+	if viper.GetInt(prefix+"max_in_flight") <= 0 {
+		return nil
+	}
+	return &QoSOptions{
+		MaxInFlight:         viper.GetInt(prefix + "max_in_flight"),
+		Routes:              viper.GetStringMapString(prefix + "routes"),
+		BackgroundThreshold: viper.GetFloat64(prefix + "background_threshold"),
+		NormalThreshold:     viper.GetFloat64(prefix + "normal_threshold"),
+	}
+}
+
+// qos object
+type qos struct {
+	options  QoSOptions
+	logger   *logrus.Logger
+	inFlight int64
+	// limit returns current in-flight limit
+	limit    func() int
+	gauge    prometheus.Gauge
+	rejected *prometheus.CounterVec
+}
+
+// newQoSMiddleware creates load shedding middleware
+func newQoSMiddleware(options *QoSOptions, logger *logrus.Logger) *qos {
+	q := &qos{
+		options: *options,
+		logger:  logger,
+	}
+	if q.options.BackgroundThreshold <= 0 {
+		q.options.BackgroundThreshold = 0.5
+	}
+	if q.options.NormalThreshold <= 0 {
+		q.options.NormalThreshold = 0.9
+	}
+	routes := map[string]string{
+		"/status":  PriorityCritical,
+		"/healthz": PriorityCritical,
+		"/readyz":  PriorityCritical,
+		"/metrics": PriorityCritical,
+	}
+	for route, class := range q.options.Routes {
+		routes[route] = class
+	}
+	q.options.Routes = routes
+	q.limit = func() int { return q.options.MaxInFlight }
+
+	q.gauge = registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of requests being processed.",
+	})).(prometheus.Gauge)
+	q.rejected = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_shed_total",
+		Help: "Number of requests rejected by load shedding by priority class.",
+	}, []string{"class"})).(*prometheus.CounterVec)
+	return q
+}
+
+// class returns priority class of request, route is matched as template or path without strip path
+func (q *qos) class(r *http.Request) string {
+	if class, ok := q.options.Routes[serviceRoute(r)]; ok {
+		return class
+	}
+	if class, ok := q.options.Routes[trimStripPath(r, r.URL.Path)]; ok {
+		return class
+	}
+	return PriorityNormal
+}
+
+// admit returns if request of class can be processed with current number of in-flight requests
+func (q *qos) admit(class string, inFlight int64) bool {
+	limit := float64(q.limit())
+	switch class {
+	case PriorityCritical:
+		return true
+	case PriorityBackground:
+		return float64(inFlight) <= limit*q.options.BackgroundThreshold
+	default:
+		return float64(inFlight) <= limit*q.options.NormalThreshold
+	}
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (q *qos) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := q.class(r)
+		inFlight := atomic.AddInt64(&q.inFlight, 1)
+		q.gauge.Inc()
+		defer func() {
+			atomic.AddInt64(&q.inFlight, -1)
+			q.gauge.Dec()
+		}()
+
+		if !q.admit(class, inFlight) {
+			q.rejected.WithLabelValues(class).Inc()
+			logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger)
+			err := ServerErrorWithoutStack(fmt.Errorf("load shedding: %d requests in flight, %s request rejected", inFlight, class), http.StatusServiceUnavailable, "Server is overloaded").WithRetryAfter(time.Second)
+			processHTTPError(err, w, r, logger, nil)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,39 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQoSClassWithStripPath(t *testing.T) {
+	q := newQoSMiddleware(&QoSOptions{MaxInFlight: 10, Routes: map[string]string{
+		"/orders/{id}": PriorityCritical,
+		"/reports":     PriorityBackground,
+	}}, nil)
+	tests := []struct {
+		name      string
+		stripPath string
+		path      string
+		template  string
+		want      string
+	}{
+		{"template", "", "/orders/1", "/orders/{id}", PriorityCritical},
+		{"template behind strip path", "/api", "/api/orders/1", "/api/orders/{id}", PriorityCritical},
+		{"path behind strip path", "/api/", "/api/reports", "", PriorityBackground},
+		{"built-in route behind strip path", "/api", "/api/status", "/api/status", PriorityCritical},
+		{"other route", "/api", "/api/users", "/api/users", PriorityNormal},
+		{"prefix is not stripped from other paths", "/api", "/apiorders/1", "/apiorders/{id}", PriorityNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			ctx := context.WithValue(r.Context(), contextTypeStripPath, tt.stripPath)
+			ctx = context.WithValue(ctx, contextTypeRouteTemplate, &requestRoute{template: tt.template})
+			if got := q.class(r.WithContext(ctx)); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
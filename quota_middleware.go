@@ -0,0 +1,233 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// QuotaStore is storage of quota usage (e.g. in memory, Redis, database)
+type QuotaStore interface {
+	// Increment increments usage of key in window and returns usage including this request.
+	// Window is identified by its start, ttl is time when usage can be forgotten.
+	Increment(ctx context.Context, key string, windowStart time.Time, ttl time.Duration) (usage int64, err error)
+}
+
+// QuotaLimits are max number of requests per window. Zero default limit means unlimited, zero scope limit means
+// that default limit applies and negative scope limit means unlimited.
+type QuotaLimits struct {
+	Daily   int64 `mapstructure:"daily"`
+	Monthly int64 `mapstructure:"monthly"`
+}
+
+// QuotaOptions is a configuration container for request quotas
+type QuotaOptions struct {
+	// Default limits
+	QuotaLimits
+	// Limits for users with given scope - they replace default limits, the most generous limits of user scopes
+	// are used
+	ScopeLimits map[string]QuotaLimits
+	// Storage of usage, default is in-memory store (not shared between replicas)
+	Store QuotaStore
+	// Function returning quota key of the request. Default is user ID of authenticated user (API keys have to be
+	// authenticated by IdentitySource). Requests with empty key are not limited, so the key must not be taken
+	// from unauthenticated input - client could use new key for every request.
+	KeyFn func(r *http.Request, userInfo *UserInfo) string
+	// Fail requests if store is not available. Default is to allow request.
+	FailClosed bool
+}
+
+// QuotaOptionsFromViper reads quota options, nil is returned if no limit is configured
+func QuotaOptionsFromViper(prefix string) (options *QuotaOptions) {
+	options = &QuotaOptions{
+		QuotaLimits: QuotaLimits{
+			Daily:   viper.GetInt64(prefix + "daily"),
+			Monthly: viper.GetInt64(prefix + "monthly"),
+		},
+		FailClosed: viper.GetBool(prefix + "fail_closed"),
+	}
+	viper.UnmarshalKey(prefix+"scopes", &options.ScopeLimits)
+	if options.Daily == 0 && options.Monthly == 0 && len(options.ScopeLimits) == 0 {
+		return nil
+	}
+	return
+}
+
+// quota object
+type quota struct {
+	options QuotaOptions
+	logger  *logrus.Logger
+}
+
+// newQuotaMiddleware creates quota middleware
+func newQuotaMiddleware(options *QuotaOptions, logger *logrus.Logger) *quota {
+	q := &quota{
+		options: *options,
+		logger:  logger,
+	}
+	if q.options.Store == nil {
+		q.options.Store = NewMemoryQuotaStore()
+	}
+	if q.options.KeyFn == nil {
+		q.options.KeyFn = defaultQuotaKey
+	}
+	return q
+}
+
+// defaultQuotaKey returns user ID of authenticated user
+func defaultQuotaKey(r *http.Request, userInfo *UserInfo) string {
+	if userInfo != nil && userInfo != unauthenticatedUser && userInfo != userWithInvalidToken && userInfo.UserID != "" {
+		return "user:" + userInfo.UserID
+	}
+	return ""
+}
+
+// limits returns quota limits of the user, limits set by user scopes replace default ones
+func (q *quota) limits(userInfo *UserInfo) (limits QuotaLimits) {
+	var scoped QuotaLimits
+	if userInfo != nil {
+		for scope, scopeLimits := range q.options.ScopeLimits {
+			if userInfo.HasScope(scope) {
+				scoped.Daily = moreGenerousLimit(scoped.Daily, scopeLimits.Daily)
+				scoped.Monthly = moreGenerousLimit(scoped.Monthly, scopeLimits.Monthly)
+			}
+		}
+	}
+	limits = q.options.QuotaLimits
+	if scoped.Daily != 0 {
+		limits.Daily = scoped.Daily
+	}
+	if scoped.Monthly != 0 {
+		limits.Monthly = scoped.Monthly
+	}
+	return
+}
+
+// moreGenerousLimit returns more generous of scope limits - zero is not set and negative is unlimited
+func moreGenerousLimit(a int64, b int64) int64 {
+	switch {
+	case a < 0 || b < 0:
+		return -1
+	case b > a:
+		return b
+	}
+	return a
+}
+
+// Middleware returns middleware function that counts requests and rejects them when quota is exceeded
+func (q *quota) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userInfo, _ := r.Context().Value(contextTypeUserInfo).(*UserInfo)
+		key := q.options.KeyFn(r, userInfo)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		limits := q.limits(userInfo)
+		now := time.Now().UTC()
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		windows := []struct {
+			name  string
+			limit int64
+			start time.Time
+			end   time.Time
+		}{
+			{"daily", limits.Daily, dayStart, dayStart.AddDate(0, 0, 1)},
+			{"monthly", limits.Monthly, monthStart, monthStart.AddDate(0, 1, 0)},
+		}
+
+		headerSet := false
+		for _, window := range windows {
+			if window.limit <= 0 {
+				continue
+			}
+			usage, err := q.options.Store.Increment(r.Context(), key+":"+window.name, window.start, window.end.Sub(now))
+			if err != nil {
+				if q.logger != nil {
+					q.logger.WithError(err).Error("quota: unable to increment usage")
+				}
+				if q.options.FailClosed {
+					processHTTPError(ServerErrorWithoutStack(err, http.StatusServiceUnavailable, "Quota not available"), w, r, q.logger, nil)
+					return
+				}
+				continue
+			}
+
+			remaining := window.limit - usage
+			if remaining < 0 {
+				remaining = 0
+			}
+			// Headers describe the first limited window, or the window that was exceeded
+			if !headerSet || usage > window.limit {
+				w.Header().Set("X-Quota-Limit", strconv.FormatInt(window.limit, 10))
+				w.Header().Set("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+				w.Header().Set("X-Quota-Reset", strconv.FormatInt(window.end.Unix(), 10))
+				headerSet = true
+			}
+
+			if usage > window.limit {
+				err = ServerErrorWithoutStack(nil, http.StatusTooManyRequests, "Quota exceeded").
+					WithErrorCode("QUOTA_EXCEEDED").
+					WithRetryAfter(window.end.Sub(now))
+				processHTTPError(err, w, r, q.logger, nil)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// memoryQuotaStore is in-memory QuotaStore
+type memoryQuotaStore struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryQuotaEntry
+	cleanup time.Time
+}
+
+type memoryQuotaEntry struct {
+	windowStart time.Time
+	usage       int64
+	expires     time.Time
+}
+
+// NewMemoryQuotaStore creates in-memory quota store. Usage is not shared between replicas and it is lost on restart.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{
+		entries: make(map[string]*memoryQuotaEntry),
+	}
+}
+
+// Increment implements QuotaStore
+func (m *memoryQuotaStore) Increment(_ context.Context, key string, windowStart time.Time, ttl time.Duration) (usage int64, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	if now.After(m.cleanup) {
+		for k, entry := range m.entries {
+			if now.After(entry.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.cleanup = now.Add(time.Minute)
+	}
+
+	entry, ok := m.entries[key]
+	if !ok || !entry.windowStart.Equal(windowStart) {
+		entry = &memoryQuotaEntry{windowStart: windowStart}
+		m.entries[key] = entry
+	}
+	entry.usage++
+	entry.expires = now.Add(ttl)
+	usage = entry.usage
+	return
+}
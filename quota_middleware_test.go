@@ -0,0 +1,96 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuotaKeyIgnoresUnauthenticatedAPIKey(t *testing.T) {
+	q := newQuotaMiddleware(&QuotaOptions{QuotaLimits: QuotaLimits{Daily: 1}}, nil)
+	tests := []struct {
+		name     string
+		userInfo *UserInfo
+		apiKey   string
+		key      string
+	}{
+		{"anonymous with API key", unauthenticatedUser, "victim-key", ""},
+		{"invalid token with API key", userWithInvalidToken, "victim-key", ""},
+		{"no user with API key", nil, "victim-key", ""},
+		{"authenticated user", &UserInfo{UserID: "u1"}, "victim-key", "user:u1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-API-Key", test.apiKey)
+			if key := q.options.KeyFn(req, test.userInfo); key != test.key {
+				t.Fatalf("expected key %q, got %q", test.key, key)
+			}
+		})
+	}
+}
+
+func TestQuotaAPIKeyRotationDoesNotDrainQuota(t *testing.T) {
+	q := newQuotaMiddleware(&QuotaOptions{QuotaLimits: QuotaLimits{Daily: 2}}, nil)
+	handler := q.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	user := &UserInfo{UserID: "u1"}
+	serve := func(userInfo *UserInfo, apiKey string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		req = req.WithContext(context.WithValue(req.Context(), contextTypeUserInfo, userInfo))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	// Anonymous requests with victim's API key don't count against authenticated user
+	for i := 0; i < 5; i++ {
+		serve(unauthenticatedUser, "u1")
+	}
+	for i := 0; i < 2; i++ {
+		if status := serve(user, fmt.Sprint(i)); status != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, status)
+		}
+	}
+	// Rotating API key doesn't give authenticated user fresh quota
+	if status := serve(user, "random"); status != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", status)
+	}
+}
+
+func TestQuotaScopeLimits(t *testing.T) {
+	options := &QuotaOptions{
+		QuotaLimits: QuotaLimits{Daily: 100, Monthly: 1000},
+		ScopeLimits: map[string]QuotaLimits{
+			"free":      {Daily: 10},
+			"pro":       {Daily: 1000, Monthly: 20000},
+			"unlimited": {Daily: -1, Monthly: -1},
+		},
+	}
+	tests := []struct {
+		name   string
+		scopes []string
+		limits QuotaLimits
+	}{
+		{"default", nil, QuotaLimits{Daily: 100, Monthly: 1000}},
+		{"stricter scope limit", []string{"free"}, QuotaLimits{Daily: 10, Monthly: 1000}},
+		{"more generous scope limit", []string{"pro"}, QuotaLimits{Daily: 1000, Monthly: 20000}},
+		{"most generous of scopes", []string{"free", "pro"}, QuotaLimits{Daily: 1000, Monthly: 20000}},
+		{"unlimited scope", []string{"free", "unlimited"}, QuotaLimits{Daily: -1, Monthly: -1}},
+	}
+	q := newQuotaMiddleware(options, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if limits := q.limits(&UserInfo{UserID: "u", Scopes: test.scopes}); limits != test.limits {
+				t.Fatalf("expected %+v, got %+v", test.limits, limits)
+			}
+		})
+	}
+
+	// Scope limit applies when there is no default limit
+	q = newQuotaMiddleware(&QuotaOptions{ScopeLimits: map[string]QuotaLimits{"free": {Daily: 10}}}, nil)
+	if limits := q.limits(&UserInfo{UserID: "u", Scopes: []string{"free"}}); limits.Daily != 10 {
+		t.Fatalf("scope limit without default: %+v", limits)
+	}
+}
@@ -0,0 +1,545 @@
+package webservice
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Output formats of traffic recorder
+const (
+	RecorderFormatHAR     = "har"
+	RecorderFormatOpenAPI = "openapi"
+)
+
+// RecorderOptions is a configuration container for traffic recorder - request/response pairs are written to
+// directory as HAR files (one entry per file, see Replay) or merged into OpenAPI example fragments (one file per
+// operation). Secret headers, query parameters and fields of JSON and form bodies (see SetMaskPatterns) are masked.
+// Files may contain personal data, they are readable only by owner.
+type RecorderOptions struct {
+	// Output directory
+	Dir string
+	// RecorderFormatHAR (default) or RecorderFormatOpenAPI
+	Format string
+	// Recorded path prefixes, empty means all paths. Operational routes are never recorded.
+	Paths []string
+	// Pairs with larger request or response body are not recorded. Default is 64 KiB.
+	MaxBodySize int64
+	// Max number of written HAR files, recording stops when limit is reached. Default is 1000.
+	MaxEntries int
+}
+
+// RecorderOptionsFromViper reads recorder options (dir, format, paths, max_body_size, max_entries), nil is
+// returned if recorder is not enabled
+func RecorderOptionsFromViper(prefix string) *RecorderOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &RecorderOptions{
+		Dir:         viper.GetString(prefix + "dir"),
+		Format:      viper.GetString(prefix + "format"),
+		Paths:       viper.GetStringSlice(prefix + "paths"),
+		MaxBodySize: viper.GetInt64(prefix + "max_body_size"),
+		MaxEntries:  viper.GetInt(prefix + "max_entries"),
+	}
+}
+
+// recorderSecretHeaders are always masked
+var recorderSecretHeaders = map[string]bool{"authorization": true, "proxy-authorization": true, "cookie": true, "set-cookie": true}
+
+// recorder object
+type recorder struct {
+	dir         string
+	format      string
+	paths       []string
+	maxBodySize int64
+	maxEntries  int
+	logger      *logrus.Logger
+	mutex       sync.Mutex
+	entries     int
+	sequence    uint64
+}
+
+// newRecorder creates recorder, output directory is created
+func newRecorder(options *RecorderOptions, logger *logrus.Logger) (*recorder, error) {
+	rec := &recorder{
+		dir:         options.Dir,
+		format:      options.Format,
+		paths:       options.Paths,
+		maxBodySize: options.MaxBodySize,
+		maxEntries:  options.MaxEntries,
+		logger:      logger,
+	}
+	if rec.format == "" {
+		rec.format = RecorderFormatHAR
+	}
+	if rec.format != RecorderFormatHAR && rec.format != RecorderFormatOpenAPI {
+		return nil, fmt.Errorf("unsupported recorder format %q", rec.format)
+	}
+	if rec.dir == "" {
+		return nil, errors.New("recorder directory is not configured")
+	}
+	if rec.maxBodySize <= 0 {
+		rec.maxBodySize = 64 << 10
+	}
+	if rec.maxEntries <= 0 {
+		rec.maxEntries = 1000
+	}
+	return rec, os.MkdirAll(rec.dir, 0o700)
+}
+
+// recordingWriter captures response body up to limit
+type recordingWriter struct {
+	*responseRecorder
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+// Write implements http.ResponseWriter
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if !rw.overflow {
+		if int64(rw.body.Len()+len(b)) > rw.limit {
+			rw.overflow = true
+		} else {
+			rw.body.Write(b)
+		}
+	}
+	return rw.responseRecorder.Write(b)
+}
+
+// Middleware records request/response pairs
+func (rec *recorder) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rec.records(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		requestBody, err := io.ReadAll(io.LimitReader(r.Body, rec.maxBodySize+1))
+		if err != nil || int64(len(requestBody)) > rec.maxBodySize {
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(requestBody), r.Body))
+			h.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+		started := time.Now()
+		rw := &recordingWriter{responseRecorder: newResponseRecorder(w), limit: rec.maxBodySize}
+		h.ServeHTTP(rw, r)
+		if rw.overflow {
+			return
+		}
+
+		exchange := &recordedExchange{
+			request:      r,
+			requestBody:  requestBody,
+			status:       rw.Status(),
+			header:       w.Header(),
+			responseBody: rw.body.Bytes(),
+			started:      started,
+			duration:     time.Since(started),
+			route:        RouteTemplate(r),
+		}
+		if err := rec.write(exchange); err != nil && rec.logger != nil {
+			rec.logger.WithError(err).Error("recorder: unable to write recorded traffic")
+		}
+	})
+}
+
+// records returns true if path is recorded
+func (rec *recorder) records(path string) bool {
+	if operationalRoutes[path] || strings.HasPrefix(path, "/debug/") || strings.HasPrefix(path, "/console") {
+		return false
+	}
+	if len(rec.paths) == 0 {
+		return true
+	}
+	for _, prefix := range rec.paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordedExchange is captured request/response pair
+type recordedExchange struct {
+	request      *http.Request
+	requestBody  []byte
+	status       int
+	header       http.Header
+	responseBody []byte
+	started      time.Time
+	duration     time.Duration
+	route        string
+}
+
+// write writes exchange in configured format
+func (rec *recorder) write(exchange *recordedExchange) error {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if rec.format == RecorderFormatOpenAPI {
+		return rec.writeOpenAPIExample(exchange)
+	}
+	if rec.entries >= rec.maxEntries {
+		return nil
+	}
+	rec.entries++
+	if rec.entries == rec.maxEntries && rec.logger != nil {
+		rec.logger.WithField("max_entries", rec.maxEntries).Warn("recorder: limit of recorded entries reached, recording stopped")
+	}
+	rec.sequence++
+
+	r := exchange.request
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	entry := harEntry{
+		StartedDateTime: exchange.started.UTC().Format(time.RFC3339Nano),
+		Time:            float64(exchange.duration.Microseconds()) / 1000,
+		Request: harRequest{
+			Method:      r.Method,
+			URL:         scheme + "://" + r.Host + maskedRequestURI(r.URL),
+			HTTPVersion: r.Proto,
+			Headers:     harHeaders(r.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(exchange.requestBody),
+		},
+		Response: harResponse{
+			Status:      exchange.status,
+			StatusText:  http.StatusText(exchange.status),
+			HTTPVersion: r.Proto,
+			Headers:     harHeaders(exchange.header),
+			Content:     harBody(exchange.responseBody, exchange.header.Get("Content-Type")),
+			HeadersSize: -1,
+			BodySize:    len(exchange.responseBody),
+		},
+		Cache:   struct{}{},
+		Timings: harTimings{Wait: float64(exchange.duration.Microseconds()) / 1000},
+		Comment: exchange.route,
+	}
+	query := maskValues(r.URL.Query())
+	for _, name := range sortedKeys(query) {
+		for _, value := range query[name] {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+		}
+	}
+	if len(exchange.requestBody) > 0 {
+		content := harBody(exchange.requestBody, r.Header.Get("Content-Type"))
+		entry.Request.PostData = &harPostData{MimeType: content.MimeType, Text: content.Text, Encoding: content.Encoding}
+	}
+
+	har := harFile{Log: harLog{Version: "1.2", Creator: harCreator{Name: "webservice", Version: "1"}, Entries: []harEntry{entry}}}
+	name := fmt.Sprintf("%s_%06d_%s.har", exchange.started.UTC().Format("20060102T150405"), rec.sequence, recorderFileName(r.Method, exchange.route))
+	return writeJSONFile(filepath.Join(rec.dir, name), har)
+}
+
+// recorderFileNameChars are replaced in file names
+var recorderFileNameChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// recorderFileName returns file name of operation (e.g. get_users_id)
+func recorderFileName(method string, route string) string {
+	name := strings.Trim(recorderFileNameChars.ReplaceAllString(route, "_"), "_")
+	if name == "" {
+		name = "root"
+	}
+	return strings.ToLower(method) + "_" + name
+}
+
+// writeJSONFile writes indented JSON file, file is replaced atomically
+func writeJSONFile(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err = os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// harHeaders converts headers to HAR list, secret headers are masked
+func harHeaders(header http.Header) []harNameValue {
+	list := []harNameValue{}
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			if recorderSecretHeaders[strings.ToLower(name)] || isSecretName(name) {
+				value = maskedValue
+			}
+			list = append(list, harNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// harBody converts body to HAR content, secrets of JSON bodies are masked and binary bodies are base64 encoded
+func harBody(body []byte, contentType string) harContent {
+	content := harContent{Size: len(body), MimeType: contentType}
+	if masked, ok := maskJSONBody(body, contentType); ok {
+		content.Text = string(masked)
+	} else if masked, ok := maskFormBody(body, contentType); ok {
+		content.Text = masked
+	} else if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text, content.Encoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return content
+}
+
+// maskJSONBody returns JSON body with masked secrets, ok is false if body is not JSON
+func maskJSONBody(body []byte, contentType string) (masked []byte, ok bool) {
+	value, ok := jsonBodyValue(body, contentType)
+	if !ok {
+		return nil, false
+	}
+	masked, err := json.Marshal(value)
+	return masked, err == nil
+}
+
+// maskFormBody returns urlencoded form body with masked secrets, ok is false if body is not form
+func maskFormBody(body []byte, contentType string) (masked string, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-www-form-urlencoded" {
+		return "", false
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", false
+	}
+	return maskValues(values).Encode(), true
+}
+
+// maskedRequestURI returns request URI with masked values of secret query parameters
+func maskedRequestURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	masked := *u
+	masked.RawQuery = maskValues(u.Query()).Encode()
+	return masked.RequestURI()
+}
+
+// maskValues masks values of secret query parameters or form fields in place
+func maskValues(values url.Values) url.Values {
+	for name, list := range values {
+		if isSecretName(name) {
+			for idx := range list {
+				list[idx] = maskedValue
+			}
+		}
+	}
+	return values
+}
+
+// isSecretName returns if header, query parameter or form field is secret - dashes are treated as underscores,
+// so X-API-Key matches *api_key* pattern
+func isSecretName(name string) bool {
+	return IsSecretKey(name) || IsSecretKey(strings.ReplaceAll(name, "-", "_"))
+}
+
+// sortedKeys returns sorted names of header or values, files are written in stable order
+func sortedKeys(values map[string][]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonBodyValue parses JSON body with masked secrets, ok is false if body is not JSON
+func jsonBodyValue(body []byte, contentType string) (value interface{}, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !isJSONMediaType(mediaType) || len(body) == 0 {
+		return nil, false
+	}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, false
+	}
+	return maskGeneric(value), true
+}
+
+// writeOpenAPIExample merges request and response examples into OpenAPI fragment of operation
+// (paths.<route>.<method>), requests without matched route are skipped
+func (rec *recorder) writeOpenAPIExample(exchange *recordedExchange) error {
+	if exchange.route == "" {
+		return nil
+	}
+	r := exchange.request
+	filename := filepath.Join(rec.dir, recorderFileName(r.Method, exchange.route)+".json")
+	method := strings.ToLower(r.Method)
+	var fragment struct {
+		Paths map[string]map[string]*openAPIOperation `json:"paths"`
+	}
+	if data, err := os.ReadFile(filename); err == nil {
+		if err = json.Unmarshal(data, &fragment); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	if fragment.Paths == nil {
+		fragment.Paths = map[string]map[string]*openAPIOperation{}
+	}
+	if fragment.Paths[exchange.route] == nil {
+		fragment.Paths[exchange.route] = map[string]*openAPIOperation{}
+	}
+	operation := fragment.Paths[exchange.route][method]
+	if operation == nil {
+		operation = &openAPIOperation{Responses: map[string]*openAPIResponse{}}
+		fragment.Paths[exchange.route][method] = operation
+	}
+
+	if len(exchange.requestBody) > 0 {
+		contentType, example := openAPIExample(exchange.requestBody, r.Header.Get("Content-Type"))
+		if operation.RequestBody == nil {
+			operation.RequestBody = &openAPIRequestBody{Content: map[string]openAPIMediaType{}}
+		}
+		operation.RequestBody.Content[contentType] = openAPIMediaType{Example: example}
+	}
+	status := strconv.Itoa(exchange.status)
+	response := operation.Responses[status]
+	if response == nil {
+		response = &openAPIResponse{Description: http.StatusText(exchange.status)}
+		operation.Responses[status] = response
+	}
+	if len(exchange.responseBody) > 0 {
+		contentType, example := openAPIExample(exchange.responseBody, exchange.header.Get("Content-Type"))
+		if response.Content == nil {
+			response.Content = map[string]openAPIMediaType{}
+		}
+		response.Content[contentType] = openAPIMediaType{Example: example}
+	}
+	return writeJSONFile(filename, fragment)
+}
+
+// openAPIExample returns media type and example value of body, JSON bodies are examples as parsed values
+func openAPIExample(body []byte, contentType string) (string, interface{}) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	if value, ok := jsonBodyValue(body, contentType); ok {
+		return mediaType, value
+	}
+	if masked, ok := maskFormBody(body, contentType); ok {
+		return mediaType, masked
+	}
+	if utf8.Valid(body) {
+		return mediaType, string(body)
+	}
+	return mediaType, base64.StdEncoding.EncodeToString(body)
+}
+
+// OpenAPI fragment written by recorder
+type openAPIOperation struct {
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIRequestBody struct {
+	Content map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Example interface{} `json:"example"`
+}
+
+// HAR 1.2 structures (http://www.softwareishard.com/blog/har-12-spec/)
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Route template of recorded request
+	Comment string `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Non-standard, base64 for binary body
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
@@ -0,0 +1,64 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderMasksSecrets(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		header      string
+		secret      string
+	}{
+		{"API key header", "/items", "", "", "X-API-Key", "key-123"},
+		{"authorization header", "/items", "", "", "Authorization", "Bearer abc"},
+		{"query parameter", "/items?access_token=tok-123&page=1", "", "", "", "tok-123"},
+		{"form field", "/token", "application/x-www-form-urlencoded", "grant_type=client_credentials&client_secret=sec-123", "", "sec-123"},
+		{"form password", "/login", "application/x-www-form-urlencoded", "user=a&password=pwd-123", "", "pwd-123"},
+		{"JSON field", "/login", "application/json", `{"user":"a","password":"pwd-123"}`, "", "pwd-123"},
+	}
+	for _, format := range []string{RecorderFormatHAR, RecorderFormatOpenAPI} {
+		for _, test := range tests {
+			t.Run(format+" "+test.name, func(t *testing.T) {
+				dir := filepath.Join(t.TempDir(), "traffic")
+				rec, err := newRecorder(&RecorderOptions{Dir: dir, Format: format}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				handler := routeHolderMiddleware(rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					r.Context().Value(contextTypeRouteTemplate).(*requestRoute).template = r.URL.Path
+					w.Write([]byte("ok"))
+				})))
+				req := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+				if test.contentType != "" {
+					req.Header.Set("Content-Type", test.contentType)
+				}
+				if test.header != "" {
+					req.Header.Set(test.header, test.secret)
+				}
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+
+				files, _ := filepath.Glob(filepath.Join(dir, "*"))
+				if len(files) != 1 {
+					t.Fatalf("expected single file, got %v", files)
+				}
+				info, _ := os.Stat(files[0])
+				if info.Mode().Perm() != 0o600 {
+					t.Fatalf("file mode %v", info.Mode().Perm())
+				}
+				data, _ := os.ReadFile(files[0])
+				if strings.Contains(string(data), test.secret) {
+					t.Fatalf("secret %q written in clear:\n%s", test.secret, data)
+				}
+			})
+		}
+	}
+}
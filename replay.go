@@ -0,0 +1,288 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplayOptions is a configuration container for replay of traffic captured by recorder (see EnableRecorder)
+type ReplayOptions struct {
+	// Base URL of tested service, path and query of recorded requests are appended
+	Target string
+	// Ignored JSON paths of response body - keys are separated by dot, array items are indexed (items.0.id) and
+	// * matches any key or index (items.*.created_at)
+	IgnorePaths []string
+	// Headers added to replayed requests, e.g. Authorization replacing masked value of recording
+	Header http.Header
+	// HTTP client, default client has 30s timeout
+	Client *http.Client
+}
+
+// ReplayResult is result of single replayed request, it passed if Differences are empty and Err is nil
+type ReplayResult struct {
+	Method string
+	Path   string
+	// Route template of recorded request
+	Route       string
+	Status      int
+	Duration    time.Duration
+	Differences []string
+	Err         error
+}
+
+// Passed returns true if response of replayed request matches recorded response
+func (r *ReplayResult) Passed() bool {
+	return r.Err == nil && len(r.Differences) == 0
+}
+
+// replayedHeaders are not copied from recorded requests
+var replayedHeaders = map[string]bool{"host": true, "content-length": true, "connection": true, "accept-encoding": true, "transfer-encoding": true}
+
+// Replay re-sends requests recorded in HAR files (files or directories with .har files) to target and compares
+// status and body of responses with recorded ones. Requests are sent sequentially in order of recording. Masked
+// headers and query parameters of recording are not sent and masked values are not compared. Note that unsafe
+// requests (POST, DELETE, ...) are replayed too.
+func Replay(ctx context.Context, paths []string, options *ReplayOptions) ([]*ReplayResult, error) {
+	target, err := url.Parse(strings.TrimSuffix(options.Target, "/"))
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid replay target %q", options.Target)
+	}
+	entries, err := loadHAREntries(paths)
+	if err != nil {
+		return nil, err
+	}
+	client := options.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	results := make([]*ReplayResult, 0, len(entries))
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return results, err
+		}
+		results = append(results, replayEntry(ctx, client, target, entry, options))
+	}
+	return results, nil
+}
+
+// loadHAREntries reads entries of HAR files ordered by start time
+func loadHAREntries(paths []string) ([]harEntry, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.har"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	var entries []harEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var har harFile
+		if err = json.Unmarshal(data, &har); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		entries = append(entries, har.Log.Entries...)
+	}
+	// RFC 3339 times of recorder are in UTC, they are ordered as strings
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime < entries[j].StartedDateTime
+	})
+	return entries, nil
+}
+
+// replayEntry sends recorded request to target and compares response
+func replayEntry(ctx context.Context, client *http.Client, target *url.URL, entry harEntry, options *ReplayOptions) *ReplayResult {
+	result := &ReplayResult{Method: entry.Request.Method, Route: entry.Comment}
+	recorded, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if recorded.RawQuery != "" {
+		// Masked parameters are not sent, like masked headers
+		query := recorded.Query()
+		for name, values := range query {
+			if len(values) > 0 && values[0] == maskedValue {
+				query.Del(name)
+			}
+		}
+		recorded.RawQuery = query.Encode()
+	}
+	result.Path = recorded.RequestURI()
+
+	var body []byte
+	if entry.Request.PostData != nil {
+		if body, err = harText(entry.Request.PostData.Text, entry.Request.PostData.Encoding); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, entry.Request.Method, target.String()+result.Path, bytes.NewReader(body))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	for _, header := range entry.Request.Headers {
+		if !replayedHeaders[strings.ToLower(header.Name)] && header.Value != maskedValue {
+			req.Header.Add(header.Name, header.Value)
+		}
+	}
+	for key, values := range options.Header {
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+	actual, err := io.ReadAll(resp.Body)
+	result.Duration = time.Since(started)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Status = resp.StatusCode
+
+	if resp.StatusCode != entry.Response.Status {
+		result.Differences = append(result.Differences, fmt.Sprintf("status: expected %d, got %d", entry.Response.Status, resp.StatusCode))
+	}
+	expected, err := harText(entry.Response.Content.Text, entry.Response.Content.Encoding)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Differences = append(result.Differences, diffBodies(expected, actual, options.IgnorePaths)...)
+	return result
+}
+
+// harText decodes text of HAR content
+func harText(text string, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// diffBodies compares bodies as JSON values if both are JSON, otherwise as bytes
+func diffBodies(expected []byte, actual []byte, ignorePaths []string) []string {
+	var expectedValue, actualValue interface{}
+	if json.Unmarshal(expected, &expectedValue) == nil && json.Unmarshal(actual, &actualValue) == nil {
+		var differences []string
+		diffJSON("", expectedValue, actualValue, ignorePaths, &differences)
+		return differences
+	}
+	if !bytes.Equal(expected, actual) {
+		return []string{fmt.Sprintf("body: expected %d bytes, got %d bytes with different content", len(expected), len(actual))}
+	}
+	return nil
+}
+
+// diffJSON appends differences of JSON values at path (empty for root) to list
+func diffJSON(path string, expected interface{}, actual interface{}, ignorePaths []string, differences *[]string) {
+	if ignoredPath(path, ignorePaths) || expected == maskedValue {
+		return
+	}
+	label := strings.TrimSuffix("body."+path, ".")
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(expectedValue)+len(actualValue))
+		for key := range expectedValue {
+			keys = append(keys, key)
+		}
+		for key := range actualValue {
+			if _, ok := expectedValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := strings.TrimPrefix(path+"."+key, ".")
+			e, inExpected := expectedValue[key]
+			a, inActual := actualValue[key]
+			switch {
+			case inExpected && inActual:
+				diffJSON(child, e, a, ignorePaths, differences)
+			case ignoredPath(child, ignorePaths):
+			case !inActual:
+				*differences = append(*differences, "body."+child+": missing")
+			default:
+				*differences = append(*differences, "body."+child+": unexpected")
+			}
+		}
+		return
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(expectedValue) != len(actualValue) {
+			*differences = append(*differences, fmt.Sprintf("%s: expected %d items, got %d", label, len(expectedValue), len(actualValue)))
+			return
+		}
+		for i := range expectedValue {
+			diffJSON(strings.TrimPrefix(path+"."+strconv.Itoa(i), "."), expectedValue[i], actualValue[i], ignorePaths, differences)
+		}
+		return
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		e, _ := json.Marshal(expected)
+		a, _ := json.Marshal(actual)
+		*differences = append(*differences, fmt.Sprintf("%s: expected %s, got %s", label, e, a))
+	}
+}
+
+// ignoredPath returns true if path matches any of patterns, * matches single segment
+func ignoredPath(path string, patterns []string) bool {
+	segments := strings.Split(path, ".")
+	for _, pattern := range patterns {
+		patternSegments := strings.Split(pattern, ".")
+		if len(patternSegments) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, segment := range patternSegments {
+			if segment != "*" && segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
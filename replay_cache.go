@@ -0,0 +1,160 @@
+package webservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NonceCache remembers used nonces within validity window to prevent replay of signed requests
+type NonceCache interface {
+	// Use marks nonce as used for ttl (has to be positive). It returns false if nonce was already used.
+	Use(ctx context.Context, nonce string, ttl time.Duration) (fresh bool, err error)
+	// Release forgets used nonce, so it can be used again (e.g. processing of request failed)
+	Release(ctx context.Context, nonce string) (err error)
+}
+
+// checkNonceTTL returns error for ttl which would not protect against replays
+func checkNonceTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid nonce ttl %v", ttl)
+	}
+	return nil
+}
+
+// memoryNonceCache is in-memory NonceCache - nonces are not shared between instances
+type memoryNonceCache struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewMemoryNonceCache creates in-memory nonce cache
+func NewMemoryNonceCache() NonceCache {
+	return &memoryNonceCache{nonces: map[string]time.Time{}}
+}
+
+// Use implements NonceCache
+func (c *memoryNonceCache) Use(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	if err := checkNonceTTL(ttl); err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastPrune) > time.Minute {
+		for key, expires := range c.nonces {
+			if now.After(expires) {
+				delete(c.nonces, key)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if expires, found := c.nonces[nonce]; found && now.Before(expires) {
+		return false, nil
+	}
+	c.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// Release implements NonceCache
+func (c *memoryNonceCache) Release(_ context.Context, nonce string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.nonces, nonce)
+	return nil
+}
+
+// redisNonceCache is NonceCache shared by all instances in Redis
+type redisNonceCache struct {
+	redis  RedisEvaler
+	prefix string
+}
+
+// NewRedisNonceCache creates Redis based nonce cache, keys are prefixed with prefix
+func NewRedisNonceCache(redis RedisEvaler, prefix string) NonceCache {
+	return &redisNonceCache{redis: redis, prefix: prefix}
+}
+
+const redisNonceScript = `
+if redis.call("SET", KEYS[1], "1", "NX", "PX", ARGV[1]) then
+	return 1
+end
+return 0`
+
+// Use implements NonceCache
+func (c *redisNonceCache) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	if err := checkNonceTTL(ttl); err != nil {
+		return false, err
+	}
+	result, err := c.redis.Eval(ctx, redisNonceScript, []string{c.prefix + nonce}, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.(int64)
+	return n == 1, nil
+}
+
+const redisReleaseNonceScript = `return redis.call("DEL", KEYS[1])`
+
+// Release implements NonceCache
+func (c *redisNonceCache) Release(ctx context.Context, nonce string) (err error) {
+	_, err = c.redis.Eval(ctx, redisReleaseNonceScript, []string{c.prefix + nonce})
+	return
+}
+
+// newNonce generates random nonce
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// replayProtectedVerifier rejects webhooks with already seen payload
+type replayProtectedVerifier struct {
+	verifier WebhookVerifier
+	cache    NonceCache
+	window   time.Duration
+}
+
+// ReplayProtectedVerifier wraps webhook verifier with replay cache - verified payload can't be delivered again
+// within window. Window should match timestamp tolerance of the verifier, zero means 5 minutes. If handler of
+// the payload fails, payload is released, so redelivery of the provider is accepted.
+func ReplayProtectedVerifier(verifier WebhookVerifier, cache NonceCache, window time.Duration) WebhookVerifier {
+	return &replayProtectedVerifier{verifier: verifier, cache: cache, window: timestampTolerance(window)}
+}
+
+// payloadNonce returns nonce of webhook payload
+func payloadNonce(payload []byte) string {
+	digest := sha256.Sum256(payload)
+	return "webhook:" + hex.EncodeToString(digest[:])
+}
+
+// Verify implements WebhookVerifier
+func (v *replayProtectedVerifier) Verify(r *http.Request, payload []byte) (err error) {
+	if err = v.verifier.Verify(r, payload); err != nil {
+		return
+	}
+	fresh, err := v.cache.Use(r.Context(), payloadNonce(payload), v.window)
+	if err != nil {
+		return
+	}
+	if !fresh {
+		return fmt.Errorf("webhook payload was already delivered")
+	}
+	return
+}
+
+// Delivered implements webhookDeliveryObserver - payload of failed delivery is released
+func (v *replayProtectedVerifier) Delivered(r *http.Request, payload []byte, deliveryErr error) {
+	if deliveryErr != nil {
+		v.cache.Release(context.WithoutCancel(r.Context()), payloadNonce(payload))
+	}
+}
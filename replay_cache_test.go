@@ -0,0 +1,140 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRedis emulates Redis scripts of nonce cache
+type testRedis struct {
+	mu   sync.Mutex
+	keys map[string]time.Time
+}
+
+// Eval implements RedisEvaler
+func (r *testRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch script {
+	case redisNonceScript:
+		ttl := args[0].(int64)
+		if ttl <= 0 {
+			return nil, errors.New("ERR invalid expire time in 'set' command")
+		}
+		if expires, ok := r.keys[keys[0]]; ok && time.Now().Before(expires) {
+			return int64(0), nil
+		}
+		r.keys[keys[0]] = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		return int64(1), nil
+	case redisReleaseNonceScript:
+		delete(r.keys, keys[0])
+		return int64(1), nil
+	}
+	return nil, errors.New("unknown script")
+}
+
+func TestNonceCache(t *testing.T) {
+	caches := []struct {
+		name  string
+		cache func() NonceCache
+	}{
+		{"memory", NewMemoryNonceCache},
+		{"redis", func() NonceCache { return NewRedisNonceCache(&testRedis{keys: map[string]time.Time{}}, "test:") }},
+	}
+	ctx := context.Background()
+	for _, c := range caches {
+		t.Run(c.name, func(t *testing.T) {
+			tests := []struct {
+				name string
+				run  func(cache NonceCache) (fresh bool, err error)
+				want bool
+				err  bool
+			}{
+				{"first use", func(cache NonceCache) (bool, error) {
+					return cache.Use(ctx, "n", time.Minute)
+				}, true, false},
+				{"second use", func(cache NonceCache) (bool, error) {
+					cache.Use(ctx, "n", time.Minute)
+					return cache.Use(ctx, "n", time.Minute)
+				}, false, false},
+				{"use after release", func(cache NonceCache) (bool, error) {
+					cache.Use(ctx, "n", time.Minute)
+					if err := cache.Release(ctx, "n"); err != nil {
+						return false, err
+					}
+					return cache.Use(ctx, "n", time.Minute)
+				}, true, false},
+				{"use after expiration", func(cache NonceCache) (bool, error) {
+					cache.Use(ctx, "n", time.Millisecond)
+					time.Sleep(time.Millisecond * 5)
+					return cache.Use(ctx, "n", time.Minute)
+				}, true, false},
+				{"zero ttl", func(cache NonceCache) (bool, error) {
+					return cache.Use(ctx, "n", 0)
+				}, false, true},
+				{"negative ttl", func(cache NonceCache) (bool, error) {
+					return cache.Use(ctx, "n", -time.Minute)
+				}, false, true},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					fresh, err := tt.run(c.cache())
+					if (err != nil) != tt.err {
+						t.Fatalf("got error %v, want error %v", err, tt.err)
+					}
+					if fresh != tt.want {
+						t.Fatalf("got fresh %v, want %v", fresh, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+// acceptingVerifier accepts all payloads
+type acceptingVerifier struct{}
+
+// Verify implements WebhookVerifier
+func (acceptingVerifier) Verify(r *http.Request, payload []byte) error {
+	return nil
+}
+
+func TestReplayProtectedRedelivery(t *testing.T) {
+	tests := []struct {
+		name           string
+		window         time.Duration
+		handlerErr     error
+		wantFirst      int
+		wantRedelivery int
+	}{
+		{"delivered", time.Minute, nil, http.StatusOK, http.StatusUnauthorized},
+		{"default window", 0, nil, http.StatusOK, http.StatusUnauthorized},
+		{"handler failed", time.Minute, ServerError(nil, http.StatusInternalServerError, "Failed"), http.StatusInternalServerError, http.StatusOK},
+		{"negative window", -time.Minute, nil, http.StatusUnauthorized, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := WebhookHandler(ReplayProtectedVerifier(acceptingVerifier{}, NewMemoryNonceCache(), tt.window), func(w http.ResponseWriter, r *http.Request, payload []byte) error {
+				calls++
+				if calls == 1 {
+					return tt.handlerErr
+				}
+				return nil
+			})
+			for idx, want := range []int{tt.wantFirst, tt.wantRedelivery} {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(`{"id":1}`))))
+				if w.Code != want {
+					t.Fatalf("delivery %d: got status %d, want %d", idx+1, w.Code, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// HMACAuthScheme is Authorization header scheme of signed requests:
+// Authorization: HMAC-SHA256 Credential=<key id>, Timestamp=<unix seconds>, Nonce=<random>, Signature=<hex HMAC>
+const HMACAuthScheme = "HMAC-SHA256"
+
+// HMACKey is a signing key of machine-to-machine client
+type HMACKey struct {
+	Secret string   `mapstructure:"secret"`
+	UserID string   `mapstructure:"uid"`
+	Scopes []string `mapstructure:"scopes"`
+}
+
+// HMACKeyStore looks up signing keys by key ID. Nil key is returned for unknown key ID.
+type HMACKeyStore interface {
+	LookupKey(ctx context.Context, keyID string) (*HMACKey, error)
+}
+
+// StaticHMACKeys is HMACKeyStore with keys from configuration
+type StaticHMACKeys map[string]*HMACKey
+
+// LookupKey implements HMACKeyStore
+func (s StaticHMACKeys) LookupKey(_ context.Context, keyID string) (*HMACKey, error) {
+	return s[keyID], nil
+}
+
+// HMACOptions configures request signature authentication
+type HMACOptions struct {
+	Keys HMACKeyStore
+	// Allowed difference between signature timestamp and server time. Default is 5 minutes.
+	Tolerance time.Duration
+	// Replay cache - if set, requests must contain nonce and every nonce is accepted only once within tolerance
+	Nonces NonceCache
+	// Max size of signed body, larger requests are rejected with 413. Default is 10 MiB.
+	MaxBodySize int64
+}
+
+// HMACOptionsFromViper reads signing keys (map key ID -> secret, uid, scopes), tolerance, replay_protection and
+// max_body_size, nil is returned if no key is configured
+func HMACOptionsFromViper(prefix string) *HMACOptions {
+	keys := StaticHMACKeys{}
+	viper.UnmarshalKey(prefix+"keys", &keys)
+	if len(keys) == 0 {
+		return nil
+	}
+	options := &HMACOptions{
+		Keys:        keys,
+		Tolerance:   viper.GetDuration(prefix + "tolerance"),
+		MaxBodySize: viper.GetInt64(prefix + "max_body_size"),
+	}
+	if viper.GetBool(prefix + "replay_protection") {
+		options.Nonces = NewMemoryNonceCache()
+	}
+	return options
+}
+
+// canonicalRequest returns string signed by client: method, path with query, hex SHA-256 of body, timestamp
+// and nonce (if used) separated by new lines
+func canonicalRequest(method string, requestURI string, body []byte, timestamp string, nonce string) []byte {
+	bodyHash := sha256.Sum256(body)
+	parts := []string{method, requestURI, hex.EncodeToString(bodyHash[:]), timestamp}
+	if nonce != "" {
+		parts = append(parts, nonce)
+	}
+	return []byte(strings.Join(parts, "\n"))
+}
+
+// parseHMACAuthorization parses parameters of HMAC Authorization header
+func parseHMACAuthorization(header string) (keyID string, timestamp string, nonce string, signature string, err error) {
+	params := strings.TrimSpace(strings.TrimPrefix(header, HMACAuthScheme))
+	for _, param := range strings.Split(params, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			continue
+		}
+		switch name {
+		case "Credential":
+			keyID = value
+		case "Timestamp":
+			timestamp = value
+		case "Nonce":
+			nonce = value
+		case "Signature":
+			signature = value
+		}
+	}
+	if keyID == "" || timestamp == "" || signature == "" {
+		err = fmt.Errorf("incomplete %s authorization header", HMACAuthScheme)
+	}
+	return
+}
+
+// verifyHMACRequest verifies signed request and returns user info of the signing key. Body of request is restored,
+// *http.MaxBytesError is returned if it exceeds MaxBodySize.
+func verifyHMACRequest(r *http.Request, options *HMACOptions) (*UserInfo, error) {
+	keyID, timestamp, nonce, signature, err := parseHMACAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	tolerance := timestampTolerance(options.Tolerance)
+	if err = checkTimestamp(timestamp, tolerance); err != nil {
+		return nil, err
+	}
+	if options.Nonces != nil && nonce == "" {
+		return nil, fmt.Errorf("nonce is required")
+	}
+	key, err := options.Keys.LookupKey(r.Context(), keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown key ID: %s", keyID)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		maxBodySize := options.MaxBodySize
+		if maxBodySize <= 0 {
+			maxBodySize = 10 << 20
+		}
+		body, err = io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := computeHMAC(sha256.New, []byte(key.Secret), canonicalRequest(r.Method, r.URL.RequestURI(), body, timestamp, nonce))
+	if !equalSignature(expected, signature) {
+		return nil, fmt.Errorf("invalid request signature")
+	}
+
+	// Nonce is stored only for valid signatures, so it can't be burned by forged requests
+	if options.Nonces != nil {
+		fresh, err := options.Nonces.Use(r.Context(), "hmac:"+keyID+":"+nonce, 2*tolerance)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			return nil, fmt.Errorf("replayed request (nonce already used)")
+		}
+	}
+
+	userID := key.UserID
+	if userID == "" {
+		userID = keyID
+	}
+	return &UserInfo{
+		UserID: userID,
+		Scopes: key.Scopes,
+		Claims: map[string]interface{}{"kid": keyID, "auth": HMACAuthScheme},
+		// Claims are not trusted as marker of signed request, JWT can contain the same "auth" claim
+		authScheme: HMACAuthScheme,
+	}, nil
+}
+
+// SignRequest signs outbound request with HMAC key - counterpart of HMAC authentication for Go clients
+func SignRequest(req *http.Request, keyID string, secret string) (err error) {
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newNonce()
+	signature := computeHMAC(sha256.New, []byte(secret), canonicalRequest(req.Method, req.URL.RequestURI(), body, timestamp, nonce))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, Timestamp=%s, Nonce=%s, Signature=%s", HMACAuthScheme, keyID, timestamp, nonce, signature))
+	return
+}
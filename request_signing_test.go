@@ -0,0 +1,72 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEmailAllowedDoesNotTrustAuthClaim(t *testing.T) {
+	a := &authorization{requireVerifiedEmail: true, allowedEmailDomains: []string{"example.com"}}
+	options := &HMACOptions{Keys: StaticHMACKeys{"k1": {Secret: "secret", UserID: "machine"}}}
+
+	req := httptest.NewRequest("POST", "/items", strings.NewReader(`{}`))
+	if err := SignRequest(req, "k1", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := verifyHMACRequest(req, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userInfo *UserInfo
+		allowed  bool
+	}{
+		{"signed request", signed, true},
+		{"token with auth claim", &UserInfo{UserID: "u", Email: "u@evil.com", Claims: map[string]interface{}{"auth": HMACAuthScheme}}, false},
+		{"token with copied claims of signed request", &UserInfo{UserID: "u", Claims: signed.Claims}, false},
+		{"unverified email", &UserInfo{UserID: "u", Email: "u@example.com", Claims: map[string]interface{}{}}, false},
+		{"verified email", &UserInfo{UserID: "u", Email: "u@example.com", Claims: map[string]interface{}{"email_verified": true}}, true},
+		{"verified email of other domain", &UserInfo{UserID: "u", Email: "u@evil.com", Claims: map[string]interface{}{"email_verified": true}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed := a.emailAllowed(test.userInfo); allowed != test.allowed {
+				t.Fatalf("expected %v, got %v", test.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestHMACBodyLimit(t *testing.T) {
+	options := &HMACOptions{Keys: StaticHMACKeys{"k1": {Secret: "secret"}}, MaxBodySize: 16}
+	a := newAuthorizationMiddleware(&AuthorizationOptions{HMAC: options}, nil)
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"within limit", strings.Repeat("x", 16), http.StatusNoContent},
+		{"over limit", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/items", strings.NewReader(test.body))
+			if err := SignRequest(req, "k1", "secret"); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+		})
+	}
+}
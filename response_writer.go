@@ -0,0 +1,76 @@
+package webservice
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseRecorder wraps http.ResponseWriter and records status code and number of written bytes
+type responseRecorder struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int64
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		ResponseWriter: w,
+	}
+}
+
+// WriteHeader implements http.ResponseWriter
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (rr *responseRecorder) Write(b []byte) (n int, err error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err = rr.ResponseWriter.Write(b)
+	rr.bytesWritten += int64(n)
+	return
+}
+
+// Flush implements http.Flusher if underlying writer supports it
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		if rr.status == 0 {
+			rr.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if underlying writer supports it (websockets), hijacked connection is recorded
+// with status 101
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rr.ResponseWriter).Hijack()
+	if err == nil && rr.status == 0 {
+		rr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns original response writer (used by http.ResponseController)
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Status returns written status code (200 if nothing was written explicitly)
+func (rr *responseRecorder) Status() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
+
+// BytesWritten returns number of body bytes written
+func (rr *responseRecorder) BytesWritten() int64 {
+	return rr.bytesWritten
+}
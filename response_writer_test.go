@@ -0,0 +1,63 @@
+package webservice
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWrappedWriterHijack(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tests := []struct {
+		name string
+		wrap func(h http.Handler) http.Handler
+	}{
+		{"logging", NewLoggingMiddleware(logger).Middleware},
+		{"location rewriter", externalURLMiddleware("/api", true)},
+		{"recorder", func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rec := newResponseRecorder(w)
+				h.ServeHTTP(rec, r)
+				if rec.Status() != http.StatusSwitchingProtocols {
+					t.Errorf("recorded status %d", rec.Status())
+				}
+			})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, rw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer conn.Close()
+				rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+				rw.Flush()
+			})))
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			io.WriteString(conn, "GET /api/ws HTTP/1.1\r\nHost: test\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+		})
+	}
+}
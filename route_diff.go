@@ -0,0 +1,175 @@
+package webservice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// RouteDiffOptions is a configuration container for detection of route changes between runs
+type RouteDiffOptions struct {
+	// File with route manifest of previous run (or committed manifest)
+	File string
+	// Manifest is committed baseline - it is compared, but not overwritten
+	ReadOnly bool
+}
+
+// RouteDiffOptionsFromViper reads route diff options (file, read_only), nil is returned if file is not set
+func RouteDiffOptionsFromViper(prefix string) *RouteDiffOptions {
+	file := viper.GetString(prefix + "file")
+	if file == "" {
+		return nil
+	}
+	return &RouteDiffOptions{
+		File:     file,
+		ReadOnly: viper.GetBool(prefix + "read_only"),
+	}
+}
+
+// RouteManifest is persisted list of routes and their authorization
+type RouteManifest struct {
+	Hash   string                `json:"hash"`
+	Routes []*RouteManifestEntry `json:"routes"`
+}
+
+// RouteManifestEntry is authorization of single method and path
+type RouteManifestEntry struct {
+	Method string   `json:"method"`
+	Path   string   `json:"path"`
+	Policy string   `json:"policy"`
+	Scopes []string `json:"scopes,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// key identifies entry in manifest
+func (e *RouteManifestEntry) key() string {
+	return e.Method + " " + e.Path
+}
+
+// access describes authorization of entry
+func (e *RouteManifestEntry) access() string {
+	var access []string
+	if e.Policy != RoutePolicyScopes && e.Policy != RoutePolicyGroups {
+		access = append(access, e.Policy)
+	}
+	if len(e.Scopes) > 0 {
+		access = append(access, "scopes="+strings.Join(e.Scopes, ","))
+	}
+	if len(e.Groups) > 0 {
+		access = append(access, "groups="+strings.Join(e.Groups, ","))
+	}
+	return strings.Join(access, " ")
+}
+
+// routeManifest creates manifest of routes registered in router
+func (s *webservice) routeManifest(router *mux.Router) *RouteManifest {
+	manifest := &RouteManifest{}
+	for _, ra := range s.resolvedRouteAuthorizationReport(router) {
+		methods := ra.Methods
+		if len(methods) == 0 {
+			methods = []string{"*"}
+		}
+		for _, method := range methods {
+			manifest.Routes = append(manifest.Routes, &RouteManifestEntry{
+				Method: method,
+				Path:   ra.Path,
+				Policy: ra.Policy,
+				Scopes: ra.Scopes,
+				Groups: ra.Groups,
+			})
+		}
+	}
+	sort.Slice(manifest.Routes, func(i, j int) bool { return manifest.Routes[i].key() < manifest.Routes[j].key() })
+	routes, _ := json.Marshal(manifest.Routes)
+	digest := sha256.Sum256(routes)
+	manifest.Hash = hex.EncodeToString(digest[:])
+	return manifest
+}
+
+// diffRoutes logs routes added, removed or changed since previous run and stores current manifest
+func (s *webservice) diffRoutes(router *mux.Router, options *RouteDiffOptions) (err error) {
+	current := s.routeManifest(router)
+
+	data, err := os.ReadFile(options.File)
+	if errors.Is(err, fs.ErrNotExist) {
+		if s.logger != nil {
+			s.logger.WithField("file", options.File).WithField("routes_hash", current.Hash).Info("No previous route manifest, routes are not compared")
+		}
+		err = nil
+	} else if err != nil {
+		return
+	} else {
+		previous := &RouteManifest{}
+		if err = json.Unmarshal(data, previous); err != nil {
+			return
+		}
+		if previous.Hash != current.Hash {
+			s.logRouteDiff(previous, current)
+		} else if s.logger != nil {
+			s.logger.WithField("routes_hash", current.Hash).Debug("Routes did not change")
+		}
+	}
+
+	if options.ReadOnly {
+		return
+	}
+	data, err = json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return
+	}
+	return os.WriteFile(options.File, append(data, '\n'), 0644)
+}
+
+// logRouteDiff logs every difference between manifests, new anonymous access is logged as warning
+func (s *webservice) logRouteDiff(previous *RouteManifest, current *RouteManifest) {
+	if s.logger == nil {
+		return
+	}
+	before := map[string]*RouteManifestEntry{}
+	for _, entry := range previous.Routes {
+		before[entry.key()] = entry
+	}
+	var added, removed, changed int
+	for _, entry := range current.Routes {
+		fields := logrus.Fields{"method": entry.Method, "path": entry.Path, "access": entry.access()}
+		old, found := before[entry.key()]
+		delete(before, entry.key())
+		switch {
+		case !found:
+			added++
+			if policyAllowsAnonymous(entry.Policy) {
+				s.logger.WithFields(fields).Warn("New route allows anonymous access")
+			} else {
+				s.logger.WithFields(fields).Info("Route added")
+			}
+		case old.access() != entry.access():
+			changed++
+			fields["previous_access"] = old.access()
+			if policyAllowsAnonymous(entry.Policy) && !policyAllowsAnonymous(old.Policy) {
+				s.logger.WithFields(fields).Warn("Route newly allows anonymous access")
+			} else {
+				s.logger.WithFields(fields).Info("Route authorization changed")
+			}
+		}
+	}
+	for _, entry := range before {
+		removed++
+		s.logger.WithFields(logrus.Fields{"method": entry.Method, "path": entry.Path, "access": entry.access()}).Info("Route removed")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"added":                added,
+		"removed":              removed,
+		"changed":              changed,
+		"routes_hash":          current.Hash,
+		"previous_routes_hash": previous.Hash,
+	}).Warn("Routes changed since previous run")
+}
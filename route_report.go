@@ -0,0 +1,174 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Authorization policies of routes in route report
+const (
+	RoutePolicyDefault                 = "default"
+	RoutePolicyScopes                  = "scopes"
+	RoutePolicyGroups                  = "groups"
+	RoutePolicyAnonymous               = "anonymous"
+	RoutePolicyInvalidTokenIsAnonymous = "invalid_token_is_anonymous"
+	RoutePolicyRule                    = "rule"
+	RoutePolicyUndeclared              = "undeclared"
+)
+
+// RouteAuthorization describes authorization of registered route
+type RouteAuthorization struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods,omitempty"`
+	Policy  string   `json:"policy"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	// Path of configuration rule applied to route
+	Rule string `json:"rule,omitempty"`
+}
+
+// allowsAnonymous returns if route can be called without valid token
+func (ra *RouteAuthorization) allowsAnonymous() bool {
+	return policyAllowsAnonymous(ra.Policy)
+}
+
+// policyAllowsAnonymous returns if route with authorization policy can be called without valid token
+func policyAllowsAnonymous(policy string) bool {
+	return policy == RoutePolicyAnonymous || policy == RoutePolicyInvalidTokenIsAnonymous
+}
+
+// resolvedRouteAuthorizationReport returns route authorization report with scopes of routes using default
+// authorization resolved from authorization options
+func (s *webservice) resolvedRouteAuthorizationReport(router *mux.Router) (report []*RouteAuthorization) {
+	report = s.routeAuthorizationReport(router)
+	base := strings.TrimSuffix(s.stripPath, "/")
+	for _, ra := range report {
+		if ra.Policy == RoutePolicyDefault {
+			ra.Scopes = s.defaultRouteScopes(strings.TrimPrefix(ra.Path, base))
+		}
+	}
+	return
+}
+
+// routeAuthorizationReport walks mux router and describes authorization of every route. Routes of custom Router
+// (SetRouter) are not visible to the report.
+func (s *webservice) routeAuthorizationReport(router *mux.Router) (report []*RouteAuthorization) {
+	options := s.authorizationOptions
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		for {
+			wrapper, ok := handler.(interface{ Unwrap() http.Handler })
+			if !ok {
+				break
+			}
+			handler = wrapper.Unwrap()
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			path, _ = route.GetPathRegexp()
+		}
+		methods, _ := route.GetMethods()
+		ra := &RouteAuthorization{Path: path, Methods: methods, Policy: RoutePolicyUndeclared}
+
+		if ah, ok := handler.(*apphandler); ok {
+			ra.Policy = RoutePolicyDefault
+			if options != nil && options.AllowAnonymous {
+				ra.Policy = RoutePolicyAnonymous
+			}
+			if ah.allowedScopes != nil {
+				ra.Policy = RoutePolicyScopes
+				ra.Scopes = *ah.allowedScopes
+			}
+			if ah.allowedGroups != nil {
+				ra.Policy = RoutePolicyGroups
+				ra.Groups = *ah.allowedGroups
+			}
+			if ah.invalidTokenIsAnonymous != nil && *ah.invalidTokenIsAnonymous {
+				ra.Policy = RoutePolicyInvalidTokenIsAnonymous
+			}
+			if ah.allowAnonymous != nil {
+				if *ah.allowAnonymous {
+					ra.Policy = RoutePolicyAnonymous
+				} else if ra.Policy == RoutePolicyAnonymous {
+					ra.Policy = RoutePolicyDefault
+				}
+			}
+		}
+
+		if options != nil {
+			relativePath := strings.TrimPrefix(path, strings.TrimSuffix(s.stripPath, "/"))
+			for idx := range options.Rules {
+				rule := &options.Rules[idx]
+				method := ""
+				if len(methods) == 1 {
+					method = methods[0]
+				}
+				if (method != "" || len(rule.Methods) == 0) && rule.matches(method, relativePath) {
+					ra.Rule = rule.Path
+					if ra.Policy == RoutePolicyUndeclared || ra.Policy == RoutePolicyDefault {
+						ra.Policy = RoutePolicyRule
+						ra.Scopes = rule.Scopes
+					}
+					break
+				}
+			}
+		}
+
+		report = append(report, ra)
+		return nil
+	})
+	return
+}
+
+// defaultRouteScopes returns scopes required by route with default policy - scopes of mount or required scope
+// of authorization options. Path is relative to strip path.
+func (s *webservice) defaultRouteScopes(path string) []string {
+	for _, m := range s.mounts {
+		if strings.HasPrefix(path, m.prefix) && len(m.requiredScopes) > 0 {
+			return m.requiredScopes
+		}
+	}
+	if s.authorizationOptions != nil && !s.authorizationOptions.Disabled && s.authorizationOptions.RequiredScope != "" {
+		return []string{s.authorizationOptions.RequiredScope}
+	}
+	return nil
+}
+
+// checkRouteAuthorization logs routes allowing anonymous access, serves report at /debug/routes in dev mode and
+// in strict mode fails if any route has no authorization declaration
+func (s *webservice) checkRouteAuthorization(router *mux.Router) (err error) {
+	if s.authorizationOptions == nil || s.authorizationOptions.Disabled {
+		return
+	}
+	report := s.routeAuthorizationReport(router)
+
+	var undeclared []string
+	for _, ra := range report {
+		if ra.allowsAnonymous() && s.logger != nil {
+			s.logger.WithFields(logrus.Fields{"path": ra.Path, "methods": ra.Methods, "policy": ra.Policy}).Info("route allows anonymous access")
+		}
+		if ra.Policy == RoutePolicyUndeclared {
+			undeclared = append(undeclared, ra.Path)
+			if s.logger != nil {
+				s.logger.WithFields(logrus.Fields{"path": ra.Path, "methods": ra.Methods}).Warn("route has no authorization declaration")
+			}
+		}
+	}
+	if s.authorizationOptions.Strict && len(undeclared) > 0 {
+		return fmt.Errorf("strict authorization: routes without authorization declaration: %s", strings.Join(undeclared, ", "))
+	}
+
+	if s.devMode {
+		router.Handle("/debug/routes", AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+			return WriteJSON(w, r, report)
+		}).AllowAnonymous()).Methods("GET")
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// requestRoute is holder for path template of matched route. It is created before routing,
+// so middlewares wrapping router can read template after request is served.
+type requestRoute struct {
+	template string
+}
+
+// RouteTemplate returns path template of matched route (e.g. /users/{id}) or empty string if route is not known (yet)
+func RouteTemplate(r *http.Request) string {
+	return RouteTemplateFromContext(r.Context())
+}
+
+// serviceRoute returns route template without configured strip path (e.g. /status for /api/status), so it can be
+// compared with routes of service
+func serviceRoute(r *http.Request) string {
+	return trimStripPath(r, RouteTemplate(r))
+}
+
+// trimStripPath returns path (or route template) without configured strip path
+func trimStripPath(r *http.Request, path string) string {
+	if stripPath, ok := r.Context().Value(contextTypeStripPath).(string); ok && stripPath != "" {
+		if trimmed := strings.TrimPrefix(path, strings.TrimSuffix(stripPath, "/")); strings.HasPrefix(trimmed, "/") {
+			return trimmed
+		}
+	}
+	return path
+}
+
+// RouteTemplateFromContext returns path template of matched route stored in context
+func RouteTemplateFromContext(ctx context.Context) string {
+	if holder, ok := ctx.Value(contextTypeRouteTemplate).(*requestRoute); ok && holder != nil {
+		return holder.template
+	}
+	return ""
+}
+
+// routeHolderMiddleware prepares holder for route template in request context
+func routeHolderMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(contextTypeRouteTemplate).(*requestRoute); !ok {
+			r = r.WithContext(context.WithValue(r.Context(), contextTypeRouteTemplate, &requestRoute{}))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// routeTemplateMiddleware resolves template of matched mux route - it has to be used in router.Use()
+func routeTemplateMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				if holder, ok := r.Context().Value(contextTypeRouteTemplate).(*requestRoute); ok && holder != nil {
+					holder.template = template
+				} else {
+					r = r.WithContext(context.WithValue(r.Context(), contextTypeRouteTemplate, &requestRoute{template: template}))
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
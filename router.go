@@ -0,0 +1,158 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Router is minimal router abstraction, so application routes can be served by other router than gorilla/mux.
+// Framework endpoints (status, health, metrics) are always served by internal gorilla/mux router.
+type Router interface {
+	http.Handler
+	// Handle registers handler for method and path pattern with {name} placeholders. Empty method matches all methods.
+	Handle(method string, pattern string, handler http.Handler)
+	// Use adds middlewares applied to matched routes
+	Use(middlewares ...func(http.Handler) http.Handler)
+}
+
+// ConfigureRoutesHandler is an interface to implement to configure routing independently on router implementation
+type ConfigureRoutesHandler interface {
+	ConfigureRoutes(router Router) (err error)
+}
+
+// pathParamFn resolves path parameter of matched route
+type pathParamFn func(r *http.Request, name string) string
+
+// PathParam returns value of path parameter of matched route regardless of used router
+func PathParam(r *http.Request, name string) string {
+	if fn, ok := r.Context().Value(contextTypePathParam).(pathParamFn); ok && fn != nil {
+		return fn(r, name)
+	}
+	return mux.Vars(r)[name]
+}
+
+// routeHandler wraps handler registered in router adapter, so route template and path parameters are available
+func routeHandler(template string, pathParam pathParamFn, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if holder, ok := ctx.Value(contextTypeRouteTemplate).(*requestRoute); ok && holder != nil {
+			holder.template = template
+		} else {
+			ctx = context.WithValue(ctx, contextTypeRouteTemplate, &requestRoute{template: template})
+		}
+		ctx = context.WithValue(ctx, contextTypePathParam, pathParam)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// muxRouter is adapter for gorilla/mux
+type muxRouter struct {
+	router *mux.Router
+}
+
+// NewMuxRouter creates Router adapter for gorilla/mux router (default router)
+func NewMuxRouter(router *mux.Router) Router {
+	router.Use(routeTemplateMiddleware)
+	return &muxRouter{router: router}
+}
+
+// ServeHTTP implements http.Handler
+func (m *muxRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.router.ServeHTTP(w, r)
+}
+
+// Handle implements Router
+func (m *muxRouter) Handle(method string, pattern string, handler http.Handler) {
+	route := m.router.Handle(pattern, handler)
+	if method != "" {
+		route.Methods(method)
+	}
+}
+
+// Use implements Router
+func (m *muxRouter) Use(middlewares ...func(http.Handler) http.Handler) {
+	for _, middleware := range middlewares {
+		m.router.Use(middleware)
+	}
+}
+
+// serveMuxRouter is adapter for net/http ServeMux with Go 1.22 patterns
+type serveMuxRouter struct {
+	mux         *http.ServeMux
+	middlewares []func(http.Handler) http.Handler
+}
+
+// NewServeMuxRouter creates Router adapter for net/http ServeMux (method and wildcard patterns of Go 1.22).
+// Middlewares are applied when handler is registered, so Use() has to be called before Handle().
+func NewServeMuxRouter(serveMux *http.ServeMux) Router {
+	if serveMux == nil {
+		serveMux = http.NewServeMux()
+	}
+	return &serveMuxRouter{mux: serveMux}
+}
+
+// ServeHTTP implements http.Handler
+func (m *serveMuxRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+// Handle implements Router
+func (m *serveMuxRouter) Handle(method string, pattern string, handler http.Handler) {
+	for idx := len(m.middlewares) - 1; idx >= 0; idx-- {
+		handler = m.middlewares[idx](handler)
+	}
+	muxPattern := pattern
+	if method != "" {
+		muxPattern = method + " " + pattern
+	}
+	m.mux.Handle(muxPattern, routeHandler(pattern, func(r *http.Request, name string) string {
+		return r.PathValue(name)
+	}, handler))
+}
+
+// Use implements Router
+func (m *serveMuxRouter) Use(middlewares ...func(http.Handler) http.Handler) {
+	m.middlewares = append(m.middlewares, middlewares...)
+}
+
+// ChiRouter is subset of go-chi/chi Router used by adapter (chi.Router satisfies it)
+type ChiRouter interface {
+	http.Handler
+	Method(method string, pattern string, handler http.Handler)
+	Handle(pattern string, handler http.Handler)
+	Use(middlewares ...func(http.Handler) http.Handler)
+}
+
+// chiRouter is adapter for go-chi/chi
+type chiRouter struct {
+	router   ChiRouter
+	urlParam pathParamFn
+}
+
+// NewChiRouter creates Router adapter for go-chi/chi router. urlParam should be chi.URLParam,
+// so PathParam() works without the framework depending on chi.
+func NewChiRouter(router ChiRouter, urlParam func(r *http.Request, key string) string) Router {
+	return &chiRouter{router: router, urlParam: urlParam}
+}
+
+// ServeHTTP implements http.Handler
+func (c *chiRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.router.ServeHTTP(w, r)
+}
+
+// Handle implements Router
+func (c *chiRouter) Handle(method string, pattern string, handler http.Handler) {
+	handler = routeHandler(pattern, c.urlParam, handler)
+	if method == "" {
+		c.router.Handle(pattern, handler)
+	} else {
+		c.router.Method(method, pattern, handler)
+	}
+}
+
+// Use implements Router
+func (c *chiRouter) Use(middlewares ...func(http.Handler) http.Handler) {
+	c.router.Use(middlewares...)
+}
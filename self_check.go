@@ -0,0 +1,86 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SelfCheckOptions configures self-check mode - service starts, calls its own endpoints and shuts down
+// (Start() returns error if any check failed)
+type SelfCheckOptions struct {
+	// Additional routes checked after /status and /healthz (relative to strip path)
+	Routes []string
+	// Timeout of single request, default is 5 seconds
+	Timeout time.Duration
+}
+
+// SelfCheckOptionsFromViper reads self-check options (selfcheck, selfcheck_routes and selfcheck_timeout),
+// nil is returned if self-check mode is not enabled
+func SelfCheckOptionsFromViper() *SelfCheckOptions {
+	if !viper.GetBool("selfcheck") {
+		return nil
+	}
+	return &SelfCheckOptions{
+		Routes:  viper.GetStringSlice("selfcheck_routes"),
+		Timeout: viper.GetDuration("selfcheck_timeout"),
+	}
+}
+
+// selfCheck calls /status, /healthz and configured routes on listener address. Request fails on 4xx/5xx status.
+func (s *webservice) selfCheck(addr string) (err error) {
+	timeout := s.selfCheckOptions.Timeout
+	if timeout <= 0 {
+		timeout = time.Second * 5
+	}
+	client := &http.Client{Timeout: timeout}
+	host := "localhost"
+	if socket, ok := strings.CutPrefix(addr, unixSocketPrefix); ok {
+		client.Transport = &http.Transport{DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}}
+	} else {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		host = net.JoinHostPort("127.0.0.1", port)
+	}
+	base := "http://" + host + strings.TrimSuffix(s.stripPath, "/")
+
+	failed := 0
+	for _, route := range append([]string{"/status", "/healthz"}, s.selfCheckOptions.Routes...) {
+		var status int
+		resp, reqErr := client.Get(base + route)
+		if reqErr == nil {
+			status = resp.StatusCode
+			resp.Body.Close()
+			if status >= http.StatusBadRequest {
+				reqErr = fmt.Errorf("unexpected status %d", status)
+			}
+		}
+		if reqErr != nil {
+			failed++
+			if s.logger != nil {
+				s.logger.WithError(reqErr).WithField("route", route).Error("self-check failed")
+			}
+		} else if s.logger != nil {
+			s.logger.WithField("route", route).WithField("status", status).Print("self-check passed")
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d self-check(s) failed", failed)
+	}
+	return
+}
+
+// Enable self-check mode - service shuts down after its endpoints are checked (e.g. container HEALTHCHECK,
+// deploy gate)
+func (s *webservice) EnableSelfCheck(options *SelfCheckOptions) {
+	s.selfCheckOptions = options
+}
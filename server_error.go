@@ -1,12 +1,26 @@
 package webservice
 
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+)
+
 // ServerErrorData is custom error that should be used to describe better errors
 type ServerErrorData struct {
-	Parent       error  `json:"-"`
-	Code         int    `json:"code,omitempty"`
-	Message      string `json:"message,omitempty"`
-	Description  string `json:"description,omitempty"`
-	FunctionInfo string `json:"-"`
+	XMLName      xml.Name `json:"-" xml:"error"`
+	Parent       error    `json:"-" xml:"-"`
+	Code         int      `json:"code,omitempty" xml:"code,omitempty"`
+	ErrorCode    string   `json:"error_code,omitempty" xml:"error_code,omitempty"`
+	Message      string   `json:"message,omitempty" xml:"message,omitempty"`
+	Description  string   `json:"description,omitempty" xml:"description,omitempty"`
+	FunctionInfo string   `json:"-" xml:"-"`
+	// Details are structured data of error (e.g. list of invalid rows)
+	Details interface{} `json:"details,omitempty" xml:"details>detail,omitempty"`
+	// Headers are written to response together with error (e.g. Retry-After)
+	Headers http.Header `json:"-" xml:"-"`
+	stack   []uintptr
 }
 
 // ServerErrorWithText extra text
@@ -25,16 +39,64 @@ func (e *ServerErrorData) Error() string {
 	return e.Message
 }
 
-// ServerError Create error object
+// ServerError Create error object. Stack is captured only for server errors (code >= 500)
 func ServerError(Parent error, Code int, Message string) *ServerErrorData {
 	e := new(ServerErrorData)
 	e.Parent = Parent
 	e.Code = Code
 	e.Message = Message
 	e.FunctionInfo = getCurrentFunctionInfo(1)
+	if Code >= 500 {
+		e.stack = captureStack(1)
+	}
+	return e
+}
+
+// Stack returns formatted stack trace captured when error was created (empty for errors < 500)
+func (e *ServerErrorData) Stack() string {
+	return formatStack(e.stack)
+}
+
+// WithHeader adds response header that will be written together with error
+func (e *ServerErrorData) WithHeader(key string, value string) *ServerErrorData {
+	e.Headers = addHeader(e.Headers, key, value)
+	return e
+}
+
+// WithDetails sets structured details of error written to response
+func (e *ServerErrorData) WithDetails(details interface{}) *ServerErrorData {
+	e.Details = details
 	return e
 }
 
+// WithRetryAfter sets Retry-After header in seconds
+func (e *ServerErrorData) WithRetryAfter(d time.Duration) *ServerErrorData {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 0 {
+		seconds = 0
+	}
+	e.Headers = addHeader(e.Headers, "Retry-After", strconv.FormatInt(seconds, 10))
+	return e
+}
+
+// WithRateLimit sets X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers
+func (e *ServerErrorData) WithRateLimit(limit int, remaining int, reset time.Time) *ServerErrorData {
+	e.Headers = addHeader(e.Headers, "X-RateLimit-Limit", strconv.Itoa(limit))
+	e.Headers = addHeader(e.Headers, "X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !reset.IsZero() {
+		e.Headers = addHeader(e.Headers, "X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}
+	return e
+}
+
+func addHeader(h http.Header, key string, value string) http.Header {
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Add(key, value)
+	return h
+}
+
 // ServerError Create error object
 func ServerErrorWithoutStack(Parent error, Code int, Message string) *ServerErrorData {
 	e := new(ServerErrorData)
@@ -9,12 +9,14 @@ import (
 type ServerStatus struct {
 	Process string `json:"process"`
 	Pid     int    `json:"pid"`
+	*KubernetesMetadata
 }
 
 // NewServerStatus create default service status
 func NewServerStatus() *ServerStatus {
 	return &ServerStatus{
-		Process: os.Args[0],
-		Pid:     os.Getpid(),
+		Process:            os.Args[0],
+		Pid:                os.Getpid(),
+		KubernetesMetadata: DetectKubernetesMetadata(),
 	}
 }
@@ -0,0 +1,420 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ServiceRegistration describes service instance registered in service discovery
+type ServiceRegistration struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	// Health check URL (e.g. http://10.0.0.1:8080/healthz)
+	HealthURL string `json:"health_url,omitempty"`
+}
+
+// ServiceRegistry is service discovery backend (Consul, etcd, ...)
+type ServiceRegistry interface {
+	Register(ctx context.Context, registration *ServiceRegistration) (err error)
+	Deregister(ctx context.Context, registration *ServiceRegistration) (err error)
+}
+
+// loggingRegistry is registry logging failures of background work (e.g. lease keepalive)
+type loggingRegistry interface {
+	setLogger(logger *logrus.Logger)
+}
+
+// ServiceDiscoveryOptions is a configuration container for self-registration
+type ServiceDiscoveryOptions struct {
+	Registry ServiceRegistry
+	// Service name, default is name of main module from build info
+	Name string
+	// Instance ID, default is name-hostname-port
+	ID string
+	// Advertised address, default is first non-loopback IP address. Required for Unix socket listener.
+	Address string
+	// Advertised port, default is port of listener. Required for Unix socket listener.
+	Port int
+	Tags []string
+	Meta map[string]string
+	// Health endpoint path, default is /healthz
+	HealthPath string
+}
+
+// ServiceDiscoveryOptionsFromViper reads service discovery options (type: consul|etcd, url, token, name, tags, address, port),
+// nil is returned if service discovery is not configured
+func ServiceDiscoveryOptionsFromViper(prefix string) (options *ServiceDiscoveryOptions) {
+	var registry ServiceRegistry
+	switch viper.GetString(prefix + "type") {
+	case "consul":
+		registry = NewConsulRegistry(viper.GetString(prefix+"url"), viper.GetString(prefix+"token"))
+	case "etcd":
+		registry = NewEtcdRegistry(viper.GetString(prefix+"url"), viper.GetDuration(prefix+"ttl"))
+	default:
+		return nil
+	}
+	return &ServiceDiscoveryOptions{
+		Registry:   registry,
+		Name:       viper.GetString(prefix + "name"),
+		ID:         viper.GetString(prefix + "id"),
+		Address:    viper.GetString(prefix + "address"),
+		Port:       viper.GetInt(prefix + "port"),
+		Tags:       viper.GetStringSlice(prefix + "tags"),
+		Meta:       viper.GetStringMapString(prefix + "meta"),
+		HealthPath: viper.GetString(prefix + "health_path"),
+	}
+}
+
+// buildServiceName returns name of main module (last path element)
+func buildServiceName() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Path != "" {
+		return path.Base(info.Main.Path)
+	}
+	return path.Base(os.Args[0])
+}
+
+// advertisedAddress returns first non-loopback IPv4 address
+func advertisedAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				return ipNet.IP.String()
+			}
+		}
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// newServiceRegistration creates registration for service listening on addr. Address of Unix socket listener is
+// not reachable by other hosts, so advertised address and port have to be configured.
+func newServiceRegistration(options *ServiceDiscoveryOptions, listenAddr string, stripPath string) (registration *ServiceRegistration, err error) {
+	var host string
+	port := options.Port
+	if strings.HasPrefix(listenAddr, unixSocketPrefix) {
+		if options.Address == "" || options.Port == 0 {
+			return nil, fmt.Errorf("service discovery: advertised address and port have to be configured for Unix socket listener %s", listenAddr)
+		}
+	} else {
+		var portStr string
+		host, portStr, err = net.SplitHostPort(listenAddr)
+		if err != nil {
+			return
+		}
+		if port == 0 {
+			port, err = strconv.Atoi(portStr)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	registration = &ServiceRegistration{
+		ID:      options.ID,
+		Name:    options.Name,
+		Address: options.Address,
+		Port:    port,
+		Tags:    options.Tags,
+		Meta:    options.Meta,
+	}
+	if registration.Name == "" {
+		registration.Name = buildServiceName()
+	}
+	if registration.Address == "" {
+		if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+			registration.Address = host
+		} else {
+			registration.Address = advertisedAddress()
+		}
+	}
+	if registration.ID == "" {
+		hostname, _ := os.Hostname()
+		registration.ID = fmt.Sprintf("%s-%s-%d", registration.Name, hostname, port)
+	}
+	healthPath := options.HealthPath
+	if healthPath == "" {
+		healthPath = "/healthz"
+	}
+	if stripPath != "/" {
+		healthPath = strings.TrimRight(stripPath, "/") + healthPath
+	}
+	registration.HealthURL = "http://" + net.JoinHostPort(registration.Address, strconv.Itoa(port)) + healthPath
+	return
+}
+
+// enableServiceDiscovery registers service when listener is ready and deregisters it when shutdown starts
+func (s *webservice) enableServiceDiscovery(options *ServiceDiscoveryOptions) {
+	var registration *ServiceRegistration
+
+	s.OnEvent(StageListenerReady, func(ctx context.Context, event *LifecycleEvent) (err error) {
+		if registry, ok := options.Registry.(loggingRegistry); ok {
+			registry.setLogger(s.logger)
+		}
+		registration, err = newServiceRegistration(options, event.Addr, s.stripPath)
+		if err != nil {
+			return
+		}
+		err = options.Registry.Register(ctx, registration)
+		if err == nil && s.logger != nil {
+			s.logger.WithField("id", registration.ID).Print("Service registered in service discovery")
+		}
+		return
+	})
+
+	s.OnEvent(StageShutdownStarted, func(ctx context.Context, event *LifecycleEvent) (err error) {
+		if registration == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		return options.Registry.Deregister(ctx, registration)
+	})
+}
+
+// doJSON sends JSON request and decodes JSON response
+func doJSON(ctx context.Context, client *http.Client, method string, url string, headers map[string]string, body interface{}, result interface{}) (err error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: unexpected status %d: %s", method, url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+	}
+	return
+}
+
+// consulRegistry registers service in local Consul agent
+type consulRegistry struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewConsulRegistry creates Consul registry (url of agent, default is http://127.0.0.1:8500)
+func NewConsulRegistry(url string, token string) ServiceRegistry {
+	if url == "" {
+		url = "http://127.0.0.1:8500"
+	}
+	return &consulRegistry{
+		url:    strings.TrimRight(url, "/"),
+		token:  token,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (c *consulRegistry) headers() map[string]string {
+	if c.token == "" {
+		return nil
+	}
+	return map[string]string{"X-Consul-Token": c.token}
+}
+
+// Register implements ServiceRegistry
+func (c *consulRegistry) Register(ctx context.Context, registration *ServiceRegistration) (err error) {
+	body := map[string]interface{}{
+		"ID":      registration.ID,
+		"Name":    registration.Name,
+		"Address": registration.Address,
+		"Port":    registration.Port,
+		"Tags":    registration.Tags,
+		"Meta":    registration.Meta,
+		"Check": map[string]interface{}{
+			"HTTP":                           registration.HealthURL,
+			"Interval":                       "10s",
+			"Timeout":                        "5s",
+			"DeregisterCriticalServiceAfter": "1m",
+		},
+	}
+	return doJSON(ctx, c.client, http.MethodPut, c.url+"/v1/agent/service/register", c.headers(), body, nil)
+}
+
+// Deregister implements ServiceRegistry
+func (c *consulRegistry) Deregister(ctx context.Context, registration *ServiceRegistration) (err error) {
+	return doJSON(ctx, c.client, http.MethodPut, c.url+"/v1/agent/service/deregister/"+registration.ID, c.headers(), nil, nil)
+}
+
+// etcdRegistry registers service in etcd (v3 JSON gateway) under /services/{name}/{id} with lease
+type etcdRegistry struct {
+	url     string
+	ttl     time.Duration
+	client  *http.Client
+	logger  *logrus.Logger
+	mutex   sync.Mutex
+	leaseID string
+	cancel  context.CancelFunc
+}
+
+// NewEtcdRegistry creates etcd registry (url of etcd endpoint, default is http://127.0.0.1:2379).
+// Registration is kept alive with lease of given ttl (default 30s). If the lease expires (e.g. etcd was not
+// reachable for ttl), new lease is granted and the service is registered again.
+func NewEtcdRegistry(url string, ttl time.Duration) ServiceRegistry {
+	if url == "" {
+		url = "http://127.0.0.1:2379"
+	}
+	if ttl <= 0 {
+		ttl = time.Second * 30
+	}
+	return &etcdRegistry{
+		url:    strings.TrimRight(url, "/"),
+		ttl:    ttl,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+// setLogger implements loggingRegistry
+func (e *etcdRegistry) setLogger(logger *logrus.Logger) {
+	e.logger = logger
+}
+
+// Register implements ServiceRegistry
+func (e *etcdRegistry) Register(ctx context.Context, registration *ServiceRegistration) (err error) {
+	leaseID, err := e.put(ctx, registration)
+	if err != nil {
+		return
+	}
+
+	keepAliveCtx, cancel := context.WithCancel(context.Background())
+	e.mutex.Lock()
+	e.leaseID = leaseID
+	e.cancel = cancel
+	e.mutex.Unlock()
+
+	go e.keepAlive(keepAliveCtx, registration, leaseID)
+	return
+}
+
+// put grants lease and puts registration key with it
+func (e *etcdRegistry) put(ctx context.Context, registration *ServiceRegistration) (leaseID string, err error) {
+	var lease struct {
+		ID string `json:"ID"`
+	}
+	err = doJSON(ctx, e.client, http.MethodPost, e.url+"/v3/lease/grant", nil, map[string]interface{}{"TTL": int64(e.ttl / time.Second)}, &lease)
+	if err != nil {
+		return
+	}
+
+	value, err := json.Marshal(registration)
+	if err != nil {
+		return
+	}
+	key := "/services/" + registration.Name + "/" + registration.ID
+	err = doJSON(ctx, e.client, http.MethodPost, e.url+"/v3/kv/put", nil, map[string]interface{}{
+		"key":   base64.StdEncoding.EncodeToString([]byte(key)),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": lease.ID,
+	}, nil)
+	return lease.ID, err
+}
+
+// keepAlive refreshes lease until context is done, registration is put again with new lease if the lease is gone
+func (e *etcdRegistry) keepAlive(ctx context.Context, registration *ServiceRegistration, leaseID string) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// TTL of expired or revoked lease is not positive
+		var response struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		err := doJSON(ctx, e.client, http.MethodPost, e.url+"/v3/lease/keepalive", nil, map[string]interface{}{"ID": leaseID}, &response)
+		if err != nil {
+			if ctx.Err() == nil && e.logger != nil {
+				e.logger.WithError(err).WithField("lease", leaseID).Warn("Unable to keep service discovery lease alive")
+			}
+			continue
+		}
+		if ttl, _ := strconv.ParseInt(response.Result.TTL, 10, 64); ttl > 0 {
+			continue
+		}
+
+		newLeaseID, err := e.put(ctx, registration)
+		if err != nil {
+			if ctx.Err() == nil && e.logger != nil {
+				e.logger.WithError(err).WithField("id", registration.ID).Error("Unable to register service again after its lease expired")
+			}
+			continue
+		}
+		e.mutex.Lock()
+		deregistered := ctx.Err() != nil
+		if !deregistered {
+			e.leaseID = newLeaseID
+		}
+		e.mutex.Unlock()
+		if deregistered {
+			// Deregister revoked the previous lease while the new one was granted
+			revokeCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			doJSON(revokeCtx, e.client, http.MethodPost, e.url+"/v3/lease/revoke", nil, map[string]interface{}{"ID": newLeaseID}, nil)
+			cancel()
+			return
+		}
+		if e.logger != nil {
+			e.logger.WithField("id", registration.ID).WithField("lease", newLeaseID).Warn("Service discovery lease expired, service registered again")
+		}
+		leaseID = newLeaseID
+	}
+}
+
+// Deregister implements ServiceRegistry - lease is revoked, so the key is removed
+func (e *etcdRegistry) Deregister(ctx context.Context, registration *ServiceRegistration) (err error) {
+	e.mutex.Lock()
+	leaseID, cancel := e.leaseID, e.cancel
+	e.leaseID, e.cancel = "", nil
+	// Keepalive is stopped under the lock, so it does not publish lease granted after deregistration
+	if cancel != nil {
+		cancel()
+	}
+	e.mutex.Unlock()
+	if leaseID == "" {
+		return
+	}
+	return doJSON(ctx, e.client, http.MethodPost, e.url+"/v3/lease/revoke", nil, map[string]interface{}{"ID": leaseID}, nil)
+}
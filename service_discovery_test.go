@@ -0,0 +1,158 @@
+package webservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestServiceRegistrationAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    ServiceDiscoveryOptions
+		listenAddr string
+		wantErr    bool
+		wantHealth string
+	}{
+		{"tcp listener", ServiceDiscoveryOptions{Name: "svc"}, "10.0.0.1:8080", false, "http://10.0.0.1:8080/healthz"},
+		{"tcp listener with advertised address", ServiceDiscoveryOptions{Name: "svc", Address: "app.local", Port: 80}, "10.0.0.1:8080", false, "http://app.local:80/healthz"},
+		{"unix socket without advertised address", ServiceDiscoveryOptions{Name: "svc"}, "unix:///var/run/app.sock", true, ""},
+		{"unix socket without advertised port", ServiceDiscoveryOptions{Name: "svc", Address: "10.0.0.1"}, "unix:///var/run/app.sock", true, ""},
+		{"unix socket with advertised address", ServiceDiscoveryOptions{Name: "svc", Address: "10.0.0.1", Port: 8080}, "unix:///var/run/app.sock", false, "http://10.0.0.1:8080/healthz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			registration, err := newServiceRegistration(&options, tt.listenAddr, "/")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && registration.HealthURL != tt.wantHealth {
+				t.Fatalf("got health URL %s, want %s", registration.HealthURL, tt.wantHealth)
+			}
+		})
+	}
+}
+
+// fakeEtcd emulates lease and kv endpoints of etcd JSON gateway
+type fakeEtcd struct {
+	mutex sync.Mutex
+	// Lease IDs granted so far
+	leases int
+	// Live lease IDs
+	alive map[string]bool
+	// Lease of registration key
+	keyLease string
+	// Keepalive requests fail with server error
+	failKeepAlive bool
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.leases++
+		id := strconv.Itoa(f.leases)
+		f.alive[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id, "TTL": "1"})
+	case "/v3/kv/put":
+		f.keyLease = body["lease"]
+		w.Write([]byte("{}"))
+	case "/v3/lease/keepalive":
+		if f.failKeepAlive {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		result := map[string]string{"ID": body["ID"]}
+		if f.alive[body["ID"]] {
+			result["TTL"] = "1"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	case "/v3/lease/revoke":
+		delete(f.alive, body["ID"])
+		if f.keyLease == body["ID"] {
+			f.keyLease = ""
+		}
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// expire removes lease of registration key like etcd does when keepalive is missing for TTL
+func (f *fakeEtcd) expire() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.alive, f.keyLease)
+	f.keyLease = ""
+}
+
+// registeredLease returns lease of registration key, empty if the key is not registered
+func (f *fakeEtcd) registeredLease() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.keyLease
+}
+
+func TestEtcdRegistryKeepAlive(t *testing.T) {
+	etcd := &fakeEtcd{alive: map[string]bool{}, failKeepAlive: true}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	logger, hook := test.NewNullLogger()
+	registry := NewEtcdRegistry(server.URL, time.Millisecond*30).(*etcdRegistry)
+	registry.setLogger(logger)
+	registration := &ServiceRegistration{ID: "svc-1", Name: "svc"}
+	if err := registry.Register(context.Background(), registration); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(what string, condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second * 5)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatal(what)
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+
+	// Keepalive failures are logged
+	waitFor("keepalive failure is not logged", func() bool {
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.WarnLevel && entry.Data["lease"] == "1" {
+				return true
+			}
+		}
+		return false
+	})
+
+	// Registration is put again with new lease when the lease is gone
+	etcd.mutex.Lock()
+	etcd.failKeepAlive = false
+	etcd.mutex.Unlock()
+	etcd.expire()
+	waitFor("service is not registered again after lease expired", func() bool {
+		return etcd.registeredLease() == "2"
+	})
+
+	// Deregistration revokes the current lease
+	if err := registry.Deregister(context.Background(), registration); err != nil {
+		t.Fatal(err)
+	}
+	if lease := etcd.registeredLease(); lease != "" {
+		t.Fatalf("lease %s is not revoked", lease)
+	}
+}
@@ -0,0 +1,233 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpSource is directory on SFTP server. SSH connection is kept between operations and it is re-established after
+// error.
+type sftpSource struct {
+	addr   string
+	config *ssh.ClientConfig
+	dir    string
+	mu     sync.Mutex
+	raw    net.Conn
+	ssh    *ssh.Client
+	client *sftp.Client
+}
+
+// NewSFTPSource returns file source of SFTP directory, default port is 22. Host key of server has to be verified
+// by config.HostKeyCallback (see SFTPClientConfig).
+func NewSFTPSource(addr string, config *ssh.ClientConfig, dir string) FileSource {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	return &sftpSource{addr: addr, config: config, dir: dir}
+}
+
+// SFTPClientConfig returns SSH client configuration with password and/or private key (PEM file) authentication,
+// host keys are verified against known_hosts file (~/.ssh/known_hosts if empty)
+func SFTPClientConfig(username string, password string, privateKeyFile string, knownHostsFile string) (config *ssh.ClientConfig, err error) {
+	config = &ssh.ClientConfig{User: username, Timeout: ftpTimeout}
+	if privateKeyFile != "" {
+		var key []byte
+		if key, err = os.ReadFile(privateKeyFile); err != nil {
+			return
+		}
+		var signer ssh.Signer
+		if signer, err = ssh.ParsePrivateKey(key); err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %w", privateKeyFile, err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	if knownHostsFile == "" {
+		var home string
+		if home, err = os.UserHomeDir(); err != nil {
+			return
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	if config.HostKeyCallback, err = knownhosts.New(knownHostsFile); err != nil {
+		return nil, fmt.Errorf("unable to read known hosts: %w", err)
+	}
+	return
+}
+
+// List implements FileSource
+func (s *sftpSource) List(ctx context.Context) (files []RemoteFile, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetOnError(&err)
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+	defer s.watch(ctx, &err)()
+	entries, err := s.client.ReadDir(s.path("."))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			files = append(files, RemoteFile{Name: entry.Name(), Size: entry.Size(), ModTime: entry.ModTime()})
+		}
+	}
+	return
+}
+
+// Open implements FileSource - connection is locked until content is closed
+func (s *sftpSource) Open(ctx context.Context, name string) (content io.ReadCloser, err error) {
+	s.mu.Lock()
+	defer func() {
+		if err != nil {
+			s.resetOnError(&err)
+			s.mu.Unlock()
+		}
+	}()
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+	raw := s.raw
+	raw.SetDeadline(operationDeadline(ctx))
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	file, err := s.client.Open(s.path(name))
+	if err != nil {
+		stop()
+		return
+	}
+	return &sftpReader{source: s, raw: raw, file: file, ctx: ctx, stop: stop}, nil
+}
+
+// Rename implements FileSource
+func (s *sftpSource) Rename(ctx context.Context, from string, to string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetOnError(&err)
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+	defer s.watch(ctx, &err)()
+	if err = s.client.MkdirAll(s.path(path.Dir(to))); err != nil {
+		return
+	}
+	return s.client.Rename(s.path(from), s.path(to))
+}
+
+// path returns path of file on server
+func (s *sftpSource) path(name string) string {
+	if s.dir == "" {
+		return name
+	}
+	return path.Join(s.dir, name)
+}
+
+// connect opens SSH connection and SFTP session if they are not open
+func (s *sftpSource) connect(ctx context.Context) (err error) {
+	if s.client != nil {
+		return
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, ftpTimeout)
+	defer cancel()
+	raw, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", s.addr)
+	if err != nil {
+		return
+	}
+	raw.SetDeadline(operationDeadline(ctx))
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	defer stop()
+	conn, channels, requests, err := ssh.NewClientConn(raw, s.addr, s.config)
+	if err != nil {
+		raw.Close()
+		return
+	}
+	client := ssh.NewClient(conn, channels, requests)
+	if s.client, err = sftp.NewClient(client); err != nil {
+		client.Close()
+		return
+	}
+	s.raw, s.ssh = raw, client
+	return
+}
+
+// watch sets deadline of operation on open connection and aborts operation when ctx is done, returned function
+// clears deadline (connection is idle between operations)
+func (s *sftpSource) watch(ctx context.Context, err *error) func() {
+	raw := s.raw
+	raw.SetDeadline(operationDeadline(ctx))
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	return func() {
+		if !stop() && *err == nil {
+			// Connection was closed
+			*err = ctx.Err()
+		}
+		raw.SetDeadline(time.Time{})
+	}
+}
+
+// resetOnError closes connection after error, so it is re-established by next operation
+func (s *sftpSource) resetOnError(err *error) {
+	if *err == nil || s.ssh == nil {
+		return
+	}
+	if s.client != nil {
+		s.client.Close()
+	}
+	s.ssh.Close()
+	s.client, s.ssh, s.raw = nil, nil, nil
+}
+
+// sftpReader is content of downloaded file, closing it unlocks connection. Each read has to finish within ftpTimeout
+// (and before deadline of ctx), reading is aborted when ctx is cancelled.
+type sftpReader struct {
+	source *sftpSource
+	raw    net.Conn
+	file   *sftp.File
+	ctx    context.Context
+	stop   func() bool
+	// err is error of aborted reading
+	err error
+}
+
+// Read implements io.Reader
+func (r *sftpReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.raw.SetDeadline(operationDeadline(r.ctx))
+	n, err = r.file.Read(p)
+	if err = readError(r.ctx, err); err != nil && err != io.EOF {
+		r.err = err
+	}
+	return
+}
+
+// Close implements io.Closer
+func (r *sftpReader) Close() (err error) {
+	defer r.source.mu.Unlock()
+	defer r.source.resetOnError(&err)
+	if !r.stop() && r.err == nil {
+		r.err = r.ctx.Err()
+	}
+	if r.err != nil {
+		// Reading was aborted, connection is closed
+		return r.err
+	}
+	r.raw.SetDeadline(operationDeadline(r.ctx))
+	err = r.file.Close()
+	r.raw.SetDeadline(time.Time{})
+	return
+}
@@ -0,0 +1,151 @@
+package webservice
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSFTPServer starts SFTP server with password authentication (user/secret), its address and host key are
+// returned
+func startSFTPServer(t *testing.T) (addr string, hostKey ssh.PublicKey) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "user" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config)
+		}
+	}()
+	return listener.Addr().String(), signer.PublicKey()
+}
+
+// serveSFTP serves sftp subsystem of SSH connection
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range channelRequests {
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		go func() {
+			defer channel.Close()
+			if server, err := sftp.NewServer(channel); err == nil {
+				server.Serve()
+			}
+		}()
+	}
+}
+
+func TestSFTPSource(t *testing.T) {
+	addr, hostKey := startSFTPServer(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+
+	tests := []struct {
+		name     string
+		hostKey  ssh.PublicKey
+		password string
+		wantErr  bool
+	}{
+		{"known host", hostKey, "secret", false},
+		{"unknown host key", otherSigner.PublicKey(), "secret", true},
+		{"wrong password", hostKey, "wrong", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			knownHosts := filepath.Join(tmp, "known_hosts")
+			if err := os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, tt.hostKey)+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			dir := filepath.Join(tmp, "inbox")
+			os.Mkdir(dir, 0o755)
+			os.WriteFile(filepath.Join(dir, "data.csv"), []byte("a,b"), 0o644)
+
+			config, err := SFTPClientConfig("user", tt.password, "", knownHosts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source := NewSFTPSource(addr, config, filepath.ToSlash(dir))
+			ctx := context.Background()
+			files, err := source.List(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].Name != "data.csv" || files[0].Size != 3 {
+				t.Fatalf("unexpected files %+v", files)
+			}
+
+			content, err := source.Open(ctx, "data.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(content)
+			content.Close()
+			if err != nil || string(data) != "a,b" {
+				t.Fatalf("unexpected content %q (%v)", data, err)
+			}
+
+			if err = source.Rename(ctx, "data.csv", "archive/data.csv"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = os.Stat(filepath.Join(dir, "archive", "data.csv")); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package webservice
+
+import (
+	"time"
+)
+
+// WithShutdownTimeout sets max duration of graceful shutdown (waiting for active requests and stopping
+// components), default is 30 seconds
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(s *webservice) {
+		s.SetShutdownTimeout(timeout)
+	}
+}
+
+// WithShutdownDelay sets drain delay before graceful shutdown (see SetShutdownDelay())
+func WithShutdownDelay(delay time.Duration) Option {
+	return func(s *webservice) {
+		s.SetShutdownDelay(delay)
+	}
+}
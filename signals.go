@@ -0,0 +1,17 @@
+package webservice
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultSignals are signals triggering graceful shutdown, SIGTERM is sent by Kubernetes on pod termination
+var defaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// WithSignals replaces signals triggering graceful shutdown (default is SIGINT and SIGTERM), e.g. syscall.SIGQUIT
+// can be added. No signals means that service is shut down only by Shutdown().
+func WithSignals(signals ...os.Signal) Option {
+	return func(s *webservice) {
+		s.signals = signals
+	}
+}
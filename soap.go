@@ -0,0 +1,305 @@
+package webservice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// SOAP envelope namespaces
+const (
+	SOAP11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	SOAP12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// SOAP fault codes, they are written as Sender and Receiver in SOAP 1.2
+const (
+	SOAPFaultClient = "Client"
+	SOAPFaultServer = "Server"
+)
+
+// SOAPOptions is a configuration container for SOAP handler
+type SOAPOptions struct {
+	// WSDL file served for GET requests with ?wsdl
+	WSDLFile string
+	// Required scopes per operation (name of body element). User needs at least one of listed scopes.
+	OperationScopes map[string][]string
+}
+
+// SOAPOptionsFromViper reads SOAP options (wsdl_file, operation_scopes)
+func SOAPOptionsFromViper(prefix string) (options *SOAPOptions) {
+	options = &SOAPOptions{
+		WSDLFile: viper.GetString(prefix + "wsdl_file"),
+	}
+	viper.UnmarshalKey(prefix+"operation_scopes", &options.OperationScopes)
+	return
+}
+
+// SOAPRequest is parsed SOAP envelope
+type SOAPRequest struct {
+	// Envelope namespace (SOAP11Namespace or SOAP12Namespace)
+	Namespace string
+	// SOAPAction header (SOAP 1.1) or action parameter of content type (SOAP 1.2)
+	Action string
+	// Name of operation element in SOAP body
+	Operation xml.Name
+	// Inner XML of SOAP header, nil if envelope has no header
+	Header  []byte
+	body    []byte
+	charset string
+}
+
+// Decode decodes operation element of SOAP body into v (see DecodeXML)
+func (req *SOAPRequest) Decode(v interface{}) error {
+	_, _, decoder, operation, err := soapBodyElement(req.body, req.charset)
+	if err != nil {
+		return err
+	}
+	return decoder.DecodeElement(v, &operation)
+}
+
+// SOAPHandlerFn handles SOAP operation, response is marshalled into SOAP body (nil means empty body). Errors are
+// written as SOAP faults - SOAPFault is written as is, ServerError with status < 500 is client fault with error in
+// detail, other errors are server faults with generic message.
+type SOAPHandlerFn func(r *http.Request, req *SOAPRequest, userInfo *UserInfo) (response interface{}, err error)
+
+// SOAPFault is error written as SOAP fault
+type SOAPFault struct {
+	// SOAPFaultClient or SOAPFaultServer
+	Code    string
+	Message string
+	// Detail is marshalled into fault detail, nil means no detail
+	Detail interface{}
+}
+
+func (f *SOAPFault) Error() string {
+	return f.Message
+}
+
+// SOAPHandler serves SOAP 1.1 and 1.2 operations with authorization of AppHandler, operation is selected by name
+// of body element. WSDL file is served for GET ?wsdl with the same authorization as operations. Requests rejected
+// before envelope is parsed (authorization, content type) get JSON errors.
+func SOAPHandler(operations map[string]SOAPHandlerFn, options *SOAPOptions) Handler {
+	if options == nil {
+		options = &SOAPOptions{}
+	}
+	return AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		if r.Method == http.MethodGet {
+			_, wsdl := r.URL.Query()["wsdl"]
+			_, wsdlUpper := r.URL.Query()["WSDL"]
+			if (wsdl || wsdlUpper) && options.WSDLFile != "" {
+				w.Header()["Content-Type"] = []string{"text/xml; charset=utf-8"}
+				http.ServeFile(w, r, options.WSDLFile)
+				return nil
+			}
+			return ServerError(nil, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+
+		mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		namespace := SOAP11Namespace
+		switch mediaType {
+		case "text/xml":
+		case "application/soap+xml":
+			namespace = SOAP12Namespace
+		default:
+			return ServerErrorWithoutStack(nil, http.StatusUnsupportedMediaType, "SOAP content type is expected").WithErrorCode("UNSUPPORTED_MEDIA_TYPE")
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, defaultMaxBodyBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return ServerErrorWithoutStack(err, http.StatusRequestEntityTooLarge, "Request body too large")
+			}
+			return ServerError(err, http.StatusBadRequest, "Unable to read request")
+		}
+
+		req := &SOAPRequest{
+			Action:  strings.Trim(r.Header.Get("SOAPAction"), `"`),
+			body:    body,
+			charset: params["charset"],
+		}
+		if action, ok := params["action"]; ok {
+			req.Action = action
+		}
+		var operation xml.StartElement
+		req.Namespace, req.Header, _, operation, err = soapBodyElement(body, req.charset)
+		if err != nil {
+			return writeSOAPFault(w, r, namespace, "", &SOAPFault{Code: SOAPFaultClient, Message: "Malformed SOAP request: " + err.Error()})
+		}
+		req.Operation = operation.Name
+		name := operation.Name.Local
+
+		fn, ok := operations[name]
+		if !ok {
+			return writeSOAPFault(w, r, req.Namespace, name, &SOAPFault{Code: SOAPFaultClient, Message: fmt.Sprintf("Unknown operation: %s", name)})
+		}
+		if scopes, ok := options.OperationScopes[name]; ok && !hasAnyScope(userInfo, scopes) {
+			message := "Forbidden"
+			if userInfo == nil {
+				message = "Unauthorized"
+			}
+			return writeSOAPFault(w, r, req.Namespace, name, &SOAPFault{Code: SOAPFaultClient, Message: message})
+		}
+
+		response, err := fn(r, req, userInfo)
+		if err != nil {
+			return writeSOAPFault(w, r, req.Namespace, name, err)
+		}
+		var content []byte
+		if response != nil {
+			if content, err = xml.Marshal(response); err != nil {
+				return writeSOAPFault(w, r, req.Namespace, name, err)
+			}
+		}
+		return writeSOAPEnvelope(w, req.Namespace, http.StatusOK, content)
+	})
+}
+
+// soapBodyElement parses SOAP envelope up to the first element of body, decoder is positioned after its start
+func soapBodyElement(body []byte, charset string) (namespace string, header []byte, decoder *xml.Decoder, operation xml.StartElement, err error) {
+	if decoder, err = newXMLDecoder(bytes.NewReader(body), charset); err != nil {
+		return
+	}
+	root, err := xmlRootElement(decoder)
+	if err != nil {
+		return
+	}
+	namespace = root.Name.Space
+	if root.Name.Local != "Envelope" || (namespace != SOAP11Namespace && namespace != SOAP12Namespace) {
+		err = errors.New("SOAP envelope is expected")
+		return
+	}
+	for {
+		var token xml.Token
+		if token, err = decoder.Token(); err != nil {
+			return
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != namespace {
+				if err = decoder.Skip(); err != nil {
+					return
+				}
+				continue
+			}
+			switch t.Name.Local {
+			case "Header":
+				var h struct {
+					Content []byte `xml:",innerxml"`
+				}
+				if err = decoder.DecodeElement(&h, &t); err != nil {
+					return
+				}
+				header = h.Content
+			case "Body":
+				for {
+					if token, err = decoder.Token(); err != nil {
+						return
+					}
+					switch t := token.(type) {
+					case xml.StartElement:
+						operation = t
+						return
+					case xml.EndElement:
+						err = errors.New("SOAP body is empty")
+						return
+					}
+				}
+			default:
+				if err = decoder.Skip(); err != nil {
+					return
+				}
+			}
+		case xml.EndElement:
+			err = errors.New("SOAP body is missing")
+			return
+		}
+	}
+}
+
+// writeSOAPFault logs error and writes it as SOAP fault. SOAP 1.1 faults have status 500, SOAP 1.2 client (sender)
+// faults have status 400.
+func writeSOAPFault(w http.ResponseWriter, r *http.Request, namespace string, operation string, err error) error {
+	var fault *SOAPFault
+	switch e := err.(type) {
+	case *SOAPFault:
+		fault = e
+	case *ServerErrorData:
+		fault = &SOAPFault{Code: SOAPFaultServer, Message: e.Message}
+		if e.Code < 500 {
+			if e.Parent != nil {
+				e.Description = e.Parent.Error()
+			}
+			fault = &SOAPFault{Code: SOAPFaultClient, Message: e.Message, Detail: e}
+		}
+	default:
+		fault = &SOAPFault{Code: SOAPFaultServer, Message: "Internal Server Error"}
+	}
+
+	if logger, _ := r.Context().Value(contextTypeLogger).(*logrus.Logger); logger != nil {
+		logEntry := logger.WithError(err).WithField("operation", operation)
+		if fault.Code == SOAPFaultServer {
+			logEntry.Error("SOAP fault")
+		} else {
+			logEntry.Warn("SOAP fault")
+		}
+	}
+
+	var detail []byte
+	if fault.Detail != nil {
+		var marshalErr error
+		if detail, marshalErr = xml.Marshal(fault.Detail); marshalErr != nil {
+			detail = nil
+		}
+	}
+
+	var buf bytes.Buffer
+	status := http.StatusInternalServerError
+	if namespace == SOAP12Namespace {
+		code := "Receiver"
+		if fault.Code == SOAPFaultClient {
+			code = "Sender"
+			status = http.StatusBadRequest
+		}
+		buf.WriteString("<soap:Fault><soap:Code><soap:Value>soap:" + code + "</soap:Value></soap:Code>")
+		buf.WriteString(`<soap:Reason><soap:Text xml:lang="en">`)
+		xml.EscapeText(&buf, []byte(fault.Message))
+		buf.WriteString("</soap:Text></soap:Reason>")
+		if detail != nil {
+			buf.WriteString("<soap:Detail>")
+			buf.Write(detail)
+			buf.WriteString("</soap:Detail>")
+		}
+	} else {
+		buf.WriteString("<soap:Fault><faultcode>soap:" + fault.Code + "</faultcode><faultstring>")
+		xml.EscapeText(&buf, []byte(fault.Message))
+		buf.WriteString("</faultstring>")
+		if detail != nil {
+			buf.WriteString("<detail>")
+			buf.Write(detail)
+			buf.WriteString("</detail>")
+		}
+	}
+	buf.WriteString("</soap:Fault>")
+	return writeSOAPEnvelope(w, namespace, status, buf.Bytes())
+}
+
+// writeSOAPEnvelope writes content wrapped in SOAP envelope
+func writeSOAPEnvelope(w http.ResponseWriter, namespace string, status int, content []byte) error {
+	contentType := "text/xml; charset=utf-8"
+	if namespace == SOAP12Namespace {
+		contentType = "application/soap+xml; charset=utf-8"
+	}
+	w.Header()["Content-Type"] = []string{contentType}
+	w.WriteHeader(status)
+	_, err := fmt.Fprintf(w, `%s<soap:Envelope xmlns:soap="%s"><soap:Body>%s</soap:Body></soap:Envelope>`, xml.Header, namespace, content)
+	return err
+}
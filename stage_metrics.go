@@ -0,0 +1,57 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stageContextKey is context key of inner duration of currently measured stage
+type stageContextKey struct{}
+
+var (
+	stageDuration     *prometheus.HistogramVec
+	stageDurationOnce sync.Once
+)
+
+// stageDurationHistogram returns histogram of time spent in middleware stages
+func stageDurationHistogram() *prometheus.HistogramVec {
+	stageDurationOnce.Do(func() {
+		stageDuration = registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_middleware_stage_duration_seconds",
+			Help:    "Time spent in request processing stages (auth, cors, handler, ...) excluding nested stages.",
+			Buckets: []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"stage"})).(*prometheus.HistogramVec)
+	})
+	return stageDuration
+}
+
+// timedStage wraps h with middleware mw and records time spent in mw itself (time spent in h is excluded).
+// Stage timing is recorded only if Prometheus metrics are enabled.
+func (s *webservice) timedStage(stage string, mw func(http.Handler) http.Handler, h http.Handler) http.Handler {
+	if !s.enablePrometheusMetrics {
+		return mw(h)
+	}
+	observer := stageDurationHistogram().WithLabelValues(stage)
+	inner := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		if innerDuration, ok := r.Context().Value(stageContextKey{}).(*time.Duration); ok {
+			*innerDuration = time.Since(start)
+		}
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var innerDuration time.Duration
+		start := time.Now()
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stageContextKey{}, &innerDuration)))
+		observer.Observe((time.Since(start) - innerDuration).Seconds())
+	})
+}
+
+// noMiddleware is identity middleware used to time handler stage
+func noMiddleware(h http.Handler) http.Handler {
+	return h
+}
@@ -0,0 +1,94 @@
+package webservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// StreamIterator returns next item of streamed result set, ok is false when there are no more items
+type StreamIterator[T any] func(ctx context.Context) (item T, ok bool, err error)
+
+// streamFlushInterval is max time between flushes of streamed response
+const streamFlushInterval = time.Second
+
+// streamItems encodes items from iterator with periodic flushes. Streaming stops when request context is cancelled.
+func streamItems[T any](w http.ResponseWriter, r *http.Request, next StreamIterator[T], prefix string, separator string, suffix string) (count int, err error) {
+	flusher, _ := w.(http.Flusher)
+	lastFlush := time.Now()
+	ctx := r.Context()
+
+	if _, err = w.Write([]byte(prefix)); err != nil {
+		return
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var item T
+		var ok bool
+		item, ok, err = next(ctx)
+		if err != nil || !ok {
+			break
+		}
+		var data []byte
+		data, err = json.Marshal(item)
+		if err != nil {
+			return
+		}
+		if count > 0 {
+			if _, err = w.Write([]byte(separator)); err != nil {
+				return
+			}
+		}
+		if _, err = w.Write(data); err != nil {
+			return
+		}
+		count++
+		if flusher != nil && time.Since(lastFlush) >= streamFlushInterval {
+			flusher.Flush()
+			lastFlush = time.Now()
+		}
+	}
+	if err != nil {
+		return
+	}
+	// Delimited streams without prefix (NDJSON) have no content for empty result
+	if count > 0 || prefix != "" {
+		_, err = w.Write([]byte(suffix))
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return
+}
+
+// StreamJSON writes items as JSON array without building whole result in memory. Response is flushed
+// periodically and streaming stops when client disconnects. Status is sent with the first write, so error
+// returned after streaming started leaves truncated (invalid) JSON - clients detect it by parse error.
+func StreamJSON[T any](w http.ResponseWriter, r *http.Request, next StreamIterator[T]) (err error) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_, err = streamItems(w, r, next, "[", ",", "]")
+	return
+}
+
+// StreamNDJSON writes items as newline delimited JSON (one item per line)
+func StreamNDJSON[T any](w http.ResponseWriter, r *http.Request, next StreamIterator[T]) (err error) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	_, err = streamItems(w, r, next, "", "\n", "\n")
+	return
+}
+
+// SliceIterator returns iterator over items of slice
+func SliceIterator[T any](items []T) StreamIterator[T] {
+	idx := 0
+	return func(ctx context.Context) (item T, ok bool, err error) {
+		if idx >= len(items) {
+			return
+		}
+		item, ok = items[idx], true
+		idx++
+		return
+	}
+}
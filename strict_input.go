@@ -0,0 +1,90 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// StrictOptions configures strict input validation for services exposed to untrusted input
+type StrictOptions struct {
+	// Content types accepted by AppHandler endpoints with body, default is application/json (and +json types).
+	// XML types (see BindBody) have to be listed explicitly.
+	ContentTypes []string
+}
+
+// StrictOptionsFromViper reads strict mode options, nil is returned if strict mode is not enabled
+func StrictOptionsFromViper(prefix string) *StrictOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &StrictOptions{
+		ContentTypes: viper.GetStringSlice(prefix + "content_types"),
+	}
+}
+
+// strictInputMiddleware rejects requests with malformed query and makes strict options available to AppHandler,
+// which validates query parameters and content type. Size of headers is checked by headerLimitMiddleware.
+func strictInputMiddleware(options *StrictOptions, logger *logrus.Logger) func(h http.Handler) http.Handler {
+	o := *options
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := url.ParseQuery(r.URL.RawQuery); err != nil {
+				processHTTPError(ServerError(err, http.StatusBadRequest, "Malformed query"), w, r, logger, nil)
+				return
+			}
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextTypeStrictOptions, &o)))
+		})
+	}
+}
+
+// validateStrictInput validates request of AppHandler in strict mode - query parameters not allowed by
+// AllowQueryParams() and unsupported content types of request body are rejected
+func validateStrictInput(r *http.Request, allowedQueryParams *[]string) error {
+	options, ok := r.Context().Value(contextTypeStrictOptions).(*StrictOptions)
+	if !ok {
+		return nil
+	}
+
+	if allowedQueryParams != nil {
+		for name := range r.URL.Query() {
+			allowed := false
+			for _, param := range *allowedQueryParams {
+				if name == param {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return ServerError(nil, http.StatusBadRequest, fmt.Sprintf("Unknown query parameter: %s", name))
+			}
+		}
+	}
+
+	if r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return ServerError(err, http.StatusUnsupportedMediaType, "Invalid Content-Type")
+		}
+		supported := false
+		if len(options.ContentTypes) == 0 {
+			supported = mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+		}
+		for _, contentType := range options.ContentTypes {
+			if strings.EqualFold(mediaType, contentType) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return ServerError(nil, http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported Content-Type: %s", mediaType))
+		}
+	}
+	return nil
+}
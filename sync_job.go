@@ -0,0 +1,383 @@
+package webservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrSyncJobRunning is returned by SyncJob.Run if previous run is not finished
+var ErrSyncJobRunning = errors.New("sync job is already running")
+
+// SyncRecord is record read from sync source
+type SyncRecord struct {
+	// Cursor is position of record in source (e.g. change timestamp or sequence number), cursor of the last record
+	// of written batch is saved as checkpoint
+	Cursor string
+	Data   interface{}
+}
+
+// SyncSource reads records changed after cursor (empty cursor means initial load) in order of cursor
+type SyncSource interface {
+	Read(ctx context.Context, cursor string, limit int) (records []SyncRecord, err error)
+}
+
+// SyncTarget writes batch of records, batch is written again if checkpoint was not saved so writes should be
+// idempotent (upserts)
+type SyncTarget interface {
+	Write(ctx context.Context, records []SyncRecord) (err error)
+}
+
+// CheckpointStore persists cursors of sync jobs
+type CheckpointStore interface {
+	// LoadCheckpoint returns saved cursor, empty cursor if job has no checkpoint
+	LoadCheckpoint(ctx context.Context, job string) (cursor string, err error)
+	SaveCheckpoint(ctx context.Context, job string, cursor string) (err error)
+}
+
+// SyncSummary is result of one sync run
+type SyncSummary struct {
+	Job      string
+	Started  time.Time
+	Duration time.Duration
+	// Number of written records and batches
+	Records int
+	Batches int
+	// Cursor before and after run
+	FromCursor string
+	ToCursor   string
+}
+
+// SyncJob periodically copies records changed since the last checkpoint from source to target in batches, checkpoint
+// is saved after each written batch so failed run continues where it stopped. It is a Component configured from
+// <name>.* keys (interval, at - daily time like "02:00" which takes precedence over interval, batch_size, timeout,
+// run_on_start). Jobs of replicated services should be gated by LeaderElector.
+type SyncJob struct {
+	// Interval between runs, default is 1 hour
+	Interval time.Duration
+	// Daily time of run in local time zone (HH:MM), Interval is used if it is empty
+	At string
+	// Max number of records in one batch, default is 500
+	BatchSize int
+	// Max duration of run, zero means no limit
+	Timeout time.Duration
+	// Run job when component is started
+	RunOnStart bool
+	// Job runs only on leader replica if it is set
+	Leader      *LeaderElector
+	name        string
+	source      SyncSource
+	target      SyncTarget
+	checkpoints CheckpointStore
+	logger      *logrus.Logger
+	running     sync.Mutex
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	runs        *prometheus.CounterVec
+	records     *prometheus.CounterVec
+	duration    *prometheus.GaugeVec
+	lastSuccess *prometheus.GaugeVec
+}
+
+// NewSyncJob creates sync job component, name is used as configuration key, checkpoint key and metric label
+func NewSyncJob(name string, source SyncSource, target SyncTarget, checkpoints CheckpointStore, logger *logrus.Logger) *SyncJob {
+	return &SyncJob{
+		Interval:    time.Hour,
+		BatchSize:   500,
+		name:        name,
+		source:      source,
+		target:      target,
+		checkpoints: checkpoints,
+		logger:      logger,
+	}
+}
+
+// Name implements Component
+func (j *SyncJob) Name() string {
+	return j.name
+}
+
+// Configure implements Component
+func (j *SyncJob) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("interval") {
+		j.Interval = config.GetDuration("interval")
+	}
+	if config.IsSet("at") {
+		j.At = config.GetString("at")
+	}
+	if config.IsSet("batch_size") {
+		j.BatchSize = config.GetInt("batch_size")
+	}
+	if config.IsSet("timeout") {
+		j.Timeout = config.GetDuration("timeout")
+	}
+	if config.IsSet("run_on_start") {
+		j.RunOnStart = config.GetBool("run_on_start")
+	}
+	if j.At != "" {
+		if _, err = time.Parse("15:04", j.At); err != nil {
+			return fmt.Errorf("%s: invalid daily time %q, HH:MM is expected", j.name, j.At)
+		}
+	} else if j.Interval <= 0 {
+		return fmt.Errorf("%s: interval has to be positive", j.name)
+	}
+	if j.BatchSize <= 0 {
+		return fmt.Errorf("%s: batch size has to be positive", j.name)
+	}
+
+	j.runs = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_job_runs_total",
+		Help: "Number of sync job runs by result (success, failed).",
+	}, []string{"job", "result"})).(*prometheus.CounterVec)
+	j.records = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_job_records_total",
+		Help: "Number of records written by sync jobs.",
+	}, []string{"job"})).(*prometheus.CounterVec)
+	j.duration = registerCollector(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_job_duration_seconds",
+		Help: "Duration of the last sync job run.",
+	}, []string{"job"})).(*prometheus.GaugeVec)
+	j.lastSuccess = registerCollector(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sync_job_last_success_timestamp_seconds",
+		Help: "Time of the last successful sync job run.",
+	}, []string{"job"})).(*prometheus.GaugeVec)
+	return
+}
+
+// Routes implements Component
+func (j *SyncJob) Routes(router *mux.Router) (err error) {
+	return
+}
+
+// Start implements Component - starts scheduling of runs
+func (j *SyncJob) Start(ctx context.Context) (err error) {
+	ctx, j.cancel = context.WithCancel(ctx)
+	j.wg.Add(1)
+	go j.schedule(ctx)
+	return
+}
+
+// Stop implements Component - running job is cancelled, it continues from the last checkpoint next time
+func (j *SyncJob) Stop(ctx context.Context) (err error) {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+	return
+}
+
+// nextRun returns time of the next scheduled run
+func (j *SyncJob) nextRun(now time.Time) time.Time {
+	if j.At == "" {
+		return now.Add(j.Interval)
+	}
+	at, _ := time.Parse("15:04", j.At)
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// schedule runs job at scheduled times until context is cancelled
+func (j *SyncJob) schedule(ctx context.Context) {
+	defer j.wg.Done()
+	if j.RunOnStart {
+		j.scheduledRun(ctx)
+	}
+	for {
+		timer := time.NewTimer(time.Until(j.nextRun(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		j.scheduledRun(ctx)
+	}
+}
+
+// scheduledRun runs job unless this replica is not leader, errors are logged by Run
+func (j *SyncJob) scheduledRun(ctx context.Context) {
+	if j.Leader != nil && !j.Leader.IsLeader() {
+		if j.logger != nil {
+			j.logger.WithField("job", j.name).Debug("sync job: skipped, replica is not leader")
+		}
+		return
+	}
+	j.Run(ctx)
+}
+
+// Run syncs records changed since the last checkpoint, it can be called to trigger job manually. Summary of run is
+// logged and reported by metrics. ErrSyncJobRunning is returned if job is running already.
+func (j *SyncJob) Run(ctx context.Context) (summary SyncSummary, err error) {
+	if !j.running.TryLock() {
+		return summary, ErrSyncJobRunning
+	}
+	defer j.running.Unlock()
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+
+	summary = SyncSummary{Job: j.name, Started: time.Now()}
+	defer func() {
+		summary.Duration = time.Since(summary.Started)
+		j.report(summary, err)
+	}()
+
+	if summary.FromCursor, err = j.checkpoints.LoadCheckpoint(ctx, j.name); err != nil {
+		err = fmt.Errorf("unable to load checkpoint: %w", err)
+		return
+	}
+	summary.ToCursor = summary.FromCursor
+	for {
+		var records []SyncRecord
+		if records, err = j.source.Read(ctx, summary.ToCursor, j.BatchSize); err != nil {
+			err = fmt.Errorf("unable to read records: %w", err)
+			return
+		}
+		if len(records) == 0 {
+			return
+		}
+		if err = j.target.Write(ctx, records); err != nil {
+			err = fmt.Errorf("unable to write records: %w", err)
+			return
+		}
+		cursor := records[len(records)-1].Cursor
+		if err = j.checkpoints.SaveCheckpoint(ctx, j.name, cursor); err != nil {
+			err = fmt.Errorf("unable to save checkpoint: %w", err)
+			return
+		}
+		summary.ToCursor = cursor
+		summary.Records += len(records)
+		summary.Batches++
+		if j.records != nil {
+			j.records.WithLabelValues(j.name).Add(float64(len(records)))
+		}
+		if len(records) < j.BatchSize {
+			return
+		}
+	}
+}
+
+// report logs summary of run and updates metrics
+func (j *SyncJob) report(summary SyncSummary, err error) {
+	result := "success"
+	if err != nil {
+		result = "failed"
+	}
+	if j.runs != nil {
+		j.runs.WithLabelValues(j.name, result).Inc()
+		j.duration.WithLabelValues(j.name).Set(summary.Duration.Seconds())
+		if err == nil {
+			j.lastSuccess.WithLabelValues(j.name).Set(float64(time.Now().Unix()))
+		}
+	}
+	if j.logger == nil {
+		return
+	}
+	logEntry := j.logger.WithFields(logrus.Fields{
+		"job":         j.name,
+		"records":     summary.Records,
+		"batches":     summary.Batches,
+		"duration":    summary.Duration.String(),
+		"from_cursor": summary.FromCursor,
+		"to_cursor":   summary.ToCursor,
+	})
+	if err != nil {
+		logEntry.WithError(err).Error("sync job: run failed")
+		return
+	}
+	logEntry.Info("sync job: run finished")
+}
+
+// memoryCheckpointStore keeps checkpoints in memory (tests, jobs doing full sync after restart)
+type memoryCheckpointStore struct {
+	mutex   sync.Mutex
+	cursors map[string]string
+}
+
+// NewMemoryCheckpointStore returns in-memory checkpoint store, checkpoints are lost on restart
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{cursors: map[string]string{}}
+}
+
+// LoadCheckpoint implements CheckpointStore
+func (s *memoryCheckpointStore) LoadCheckpoint(ctx context.Context, job string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cursors[job], nil
+}
+
+// SaveCheckpoint implements CheckpointStore
+func (s *memoryCheckpointStore) SaveCheckpoint(ctx context.Context, job string, cursor string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cursors[job] = cursor
+	return nil
+}
+
+// sqlCheckpointStore keeps checkpoints in database table
+type sqlCheckpointStore struct {
+	db          *sql.DB
+	table       string
+	placeholder string
+}
+
+// NewSQLCheckpointStore returns checkpoint store of database table, default table is "sync_checkpoints". Expected
+// schema: job VARCHAR primary key, sync_cursor VARCHAR, updated_at TIMESTAMP. Placeholder is "?" (MySQL, SQLite) or
+// "$" (PostgreSQL).
+func NewSQLCheckpointStore(db *sql.DB, table string, placeholder string) (CheckpointStore, error) {
+	if table == "" {
+		table = "sync_checkpoints"
+	}
+	if strings.ContainsAny(table, " ;'\"") {
+		return nil, fmt.Errorf("invalid checkpoint table name: %s", table)
+	}
+	return &sqlCheckpointStore{db: db, table: table, placeholder: placeholder}, nil
+}
+
+// bind returns n-th (1 based) query placeholder
+func (s *sqlCheckpointStore) bind(n int) string {
+	if s.placeholder == "$" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// LoadCheckpoint implements CheckpointStore
+func (s *sqlCheckpointStore) LoadCheckpoint(ctx context.Context, job string) (cursor string, err error) {
+	query := fmt.Sprintf("SELECT sync_cursor FROM %s WHERE job = %s", s.table, s.bind(1))
+	err = s.db.QueryRowContext(ctx, query, job).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// SaveCheckpoint implements CheckpointStore - row is updated or inserted (no dialect specific upsert)
+func (s *sqlCheckpointStore) SaveCheckpoint(ctx context.Context, job string, cursor string) (err error) {
+	now := time.Now().UTC()
+	update := fmt.Sprintf("UPDATE %s SET sync_cursor = %s, updated_at = %s WHERE job = %s", s.table, s.bind(1), s.bind(2), s.bind(3))
+	result, err := s.db.ExecContext(ctx, update, cursor, now, job)
+	if err != nil {
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (job, sync_cursor, updated_at) VALUES (%s, %s, %s)", s.table, s.bind(1), s.bind(2), s.bind(3))
+	_, err = s.db.ExecContext(ctx, insert, job, cursor, now)
+	return
+}
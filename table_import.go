@@ -0,0 +1,686 @@
+package webservice
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table formats supported by ParseTable
+const (
+	TableFormatCSV  = "csv"
+	TableFormatXLSX = "xlsx"
+)
+
+// xlsxContentType is media type of Excel workbook
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsxMaxPartBytes limits decompressed size of workbook parts read into memory (shared strings, styles)
+const xlsxMaxPartBytes = 256 << 20
+
+// TableOptions is a configuration container for ParseTable and BindTable
+type TableOptions struct {
+	// CSV field separator, it is detected from header line (comma, semicolon or tab) if it is zero
+	Comma rune
+	// XLSX sheet name, default is the first sheet
+	Sheet string
+	// Max number of data rows, default is 100000
+	MaxRows int
+	// Max number of listed row errors, rest of table is validated but errors are only counted. Default is 100.
+	MaxErrors int
+	// Max size of uploaded table, default is 32 MiB
+	MaxBytes int64
+}
+
+// withDefaults returns copy of options with defaults
+func (o *TableOptions) withDefaults() TableOptions {
+	options := TableOptions{}
+	if o != nil {
+		options = *o
+	}
+	if options.MaxRows <= 0 {
+		options.MaxRows = 100000
+	}
+	if options.MaxErrors <= 0 {
+		options.MaxErrors = 100
+	}
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 32 << 20
+	}
+	return options
+}
+
+// RowError is invalid value in row of parsed table
+type RowError struct {
+	XMLName xml.Name `json:"-" xml:"row_error"`
+	// Row number in file, header is row 1
+	Row    int    `json:"row" xml:"row,attr"`
+	Column string `json:"column,omitempty" xml:"column,attr,omitempty"`
+	Reason string `json:"reason" xml:"reason"`
+}
+
+// RowErrors are invalid rows of table, they are details of 422 error returned by ParseTable
+type RowErrors []RowError
+
+func (e RowErrors) Error() string {
+	messages := make([]string, len(e))
+	for idx, re := range e {
+		if re.Column == "" {
+			messages[idx] = fmt.Sprintf("row %d: %s", re.Row, re.Reason)
+			continue
+		}
+		messages[idx] = fmt.Sprintf("row %d, column %s: %s", re.Row, re.Column, re.Reason)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// tableRows reads rows of table, io.EOF is returned after the last row
+type tableRows interface {
+	Next() (row int, cells []string, err error)
+	Close() error
+}
+
+// ParseTable streams rows of CSV or XLSX table into records of struct type T. First row is header, fields tagged
+// with column:"Header name" are filled from cells of matching column (case insensitive). Conversion and tags
+// default and validate work like in BindParams, empty cells are missing values. Missing required columns are
+// reported before any row is parsed. fn is called for each valid row in order of table until the first invalid
+// row - remaining rows are only validated and all row errors are returned as 422 error with INVALID_ROWS code and
+// RowErrors in details. Handlers which must not import partial tables should write records in transaction or
+// collect them first. Error returned by fn stops parsing and it is returned as is.
+func ParseTable[T any](content io.Reader, format string, options *TableOptions, fn func(row int, record *T) error) error {
+	if reflect.TypeOf((*T)(nil)).Elem().Kind() != reflect.Struct {
+		return ServerError(nil, http.StatusInternalServerError, "Table can be parsed only to struct records")
+	}
+	opts := options.withDefaults()
+
+	var rows tableRows
+	switch format {
+	case TableFormatCSV:
+		rows = newCSVRows(content, opts.Comma)
+	case TableFormatXLSX:
+		var err error
+		if rows, err = newXLSXRows(content, opts.Sheet, opts.MaxBytes); err != nil {
+			return tableReadError(err)
+		}
+	default:
+		return ServerErrorWithoutStack(nil, http.StatusUnsupportedMediaType, "CSV or XLSX table is expected").WithErrorCode("UNSUPPORTED_MEDIA_TYPE")
+	}
+	defer rows.Close()
+
+	headerRow, header, err := rows.Next()
+	if err == io.EOF {
+		errs := RowErrors{{Row: 1, Reason: "header row is missing"}}
+		return ServerErrorWithoutStack(errs, http.StatusUnprocessableEntity, "Invalid table").WithErrorCode("INVALID_ROWS").WithDetails(errs)
+	}
+	if err != nil {
+		return tableReadError(err)
+	}
+	columns := map[string]int{}
+	for idx, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; !ok && name != "" {
+			columns[name] = idx
+		}
+	}
+	var errs RowErrors
+	for _, column := range requiredColumns(reflect.TypeOf((*T)(nil)).Elem()) {
+		if _, ok := columns[strings.ToLower(column)]; !ok {
+			errs = append(errs, RowError{Row: headerRow, Column: column, Reason: "column is missing"})
+		}
+	}
+	if len(errs) > 0 {
+		return ServerErrorWithoutStack(errs, http.StatusUnprocessableEntity, "Invalid table").WithErrorCode("INVALID_ROWS").WithDetails(errs)
+	}
+
+	var row int
+	var cells []string
+	sources := []taggedParamSource{
+		{tag: "column", get: func(name string) ([]string, bool) {
+			idx, ok := columns[strings.ToLower(name)]
+			if !ok || idx >= len(cells) {
+				return nil, false
+			}
+			value := strings.TrimSpace(cells[idx])
+			return []string{value}, value != ""
+		}},
+	}
+	dataRows, invalidRows := 0, 0
+	for {
+		if row, cells, err = rows.Next(); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tableReadError(err)
+		}
+		if isEmptyRow(cells) {
+			continue
+		}
+		if dataRows++; dataRows > opts.MaxRows {
+			return ServerErrorWithoutStack(nil, http.StatusRequestEntityTooLarge, fmt.Sprintf("Table has more than %d rows", opts.MaxRows))
+		}
+
+		var record T
+		var paramErrs ParamErrors
+		bindStruct(reflect.ValueOf(&record).Elem(), sources, nil, &paramErrs)
+		if len(paramErrs) > 0 {
+			invalidRows++
+			for _, pe := range paramErrs {
+				if len(errs) < opts.MaxErrors {
+					errs = append(errs, RowError{Row: row, Column: pe.Name, Reason: pe.Reason})
+				}
+			}
+			continue
+		}
+		if invalidRows == 0 {
+			if err = fn(row, &record); err != nil {
+				return err
+			}
+		}
+	}
+	if invalidRows > 0 {
+		return ServerErrorWithoutStack(errs, http.StatusUnprocessableEntity, fmt.Sprintf("Table has %d invalid rows", invalidRows)).
+			WithErrorCode("INVALID_ROWS").WithDetails(errs)
+	}
+	return nil
+}
+
+// BindTable parses uploaded CSV or XLSX table by ParseTable. Table is read from file of multipart form field, or
+// from request body if field is empty. Format is selected by file extension (.csv, .xlsx) or content type
+// (text/csv, XLSX media type), other formats are rejected with 415 error.
+func BindTable[T any](r *http.Request, field string, options *TableOptions, fn func(row int, record *T) error) error {
+	opts := options.withDefaults()
+	r.Body = http.MaxBytesReader(nil, r.Body, opts.MaxBytes)
+
+	var content io.Reader = r.Body
+	contentType, filename := r.Header.Get("Content-Type"), ""
+	if field != "" {
+		if err := r.ParseMultipartForm(defaultMaxFormMemory); err != nil {
+			if err == http.ErrNotMultipart {
+				return ServerErrorWithoutStack(err, http.StatusUnsupportedMediaType, "Form content type is expected").WithErrorCode("UNSUPPORTED_MEDIA_TYPE")
+			}
+			return tableReadError(err)
+		}
+		file, header, err := r.FormFile(field)
+		if err != nil {
+			errs := ParamErrors{{Source: "form", Name: field, Reason: "is required"}}
+			return ServerErrorWithoutStack(errs, http.StatusBadRequest, "Invalid request parameters").WithErrorCode("INVALID_PARAMETERS")
+		}
+		defer file.Close()
+		content, contentType, filename = file, header.Header.Get("Content-Type"), header.Filename
+	}
+	return ParseTable(content, tableFormat(contentType, filename), &opts, fn)
+}
+
+// tableFormat returns format of table by file extension or content type, empty string if format is not supported
+func tableFormat(contentType string, filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return TableFormatCSV
+	case ".xlsx":
+		return TableFormatXLSX
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return TableFormatCSV
+	case xlsxContentType:
+		return TableFormatXLSX
+	}
+	return ""
+}
+
+// tableReadError converts error of reading table to 400 or 413 error
+func tableReadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ServerErrorWithoutStack(err, http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+	return ServerErrorWithoutStack(err, http.StatusBadRequest, "Malformed table").WithErrorCode("MALFORMED_BODY")
+}
+
+// requiredColumns returns names of columns bound to fields with required rule, embedded structs are included
+func requiredColumns(t reflect.Type) (columns []string) {
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, requiredColumns(field.Type)...)
+			continue
+		}
+		name, ok := field.Tag.Lookup("column")
+		if !ok || name == "-" || !field.IsExported() {
+			continue
+		}
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if strings.TrimSpace(rule) == "required" {
+				columns = append(columns, name)
+			}
+		}
+	}
+	return
+}
+
+// isEmptyRow returns true if all cells of row are blank
+func isEmptyRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// csvRows reads rows of CSV file, UTF-8 BOM written by Excel is skipped
+type csvRows struct {
+	reader *csv.Reader
+	row    int
+}
+
+// newCSVRows creates CSV reader, separator is detected if comma is zero
+func newCSVRows(content io.Reader, comma rune) *csvRows {
+	br := bufio.NewReader(content)
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	if comma == 0 {
+		comma = detectCSVComma(br)
+	}
+	reader := csv.NewReader(br)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvRows{reader: reader}
+}
+
+// detectCSVComma returns the most frequent separator (comma, semicolon, tab) of the first line
+func detectCSVComma(br *bufio.Reader) rune {
+	head, _ := br.Peek(4096)
+	if idx := bytes.IndexByte(head, '\n'); idx >= 0 {
+		head = head[:idx]
+	}
+	comma, count := ',', bytes.Count(head, []byte{','})
+	for _, c := range []rune{';', '\t'} {
+		if n := bytes.Count(head, []byte{byte(c)}); n > count {
+			comma, count = c, n
+		}
+	}
+	return comma
+}
+
+// Next implements tableRows
+func (c *csvRows) Next() (int, []string, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return 0, nil, err
+	}
+	c.row++
+	return c.row, record, nil
+}
+
+// Close implements tableRows
+func (c *csvRows) Close() error {
+	return nil
+}
+
+// xlsxRows reads rows of worksheet, shared strings and styles are read into memory and worksheet is streamed
+type xlsxRows struct {
+	decoder   *xml.Decoder
+	sheet     io.ReadCloser
+	strings   []string
+	dateStyle []bool
+	date1904  bool
+	row       int
+	cells     []string
+}
+
+// xlsxMaxColumns is number of columns of Excel worksheet
+const xlsxMaxColumns = 16384
+
+// newXLSXRows opens worksheet of XLSX file, content which isn't io.ReaderAt is read into memory
+func newXLSXRows(content io.Reader, sheet string, maxBytes int64) (rows *xlsxRows, err error) {
+	var readerAt io.ReaderAt
+	var size int64
+	if file, ok := content.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		if size, err = file.Seek(0, io.SeekEnd); err != nil {
+			return
+		}
+		readerAt = file
+	} else {
+		var data []byte
+		if data, err = io.ReadAll(io.LimitReader(content, maxBytes+1)); err != nil {
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, &http.MaxBytesError{Limit: maxBytes}
+		}
+		readerAt, size = bytes.NewReader(data), int64(len(data))
+	}
+	archive, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var workbook struct {
+		Properties struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err = decodeXLSXPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return
+	}
+	var relationships struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err = decodeXLSXPart(files, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return
+	}
+	var sheetID string
+	for _, s := range workbook.Sheets {
+		if sheet == "" || s.Name == sheet {
+			sheetID = s.ID
+			break
+		}
+	}
+	if sheetID == "" {
+		return nil, fmt.Errorf("worksheet %q not found", sheet)
+	}
+	var sheetFile *zip.File
+	for _, rel := range relationships.Items {
+		if rel.ID == sheetID {
+			name := strings.TrimPrefix(rel.Target, "/")
+			if !strings.HasPrefix(rel.Target, "/") {
+				name = path.Join("xl", rel.Target)
+			}
+			sheetFile = files[name]
+		}
+	}
+	if sheetFile == nil {
+		return nil, errors.New("worksheet part not found")
+	}
+
+	rows = &xlsxRows{date1904: workbook.Properties.Date1904}
+	if rows.strings, err = readXLSXSharedStrings(files["xl/sharedStrings.xml"]); err != nil {
+		return nil, err
+	}
+	if rows.dateStyle, err = readXLSXDateStyles(files); err != nil {
+		return nil, err
+	}
+	if rows.sheet, err = sheetFile.Open(); err != nil {
+		return nil, err
+	}
+	rows.decoder = xml.NewDecoder(rows.sheet)
+	return rows, nil
+}
+
+// decodeXLSXPart decodes XML part of workbook
+func decodeXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s not found", name)
+	}
+	part, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	return xml.NewDecoder(io.LimitReader(part, xlsxMaxPartBytes)).Decode(v)
+}
+
+// readXLSXSharedStrings reads table of shared strings, texts of rich text runs are joined and phonetic runs are
+// skipped
+func readXLSXSharedStrings(file *zip.File) (items []string, err error) {
+	if file == nil {
+		return
+	}
+	part, err := file.Open()
+	if err != nil {
+		return
+	}
+	defer part.Close()
+	decoder := xml.NewDecoder(io.LimitReader(part, xlsxMaxPartBytes))
+	var item strings.Builder
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				if err = decoder.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				items = append(items, item.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				item.Write(t)
+			}
+		}
+	}
+}
+
+// readXLSXDateStyles returns for each cell style (index of cellXfs) if its number format is date or time
+func readXLSXDateStyles(files map[string]*zip.File) (dateStyles []bool, err error) {
+	if _, ok := files["xl/styles.xml"]; !ok {
+		return
+	}
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err = decodeXLSXPart(files, "xl/styles.xml", &styles); err != nil {
+		return
+	}
+	customDates := map[int]bool{}
+	for _, numFmt := range styles.NumFmts {
+		customDates[numFmt.ID] = isDateFormatCode(numFmt.Code)
+	}
+	dateStyles = make([]bool, len(styles.CellXfs))
+	for idx, xf := range styles.CellXfs {
+		id := xf.NumFmtID
+		dateStyles[idx] = (id >= 14 && id <= 22) || (id >= 45 && id <= 47) || customDates[id]
+	}
+	return
+}
+
+// isDateFormatCode returns true if number format contains date or time placeholders (quoted texts, escaped
+// characters and bracketed sections like colors are ignored)
+func isDateFormatCode(code string) bool {
+	inQuotes, inBrackets, escaped := false, false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes:
+			inQuotes = c != '"'
+		case inBrackets:
+			inBrackets = c != ']'
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			inQuotes = true
+		case c == '[':
+			inBrackets = true
+		case strings.ContainsRune("dmyhs", c):
+			return true
+		}
+	}
+	return false
+}
+
+// Next implements tableRows - cells are indexed by column reference, missing cells are empty
+func (x *xlsxRows) Next() (int, []string, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return 0, nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		x.row++
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "r" {
+				if row, err := strconv.Atoi(attr.Value); err == nil {
+					x.row = row
+				}
+			}
+		}
+		x.cells = x.cells[:0]
+		if err = x.readCells(); err != nil {
+			return 0, nil, err
+		}
+		return x.row, x.cells, nil
+	}
+}
+
+// Close implements tableRows
+func (x *xlsxRows) Close() error {
+	return x.sheet.Close()
+}
+
+// xlsxCell is cell of worksheet
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Style  int      `xml:"s,attr"`
+	Value  string   `xml:"v"`
+	Inline []string `xml:"is>t"`
+	Rich   []string `xml:"is>r>t"`
+}
+
+// readCells reads cells of current row up to its end
+func (x *xlsxRows) readCells() error {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				if err = x.decoder.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			var cell xlsxCell
+			if err = x.decoder.DecodeElement(&cell, &t); err != nil {
+				return err
+			}
+			column := len(x.cells)
+			if cell.Ref != "" {
+				column = xlsxColumnIndex(cell.Ref)
+			}
+			if column < 0 || column >= xlsxMaxColumns {
+				continue
+			}
+			for len(x.cells) <= column {
+				x.cells = append(x.cells, "")
+			}
+			x.cells[column] = x.cellValue(&cell)
+		}
+	}
+}
+
+// xlsxColumnIndex returns zero based column index of cell reference (e.g. B12 is 1)
+func xlsxColumnIndex(ref string) int {
+	column := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		column = column*26 + int(c-'A'+1)
+		if column > xlsxMaxColumns {
+			return -1
+		}
+	}
+	return column - 1
+}
+
+// cellValue returns text of cell, booleans are "true" / "false" and numbers with date format are RFC 3339 times
+func (x *xlsxRows) cellValue(cell *xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		idx, err := strconv.Atoi(cell.Value)
+		if err != nil || idx < 0 || idx >= len(x.strings) {
+			return ""
+		}
+		return x.strings[idx]
+	case "inlineStr":
+		return strings.Join(cell.Inline, "") + strings.Join(cell.Rich, "")
+	case "b":
+		return strconv.FormatBool(cell.Value == "1")
+	case "", "n":
+		if cell.Style >= 0 && cell.Style < len(x.dateStyle) && x.dateStyle[cell.Style] {
+			if serial, err := strconv.ParseFloat(cell.Value, 64); err == nil {
+				return x.serialTime(serial).Format(time.RFC3339)
+			}
+		}
+	}
+	return cell.Value
+}
+
+// serialTime converts Excel serial date (days since epoch of 1900 or 1904 date system) to time in UTC
+func (x *xlsxRows) serialTime(serial float64) time.Time {
+	// Epoch 1899-12-30 compensates for non-existent 1900-02-29 of 1900 date system
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if x.date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
@@ -0,0 +1,161 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// otherTenant is metrics label of tenants over cardinality limit or outside of allowlist
+const otherTenant = "other"
+
+// TenantOptions is a configuration container for tenant resolution, per-tenant log field and metrics
+type TenantOptions struct {
+	// Claim of authenticated user with tenant ID (path like "org.id" is supported), default is tenant. Tenant is
+	// taken only from this claim, requests of anonymous users and users without the claim have no tenant.
+	Claim string
+	// Header with tenant ID sent by clients (e.g. X-Tenant-ID), request of authenticated user is rejected with 403
+	// error if the header doesn't match tenant claim of the user. Empty disables the check.
+	Header string
+	// Custom resolution of tenant, it replaces claim and header
+	ResolverFn func(r *http.Request, userInfo *UserInfo) string
+	// Emit per-tenant request and error counters (http_tenant_requests_total, http_tenant_errors_total)
+	Metrics bool
+	// Tenants used as metrics label, other tenants are labeled "other". If empty, first MaxTenants tenants are
+	// used as label.
+	Allowlist []string
+	// Cardinality guard of tenant label, default is 100
+	MaxTenants int
+}
+
+// TenantOptionsFromViper reads tenant options (claim, header, metrics, allowlist, max_tenants), nil is returned
+// if it is not enabled
+func TenantOptionsFromViper(prefix string) *TenantOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &TenantOptions{
+		Claim:      viper.GetString(prefix + "claim"),
+		Header:     viper.GetString(prefix + "header"),
+		Metrics:    viper.GetBool(prefix + "metrics"),
+		Allowlist:  viper.GetStringSlice(prefix + "allowlist"),
+		MaxTenants: viper.GetInt(prefix + "max_tenants"),
+	}
+}
+
+// TenantFromContext returns tenant of request, empty string is returned if tenant is not resolved
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(contextTypeTenant).(string)
+	return tenant
+}
+
+// tenantMiddleware resolves tenant of request
+type tenantMiddleware struct {
+	options  TenantOptions
+	logger   *logrus.Logger
+	mutex    sync.Mutex
+	labels   map[string]bool
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+}
+
+// newTenantMiddleware creates tenant middleware
+func newTenantMiddleware(options *TenantOptions, logger *logrus.Logger) *tenantMiddleware {
+	t := &tenantMiddleware{
+		options: *options,
+		logger:  logger,
+		labels:  map[string]bool{},
+	}
+	if t.options.Claim == "" {
+		t.options.Claim = "tenant"
+	}
+	if t.options.MaxTenants <= 0 {
+		t.options.MaxTenants = 100
+	}
+	for _, tenant := range t.options.Allowlist {
+		t.labels[tenant] = true
+	}
+	if t.options.Metrics {
+		t.requests = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_tenant_requests_total",
+			Help: "Number of HTTP requests by tenant and status code class.",
+		}, []string{"tenant", "code"})).(*prometheus.CounterVec)
+		t.errors = registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_tenant_errors_total",
+			Help: "Number of HTTP requests of tenant failed with 5xx status.",
+		}, []string{"tenant"})).(*prometheus.CounterVec)
+	}
+	return t
+}
+
+// resolve returns tenant of request from claim of authenticated user, error is returned if tenant header doesn't
+// match it
+func (t *tenantMiddleware) resolve(r *http.Request) (tenant string, err error) {
+	userInfo, _ := r.Context().Value(contextTypeUserInfo).(*UserInfo)
+	if userInfo == unauthenticatedUser || userInfo == userWithInvalidToken {
+		userInfo = nil
+	}
+	if t.options.ResolverFn != nil {
+		return t.options.ResolverFn(r, userInfo), nil
+	}
+	if userInfo != nil {
+		tenant = userInfo.ClaimString(t.options.Claim)
+	}
+	if t.options.Header == "" || userInfo == nil {
+		return
+	}
+	if header := r.Header.Get(t.options.Header); header != "" && header != tenant {
+		err = ServerErrorWithoutStack(fmt.Errorf("tenant header %q doesn't match tenant of user %q", header, tenant),
+			http.StatusForbidden, "Tenant doesn't match").WithErrorCode("TENANT_MISMATCH")
+	}
+	return
+}
+
+// label returns metrics label of tenant - allowlisted tenant or one of first MaxTenants tenants
+func (t *tenantMiddleware) label(tenant string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.labels[tenant] {
+		return tenant
+	}
+	if len(t.options.Allowlist) == 0 && len(t.labels) < t.options.MaxTenants {
+		t.labels[tenant] = true
+		return tenant
+	}
+	return otherTenant
+}
+
+// Middleware returns middleware function that can be used in router.Use()
+func (t *tenantMiddleware) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := t.resolve(r)
+		if err != nil {
+			processHTTPError(err, w, r, t.logger, nil)
+			return
+		}
+		if tenant == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), contextTypeTenant, tenant))
+		if !t.options.Metrics {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		rec := newResponseRecorder(w)
+		h.ServeHTTP(rec, r)
+		label := t.label(tenant)
+		status := rec.Status()
+		t.requests.WithLabelValues(label, strconv.Itoa(status/100)+"xx").Inc()
+		if status >= http.StatusInternalServerError {
+			t.errors.WithLabelValues(label).Inc()
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantResolution(t *testing.T) {
+	member := &UserInfo{UserID: "u1", Claims: map[string]interface{}{"tenant": "acme"}}
+	withoutClaim := &UserInfo{UserID: "u2"}
+	tests := []struct {
+		name       string
+		user       *UserInfo
+		header     string
+		wantTenant string
+		wantStatus int
+	}{
+		{"claim", member, "", "acme", http.StatusOK},
+		{"matching header", member, "acme", "acme", http.StatusOK},
+		{"conflicting header", member, "other", "", http.StatusForbidden},
+		{"anonymous header", unauthenticatedUser, "acme", "", http.StatusOK},
+		{"invalid token header", userWithInvalidToken, "acme", "", http.StatusOK},
+		{"user without claim header", withoutClaim, "acme", "", http.StatusForbidden},
+		{"user without claim", withoutClaim, "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tenant string
+			handler := newTenantMiddleware(&TenantOptions{Header: "X-Tenant-ID"}, nil).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenant = TenantFromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), contextTypeUserInfo, tt.user))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus || tenant != tt.wantTenant {
+				t.Fatalf("got %d tenant %q, want %d tenant %q", w.Code, tenant, tt.wantStatus, tt.wantTenant)
+			}
+		})
+	}
+}
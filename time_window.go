@@ -0,0 +1,165 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TimeWindow is recurring time window (e.g. change window of maintenance endpoints)
+type TimeWindow struct {
+	// Days when window starts, empty means every day
+	Days []time.Weekday
+	// Start and end of window as offset from midnight. Window with end before start ends next day.
+	Start time.Duration
+	End   time.Duration
+	// Time zone of window, default is UTC
+	Location *time.Location
+	spec     string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseTimeWindow parses time window in format "[days] HH:MM-HH:MM [time zone]", days are comma separated
+// days or ranges (e.g. "Mon-Fri 22:00-02:00 Europe/Prague" or "Sat,Sun 00:00-24:00")
+func ParseTimeWindow(spec string) (window TimeWindow, err error) {
+	window.spec = spec
+	window.Location = time.UTC
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 3 {
+		err = fmt.Errorf("invalid time window %q", spec)
+		return
+	}
+
+	hoursIdx := 0
+	if !strings.Contains(fields[0], ":") {
+		hoursIdx = 1
+		if window.Days, err = parseWeekdays(fields[0]); err != nil {
+			return
+		}
+	}
+	if hoursIdx >= len(fields) {
+		err = fmt.Errorf("invalid time window %q: missing hours", spec)
+		return
+	}
+	hours := strings.Split(fields[hoursIdx], "-")
+	if len(hours) != 2 {
+		err = fmt.Errorf("invalid time window %q: hours must be HH:MM-HH:MM", spec)
+		return
+	}
+	if window.Start, err = parseClock(hours[0]); err != nil {
+		return
+	}
+	if window.End, err = parseClock(hours[1]); err != nil {
+		return
+	}
+	if rest := fields[hoursIdx+1:]; len(rest) == 1 {
+		if window.Location, err = time.LoadLocation(rest[0]); err != nil {
+			return
+		}
+	} else if len(rest) > 1 {
+		err = fmt.Errorf("invalid time window %q", spec)
+	}
+	return
+}
+
+// MustParseTimeWindow is like ParseTimeWindow, but panics on invalid window
+func MustParseTimeWindow(spec string) TimeWindow {
+	window, err := ParseTimeWindow(spec)
+	if err != nil {
+		panic(err)
+	}
+	return window
+}
+
+func parseWeekdays(s string) (days []time.Weekday, err error) {
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", bounds[0])
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return nil, fmt.Errorf("invalid day %q", bounds[1])
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == to {
+				break
+			}
+		}
+	}
+	return
+}
+
+func parseClock(s string) (offset time.Duration, err error) {
+	var hours, minutes int
+	if _, err = fmt.Sscanf(s, "%d:%d", &hours, &minutes); err != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// startsOn returns if window starts on given day
+func (tw TimeWindow) startsOn(day time.Weekday) bool {
+	if len(tw.Days) == 0 {
+		return true
+	}
+	for _, d := range tw.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains returns if given time is within window
+func (tw TimeWindow) Contains(t time.Time) bool {
+	location := tw.Location
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	offset := t.Sub(midnight)
+
+	if tw.End > tw.Start {
+		return tw.startsOn(t.Weekday()) && offset >= tw.Start && offset < tw.End
+	}
+	// Window over midnight - either started today or yesterday
+	if offset >= tw.Start && tw.startsOn(t.Weekday()) {
+		return true
+	}
+	return offset < tw.End && tw.startsOn((t.Weekday()+6)%7)
+}
+
+// String returns window specification
+func (tw TimeWindow) String() string {
+	if tw.spec != "" {
+		return tw.spec
+	}
+	location := "UTC"
+	if tw.Location != nil {
+		location = tw.Location.String()
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s", int(tw.Start.Hours()), int(tw.Start.Minutes())%60, int(tw.End.Hours()), int(tw.End.Minutes())%60, location)
+}
+
+// checkTimeWindows returns forbidden error if now is outside of all windows
+func checkTimeWindows(windows []TimeWindow, now time.Time) (err error) {
+	specs := make([]string, 0, len(windows))
+	for _, window := range windows {
+		if window.Contains(now) {
+			return nil
+		}
+		specs = append(specs, window.String())
+	}
+	return ServerErrorWithoutStack(nil, http.StatusForbidden, fmt.Sprintf("Route is available only during: %s", strings.Join(specs, "; ")))
+}
@@ -0,0 +1,76 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+)
+
+// AudienceOptions are verification settings for tokens issued for given audience (e.g. public API and
+// admin API tokens accepted by single service). Empty claim names keep default mapping.
+type AudienceOptions struct {
+	// Value of aud claim
+	Audience string `mapstructure:"audience"`
+	// Required scope replacing AuthorizationOptions.RequiredScope for tokens of audience
+	RequiredScope string `mapstructure:"scope"`
+	// Claim with user ID, default is sub
+	UserIDClaim string `mapstructure:"user_id_claim"`
+	// Claim with email, default is email
+	EmailClaim string `mapstructure:"email_claim"`
+	// Claim with scopes (space separated string or list), default is scope
+	ScopesClaim string `mapstructure:"scopes_claim"`
+	// Claim with group membership, default is AuthorizationOptions.GroupsClaim
+	GroupsClaim string `mapstructure:"groups_claim"`
+}
+
+// apply maps claims of token to user info
+func (ao *AudienceOptions) apply(userInfo *UserInfo) {
+	if ao.UserIDClaim != "" {
+		userInfo.UserID = userInfo.ClaimString(ao.UserIDClaim)
+	}
+	if ao.EmailClaim != "" {
+		userInfo.Email = userInfo.ClaimString(ao.EmailClaim)
+	}
+	if ao.ScopesClaim != "" {
+		userInfo.Scopes = userInfo.ClaimStringSlice(ao.ScopesClaim)
+	}
+	if ao.GroupsClaim != "" {
+		userInfo.Groups = userInfo.ClaimStringSlice(ao.GroupsClaim)
+	}
+}
+
+// tokenAudience returns settings of first configured audience present in aud claim. If no audience is
+// configured, all tokens are accepted with default settings.
+func (a *authorization) tokenAudience(userInfo *UserInfo) (audience *AudienceOptions, accepted bool) {
+	if len(a.audiences) == 0 {
+		return nil, true
+	}
+	// aud is either string or list of strings
+	tokenAudiences := []string{userInfo.ClaimString("aud")}
+	if tokenAudiences[0] == "" {
+		tokenAudiences = userInfo.ClaimStringSlice("aud")
+	}
+	for idx := range a.audiences {
+		for _, aud := range tokenAudiences {
+			if aud == a.audiences[idx].Audience {
+				return &a.audiences[idx], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// requiredScopeOf returns required scope of request, it is taken from audience settings of token if defined
+func (a *authorization) requiredScopeOf(r *http.Request) string {
+	if audience, ok := r.Context().Value(contextTypeAudience).(*AudienceOptions); ok && audience.RequiredScope != "" {
+		return audience.RequiredScope
+	}
+	return a.requiredScope
+}
+
+// contextWithAudience stores audience settings of token in context
+func contextWithAudience(ctx context.Context, audience *AudienceOptions) context.Context {
+	if audience == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextTypeAudience, audience)
+}
@@ -0,0 +1,295 @@
+package webservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// issuerKey is a signing key of token issuer
+type issuerKey struct {
+	id      string
+	private *rsa.PrivateKey
+	public  jwk.Key
+	retired time.Time
+}
+
+// TokenIssuer mints RS256 service tokens verifiable by authorization middleware of other services (claims sub,
+// email and scope). Public keys are served at /.well-known/jwks.json. It is a Component, register it with
+// svc.Register().
+type TokenIssuer struct {
+	issuer           string
+	privateKeyFile   string
+	jwksFile         string
+	rotationInterval time.Duration
+	keyRetention     time.Duration
+	devMode          bool
+	logger           *logrus.Logger
+	mutex            sync.RWMutex
+	keys             []*issuerKey
+	stop             context.CancelFunc
+	done             chan struct{}
+}
+
+// NewTokenIssuer creates token issuer. Keys are configured with token_issuer.private_key_file (PEM) or
+// token_issuer.jwks_file shared by all replicas, so every replica signs with the same key and publishes the same
+// JWKS. Key is generated in memory only in dev mode. With token_issuer.rotation_interval keys are reloaded from
+// the file periodically - key is rotated by replacing the file and keys removed from it are published for
+// token_issuer.key_retention (default 24h), which has to be longer than TTL of issued tokens.
+func NewTokenIssuer(issuer string, logger *logrus.Logger) *TokenIssuer {
+	return &TokenIssuer{
+		issuer:       issuer,
+		keyRetention: time.Hour * 24,
+		logger:       logger,
+	}
+}
+
+// setDevMode implements devModeComponent
+func (ti *TokenIssuer) setDevMode(enable bool) {
+	ti.devMode = enable
+}
+
+// Name implements Component
+func (ti *TokenIssuer) Name() string {
+	return "token_issuer"
+}
+
+// Configure implements Component - signing keys are loaded
+func (ti *TokenIssuer) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("issuer") {
+		ti.issuer = config.GetString("issuer")
+	}
+	ti.privateKeyFile = config.GetString("private_key_file")
+	ti.jwksFile = config.GetString("jwks_file")
+	ti.rotationInterval = config.GetDuration("rotation_interval")
+	if config.IsSet("key_retention") {
+		ti.keyRetention = config.GetDuration("key_retention")
+	}
+
+	switch {
+	case ti.privateKeyFile != "" || ti.jwksFile != "":
+		err = ti.reload()
+	case ti.rotationInterval > 0:
+		err = fmt.Errorf("token issuer rotation reloads keys from private_key_file or jwks_file, none is configured")
+	case ti.devMode:
+		if ti.logger != nil {
+			ti.logger.Warn("token issuer key is generated in memory (dev mode), tokens are verifiable only by this replica")
+		}
+		err = ti.generateKey()
+	default:
+		err = fmt.Errorf("token issuer key is not configured, set private_key_file or jwks_file (key is generated only in dev mode)")
+	}
+	return
+}
+
+// newIssuerKey creates signing key from private key
+func newIssuerKey(key jwk.Key) (*issuerKey, error) {
+	var private rsa.PrivateKey
+	if err := key.Raw(&private); err != nil {
+		return nil, fmt.Errorf("token issuer supports only RSA private keys: %w", err)
+	}
+	if key.KeyID() == "" {
+		if err := jwk.AssignKeyID(key); err != nil {
+			return nil, err
+		}
+	}
+	public, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	public.Set(jwk.AlgorithmKey, "RS256")
+	public.Set(jwk.KeyUsageKey, "sig")
+	return &issuerKey{id: key.KeyID(), private: &private, public: public}, nil
+}
+
+// loadKeys reads keys from private_key_file or jwks_file, signing key is the last one
+func (ti *TokenIssuer) loadKeys() (keys []*issuerKey, err error) {
+	if ti.privateKeyFile != "" {
+		data, err := os.ReadFile(ti.privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwk.ParseKey(data, jwk.WithPEM(true))
+		if err != nil {
+			return nil, err
+		}
+		// Key ID is thumbprint of the key, so it is the same in all replicas
+		k, err := newIssuerKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return []*issuerKey{k}, nil
+	}
+
+	data, err := os.ReadFile(ti.jwksFile)
+	if err != nil {
+		return
+	}
+	set, err := jwk.Parse(data)
+	if err != nil {
+		return
+	}
+	if set.Len() == 0 {
+		return nil, fmt.Errorf("token issuer JWKS file %s has no keys", ti.jwksFile)
+	}
+	// The first key of the set signs tokens, other ones are only published
+	for idx := set.Len() - 1; idx >= 0; idx-- {
+		key, _ := set.Get(idx)
+		k, err := newIssuerKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return
+}
+
+// reload loads keys from configured file. Keys which are not in the file anymore are published for key retention.
+func (ti *TokenIssuer) reload() (err error) {
+	keys, err := ti.loadKeys()
+	if err != nil {
+		return
+	}
+	ti.setKeys(keys)
+	return
+}
+
+// setKeys replaces keys, the last one is signing key. Replaced keys are published until key retention elapses.
+func (ti *TokenIssuer) setKeys(keys []*issuerKey) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	now := time.Now()
+	current := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		current[k.id] = true
+	}
+	var retained []*issuerKey
+	for _, k := range ti.keys {
+		if current[k.id] {
+			continue
+		}
+		if k.retired.IsZero() {
+			k.retired = now
+		}
+		if now.Sub(k.retired) < ti.keyRetention {
+			retained = append(retained, k)
+		}
+	}
+	rotated := len(ti.keys) > 0 && ti.keys[len(ti.keys)-1].id != keys[len(keys)-1].id
+	ti.keys = append(retained, keys...)
+	if rotated && ti.logger != nil {
+		ti.logger.WithField("kid", keys[len(keys)-1].id).Info("token issuer key rotated")
+	}
+}
+
+// generateKey generates new signing key in memory
+func (ti *TokenIssuer) generateKey() (err error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+	key, err := jwk.New(private)
+	if err != nil {
+		return
+	}
+	k, err := newIssuerKey(key)
+	if err != nil {
+		return
+	}
+	ti.setKeys([]*issuerKey{k})
+	return
+}
+
+// SignToken signs claims with current key. Claims iss (if issuer is set), iat and exp are filled.
+func (ti *TokenIssuer) SignToken(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	ti.mutex.RLock()
+	if len(ti.keys) == 0 {
+		ti.mutex.RUnlock()
+		return "", fmt.Errorf("token issuer has no signing key")
+	}
+	key := ti.keys[len(ti.keys)-1]
+	ti.mutex.RUnlock()
+
+	signed := jwt.MapClaims{}
+	for name, value := range claims {
+		signed[name] = value
+	}
+	now := time.Now()
+	if ti.issuer != "" {
+		signed["iss"] = ti.issuer
+	}
+	signed["iat"] = now.Unix()
+	signed["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, signed)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// PublicKeys returns JWKS with public keys of the issuer
+func (ti *TokenIssuer) PublicKeys() jwk.Set {
+	ti.mutex.RLock()
+	defer ti.mutex.RUnlock()
+	set := jwk.NewSet()
+	for idx := len(ti.keys) - 1; idx >= 0; idx-- {
+		set.Add(ti.keys[idx].public)
+	}
+	return set
+}
+
+// Routes implements Component - JWKS endpoint is registered
+func (ti *TokenIssuer) Routes(router *mux.Router) (err error) {
+	router.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(ti.PublicKeys())
+	}).Methods(http.MethodGet)
+	return
+}
+
+// Start implements Component - starts periodic reloading of keys if rotation is configured
+func (ti *TokenIssuer) Start(ctx context.Context) (err error) {
+	if ti.rotationInterval <= 0 {
+		return
+	}
+	ctx, ti.stop = context.WithCancel(ctx)
+	ti.done = make(chan struct{})
+	go func() {
+		defer close(ti.done)
+		ticker := time.NewTicker(ti.rotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ti.reload(); err != nil && ti.logger != nil {
+					ti.logger.WithError(err).Error("unable to reload token issuer keys")
+				}
+			}
+		}
+	}()
+	return
+}
+
+// Stop implements Component
+func (ti *TokenIssuer) Stop(ctx context.Context) (err error) {
+	if ti.stop != nil {
+		ti.stop()
+		<-ti.done
+	}
+	return
+}
@@ -0,0 +1,253 @@
+package webservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/spf13/viper"
+)
+
+// newTestIssuerKey generates private key with key ID
+func newTestIssuerKey(t *testing.T, kid string) jwk.Key {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.New(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Set(jwk.KeyIDKey, kid)
+	return key
+}
+
+// writeTestJWKS writes private keys to JWKS file, the first key signs tokens
+func writeTestJWKS(t *testing.T, file string, keys ...jwk.Key) {
+	set := jwk.NewSet()
+	for _, key := range keys {
+		set.Add(key)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyTestToken verifies token with JWKS and returns its key ID and claims
+func verifyTestToken(set jwk.Set, token string) (kid string, claims jwt.MapClaims, err error) {
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ = token.Header["kid"].(string)
+		key, found := set.LookupKeyID(kid)
+		if !found {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		var public rsa.PublicKey
+		err := key.Raw(&public)
+		return &public, err
+	})
+	return
+}
+
+// keyIDs returns key IDs of JWKS in order
+func keyIDs(set jwk.Set) (ids []string) {
+	for idx := 0; idx < set.Len(); idx++ {
+		key, _ := set.Get(idx)
+		ids = append(ids, key.KeyID())
+	}
+	return
+}
+
+func TestTokenIssuerConfigure(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, jwksFile, newTestIssuerKey(t, "a"))
+
+	tests := []struct {
+		name     string
+		devMode  bool
+		settings map[string]interface{}
+		valid    bool
+	}{
+		{"no key", false, nil, false},
+		{"no key in dev mode", true, nil, true},
+		{"rotation without key file", true, map[string]interface{}{"rotation_interval": "1h"}, false},
+		{"jwks file", false, map[string]interface{}{"jwks_file": jwksFile}, true},
+		{"missing jwks file", false, map[string]interface{}{"jwks_file": jwksFile + ".missing"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range test.settings {
+				config.Set(key, value)
+			}
+			ti := NewTokenIssuer("test", nil)
+			ti.setDevMode(test.devMode)
+			if err := ti.Configure(config); (err == nil) != test.valid {
+				t.Fatalf("expected valid %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestTokenIssuerSignToken(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, jwksFile, newTestIssuerKey(t, "a"))
+	config := viper.New()
+	config.Set("jwks_file", jwksFile)
+	ti := NewTokenIssuer("https://auth.example.com", nil)
+	if err := ti.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ti.SignToken(jwt.MapClaims{"sub": "service", "scope": "read"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token is verified with keys published by JWKS endpoint
+	router := mux.NewRouter()
+	if err = ti.Routes(router); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JWKS endpoint returned %d", rec.Code)
+	}
+	published, err := jwk.Parse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := published.Get(0)
+	var private rsa.PrivateKey
+	if key.Raw(&private) == nil {
+		t.Fatal("JWKS endpoint publishes private key")
+	}
+
+	kid, claims, err := verifyTestToken(published, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid != "a" || claims["sub"] != "service" || claims["scope"] != "read" || claims["iss"] != "https://auth.example.com" {
+		t.Fatalf("unexpected token kid %q claims %v", kid, claims)
+	}
+	if exp, _ := claims["exp"].(float64); time.Until(time.Unix(int64(exp), 0)) > time.Minute {
+		t.Fatalf("unexpected token expiration %v", claims["exp"])
+	}
+}
+
+func TestTokenIssuerReplicasShareKeys(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, jwksFile, newTestIssuerKey(t, "a"), newTestIssuerKey(t, "b"))
+
+	var replicas []*TokenIssuer
+	for i := 0; i < 2; i++ {
+		config := viper.New()
+		config.Set("jwks_file", jwksFile)
+		ti := NewTokenIssuer("test", nil)
+		if err := ti.Configure(config); err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, ti)
+	}
+
+	if a, b := fmt.Sprint(keyIDs(replicas[0].PublicKeys())), fmt.Sprint(keyIDs(replicas[1].PublicKeys())); a != b || a != "[a b]" {
+		t.Fatalf("replicas publish different keys %s and %s", a, b)
+	}
+	token, err := replicas[0].SignToken(jwt.MapClaims{"sub": "service"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = verifyTestToken(replicas[1].PublicKeys(), token); err != nil {
+		t.Fatalf("token of one replica is not verifiable with keys of other replica: %v", err)
+	}
+}
+
+func TestTokenIssuerRotation(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	keyA, keyB := newTestIssuerKey(t, "a"), newTestIssuerKey(t, "b")
+	writeTestJWKS(t, jwksFile, keyA)
+
+	config := viper.New()
+	config.Set("jwks_file", jwksFile)
+	config.Set("rotation_interval", "10ms")
+	ti := NewTokenIssuer("test", nil)
+	if err := ti.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := ti.SignToken(jwt.MapClaims{"sub": "service"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ti.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ti.Stop(context.Background())
+
+	// Key is rotated by replacing the shared file, old key is removed from it
+	writeTestJWKS(t, jwksFile, keyB)
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		token, err := ti.SignToken(jwt.MapClaims{"sub": "service"}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kid, _, err := verifyTestToken(ti.PublicKeys(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kid == "b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key is not reloaded from rotated file")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Old key is published within retention, so tokens signed before rotation are valid
+	if ids := fmt.Sprint(keyIDs(ti.PublicKeys())); ids != "[b a]" {
+		t.Fatalf("unexpected published keys %s", ids)
+	}
+	if _, _, err = verifyTestToken(ti.PublicKeys(), oldToken); err != nil {
+		t.Fatalf("token signed before rotation is rejected: %v", err)
+	}
+}
+
+func TestTokenIssuerKeyRetention(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, jwksFile, newTestIssuerKey(t, "a"))
+
+	config := viper.New()
+	config.Set("jwks_file", jwksFile)
+	config.Set("key_retention", "1ns")
+	ti := NewTokenIssuer("test", nil)
+	if err := ti.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	writeTestJWKS(t, jwksFile, newTestIssuerKey(t, "b"))
+	for i := 0; i < 2; i++ {
+		if err := ti.reload(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if ids := fmt.Sprint(keyIDs(ti.PublicKeys())); ids != "[b]" {
+		t.Fatalf("key is published after retention, got %s", ids)
+	}
+}
@@ -0,0 +1,158 @@
+package webservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// TokenRefreshOptions is a configuration container for refresh token proxy endpoint
+type TokenRefreshOptions struct {
+	// Token endpoint of identity provider
+	TokenURL string
+	// OAuth client credentials - client secret is kept on the server
+	ClientID     string
+	ClientSecret string
+	// Path of refresh endpoint, default is /auth/refresh
+	Path string
+	// If set, refresh token is read from and stored to HttpOnly cookie of given name instead of request/response body
+	CookieName string
+	// HTTP client used to call identity provider, default has 10s timeout
+	Client *http.Client
+}
+
+// TokenRefreshOptionsFromViper reads refresh proxy options, nil is returned if token URL is not configured
+func TokenRefreshOptionsFromViper(prefix string) (options *TokenRefreshOptions) {
+	if viper.GetString(prefix+"token_url") == "" {
+		return nil
+	}
+	return &TokenRefreshOptions{
+		TokenURL:     viper.GetString(prefix + "token_url"),
+		ClientID:     viper.GetString(prefix + "client_id"),
+		ClientSecret: viper.GetString(prefix + "client_secret"),
+		Path:         viper.GetString(prefix + "path"),
+		CookieName:   viper.GetString(prefix + "cookie_name"),
+	}
+}
+
+// tokenRefresher exchanges refresh tokens at identity provider. It is registered as component.
+type tokenRefresher struct {
+	options TokenRefreshOptions
+}
+
+// newTokenRefresher creates refresh proxy
+func newTokenRefresher(options *TokenRefreshOptions) *tokenRefresher {
+	t := &tokenRefresher{options: *options}
+	if t.options.Path == "" {
+		t.options.Path = "/auth/refresh"
+	}
+	if t.options.Client == nil {
+		t.options.Client = &http.Client{Timeout: time.Second * 10}
+	}
+	return t
+}
+
+// Name implements Component
+func (t *tokenRefresher) Name() string {
+	return "auth_refresh"
+}
+
+// Configure implements Component
+func (t *tokenRefresher) Configure(config *viper.Viper) (err error) {
+	return
+}
+
+// Routes implements Component
+func (t *tokenRefresher) Routes(router *mux.Router) (err error) {
+	router.Handle(t.options.Path, AppHandler(t.refreshHandler).AllowAnonymous()).Methods("POST")
+	return
+}
+
+// Start implements Component
+func (t *tokenRefresher) Start(ctx context.Context) (err error) {
+	return
+}
+
+// Stop implements Component
+func (t *tokenRefresher) Stop(ctx context.Context) (err error) {
+	return
+}
+
+// refreshHandler exchanges refresh token and returns response of identity provider
+func (t *tokenRefresher) refreshHandler(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) (err error) {
+	var refreshToken string
+	if t.options.CookieName != "" {
+		if cookie, cookieErr := r.Cookie(t.options.CookieName); cookieErr == nil {
+			refreshToken = cookie.Value
+		}
+	} else {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err = json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&body); err != nil {
+			return ServerError(err, http.StatusBadRequest, "Invalid refresh request")
+		}
+		refreshToken = body.RefreshToken
+	}
+	if refreshToken == "" {
+		return ServerError(nil, http.StatusUnauthorized, "Refresh token is missing")
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {t.options.ClientID},
+	}
+	if t.options.ClientSecret != "" {
+		form.Set("client_secret", t.options.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, t.options.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return ServerError(err, http.StatusInternalServerError, "Unable to create token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.options.Client.Do(req)
+	if err != nil {
+		return ServerError(err, http.StatusBadGateway, "Identity provider is not available")
+	}
+	defer resp.Body.Close()
+
+	var tokens map[string]interface{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&tokens); err != nil {
+		return ServerError(err, http.StatusBadGateway, "Invalid identity provider response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		// invalid_grant and similar errors mean the refresh token is not valid anymore
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+			return ServerError(fmt.Errorf("identity provider error: %v", tokens["error"]), http.StatusUnauthorized, "Refresh token rejected")
+		}
+		return ServerError(fmt.Errorf("identity provider returned %d", resp.StatusCode), http.StatusBadGateway, "Token refresh failed")
+	}
+
+	if t.options.CookieName != "" {
+		if newRefreshToken, ok := tokens["refresh_token"].(string); ok && newRefreshToken != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     t.options.CookieName,
+				Value:    newRefreshToken,
+				Path:     ExternalPath(r, t.options.Path),
+				HttpOnly: true,
+				Secure:   true,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		delete(tokens, "refresh_token")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return json.NewEncoder(w).Encode(tokens)
+}
@@ -0,0 +1,108 @@
+package webservice
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// TrustedHeaderAuthScheme is value of "auth" claim of users authenticated by upstream proxy headers
+const TrustedHeaderAuthScheme = "trusted-header"
+
+// TrustedHeaderOptions configures authentication by identity headers set by upstream authenticating proxy
+// (e.g. oauth2-proxy). Headers are trusted only from given networks or with shared secret, at least one of
+// them is required.
+type TrustedHeaderOptions struct {
+	// Header with user ID, default is X-Auth-Request-User
+	UserHeader string
+	// Header with email, default is X-Auth-Request-Email
+	EmailHeader string
+	// Header with comma separated groups, default is X-Auth-Request-Groups
+	GroupsHeader string
+	// Networks of proxy (CIDR or IP address), requests from other addresses are not trusted
+	TrustedProxies []string
+	// Header and value of secret shared with proxy
+	SecretHeader string
+	Secret       string
+
+	trustedNets []*net.IPNet
+}
+
+// TrustedHeaderOptionsFromViper reads trusted header options (user_header, email_header, groups_header,
+// trusted_proxies, secret_header, secret), nil is returned if it is not enabled
+func TrustedHeaderOptionsFromViper(prefix string) *TrustedHeaderOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &TrustedHeaderOptions{
+		UserHeader:     viper.GetString(prefix + "user_header"),
+		EmailHeader:    viper.GetString(prefix + "email_header"),
+		GroupsHeader:   viper.GetString(prefix + "groups_header"),
+		TrustedProxies: viper.GetStringSlice(prefix + "trusted_proxies"),
+		SecretHeader:   viper.GetString(prefix + "secret_header"),
+		Secret:         viper.GetString(prefix + "secret"),
+	}
+}
+
+// init sets defaults and parses trusted networks
+func (o *TrustedHeaderOptions) init() (err error) {
+	if o.UserHeader == "" {
+		o.UserHeader = "X-Auth-Request-User"
+	}
+	if o.EmailHeader == "" {
+		o.EmailHeader = "X-Auth-Request-Email"
+	}
+	if o.GroupsHeader == "" {
+		o.GroupsHeader = "X-Auth-Request-Groups"
+	}
+	if o.Secret != "" && o.SecretHeader == "" {
+		o.SecretHeader = "X-Auth-Request-Secret"
+	}
+	if o.trustedNets, err = parseTrustedProxies(o.TrustedProxies); err != nil {
+		return
+	}
+	if len(o.trustedNets) == 0 && o.Secret == "" {
+		return fmt.Errorf("trusted header authentication requires trusted proxies or shared secret")
+	}
+	return
+}
+
+// trusted returns if request comes from authenticating proxy
+func (o *TrustedHeaderOptions) trusted(r *http.Request) bool {
+	if o.Secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(o.SecretHeader)), []byte(o.Secret)) != 1 {
+		return false
+	}
+	if len(o.trustedNets) == 0 {
+		return true
+	}
+	return trustedIP(remoteIP(r), o.trustedNets)
+}
+
+// trustedHeaderUser returns user from identity headers, nil is returned if request has no identity headers
+func trustedHeaderUser(r *http.Request, options *TrustedHeaderOptions) (userInfo *UserInfo, err error) {
+	uid := r.Header.Get(options.UserHeader)
+	if uid == "" {
+		return nil, nil
+	}
+	if !options.trusted(r) {
+		return nil, fmt.Errorf("identity headers from untrusted source %s", r.RemoteAddr)
+	}
+	userInfo = &UserInfo{
+		UserID: uid,
+		Email:  r.Header.Get(options.EmailHeader),
+		Claims: map[string]interface{}{"sub": uid, "auth": TrustedHeaderAuthScheme},
+	}
+	for _, group := range strings.Split(r.Header.Get(options.GroupsHeader), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			userInfo.Groups = append(userInfo.Groups, group)
+		}
+	}
+	if userInfo.Email != "" {
+		userInfo.Claims["email"] = userInfo.Email
+	}
+	return
+}
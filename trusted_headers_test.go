@@ -0,0 +1,102 @@
+package webservice
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrustedHeaderOptionsInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		options TrustedHeaderOptions
+		valid   bool
+	}{
+		{"neither proxies nor secret", TrustedHeaderOptions{}, false},
+		{"invalid proxy network", TrustedHeaderOptions{TrustedProxies: []string{"10.0.0.0/33"}}, false},
+		{"trusted proxies", TrustedHeaderOptions{TrustedProxies: []string{"10.0.0.0/8"}}, true},
+		{"shared secret", TrustedHeaderOptions{Secret: "s3cret"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			if err := options.init(); (err == nil) != test.valid {
+				t.Fatalf("expected valid %v, got error %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestTrustedHeaderUser(t *testing.T) {
+	proxies := TrustedHeaderOptions{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.10"}}
+	secret := TrustedHeaderOptions{Secret: "s3cret"}
+	both := TrustedHeaderOptions{TrustedProxies: []string{"10.0.0.0/8"}, Secret: "s3cret"}
+
+	tests := []struct {
+		name       string
+		options    TrustedHeaderOptions
+		remoteAddr string
+		headers    map[string]string
+		wantUser   string
+		wantErr    bool
+	}{
+		{"trusted proxy network", proxies, "10.1.2.3:4000", map[string]string{"X-Auth-Request-User": "alice"}, "alice", false},
+		{"trusted proxy address", proxies, "192.168.1.10:4000", map[string]string{"X-Auth-Request-User": "alice"}, "alice", false},
+		{"untrusted peer", proxies, "192.168.1.11:4000", map[string]string{"X-Auth-Request-User": "alice"}, "", true},
+		{"untrusted peer without identity headers", proxies, "192.168.1.11:4000", nil, "", false},
+		{"shared secret", secret, "192.168.1.11:4000", map[string]string{"X-Auth-Request-User": "alice", "X-Auth-Request-Secret": "s3cret"}, "alice", false},
+		{"shared secret mismatch", secret, "10.1.2.3:4000", map[string]string{"X-Auth-Request-User": "alice", "X-Auth-Request-Secret": "wrong"}, "", true},
+		{"shared secret missing", secret, "10.1.2.3:4000", map[string]string{"X-Auth-Request-User": "alice"}, "", true},
+		{"secret and trusted proxy", both, "10.1.2.3:4000", map[string]string{"X-Auth-Request-User": "alice", "X-Auth-Request-Secret": "s3cret"}, "alice", false},
+		{"secret from untrusted peer", both, "192.168.1.11:4000", map[string]string{"X-Auth-Request-User": "alice", "X-Auth-Request-Secret": "s3cret"}, "", true},
+		{"trusted proxy without secret", both, "10.1.2.3:4000", map[string]string{"X-Auth-Request-User": "alice"}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			if err := options.init(); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+
+			userInfo, err := trustedHeaderUser(req, &options)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			uid := ""
+			if userInfo != nil {
+				uid = userInfo.UserID
+			}
+			if uid != test.wantUser {
+				t.Fatalf("expected user %q, got %q", test.wantUser, uid)
+			}
+		})
+	}
+}
+
+func TestTrustedHeaderUserClaims(t *testing.T) {
+	options := TrustedHeaderOptions{TrustedProxies: []string{"10.0.0.0/8"}, GroupsHeader: "X-Groups"}
+	if err := options.init(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.Header.Set("X-Auth-Request-User", "alice")
+	req.Header.Set("X-Auth-Request-Email", "alice@example.com")
+	req.Header.Set("X-Groups", "admins, ,devs")
+
+	userInfo, err := trustedHeaderUser(req, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo.Email != "alice@example.com" || strings.Join(userInfo.Groups, ",") != "admins,devs" {
+		t.Fatalf("unexpected user %+v", userInfo)
+	}
+	if userInfo.Claims["auth"] != TrustedHeaderAuthScheme || userInfo.Claims["email"] != "alice@example.com" {
+		t.Fatalf("unexpected claims %v", userInfo.Claims)
+	}
+}
@@ -0,0 +1,109 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientAddress is client address of request resolved by clientAddressMiddleware
+type clientAddress struct {
+	ip string
+	// Request comes from trusted proxy, its X-Forwarded-* headers can be used
+	trustedProxy bool
+}
+
+// parseTrustedProxies parses networks of trusted proxies (CIDR or IP address)
+func parseTrustedProxies(proxies []string) (nets []*net.IPNet, err error) {
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, ipNet, parseErr := net.ParseCIDR(proxy)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, parseErr)
+		}
+		nets = append(nets, ipNet)
+	}
+	return
+}
+
+// trustedIP returns if IP address belongs to trusted networks
+func trustedIP(ip string, nets []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns IP address of connection peer
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// resolveClientAddress returns client address of request. X-Forwarded-For header is used only if the peer is
+// trusted proxy - the rightmost address which is not a trusted proxy is the client, addresses on the left are
+// set by the client and can be spoofed.
+func resolveClientAddress(r *http.Request, trustedNets []*net.IPNet) *clientAddress {
+	address := &clientAddress{ip: remoteIP(r)}
+	if !trustedIP(address.ip, trustedNets) {
+		return address
+	}
+	address.trustedProxy = true
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		address.ip = hop
+		if !trustedIP(hop, trustedNets) {
+			break
+		}
+	}
+	return address
+}
+
+// clientAddressMiddleware resolves client address of request, see ClientIP()
+func clientAddressMiddleware(trustedNets []*net.IPNet) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), contextTypeClientAddress, resolveClientAddress(r, trustedNets)))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns client IP address of request. X-Forwarded-For header is used only for requests from trusted
+// proxies (see SetTrustedProxies()), peer address of connection is returned otherwise.
+func ClientIP(r *http.Request) string {
+	if address, ok := r.Context().Value(contextTypeClientAddress).(*clientAddress); ok {
+		return address.ip
+	}
+	return remoteIP(r)
+}
+
+// fromTrustedProxy returns if request comes from trusted proxy, so its X-Forwarded-* headers can be used
+func fromTrustedProxy(r *http.Request) bool {
+	address, ok := r.Context().Value(contextTypeClientAddress).(*clientAddress)
+	return ok && address.trustedProxy
+}
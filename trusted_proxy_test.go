@@ -0,0 +1,43 @@
+package webservice
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientAddress(t *testing.T) {
+	trustedNets, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwarded    []string
+		ip           string
+		trustedProxy bool
+	}{
+		{"direct client", "203.0.113.1:1234", nil, "203.0.113.1", false},
+		{"spoofed header of direct client", "203.0.113.1:1234", []string{"198.51.100.1"}, "203.0.113.1", false},
+		{"trusted proxy", "10.0.0.1:1234", []string{"203.0.113.1"}, "203.0.113.1", true},
+		{"spoofed leftmost address", "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.1"}, "203.0.113.1", true},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.1, 192.0.2.10"}, "203.0.113.1", true},
+		{"multiple headers", "10.0.0.1:1234", []string{"198.51.100.1", "203.0.113.1"}, "203.0.113.1", true},
+		{"invalid hop", "10.0.0.1:1234", []string{"203.0.113.1, unknown, 10.0.0.2"}, "10.0.0.2", true},
+		{"only trusted proxies", "10.0.0.1:1234", []string{"10.0.0.2"}, "10.0.0.2", true},
+		{"proxy without header", "10.0.0.1:1234", nil, "10.0.0.1", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			for _, value := range test.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			address := resolveClientAddress(req, trustedNets)
+			if address.ip != test.ip || address.trustedProxy != test.trustedProxy {
+				t.Fatalf("expected %s (trusted proxy %v), got %s (%v)", test.ip, test.trustedProxy, address.ip, address.trustedProxy)
+			}
+		})
+	}
+}
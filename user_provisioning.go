@@ -0,0 +1,79 @@
+package webservice
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WebServiceAuthenticatedUserHandler is an interface to implement a callback OnAuthenticatedUser() called after
+// successful token validation - services can lazily create local user records. Callback is called once per user
+// within cache TTL (see SetUserProvisioningTTL()), error fails the request and callback is retried next time.
+type WebServiceAuthenticatedUserHandler interface {
+	OnAuthenticatedUser(ctx context.Context, userInfo *UserInfo) (err error)
+}
+
+// seenUsers remembers users already passed to provisioning callbacks
+type seenUsers struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	users     map[string]time.Time
+	lastPrune time.Time
+	handlers  []WebServiceAuthenticatedUserHandler
+}
+
+// provision calls provisioning callbacks for user not seen within ttl
+func (s *seenUsers) provision(ctx context.Context, userInfo *UserInfo) (err error) {
+	now := time.Now()
+	s.mutex.Lock()
+	if now.Sub(s.lastPrune) > s.ttl {
+		for userID, seen := range s.users {
+			if now.Sub(seen) > s.ttl {
+				delete(s.users, userID)
+			}
+		}
+		s.lastPrune = now
+	}
+	seen, found := s.users[userInfo.UserID]
+	s.mutex.Unlock()
+	if found && now.Sub(seen) <= s.ttl {
+		return
+	}
+
+	for _, handler := range s.handlers {
+		if err = handler.OnAuthenticatedUser(ctx, userInfo); err != nil {
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	s.users[userInfo.UserID] = now
+	s.mutex.Unlock()
+	return
+}
+
+// newSeenUsers returns provisioning cache for objects implementing WebServiceAuthenticatedUserHandler, nil is
+// returned if there is no such object
+func (s *webservice) newSeenUsers() *seenUsers {
+	var handlers []WebServiceAuthenticatedUserHandler
+	for _, obj := range s.objects() {
+		if handler, ok := obj.(WebServiceAuthenticatedUserHandler); ok {
+			handlers = append(handlers, handler)
+		}
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+	return &seenUsers{
+		ttl:      s.userProvisioningTTL,
+		users:    map[string]time.Time{},
+		handlers: handlers,
+	}
+}
+
+// Set how long authenticated user is remembered before OnAuthenticatedUser() is called again for the user
+func (s *webservice) SetUserProvisioningTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.userProvisioningTTL = ttl
+	}
+}
@@ -0,0 +1,153 @@
+package webservice
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// WatchdogOptions is a configuration container for watchdog of heap size, goroutine count and GC pauses
+type WatchdogOptions struct {
+	// Check interval, default is 10 seconds
+	Interval time.Duration
+	// Heap size (bytes of allocated heap objects) threshold, zero disables the check
+	MaxHeapBytes uint64
+	// Goroutine count threshold, zero disables the check
+	MaxGoroutines int
+	// Threshold of the longest GC pause since previous check, zero disables the check
+	MaxGCPause time.Duration
+	// Report not ready on /readyz while thresholds are exceeded
+	Unready bool
+	// Shut down gracefully with error returned from Start() (application exits to be restarted by supervisor)
+	// when thresholds are exceeded longer than given duration, zero disables restart
+	RestartAfter time.Duration
+}
+
+// WatchdogOptionsFromViper reads watchdog options (interval, max_heap like "512MB", max_goroutines, max_gc_pause,
+// unready, restart_after), nil is returned if it is not enabled
+func WatchdogOptionsFromViper(prefix string) *WatchdogOptions {
+	if !viper.GetBool(prefix + "enabled") {
+		return nil
+	}
+	return &WatchdogOptions{
+		Interval:      viper.GetDuration(prefix + "interval"),
+		MaxHeapBytes:  uint64(viper.GetSizeInBytes(prefix + "max_heap")),
+		MaxGoroutines: viper.GetInt(prefix + "max_goroutines"),
+		MaxGCPause:    viper.GetDuration(prefix + "max_gc_pause"),
+		Unready:       viper.GetBool(prefix + "unready"),
+		RestartAfter:  viper.GetDuration(prefix + "restart_after"),
+	}
+}
+
+// watchdog checks runtime statistics periodically
+type watchdog struct {
+	options   WatchdogOptions
+	logger    *logrus.Logger
+	unhealthy *int32
+	restart   func()
+	numGC     uint32
+	since     time.Time
+}
+
+// startWatchdog starts watchdog of the service, restart is called when service should be restarted. Returned
+// function stops the watchdog.
+func (s *webservice) startWatchdog(restart func()) (stop func()) {
+	wd := &watchdog{
+		options:   *s.watchdogOptions,
+		logger:    s.logger,
+		unhealthy: &s.watchdogUnhealthy,
+		restart:   restart,
+	}
+	if wd.options.Interval <= 0 {
+		wd.options.Interval = time.Second * 10
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	wd.numGC = stats.NumGC
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(wd.options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				wd.check(now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		atomic.StoreInt32(&s.watchdogUnhealthy, 0)
+	}
+}
+
+// check compares runtime statistics with thresholds
+func (wd *watchdog) check(now time.Time) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	goroutines := runtime.NumGoroutine()
+
+	// Pauses of GCs since previous check, runtime keeps last 256 of them
+	var maxPause time.Duration
+	gcs := stats.NumGC - wd.numGC
+	if gcs > uint32(len(stats.PauseNs)) {
+		gcs = uint32(len(stats.PauseNs))
+	}
+	for i := uint32(0); i < gcs; i++ {
+		pause := time.Duration(stats.PauseNs[(stats.NumGC-i+255)%256])
+		if pause > maxPause {
+			maxPause = pause
+		}
+	}
+	wd.numGC = stats.NumGC
+
+	var violations []string
+	if wd.options.MaxHeapBytes > 0 && stats.HeapAlloc > wd.options.MaxHeapBytes {
+		violations = append(violations, fmt.Sprintf("heap %d > %d bytes", stats.HeapAlloc, wd.options.MaxHeapBytes))
+	}
+	if wd.options.MaxGoroutines > 0 && goroutines > wd.options.MaxGoroutines {
+		violations = append(violations, fmt.Sprintf("goroutines %d > %d", goroutines, wd.options.MaxGoroutines))
+	}
+	if wd.options.MaxGCPause > 0 && maxPause > wd.options.MaxGCPause {
+		violations = append(violations, fmt.Sprintf("GC pause %s > %s", maxPause, wd.options.MaxGCPause))
+	}
+
+	fields := logrus.Fields{"heap_bytes": stats.HeapAlloc, "goroutines": goroutines, "gc_pause": maxPause.String()}
+	if len(violations) == 0 {
+		if !wd.since.IsZero() {
+			wd.since = time.Time{}
+			atomic.StoreInt32(wd.unhealthy, 0)
+			if wd.logger != nil {
+				wd.logger.WithFields(fields).Info("Watchdog thresholds are no longer exceeded")
+			}
+		}
+		return
+	}
+
+	if wd.since.IsZero() {
+		wd.since = now
+	}
+	if wd.options.Unready {
+		atomic.StoreInt32(wd.unhealthy, 1)
+	}
+	if wd.logger != nil {
+		wd.logger.WithFields(fields).WithField("violations", strings.Join(violations, ", ")).
+			WithField("exceeded_for", now.Sub(wd.since).Round(time.Second).String()).Warn("Watchdog thresholds are exceeded")
+	}
+	if wd.options.RestartAfter > 0 && now.Sub(wd.since) >= wd.options.RestartAfter {
+		if wd.logger != nil {
+			wd.logger.WithField("pid", os.Getpid()).Error("Watchdog restarts the service")
+		}
+		wd.restart()
+		wd.since = now
+	}
+}
@@ -0,0 +1,202 @@
+package webservice
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWebhookBodySize is max size of webhook payload
+const maxWebhookBodySize = 5 << 20
+
+// WebhookVerifier verifies signature of inbound webhook
+type WebhookVerifier interface {
+	Verify(r *http.Request, payload []byte) (err error)
+}
+
+// webhookDeliveryObserver is verifier notified about result of handler of verified payload
+type webhookDeliveryObserver interface {
+	Delivered(r *http.Request, payload []byte, err error)
+}
+
+// WebhookHandlerFn is handler of verified webhook payload
+type WebhookHandlerFn func(w http.ResponseWriter, r *http.Request, payload []byte) (err error)
+
+// WebhookHandler creates handler that reads and verifies webhook payload before fn is called.
+// Webhooks are not authorized with user token, so handler allows anonymous access.
+func WebhookHandler(verifier WebhookVerifier, fn WebhookHandlerFn) Handler {
+	return AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize+1))
+		if err != nil {
+			return ServerError(err, http.StatusBadRequest, "Unable to read webhook payload")
+		}
+		if len(payload) > maxWebhookBodySize {
+			return ServerError(nil, http.StatusRequestEntityTooLarge, "Webhook payload too large")
+		}
+		if err = verifier.Verify(r, payload); err != nil {
+			return ServerError(err, http.StatusUnauthorized, "Invalid webhook signature")
+		}
+		err = fn(w, r, payload)
+		if observer, ok := verifier.(webhookDeliveryObserver); ok {
+			observer.Delivered(r, payload, err)
+		}
+		return err
+	}).AllowAnonymous()
+}
+
+// defaultTimestampTolerance is max age of signed timestamp if tolerance is not set
+const defaultTimestampTolerance = 5 * time.Minute
+
+// timestampTolerance returns tolerance with zero value replaced by default
+func timestampTolerance(tolerance time.Duration) time.Duration {
+	if tolerance == 0 {
+		return defaultTimestampTolerance
+	}
+	return tolerance
+}
+
+// checkTimestamp checks that timestamp is within tolerance (to prevent replays), timestamps are always rejected
+// with invalid (negative) tolerance
+func checkTimestamp(timestamp string, tolerance time.Duration) (err error) {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if tolerance <= 0 {
+		return fmt.Errorf("invalid timestamp tolerance %v", tolerance)
+	}
+	diff := time.Since(time.Unix(ts, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > tolerance {
+		return fmt.Errorf("timestamp is outside of tolerance %v", tolerance)
+	}
+	return
+}
+
+// computeHMAC returns hex encoded HMAC of message parts
+func computeHMAC(h func() hash.Hash, secret []byte, parts ...[]byte) string {
+	mac := hmac.New(h, secret)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// equalSignature compares signatures in constant time
+func equalSignature(expected string, actual string) bool {
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(actual)))
+}
+
+// gitHubWebhookVerifier verifies X-Hub-Signature-256 (or legacy X-Hub-Signature) header
+type gitHubWebhookVerifier struct {
+	secret []byte
+}
+
+// GitHubWebhookVerifier creates verifier of GitHub webhooks. GitHub does not sign delivery time,
+// use nonce cache with X-GitHub-Delivery to prevent replays.
+func GitHubWebhookVerifier(secret string) WebhookVerifier {
+	return &gitHubWebhookVerifier{secret: []byte(secret)}
+}
+
+// Verify implements WebhookVerifier
+func (v *gitHubWebhookVerifier) Verify(r *http.Request, payload []byte) (err error) {
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		if !equalSignature("sha256="+computeHMAC(sha256.New, v.secret, payload), signature) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return
+	}
+	if signature := r.Header.Get("X-Hub-Signature"); signature != "" {
+		if !equalSignature("sha1="+computeHMAC(sha1.New, v.secret, payload), signature) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return
+	}
+	return fmt.Errorf("signature header is missing")
+}
+
+// stripeWebhookVerifier verifies Stripe-Signature header
+type stripeWebhookVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+}
+
+// StripeWebhookVerifier creates verifier of Stripe webhooks. Tolerance is max age of the event, zero means
+// 5 minutes (Stripe default). Negative tolerance is invalid and all events are rejected.
+func StripeWebhookVerifier(secret string, tolerance time.Duration) WebhookVerifier {
+	return &stripeWebhookVerifier{secret: []byte(secret), tolerance: timestampTolerance(tolerance)}
+}
+
+// Verify implements WebhookVerifier
+func (v *stripeWebhookVerifier) Verify(r *http.Request, payload []byte) (err error) {
+	header := r.Header.Get("Stripe-Signature")
+	if header == "" {
+		return fmt.Errorf("signature header is missing")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, item := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	if err = checkTimestamp(timestamp, v.tolerance); err != nil {
+		return
+	}
+
+	expected := computeHMAC(sha256.New, v.secret, []byte(timestamp), []byte("."), payload)
+	for _, signature := range signatures {
+		if equalSignature(expected, signature) {
+			return
+		}
+	}
+	return fmt.Errorf("signature mismatch")
+}
+
+// slackWebhookVerifier verifies X-Slack-Signature header
+type slackWebhookVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+}
+
+// SlackWebhookVerifier creates verifier of Slack requests. Tolerance is max age of the request, zero means 5 minutes
+// (Slack recommendation). Negative tolerance is invalid and all requests are rejected.
+func SlackWebhookVerifier(signingSecret string, tolerance time.Duration) WebhookVerifier {
+	return &slackWebhookVerifier{secret: []byte(signingSecret), tolerance: timestampTolerance(tolerance)}
+}
+
+// Verify implements WebhookVerifier
+func (v *slackWebhookVerifier) Verify(r *http.Request, payload []byte) (err error) {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	signature := r.Header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("signature header is missing")
+	}
+	if err = checkTimestamp(timestamp, v.tolerance); err != nil {
+		return
+	}
+	expected := "v0=" + computeHMAC(sha256.New, v.secret, []byte("v0:"+timestamp+":"), payload)
+	if !equalSignature(expected, signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return
+}
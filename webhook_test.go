@@ -0,0 +1,70 @@
+package webservice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookVerifiers(t *testing.T) {
+	const secret = "secret"
+	payload := []byte(`{"event":"test"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	stripeHeader := func(timestamp string, key string) http.Header {
+		return http.Header{"Stripe-Signature": {"t=" + timestamp + ",v1=" + computeHMAC(sha256.New, []byte(key), []byte(timestamp), []byte("."), payload)}}
+	}
+	slackHeader := func(timestamp string, key string) http.Header {
+		return http.Header{
+			"X-Slack-Request-Timestamp": {timestamp},
+			"X-Slack-Signature":         {"v0=" + computeHMAC(sha256.New, []byte(key), []byte("v0:"+timestamp+":"), payload)},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		verifier   WebhookVerifier
+		header     http.Header
+		payload    []byte
+		wantStatus int
+	}{
+		{"github valid", GitHubWebhookVerifier(secret), http.Header{"X-Hub-Signature-256": {"sha256=" + computeHMAC(sha256.New, []byte(secret), payload)}}, payload, http.StatusOK},
+		{"github wrong signature", GitHubWebhookVerifier(secret), http.Header{"X-Hub-Signature-256": {"sha256=" + computeHMAC(sha256.New, []byte("other"), payload)}}, payload, http.StatusUnauthorized},
+		{"github missing header", GitHubWebhookVerifier(secret), http.Header{}, payload, http.StatusUnauthorized},
+		{"github oversize payload", GitHubWebhookVerifier(secret), http.Header{}, make([]byte, maxWebhookBodySize+1), http.StatusRequestEntityTooLarge},
+
+		{"stripe valid", StripeWebhookVerifier(secret, 0), stripeHeader(now, secret), payload, http.StatusOK},
+		{"stripe wrong signature", StripeWebhookVerifier(secret, 0), stripeHeader(now, "other"), payload, http.StatusUnauthorized},
+		{"stripe stale timestamp", StripeWebhookVerifier(secret, 0), stripeHeader(stale, secret), payload, http.StatusUnauthorized},
+		{"stripe negative tolerance", StripeWebhookVerifier(secret, -time.Minute), stripeHeader(now, secret), payload, http.StatusUnauthorized},
+		{"stripe missing header", StripeWebhookVerifier(secret, 0), http.Header{}, payload, http.StatusUnauthorized},
+		{"stripe oversize payload", StripeWebhookVerifier(secret, 0), stripeHeader(now, secret), make([]byte, maxWebhookBodySize+1), http.StatusRequestEntityTooLarge},
+
+		{"slack valid", SlackWebhookVerifier(secret, 0), slackHeader(now, secret), payload, http.StatusOK},
+		{"slack wrong signature", SlackWebhookVerifier(secret, 0), slackHeader(now, "other"), payload, http.StatusUnauthorized},
+		{"slack stale timestamp", SlackWebhookVerifier(secret, 0), slackHeader(stale, secret), payload, http.StatusUnauthorized},
+		{"slack negative tolerance", SlackWebhookVerifier(secret, -time.Minute), slackHeader(now, secret), payload, http.StatusUnauthorized},
+		{"slack missing header", SlackWebhookVerifier(secret, 0), http.Header{}, payload, http.StatusUnauthorized},
+		{"slack oversize payload", SlackWebhookVerifier(secret, 0), slackHeader(now, secret), make([]byte, maxWebhookBodySize+1), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := WebhookHandler(tt.verifier, func(w http.ResponseWriter, r *http.Request, payload []byte) error {
+				return nil
+			})
+			r := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(tt.payload))
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
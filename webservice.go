@@ -2,10 +2,13 @@ package webservice
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -24,6 +27,54 @@ type WebService interface {
 	SetLogger(logger *logrus.Logger)
 	EnablePrometheusMetrics(enable bool)
 	EnableAuthorization(options *AuthorizationOptions)
+	SetWarmupTimeout(timeout time.Duration)
+	OnEvent(stage LifecycleStage, hook LifecycleHook)
+	Register(components ...Component)
+	RewriteRedirects(enable bool)
+	SetRouter(router Router)
+	SetRouteMetrics(options map[string]*RouteMetricsOptions)
+	SetShutdownDelay(delay time.Duration)
+	EnableMirroring(options *MirrorOptions)
+	SetDevMode(enable bool)
+	EnableChaos(options *ChaosOptions)
+	EnableQuotas(options *QuotaOptions)
+	EnableJobs(options *JobOptions)
+	EventBus() *EventBus
+	EnableServiceDiscovery(options *ServiceDiscoveryOptions)
+	EnableDeadlines(enable bool, maxTimeout time.Duration)
+	EnableGeo(options *GeoOptions)
+	EnableBotDetection(options *BotOptions)
+	EnableTokenRefresh(options *TokenRefreshOptions)
+	EnableSelfCheck(options *SelfCheckOptions)
+	EnableStrictInput(options *StrictOptions)
+	Addr() string
+	StartAsync() (err error)
+	SetOperationalCacheTTL(ttl time.Duration)
+	Ready() <-chan struct{}
+	Done() <-chan struct{}
+	Wait() error
+	EnableCircuitBreaker(options *CircuitBreakerOptions)
+	EnableLoadShedding(options *QoSOptions)
+	EnableAdaptiveLimit(options *AdaptiveLimitOptions)
+	SetUserProvisioningTTL(ttl time.Duration)
+	EnableBruteForceProtection(options *BruteForceOptions)
+	EnableHTTP3(options *HTTP3Options)
+	EnableProxyProtocol(options *ProxyProtocolOptions)
+	SetTrustedProxies(proxies []string)
+	SetConnectionLimits(options *ConnectionOptions)
+	SetHeaderLimits(options *HeaderLimitOptions)
+	EnableTenants(options *TenantOptions)
+	EnableServiceManifest(options *ManifestOptions)
+	SetJSONOptions(options *JSONOptions)
+	EnableProfiling(options *ProfilingOptions)
+	EnableWatchdog(options *WatchdogOptions)
+	SetAPIDump(format string)
+	SetPrintConfig(settings map[string]interface{})
+	EnableRouteDiff(options *RouteDiffOptions)
+	Shutdown(ctx context.Context) error
+	SetShutdownTimeout(timeout time.Duration)
+	SetListenSocketMode(mode os.FileMode)
+	EnableRecorder(options *RecorderOptions)
 }
 
 // webservice ...
@@ -33,20 +84,78 @@ type webservice struct {
 	readTimeout             time.Duration
 	idleTimeout             time.Duration
 	listenAddress           string
+	listenSocketMode        os.FileMode
 	corsOptions             *cors.Options
 	stripPath               string
 	logger                  *logrus.Logger
 	enablePrometheusMetrics bool
 	authorizationOptions    *AuthorizationOptions
+	warmupTimeout           time.Duration
+	ready                   int32
+	lifecycle               lifecycle
+	components              []Component
+	mounts                  []*mountedObject
+	rewriteRedirects        bool
+	router                  Router
+	routeMetrics            map[string]*RouteMetricsOptions
+	shutdownDelay           time.Duration
+	mirrorOptions           *MirrorOptions
+	devMode                 bool
+	chaosOptions            *ChaosOptions
+	recorderOptions         *RecorderOptions
+	consoleIssuer           *TokenIssuer
+	quotaOptions            *QuotaOptions
+	deadlines               bool
+	maxRequestTimeout       time.Duration
+	geoOptions              *GeoOptions
+	botOptions              *BotOptions
+	selfCheckOptions        *SelfCheckOptions
+	strictOptions           *StrictOptions
+	addr                    atomic.Value
+	readyCh                 chan struct{}
+	operationalCacheTTL     time.Duration
+	circuitBreakerOptions   *CircuitBreakerOptions
+	qosOptions              *QoSOptions
+	adaptiveLimitOptions    *AdaptiveLimitOptions
+	userProvisioningTTL     time.Duration
+	bruteForceOptions       *BruteForceOptions
+	// done is closed when run started by StartAsync is finished, runErr is its result
+	done                 chan struct{}
+	runErr               error
+	eventBus             *EventBus
+	listener             net.Listener
+	http3Options         *HTTP3Options
+	http3Server          HTTP3Server
+	proxyProtocolOptions *ProxyProtocolOptions
+	trustedProxies       []string
+	connectionOptions    *ConnectionOptions
+	headerLimitOptions   *HeaderLimitOptions
+	tenantOptions        *TenantOptions
+	manifestOptions      *ManifestOptions
+	jsonOptions          *JSONOptions
+	profilingOptions     *ProfilingOptions
+	watchdogOptions      *WatchdogOptions
+	watchdogUnhealthy    int32
+	apiDumpFormat        string
+	printConfigSettings  map[string]interface{}
+	routeDiffOptions     *RouteDiffOptions
+	signals              []os.Signal
+	shutdownTimeout      time.Duration
+	// runMutex guards running flag and run channels, service can be started again after it is shut down
+	runMutex sync.Mutex
+	running  bool
+	// shutdownCh receives shutdown signals of current run, stoppedCh is closed when the run is finished
+	shutdownCh chan os.Signal
+	stoppedCh  chan struct{}
 }
 
 // WebserviceObject ...
 type WebserviceObject interface {
 }
 
-// New creates new web service
-func New(obj WebserviceObject) WebService {
-	return &webservice{
+// New creates new web service. Options can be used to mount additional service objects (see Mount()).
+func New(obj WebserviceObject, options ...Option) WebService {
+	s := &webservice{
 		obj:                     obj,
 		writeTimeout:            time.Second * 15,
 		readTimeout:             time.Second * 15,
@@ -57,7 +166,17 @@ func New(obj WebserviceObject) WebService {
 		logger:                  nil,
 		enablePrometheusMetrics: false,
 		authorizationOptions:    nil,
+		warmupTimeout:           time.Second * 60,
+		eventBus:                NewEventBus(),
+		readyCh:                 make(chan struct{}),
+		userProvisioningTTL:     time.Minute * 10,
+		signals:                 defaultSignals,
+		shutdownTimeout:         time.Second * 30,
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
 // ConfigureRouterHandler is an interface to implement to configure routing for web service
@@ -80,31 +199,189 @@ type WebServiceGetStatusHandler interface {
 	GetServerStatus() (status interface{})
 }
 
-// Start starts service
+// Start starts service and blocks until it is shut down. Startup errors (listener bind, components, warm-up)
+// are returned. Start returns after graceful shutdown is done, process exit is left to the caller - error is
+// returned if server failed, self-check failed or watchdog requested restart. ErrGeneratorModeDone is returned
+// when service ran in generator mode (--dump-api, --print-config).
 func (s *webservice) Start() (err error) {
+	err = s.StartAsync()
+	if err != nil {
+		return
+	}
+	return s.Wait()
+}
+
+// Shutdown requests graceful shutdown of running service (same as shutdown signal) and waits until it is finished or
+// context is done. Error of the run (e.g. failed self-check) is returned from Start(), nil is returned if service
+// is not running.
+func (s *webservice) Shutdown(ctx context.Context) error {
+	s.runMutex.Lock()
+	if !s.running {
+		s.runMutex.Unlock()
+		return nil
+	}
+	c, stopped := s.shutdownCh, s.stoppedCh
+	s.runMutex.Unlock()
+
+	select {
+	case c <- os.Interrupt:
+	default:
+		// Shutdown is requested already
+	}
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartAsync builds routes and binds listener - bind errors are returned to the caller immediately. Components,
+// warm-up and shutdown handling run in background, Ready() is closed when service accepts requests and Done()
+// when the run is finished (its error is returned by Wait()).
+// ErrGeneratorModeDone is returned in generator mode (--dump-api, --print-config), service does not listen.
+func (s *webservice) StartAsync() (err error) {
+
+	s.runMutex.Lock()
+	if s.running {
+		s.runMutex.Unlock()
+		return fmt.Errorf("service is already running")
+	}
+	s.running = true
+	select {
+	case <-s.readyCh:
+		// Ready channel of previous run is closed
+		s.readyCh = make(chan struct{})
+	default:
+	}
+	s.shutdownCh = make(chan os.Signal, 1)
+	s.stoppedCh = make(chan struct{})
+	c := s.shutdownCh
+	s.runMutex.Unlock()
+	defer func() {
+		if err != nil {
+			s.setRunning(false)
+		}
+	}()
+
+	// Printing of configuration is generator mode - nothing is started
+	if s.printConfigSettings != nil {
+		if err = printConfig(s.printConfigSettings, os.Stdout); err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).Errorf("unable to print configuration")
+			}
+			return
+		}
+		return ErrGeneratorModeDone
+	}
 
-	if beforeStart, ok := s.obj.(WebServiceBeforeStartHandler); ok {
-		err = beforeStart.BeforeStart()
+	if !s.wasEmitted(StageConfigLoaded) {
+		err = s.emit(context.Background(), &LifecycleEvent{Stage: StageConfigLoaded})
 		if err != nil {
 			return
 		}
 	}
 
+	addKubernetesMetadata(s.logger, s.enablePrometheusMetrics)
+
+	for _, obj := range s.objects() {
+		if beforeStart, ok := obj.(WebServiceBeforeStartHandler); ok {
+			err = beforeStart.BeforeStart()
+			if err != nil {
+				return
+			}
+		}
+	}
+
 	var handler http.Handler
 
 	router := mux.NewRouter()
 	if s.stripPath != "" && s.stripPath != "/" {
 		router = router.PathPrefix(s.stripPath).Subrouter()
 	}
+	router.Use(routeTemplateMiddleware)
+
+	if s.bruteForceOptions != nil && s.authorizationOptions != nil && !s.authorizationOptions.Disabled {
+		router.Use(newBruteForceProtection(s.bruteForceOptions, s.logger).Middleware)
+	}
+
+	if s.authorizationOptions != nil && !s.authorizationOptions.Disabled && len(s.authorizationOptions.Rules) > 0 {
+		router.Use(authorizationRulesMiddleware(s.authorizationOptions.Rules, s.stripPath, s.logger))
+	}
+	if s.authorizationOptions != nil && !s.authorizationOptions.Disabled && s.authorizationOptions.ExternalAuthorizer != nil {
+		router.Use(newExternalAuthorizer(s.authorizationOptions.ExternalAuthorizer, s.logger).Middleware)
+	}
+
+	// Load shedding runs first, so rejected requests are cheap. With both load shedding and adaptive limit,
+	// adaptive limit is enforced by priority classes.
+	var limiter *adaptiveLimiter
+	if s.adaptiveLimitOptions != nil {
+		limiter = newAdaptiveLimiter(s.adaptiveLimitOptions, s.logger)
+	}
+	if s.qosOptions != nil {
+		qosMw := newQoSMiddleware(s.qosOptions, s.logger)
+		if limiter != nil {
+			qosMw.limit = limiter.Limit
+			limiter.enforce = false
+		}
+		router.Use(qosMw.Middleware)
+	}
+	if limiter != nil {
+		router.Use(limiter.Middleware)
+	}
+
+	if s.circuitBreakerOptions != nil {
+		router.Use(newCircuitBreaker(s.circuitBreakerOptions, s.logger).Middleware)
+	}
+
+	if s.chaosOptions != nil {
+		if s.devMode {
+			if s.logger != nil {
+				s.logger.Warn("Fault injection (chaos) is enabled")
+			}
+			router.Use(newChaosMiddleware(s.chaosOptions, s.logger).Middleware)
+		} else if s.logger != nil {
+			s.logger.Warn("Fault injection (chaos) is ignored - it is available in dev mode only")
+		}
+	}
 
 	if getServerStatusHandler, ok := s.obj.(WebServiceGetStatusHandler); ok {
-		router.Handle("/status", AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
-			return json.NewEncoder(w).Encode(getServerStatusHandler.GetServerStatus())
-		}).AllowAnonymous()).Methods("GET")
+		router.Handle("/status", newMicroCache(s.operationalCacheTTL, AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+			return WriteJSON(w, r, MaskSecrets(getServerStatusHandler.GetServerStatus()))
+		}).AllowAnonymous())).Methods("GET")
 	} else {
-		router.Handle("/status", AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
-			return json.NewEncoder(w).Encode(NewServerStatus())
-		}).AllowAnonymous()).Methods("GET")
+		router.Handle("/status", newMicroCache(s.operationalCacheTTL, AppHandler(func(w http.ResponseWriter, r *http.Request, userInfo *UserInfo) error {
+			return WriteJSON(w, r, MaskSecrets(NewServerStatus()))
+		}).AllowAnonymous())).Methods("GET")
+	}
+
+	router.Handle("/healthz", AppHandler(s.healthzHandler).AllowAnonymous()).Methods("GET")
+	router.Handle("/readyz", AppHandler(s.readyzHandler).AllowAnonymous()).Methods("GET")
+	if s.manifestOptions != nil {
+		router.Handle(manifestPath, AppHandler(s.manifestHandler(router, s.manifestOptions)).AllowAnonymous()).Methods("GET")
+	}
+	var prof *profiler
+	if s.profilingOptions != nil {
+		prof = newProfiler(s.profilingOptions, s.logger)
+		prof.Routes(router)
+	}
+
+	if s.devMode {
+		if s.consoleIssuer, err = newConsoleTokenIssuer(); err != nil {
+			return
+		}
+		router.Handle("/debug/echo", AppHandler(debugEchoHandler).AllowAnonymous())
+		router.Handle("/console", AppHandler(consoleHandler).AllowAnonymous()).Methods("GET")
+		router.Handle("/console/token", AppHandler(s.consoleTokenHandler).AllowAnonymous()).Methods("POST")
+	}
+
+	// Mounted objects are registered before main object, so their prefixes take precedence
+	err = s.configureMounts(router)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WithError(err).Errorf("unable to start service")
+		}
+		return
 	}
 
 	if getHTTPHandler, ok := s.obj.(ConfigureRouterHandler); ok {
@@ -116,36 +393,198 @@ func (s *webservice) Start() (err error) {
 			return
 		}
 		if handler == nil {
+			err = fmt.Errorf("invalid handler returned in ConfigureRouter()")
 			if s.logger != nil {
-				s.logger.Fatal("invalid handler retured in ConfigureRouter()")
-			} else {
-				panic("invalid handler retured in ConfigureRouter()")
+				s.logger.WithError(err).Errorf("unable to start service")
 			}
+			return
 		}
 
 	} else {
 		handler = router
 	}
 
+	if configureRoutes, ok := s.obj.(ConfigureRoutesHandler); ok {
+		appRouter := s.router
+		if appRouter == nil {
+			// routeTemplateMiddleware is already used by router, NewMuxRouter would add it again
+			appRouter = &muxRouter{router: router}
+		}
+		err = configureRoutes.ConfigureRoutes(appRouter)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).Errorf("unable to start service")
+			}
+			return
+		}
+	}
+
+	err = s.configureComponents(router)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WithError(err).Errorf("unable to start service")
+		}
+		return
+	}
+
+	// Infrastructure routes registered below (metrics, custom router) are not part of the check
+	err = s.checkRouteAuthorization(router)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WithError(err).Errorf("unable to start service")
+		}
+		return
+	}
+
+	// Routes are compared with previous run
+	if s.routeDiffOptions != nil && s.apiDumpFormat == "" {
+		err = s.diffRoutes(router, s.routeDiffOptions)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).WithField("file", s.routeDiffOptions.File).Error("unable to compare routes with previous run")
+			}
+			err = nil
+		}
+	}
+
+	// API dump is generator mode - routes are printed and ErrGeneratorModeDone is returned without listening
+	if s.apiDumpFormat != "" {
+		err = s.dumpAPI(router, s.apiDumpFormat, os.Stdout)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).Errorf("unable to dump API")
+			}
+			return
+		}
+		return ErrGeneratorModeDone
+	}
+
 	// Prometheus metrics
 	if s.enablePrometheusMetrics {
-		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+		router.Handle("/metrics", newMicroCache(s.operationalCacheTTL, promhttp.Handler())).Methods("GET")
+	}
+
+	// Custom router serves all requests not matched by framework routes
+	if s.router != nil {
+		var appHandler http.Handler = s.router
+		if s.stripPath != "" && s.stripPath != "/" {
+			appHandler = http.StripPrefix(s.stripPath, appHandler)
+		}
+		router.PathPrefix("/").Handler(appHandler)
+	}
+
+	err = s.emit(context.Background(), &LifecycleEvent{Stage: StageRouterBuilt, Router: router})
+	if err != nil {
+		return
+	}
+
+	// Handler stage includes routing, AppHandler scope checks and response serialization
+	handler = s.timedStage("handler", noMiddleware, handler)
+
+	if s.enablePrometheusMetrics {
+		handler = newMetricsMiddleware(s.routeMetrics).Middleware(handler)
+	}
+
+	// Profiles are captured when handlers are slow or failing
+	if prof != nil {
+		handler = prof.Middleware(handler)
+	}
+
+	handler = externalURLMiddleware(s.stripPath, s.rewriteRedirects)(handler)
+
+	if s.mirrorOptions != nil {
+		var mirrorMw *mirror
+		mirrorMw, err = newMirrorMiddleware(s.mirrorOptions, s.logger)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).Errorf("unable to configure traffic mirroring")
+			}
+			return
+		}
+		handler = mirrorMw.Middleware(handler)
+	}
+
+	if s.recorderOptions != nil {
+		if s.devMode {
+			var rec *recorder
+			rec, err = newRecorder(s.recorderOptions, s.logger)
+			if err != nil {
+				if s.logger != nil {
+					s.logger.WithError(err).Errorf("unable to configure traffic recorder")
+				}
+				return
+			}
+			if s.logger != nil {
+				s.logger.WithField("dir", s.recorderOptions.Dir).Warn("Traffic recorder is enabled")
+			}
+			handler = rec.Middleware(handler)
+		} else if s.logger != nil {
+			s.logger.Warn("Traffic recorder is ignored - it is available in dev mode only")
+		}
 	}
 
 	if s.corsOptions != nil {
 		c := cors.New(*s.corsOptions)
-		handler = c.Handler(handler)
+		handler = s.timedStage("cors", c.Handler, handler)
+	}
+
+	// Quotas need user info - they have to be inside authorization middleware
+	if s.quotaOptions != nil {
+		handler = s.timedStage("quota", newQuotaMiddleware(s.quotaOptions, s.logger).Middleware, handler)
+	}
+
+	// Request deadline from X-Request-Timeout/grpc-timeout header
+	if s.deadlines {
+		handler = deadlineMiddleware(s.maxRequestTimeout)(handler)
 	}
 
 	// Add logger
 	if s.logger != nil {
-		handler = NewLoggingMiddleware(s.logger).Middleware(handler)
+		handler = s.timedStage("logging", NewLoggingMiddleware(s.logger).Middleware, handler)
+	}
+
+	// Tenant is resolved from user info before request is logged
+	if s.tenantOptions != nil {
+		handler = newTenantMiddleware(s.tenantOptions, s.logger).Middleware(handler)
+	}
+
+	// Strict input validation
+	if s.strictOptions != nil {
+		handler = strictInputMiddleware(s.strictOptions, s.logger)(handler)
+	}
+
+	// Enormous cookies and header floods are rejected with JSON 431
+	if headerLimits := s.headerLimits(); headerLimits != nil {
+		handler = headerLimitMiddleware(headerLimits, s.logger)(handler)
+	}
+
+	// Scanner traffic is tagged or blocked before it hits handlers
+	if s.botOptions != nil {
+		handler = newBotMiddleware(s.botOptions, s.logger).Middleware(handler)
+	}
+
+	// Geo info has to be resolved before request is logged
+	if s.geoOptions != nil {
+		err = s.geoOptions.Validate()
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).Errorf("unable to start service")
+			}
+			return
+		}
+		handler = s.timedStage("geo", newGeoMiddleware(s.geoOptions, s.logger).Middleware, handler)
 	}
 
 	// Authorization
 	if s.authorizationOptions != nil {
 		authMw := newAuthorizationMiddleware(s.authorizationOptions, s.logger)
-		handler = authMw.Middleware(handler)
+		authMw.seenUsers = s.newSeenUsers()
+		authMw.explain = s.devMode && s.authorizationOptions.ExplainDenials
+		if s.consoleIssuer != nil {
+			// Tokens minted by API console are accepted in dev mode
+			authMw.trustDevKeys(s.consoleIssuer.PublicKeys)
+		}
+		handler = s.timedStage("auth", authMw.Middleware, handler)
 		err = authMw.Validate()
 		if err != nil {
 			if s.logger != nil {
@@ -155,6 +594,35 @@ func (s *webservice) Start() (err error) {
 		}
 	}
 
+	handler = eventBusMiddleware(s.eventBus)(handler)
+
+	// JSON options are resolved before any middleware can respond with error
+	if s.jsonOptions != nil || s.devMode {
+		if s.jsonOptions != nil {
+			err = s.jsonOptions.Validate()
+			if err != nil {
+				if s.logger != nil {
+					s.logger.WithError(err).Errorf("unable to start service")
+				}
+				return
+			}
+		}
+		handler = jsonOptionsMiddleware(s.jsonOptions, s.devMode)(handler)
+	}
+
+	// Client address is resolved before any middleware can use it
+	trustedNets, err := parseTrustedProxies(s.trustedProxies)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WithError(err).Errorf("unable to start service")
+		}
+		return
+	}
+	handler = clientAddressMiddleware(trustedNets)(handler)
+
+	// Route template holder must wrap all middlewares reading route template
+	handler = routeHolderMiddleware(handler)
+
 	srv := &http.Server{
 		Addr: s.listenAddress,
 		// Good practice to set timeouts to avoid Slowloris attacks.
@@ -163,41 +631,204 @@ func (s *webservice) Start() (err error) {
 		IdleTimeout:  s.idleTimeout,
 		Handler:      handler,
 	}
+	if headerLimits := s.headerLimits(); headerLimits != nil {
+		srv.MaxHeaderBytes = headerLimits.serverMaxHeaderBytes()
+	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			if err != http.ErrServerClosed {
-				if s.logger != nil {
-					s.logger.Fatal(err)
-				} else {
-					panic(err)
-				}
+	listener := s.listener
+	if listener == nil {
+		listener, err = listen(srv.Addr, s.listenSocketMode)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).WithField("addr", srv.Addr).Errorf("unable to listen")
 			}
+			return
+		}
+	}
+
+	// PROXY protocol is read first, so per IP limits count clients instead of load balancer
+	if s.proxyProtocolOptions != nil {
+		wrapped, wrapErr := newProxyProtocolListener(listener, s.proxyProtocolOptions)
+		if wrapErr != nil {
+			listener.Close()
+			return wrapErr
+		}
+		listener = wrapped
+	}
+
+	if s.connectionOptions != nil {
+		srv.SetKeepAlivesEnabled(!s.connectionOptions.DisableKeepAlives)
+		if s.connectionOptions.MaxConnections > 0 || s.connectionOptions.MaxConnectionsPerIP > 0 {
+			listener = newLimitListener(listener, s.connectionOptions)
 		}
+	}
+
+	// Actual address differs from configured one for port 0
+	srv.Addr = listener.Addr().String()
+	if listener.Addr().Network() == "unix" {
+		srv.Addr = unixSocketPrefix + srv.Addr
+	}
+	s.addr.Store(srv.Addr)
+	if s.logger != nil {
+		s.logger.WithField("addr", srv.Addr).WithField("listen_address", s.listenAddress).Print("Listening")
+	}
+
+	serveErr := make(chan error, 2)
+	if s.http3Options != nil {
+		s.http3Server, err = newHTTP3Server(s.http3Options, srv.Addr, srv.Handler)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.WithError(err).Errorf("unable to create HTTP/3 server")
+			}
+			listener.Close()
+			return
+		}
+		srv.Handler = altSvcMiddleware(s.http3Server, srv.Handler)
+		go func(server HTTP3Server) {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serveErr <- fmt.Errorf("HTTP/3: %w", err)
+			}
+		}(s.http3Server)
+		if s.logger != nil {
+			s.logger.Warn("Experimental HTTP/3 support is enabled")
+		}
+	}
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+
+	// Graceful shutdown on SIGINT (Ctrl+C) and SIGTERM by default, see WithSignals()
+	if len(s.signals) > 0 {
+		signal.Notify(c, s.signals...)
+	}
+
+	done := make(chan struct{})
+	s.runMutex.Lock()
+	s.done, s.runErr = done, nil
+	s.runMutex.Unlock()
+	go func() {
+		err := s.run(srv, router, c, serveErr)
+		s.runMutex.Lock()
+		if s.done == done {
+			s.runErr = err
+		}
+		s.runMutex.Unlock()
+		close(done)
 	}()
+	return
+}
+
+// run starts components and warm-up, then serves requests until shutdown signal
+func (s *webservice) run(srv *http.Server, router *mux.Router, c chan os.Signal, serveErr chan error) (err error) {
+	defer func() {
+		s.closeHTTP3()
+		signal.Stop(c)
+		s.setRunning(false)
+	}()
+
+	// Components context is cancelled when service shuts down
+	componentsCtx, componentsCancel := context.WithCancel(ContextWithEventBus(context.Background(), s.eventBus))
+	defer componentsCancel()
+
+	err = s.startComponents(componentsCtx)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WithError(err).Errorf("unable to start service")
+		}
+		srv.Close()
+		return
+	}
 
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+	err = s.warmup()
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WithError(err).Errorf("warm-up failed")
+		}
+		srv.Close()
+		s.stopComponents(context.Background(), s.components)
+		return
+	}
+	err = s.emit(context.Background(), &LifecycleEvent{Stage: StageListenerReady, Router: router, Addr: srv.Addr})
+	if err != nil {
+		srv.Close()
+		s.stopComponents(context.Background(), s.components)
+		return
+	}
+	s.setReady(true)
+	s.runMutex.Lock()
+	close(s.readyCh)
+	s.runMutex.Unlock()
 
 	if s.logger != nil {
 		s.logger.WithField("addr", srv.Addr).Print("Service is ready for requests")
 	}
 
+	// Self-check result is sent instead of shutdown signal
+	selfCheckDone := make(chan error, 1)
+	if s.selfCheckOptions != nil {
+		go func() {
+			err := s.selfCheck(srv.Addr)
+			if err != nil {
+				if s.logger != nil {
+					s.logger.WithError(err).Error("Self-check failed")
+				}
+				err = fmt.Errorf("self-check failed: %w", err)
+			}
+			selfCheckDone <- err
+		}()
+	}
+
+	// Watchdog requests restart by graceful shutdown with error returned from Start()
+	var restart int32
+	if s.watchdogOptions != nil {
+		stopWatchdog := s.startWatchdog(func() {
+			atomic.StoreInt32(&restart, 1)
+			select {
+			case c <- os.Interrupt:
+			default:
+			}
+		})
+		defer stopWatchdog()
+	}
+
 	// Block until we receive our signal.
-	<-c
+	select {
+	case <-c:
+	case err = <-selfCheckDone:
+	case err = <-serveErr:
+		if s.logger != nil {
+			s.logger.WithError(err).Error("Server failed")
+		}
+	}
+	if atomic.LoadInt32(&restart) == 1 && err == nil {
+		err = fmt.Errorf("watchdog thresholds exceeded, service has to be restarted")
+	}
 
 	if s.logger != nil {
 		s.logger.Print("Received request for shutdown")
 	}
+	s.setReady(false)
+	s.emit(context.Background(), &LifecycleEvent{Stage: StageShutdownStarted, Router: router, Addr: srv.Addr})
 
-	if beforeEnd, ok := s.obj.(WebServiceBeforeEndHandler); ok {
-		beforeEnd.BeforeEnd()
+	// /readyz reports not ready, but requests are still served until load balancers stop routing traffic
+	if s.shutdownDelay > 0 && s.selfCheckOptions == nil {
+		if s.logger != nil {
+			s.logger.WithField("delay", s.shutdownDelay.String()).Print("Waiting before shutdown")
+		}
+		time.Sleep(s.shutdownDelay)
+	}
+
+	for _, obj := range s.objects() {
+		if beforeEnd, ok := obj.(WebServiceBeforeEndHandler); ok {
+			beforeEnd.BeforeEnd()
+		}
 	}
 
 	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
@@ -206,11 +837,12 @@ func (s *webservice) Start() (err error) {
 	// <-ctx.Done() if your application should wait for other services
 	// to finalize based on context cancellation.
 
+	componentsCancel()
+	s.stopComponents(ctx, s.components)
+
 	if s.logger != nil {
 		s.logger.Println("Shutting down")
 	}
-
-	os.Exit(0)
 	return
 }
 
@@ -228,11 +860,16 @@ func (s *webservice) SetTimeouts(writeTimeout time.Duration, readTimeout time.Du
 	}
 }
 
-// Set listen address - default value is ":8080"
+// Set listen address - default value is ":8080", Unix domain socket is set as unix:///var/run/app.sock
 func (s *webservice) SetListenAddress(listenAddress string) {
 	s.listenAddress = listenAddress
 }
 
+// Set permissions of Unix domain socket (listen address unix:///path) - zero keeps permissions given by umask
+func (s *webservice) SetListenSocketMode(mode os.FileMode) {
+	s.listenSocketMode = mode
+}
+
 // Enable CORS
 func (s *webservice) EnableCors(options *cors.Options) {
 	s.corsOptions = options
@@ -243,8 +880,20 @@ func (s *webservice) StripPath(path string) {
 	s.stripPath = path
 }
 
+// Rewrite root-relative Location headers of responses to include external prefix (X-Forwarded-Prefix + strip path)
+func (s *webservice) RewriteRedirects(enable bool) {
+	s.rewriteRedirects = enable
+}
+
+// Set router for application routes (see NewServeMuxRouter(), NewChiRouter()). Default is gorilla/mux.
+// Routes are configured by ConfigureRoutes() of service object.
+func (s *webservice) SetRouter(router Router) {
+	s.router = router
+}
+
 // Configure logger
 func (s *webservice) SetLogger(logger *logrus.Logger) {
+	addMaskingHook(logger)
 	s.logger = logger
 }
 
@@ -253,6 +902,245 @@ func (s *webservice) EnablePrometheusMetrics(enable bool) {
 	s.enablePrometheusMetrics = enable
 }
 
+// Set per-route metrics options (histogram buckets, latency objective) - key is route template (e.g. /users/{id})
+func (s *webservice) SetRouteMetrics(options map[string]*RouteMetricsOptions) {
+	s.routeMetrics = options
+}
+
+// Set delay between shutdown request and server shutdown. During the delay /readyz returns 503,
+// but requests are still served - so Kubernetes endpoints can be updated before connections are refused.
+func (s *webservice) SetShutdownDelay(delay time.Duration) {
+	s.shutdownDelay = delay
+}
+
+// Set max duration of graceful shutdown, it doesn't include shutdown delay. Zero keeps the default (30 seconds).
+func (s *webservice) SetShutdownTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// Enable traffic mirroring to shadow upstream - nil disables mirroring
+func (s *webservice) EnableMirroring(options *MirrorOptions) {
+	s.mirrorOptions = options
+}
+
+// Enable dev mode - development only features (e.g. fault injection, traffic recorder, API console at /console) are available
+func (s *webservice) SetDevMode(enable bool) {
+	s.devMode = enable
+}
+
+// Enable fault injection (artificial latency and errors) - it is applied only in dev mode
+func (s *webservice) EnableChaos(options *ChaosOptions) {
+	s.chaosOptions = options
+}
+
+// Enable recording of request/response pairs into HAR files or OpenAPI examples - it is applied only in dev mode
+func (s *webservice) EnableRecorder(options *RecorderOptions) {
+	s.recorderOptions = options
+}
+
+// Enable daily/monthly request quotas per user or API key - nil disables quotas
+func (s *webservice) EnableQuotas(options *QuotaOptions) {
+	s.quotaOptions = options
+}
+
+// Enable asynchronous jobs - handlers can use AcceptJob() and clients poll /jobs/{id}
+func (s *webservice) EnableJobs(options *JobOptions) {
+	if options != nil {
+		s.Register(newJobManager(options))
+	}
+}
+
+// Enable self-registration in service discovery (Consul, etcd) - service is registered when listener is ready
+// and deregistered when shutdown starts
+func (s *webservice) EnableServiceDiscovery(options *ServiceDiscoveryOptions) {
+	if options != nil && options.Registry != nil {
+		s.enableServiceDiscovery(options)
+	}
+}
+
+// Enable per-request deadlines - X-Request-Timeout or grpc-timeout header sets context deadline, maxTimeout caps
+// it (zero means no cap). Use NewHTTPClient() to propagate remaining budget to outbound calls.
+func (s *webservice) EnableDeadlines(enable bool, maxTimeout time.Duration) {
+	s.deadlines = enable
+	s.maxRequestTimeout = maxTimeout
+}
+
+// Enable client IP geo/ASN enrichment - resolved info is available by GeoInfoFromContext() and in logs
+func (s *webservice) EnableGeo(options *GeoOptions) {
+	s.geoOptions = options
+}
+
+// Enable bot and scanner detection - detected requests are logged, counted in http_bot_requests_total and
+// optionally blocked
+func (s *webservice) EnableBotDetection(options *BotOptions) {
+	s.botOptions = options
+}
+
+// Enable refresh token proxy endpoint (/auth/refresh) - refresh tokens are exchanged at identity provider with
+// client secret kept on the server
+func (s *webservice) EnableTokenRefresh(options *TokenRefreshOptions) {
+	if options != nil {
+		s.Register(newTokenRefresher(options))
+	}
+}
+
+// Enable strict input validation - malformed query, query parameters not declared by AllowQueryParams() and
+// unsupported Content-Types on AppHandler endpoints are rejected. Headers over 8 KiB are rejected unless header
+// limits are set (see SetHeaderLimits).
+func (s *webservice) EnableStrictInput(options *StrictOptions) {
+	s.strictOptions = options
+}
+
+// Set how long responses of /status and /metrics are cached, zero disables caching
+func (s *webservice) SetOperationalCacheTTL(ttl time.Duration) {
+	s.operationalCacheTTL = ttl
+}
+
+// Enable per-route circuit breaker - after consecutive 5xx responses route returns 503 with Retry-After until
+// probe request succeeds
+func (s *webservice) EnableCircuitBreaker(options *CircuitBreakerOptions) {
+	s.circuitBreakerOptions = options
+}
+
+// Enable load shedding by route priority classes - background requests are rejected first under load, critical
+// ones (health checks) are never rejected
+func (s *webservice) EnableLoadShedding(options *QoSOptions) {
+	s.qosOptions = options
+}
+
+// Enable adaptive concurrency limit - limit of in-flight requests follows observed latency
+func (s *webservice) EnableAdaptiveLimit(options *AdaptiveLimitOptions) {
+	s.adaptiveLimitOptions = options
+}
+
+// Enable experimental HTTP/3 listener alongside TCP listener, nil disables it
+func (s *webservice) EnableHTTP3(options *HTTP3Options) {
+	s.http3Options = options
+}
+
+// Enable PROXY protocol (v1 and v2) on the listener - client address is taken from PROXY header, nil disables it
+func (s *webservice) EnableProxyProtocol(options *ProxyProtocolOptions) {
+	s.proxyProtocolOptions = options
+}
+
+// Set networks of reverse proxies (CIDR or IP address) whose X-Forwarded-* headers are trusted - client IP address
+// (ClientIP()) is the rightmost X-Forwarded-For address which is not a trusted proxy
+func (s *webservice) SetTrustedProxies(proxies []string) {
+	s.trustedProxies = proxies
+}
+
+// Set keep-alive and connection limits of the listener, nil means no limits
+func (s *webservice) SetConnectionLimits(options *ConnectionOptions) {
+	s.connectionOptions = options
+}
+
+// Set request header limits, nil means no limits (except 1 MB limit of http.Server)
+func (s *webservice) SetHeaderLimits(options *HeaderLimitOptions) {
+	s.headerLimitOptions = options
+}
+
+// Enable tenant resolution - tenant is added to logs and optionally to per-tenant metrics, nil disables it
+func (s *webservice) EnableTenants(options *TenantOptions) {
+	s.tenantOptions = options
+}
+
+// Enable self-describing manifest at /.well-known/service-manifest (name, version, build, API versions, scopes of
+// route groups and health endpoints), nil disables it
+func (s *webservice) EnableServiceManifest(options *ManifestOptions) {
+	s.manifestOptions = options
+}
+
+// Set encoder, field naming and pretty printing of JSON responses, nil means encoding/json with struct tags
+func (s *webservice) SetJSONOptions(options *JSONOptions) {
+	s.jsonOptions = options
+}
+
+// Enable capture of profiles when latency or error thresholds are exceeded, nil disables it
+func (s *webservice) EnableProfiling(options *ProfilingOptions) {
+	s.profilingOptions = options
+}
+
+// Enable watchdog of heap size, goroutine count and GC pauses, nil disables it
+func (s *webservice) EnableWatchdog(options *WatchdogOptions) {
+	s.watchdogOptions = options
+}
+
+// Set API dump format (markdown or json) - service prints its routes with authorization requirements to stdout
+// and exits instead of starting, empty disables it
+func (s *webservice) SetAPIDump(format string) {
+	s.apiDumpFormat = format
+}
+
+// Set configuration settings printed with masked secrets to stdout instead of starting (--print-config), nil
+// disables it
+func (s *webservice) SetPrintConfig(settings map[string]interface{}) {
+	s.printConfigSettings = settings
+}
+
+// Enable logging of routes added, removed or changed since previous run (or committed manifest), nil disables it
+func (s *webservice) EnableRouteDiff(options *RouteDiffOptions) {
+	s.routeDiffOptions = options
+}
+
+// Enable blocking of clients (IP addresses and users) after repeated 401/403 responses, nil disables it
+func (s *webservice) EnableBruteForceProtection(options *BruteForceOptions) {
+	s.bruteForceOptions = options
+}
+
+// Ready returns channel closed when service is ready for requests (listener is bound, components are started
+// and warm-up is done)
+func (s *webservice) Ready() <-chan struct{} {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	return s.readyCh
+}
+
+// Done returns channel closed when service started by StartAsync stopped - after shutdown or when starting of
+// components, warm-up or listener ready hooks failed (Ready() is not closed then). Result is returned by Wait().
+// Closed channel is returned if service was not started.
+func (s *webservice) Done() <-chan struct{} {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	if s.done == nil {
+		s.done = make(chan struct{})
+		close(s.done)
+	}
+	return s.done
+}
+
+// Wait blocks until service started by StartAsync stops and returns error of the run (same as Start)
+func (s *webservice) Wait() error {
+	<-s.Done()
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	return s.runErr
+}
+
+// setRunning marks service as running or stopped
+func (s *webservice) setRunning(running bool) {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	s.running = running
+	if !running && s.stoppedCh != nil {
+		close(s.stoppedCh)
+		s.stoppedCh = nil
+	}
+}
+
+// Addr returns actual address of the listener (e.g. with port assigned for listen address ":0"). Empty string is
+// returned before the listener is bound.
+func (s *webservice) Addr() string {
+	addr, _ := s.addr.Load().(string)
+	return addr
+}
+
+// EventBus returns in-process event bus of the service
+func (s *webservice) EventBus() *EventBus {
+	return s.eventBus
+}
+
 // Enable authorization - for more details check authorization.Options struct
 func (s *webservice) EnableAuthorization(options *AuthorizationOptions) {
 	s.authorizationOptions = options
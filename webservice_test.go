@@ -0,0 +1,154 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+type testService struct {
+	handler http.Handler
+}
+
+func (t *testService) ConfigureRouter(router *mux.Router) (http.Handler, error) {
+	return t.handler, nil
+}
+
+func newTestService(handler http.Handler) WebService {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	svc := New(&testService{handler: handler})
+	svc.SetListenAddress("127.0.0.1:0")
+	svc.SetLogger(logger)
+	return svc
+}
+
+func TestStartAsyncReturnsErrorsInsteadOfExit(t *testing.T) {
+	svc := newTestService(nil)
+	if err := svc.StartAsync(); err == nil || errors.Is(err, ErrGeneratorModeDone) {
+		t.Fatalf("expected error for nil handler, got %v", err)
+	}
+
+	svc = newTestService(http.NotFoundHandler())
+	svc.SetAPIDump(APIDumpJSON)
+	if err := svc.Start(); !errors.Is(err, ErrGeneratorModeDone) {
+		t.Fatalf("expected ErrGeneratorModeDone, got %v", err)
+	}
+
+	svc = newTestService(http.NotFoundHandler())
+	svc.SetPrintConfig(map[string]interface{}{"unsupported": make(chan int)})
+	if err := svc.Start(); err == nil || errors.Is(err, ErrGeneratorModeDone) {
+		t.Fatalf("expected error of printing configuration, got %v", err)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     string
+		wantErr  bool
+	}{
+		{"plain value", map[string]interface{}{"listen_address": ":8080"}, `"listen_address": ":8080"`, false},
+		{"masked secret", map[string]interface{}{"db": map[string]interface{}{"password": "secret"}}, `"password": "` + maskedValue + `"`, false},
+		{"unsupported value", map[string]interface{}{"unsupported": make(chan int)}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := printConfig(tt.settings, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Fatalf("unexpected output %s", out.String())
+			}
+		})
+	}
+}
+
+func TestShutdownDuringSelfCheck(t *testing.T) {
+	svc := newTestService(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 50)
+	}))
+	svc.EnableSelfCheck(&SelfCheckOptions{Timeout: time.Second})
+	if err := svc.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+	<-svc.Ready()
+	if err := svc.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingComponent is component which fails to start
+type failingComponent struct{}
+
+func (failingComponent) Name() string                         { return "failing" }
+func (failingComponent) Configure(config *viper.Viper) error  { return nil }
+func (failingComponent) Routes(router *mux.Router) error      { return nil }
+func (failingComponent) Start(ctx context.Context) error      { return errors.New("component failed") }
+func (failingComponent) Stop(ctx context.Context) (err error) { return nil }
+
+// failingWarmupService is service with failing warm-up
+type failingWarmupService struct {
+	testService
+}
+
+func (s *failingWarmupService) Warmup(ctx context.Context) error {
+	return errors.New("warm-up failed")
+}
+
+func TestWaitReturnsStartupError(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func() WebService
+	}{
+		{"component", func() WebService {
+			svc := newTestService(http.NotFoundHandler())
+			svc.Register(failingComponent{})
+			return svc
+		}},
+		{"warm-up", func() WebService {
+			svc := New(&failingWarmupService{testService{handler: http.NotFoundHandler()}})
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			svc.SetLogger(logger)
+			svc.SetListenAddress("127.0.0.1:0")
+			return svc
+		}},
+		{"listener ready hook", func() WebService {
+			svc := newTestService(http.NotFoundHandler())
+			svc.OnEvent(StageListenerReady, func(ctx context.Context, event *LifecycleEvent) error {
+				return errors.New("registration failed")
+			})
+			return svc
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := tt.setup()
+			if err := svc.StartAsync(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-svc.Ready():
+				t.Fatal("service is ready")
+			case <-svc.Done():
+			case <-time.After(time.Second * 5):
+				t.Fatal("Done() was not closed")
+			}
+			if err := svc.Wait(); err == nil {
+				t.Fatal("expected error of the run")
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+// Package webservicetest contains helpers for integration tests of services built on webservice.
+package webservicetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beanox/webservice"
+)
+
+// RecordedRequest is request received by mock upstream
+type RecordedRequest struct {
+	Method string
+	// Host requested by client (original host when request was routed by Transport)
+	Host   string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+	// Matched is false if no mock route matched the request (it got 501 response)
+	Matched bool
+}
+
+// MockResponse is scripted response of mock route
+type MockResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Latency before response is written, request context cancellation is respected
+	Latency time.Duration
+	// Fail closes connection without response, client gets network error
+	Fail bool
+}
+
+// MockRoute is route of mock upstream with script of responses. Responses are returned in order of script and the
+// last one is repeated. Route without responses returns empty 200 response.
+type MockRoute struct {
+	upstream  *MockUpstream
+	method    string
+	path      string
+	responses []*MockResponse
+	calls     int
+}
+
+// MockUpstream is HTTP server standing in for upstream of tested service (reverse proxy target, REST API called
+// by service). It records requests and returns scripted responses with latency and error injection. Server is
+// closed by test cleanup.
+type MockUpstream struct {
+	// Base URL of mock server, e.g. target of webservice.ProxyHandler
+	URL      string
+	server   *httptest.Server
+	t        testing.TB
+	mutex    sync.Mutex
+	routes   []*MockRoute
+	requests []RecordedRequest
+}
+
+// NewMockUpstream starts mock upstream server
+func NewMockUpstream(t testing.TB) *MockUpstream {
+	m := &MockUpstream{t: t}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	m.URL = m.server.URL
+	t.Cleanup(m.Close)
+	return m
+}
+
+// Close stops mock server
+func (m *MockUpstream) Close() {
+	m.server.Close()
+}
+
+// On returns route for method and path, it is created if it does not exist. Empty method matches all methods and
+// path ending with * matches all paths with the prefix. Routes are matched in order of creation.
+func (m *MockUpstream) On(method string, path string) *MockRoute {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, route := range m.routes {
+		if route.method == method && route.path == path {
+			return route
+		}
+	}
+	route := &MockRoute{upstream: m, method: method, path: path}
+	m.routes = append(m.routes, route)
+	return route
+}
+
+// Respond adds response with status and body to script of route
+func (r *MockRoute) Respond(status int, body string) *MockRoute {
+	return r.add(&MockResponse{Status: status, Body: []byte(body)})
+}
+
+// RespondJSON adds JSON response to script of route
+func (r *MockRoute) RespondJSON(status int, v interface{}) *MockRoute {
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.upstream.t.Fatalf("mock upstream: unable to marshal response: %v", err)
+	}
+	response := &MockResponse{Status: status, Header: http.Header{}, Body: body}
+	response.Header.Set("Content-Type", "application/json")
+	return r.add(response)
+}
+
+// RespondWith adds response to script of route
+func (r *MockRoute) RespondWith(response MockResponse) *MockRoute {
+	return r.add(&response)
+}
+
+// Fail adds connection failure to script of route
+func (r *MockRoute) Fail() *MockRoute {
+	return r.add(&MockResponse{Fail: true})
+}
+
+// WithLatency sets latency of the last scripted response
+func (r *MockRoute) WithLatency(latency time.Duration) *MockRoute {
+	return r.updateLast(func(response *MockResponse) {
+		response.Latency = latency
+	})
+}
+
+// WithHeader adds header to the last scripted response
+func (r *MockRoute) WithHeader(key string, value string) *MockRoute {
+	return r.updateLast(func(response *MockResponse) {
+		if response.Header == nil {
+			response.Header = http.Header{}
+		}
+		response.Header.Add(key, value)
+	})
+}
+
+// Calls returns number of requests matched by route
+func (r *MockRoute) Calls() int {
+	r.upstream.mutex.Lock()
+	defer r.upstream.mutex.Unlock()
+	return r.calls
+}
+
+// add appends response to script
+func (r *MockRoute) add(response *MockResponse) *MockRoute {
+	r.upstream.mutex.Lock()
+	defer r.upstream.mutex.Unlock()
+	r.responses = append(r.responses, response)
+	return r
+}
+
+// updateLast modifies the last scripted response, empty 200 response is added if script is empty
+func (r *MockRoute) updateLast(fn func(response *MockResponse)) *MockRoute {
+	r.upstream.mutex.Lock()
+	defer r.upstream.mutex.Unlock()
+	if len(r.responses) == 0 {
+		r.responses = append(r.responses, &MockResponse{Status: http.StatusOK})
+	}
+	fn(r.responses[len(r.responses)-1])
+	return r
+}
+
+// matches returns true if route matches request
+func (r *MockRoute) matches(req *http.Request) bool {
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(r.path, "*"); ok {
+		return strings.HasPrefix(req.URL.Path, prefix)
+	}
+	return r.path == req.URL.Path
+}
+
+// Requests returns recorded requests in order of arrival
+func (m *MockUpstream) Requests() []RecordedRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]RecordedRequest(nil), m.requests...)
+}
+
+// LastRequest returns the last recorded request, test fails if there is none
+func (m *MockUpstream) LastRequest() RecordedRequest {
+	m.t.Helper()
+	requests := m.Requests()
+	if len(requests) == 0 {
+		m.t.Fatalf("mock upstream: no request received")
+	}
+	return requests[len(requests)-1]
+}
+
+// Reset removes routes and recorded requests
+func (m *MockUpstream) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.routes = nil
+	m.requests = nil
+}
+
+// Transport returns round tripper sending all requests to mock server regardless of their URL, original host is
+// kept in Host header
+func (m *MockUpstream) Transport() http.RoundTripper {
+	return &mockTransport{upstream: m, base: m.server.Client().Transport}
+}
+
+// Client returns client created like webservice.NewHTTPClient (deadline propagation) which sends all requests to
+// mock server
+func (m *MockUpstream) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: webservice.NewDeadlineTransport(m.Transport())}
+}
+
+// Install sets transport (e.g. &proxyOptions.Transport or transport field of service dependencies) to transport of
+// mock server, previous transport is restored by test cleanup. Clients and proxies have to be created after Install.
+func (m *MockUpstream) Install(transport *http.RoundTripper) {
+	previous := *transport
+	*transport = m.Transport()
+	m.t.Cleanup(func() {
+		*transport = previous
+	})
+}
+
+// mockTransport rewrites URL of requests to mock server
+type mockTransport struct {
+	upstream *MockUpstream
+	base     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	if clone.Host == "" {
+		clone.Host = req.URL.Host
+	}
+	clone.URL.Scheme = "http"
+	clone.URL.Host = strings.TrimPrefix(t.upstream.URL, "http://")
+	return t.base.RoundTrip(clone)
+}
+
+// serveHTTP records request and writes scripted response of the first matching route
+func (m *MockUpstream) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	recorded := RecordedRequest{
+		Method: req.Method,
+		Host:   req.Host,
+		Path:   req.URL.Path,
+		Query:  req.URL.RawQuery,
+		Header: req.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	}
+
+	m.mutex.Lock()
+	var response *MockResponse
+	for _, route := range m.routes {
+		if !route.matches(req) {
+			continue
+		}
+		recorded.Matched = true
+		response = &MockResponse{Status: http.StatusOK}
+		if len(route.responses) > 0 {
+			response = route.responses[min(route.calls, len(route.responses)-1)]
+		}
+		route.calls++
+		break
+	}
+	m.requests = append(m.requests, recorded)
+	m.mutex.Unlock()
+
+	if response == nil {
+		http.Error(w, fmt.Sprintf("mock upstream: no route for %s %s", req.Method, req.URL.Path), http.StatusNotImplemented)
+		return
+	}
+	if response.Latency > 0 {
+		timer := time.NewTimer(response.Latency)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	if response.Fail {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	for key, values := range response.Header {
+		w.Header()[key] = values
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(response.Body)
+}
@@ -0,0 +1,221 @@
+package webservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// poolTask is task queued in worker pool
+type poolTask struct {
+	ctx    context.Context
+	run    func(ctx context.Context)
+	fail   func(err error)
+	queued time.Time
+}
+
+// WorkerPool runs CPU-heavy tasks (reports, exports, PDF generation) on bounded number of goroutines separate
+// from HTTP handling. It is a Component, its configuration keys are <name>.workers (default number of CPUs),
+// <name>.queue_size (default 100) and <name>.timeout (default 1 minute).
+type WorkerPool struct {
+	name      string
+	workers   int
+	queueSize int
+	timeout   time.Duration
+	mutex     sync.RWMutex
+	running   bool
+	queue     chan *poolTask
+	done      chan struct{}
+	queued    prometheus.Gauge
+	wait      prometheus.Observer
+	duration  prometheus.Observer
+	tasks     *prometheus.CounterVec
+}
+
+var (
+	workerPoolQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_pool_queue_length",
+		Help: "Number of tasks waiting in worker pool queue.",
+	}, []string{"pool"})
+	workerPoolWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "worker_pool_wait_seconds",
+		Help: "Time tasks spent in worker pool queue.",
+	}, []string{"pool"})
+	workerPoolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_pool_task_duration_seconds",
+		Help:    "Duration of worker pool tasks.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"pool"})
+	workerPoolTasks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_pool_tasks_total",
+		Help: "Number of worker pool tasks by result (ok, error, timeout, rejected).",
+	}, []string{"pool", "result"})
+)
+
+// NewWorkerPool creates worker pool, name is used as configuration key and metrics label
+func NewWorkerPool(name string) *WorkerPool {
+	return &WorkerPool{
+		name:      name,
+		workers:   runtime.NumCPU(),
+		queueSize: 100,
+		timeout:   time.Minute,
+	}
+}
+
+// Name implements Component
+func (p *WorkerPool) Name() string {
+	return p.name
+}
+
+// Configure implements Component
+func (p *WorkerPool) Configure(config *viper.Viper) (err error) {
+	if config.IsSet("workers") {
+		p.workers = config.GetInt("workers")
+	}
+	if config.IsSet("queue_size") {
+		p.queueSize = config.GetInt("queue_size")
+	}
+	if config.IsSet("timeout") {
+		p.timeout = config.GetDuration("timeout")
+	}
+	if p.workers <= 0 {
+		return fmt.Errorf("worker pool %s: number of workers must be positive", p.name)
+	}
+	p.queued = registerCollector(workerPoolQueued).(*prometheus.GaugeVec).WithLabelValues(p.name)
+	p.wait = registerCollector(workerPoolWait).(*prometheus.HistogramVec).WithLabelValues(p.name)
+	p.duration = registerCollector(workerPoolDuration).(*prometheus.HistogramVec).WithLabelValues(p.name)
+	p.tasks = registerCollector(workerPoolTasks).(*prometheus.CounterVec)
+	return
+}
+
+// Routes implements Component
+func (p *WorkerPool) Routes(router *mux.Router) (err error) {
+	return
+}
+
+// Start implements Component - workers are started
+func (p *WorkerPool) Start(ctx context.Context) (err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queue = make(chan *poolTask, p.queueSize)
+	p.done = make(chan struct{})
+	for idx := 0; idx < p.workers; idx++ {
+		go p.worker(p.queue)
+	}
+	p.running = true
+	return
+}
+
+// Stop implements Component - queued tasks are finished before workers stop, new tasks are rejected
+func (p *WorkerPool) Stop(ctx context.Context) (err error) {
+	p.mutex.Lock()
+	if !p.running {
+		p.mutex.Unlock()
+		return
+	}
+	p.running = false
+	close(p.queue)
+	p.mutex.Unlock()
+	for idx := 0; idx < p.workers; idx++ {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+// worker runs queued tasks
+func (p *WorkerPool) worker(queue chan *poolTask) {
+	defer func() { p.done <- struct{}{} }()
+	for task := range queue {
+		p.queued.Dec()
+		p.wait.Observe(time.Since(task.queued).Seconds())
+		// Task of request which was already cancelled (client gone, timeout) is skipped
+		if task.ctx.Err() != nil {
+			continue
+		}
+		start := time.Now()
+		p.runTask(task)
+		p.duration.Observe(time.Since(start).Seconds())
+	}
+}
+
+// runTask runs task, panic of the task is returned as its error instead of crashing the process
+func (p *WorkerPool) runTask(task *poolTask) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			task.fail(fmt.Errorf("worker pool %s: task panicked: %v", p.name, rec))
+		}
+	}()
+	task.run(task.ctx)
+}
+
+// enqueue adds task to queue, false is returned if queue is full or pool is not running
+func (p *WorkerPool) enqueue(task *poolTask) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if !p.running {
+		return false
+	}
+	select {
+	case p.queue <- task:
+		p.queued.Inc()
+		return true
+	default:
+		return false
+	}
+}
+
+// RunInPool runs fn in worker pool and waits for result. Task has pool timeout, it is cancelled with ctx too.
+// If queue is full or pool is stopped, 503 server error with Retry-After is returned, so handlers can return error
+// directly. Panic of fn is returned as 500 server error.
+func RunInPool[T any](ctx context.Context, pool *WorkerPool, fn func(ctx context.Context) (T, error)) (result T, err error) {
+	ctx, cancel := context.WithTimeout(ctx, pool.timeout)
+	defer cancel()
+
+	type taskResult struct {
+		value T
+		err   error
+	}
+	resultCh := make(chan taskResult, 1)
+	task := &poolTask{
+		ctx:    ctx,
+		queued: time.Now(),
+		run: func(ctx context.Context) {
+			value, err := fn(ctx)
+			resultCh <- taskResult{value: value, err: err}
+		},
+		fail: func(err error) {
+			resultCh <- taskResult{err: ServerError(err, http.StatusInternalServerError, "Task failed")}
+		},
+	}
+
+	if !pool.enqueue(task) {
+		pool.tasks.WithLabelValues(pool.name, "rejected").Inc()
+		err = ServerError(fmt.Errorf("worker pool %s is full or stopped", pool.name), http.StatusServiceUnavailable, "Server is busy").WithRetryAfter(time.Second * 5)
+		return
+	}
+
+	select {
+	case r := <-resultCh:
+		if r.err != nil {
+			pool.tasks.WithLabelValues(pool.name, "error").Inc()
+		} else {
+			pool.tasks.WithLabelValues(pool.name, "ok").Inc()
+		}
+		return r.value, r.err
+	case <-ctx.Done():
+		pool.tasks.WithLabelValues(pool.name, "timeout").Inc()
+		err = ServerError(ctx.Err(), http.StatusGatewayTimeout, "Task timed out")
+		return
+	}
+}
@@ -0,0 +1,52 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRunInPool(t *testing.T) {
+	pool := NewWorkerPool("test_pool")
+	if err := pool.Configure(viper.New()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Pool which is not started rejects tasks
+	if _, err := RunInPool(ctx, pool, func(ctx context.Context) (int, error) { return 1, nil }); !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("expected 503 before start, got %v", err)
+	}
+
+	if err := pool.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := RunInPool(ctx, pool, func(ctx context.Context) (int, error) { return 1, nil }); err != nil || value != 1 {
+		t.Fatalf("unexpected result %d, %v", value, err)
+	}
+	if _, err := RunInPool(ctx, pool, func(ctx context.Context) (int, error) { panic("boom") }); !hasStatus(err, http.StatusInternalServerError) {
+		t.Fatalf("expected 500 for panicking task, got %v", err)
+	}
+	if value, err := RunInPool(ctx, pool, func(ctx context.Context) (int, error) { return 2, nil }); err != nil || value != 2 {
+		t.Fatalf("pool doesn't work after panic: %d, %v", value, err)
+	}
+
+	if err := pool.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RunInPool(ctx, pool, func(ctx context.Context) (int, error) { return 1, nil }); !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("expected 503 after stop, got %v", err)
+	}
+	if err := pool.Stop(ctx); err != nil {
+		t.Fatalf("second stop: %v", err)
+	}
+}
+
+// hasStatus returns if err is server error with given status code
+func hasStatus(err error, code int) bool {
+	var serverErr *ServerErrorData
+	return errors.As(err, &serverErr) && serverErr.Code == code
+}
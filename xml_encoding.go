@@ -0,0 +1,223 @@
+package webservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxBodyBytes is max size of body decoded by BindBody
+const defaultMaxBodyBytes = 10 << 20
+
+// isXMLMediaType returns true for application/xml, text/xml and +xml types
+func isXMLMediaType(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// isJSONMediaType returns true for application/json and +json types
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// prefersXML returns true if Accept header of request ranks XML higher than JSON. JSON wins ties and wildcards.
+func prefersXML(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	var jsonQ, xmlQ float64
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch {
+		case isXMLMediaType(mediaType):
+			if q > xmlQ {
+				xmlQ = q
+			}
+		case isJSONMediaType(mediaType), mediaType == "*/*", mediaType == "application/*":
+			if q > jsonQ {
+				jsonQ = q
+			}
+		}
+	}
+	return xmlQ > jsonQ
+}
+
+// WriteXML writes value as XML response (with XML declaration), it is indented if pretty JSON output is
+// configured (see JSONOptions)
+func WriteXML(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if options, _ := r.Context().Value(contextTypeJSONOptions).(*jsonRequestOptions); options != nil && options.pretty {
+		encoder.Indent("", "  ")
+	}
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	w.Header()["Content-Type"] = xmlContentType
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteResponse writes value as XML if Accept header of request prefers XML (application/xml, text/xml, +xml),
+// otherwise as JSON (see WriteJSON)
+func WriteResponse(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if prefersXML(r) {
+		return WriteXML(w, r, v)
+	}
+	return WriteJSON(w, r, v)
+}
+
+// BindBody decodes JSON or XML request body (selected by Content-Type) into dst and binds path and query
+// parameters like BindParams. XML is decoded by DecodeXML, charset of Content-Type header takes precedence over
+// encoding of XML declaration. Body is limited to 10 MiB, other content types are rejected with 415 error.
+func BindBody(r *http.Request, dst interface{}) error {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := http.MaxBytesReader(nil, r.Body, defaultMaxBodyBytes)
+	var err error
+	switch {
+	case isJSONMediaType(mediaType):
+		err = json.NewDecoder(body).Decode(dst)
+	case isXMLMediaType(mediaType):
+		err = decodeXML(body, params["charset"], dst)
+	default:
+		return ServerErrorWithoutStack(nil, http.StatusUnsupportedMediaType, "JSON or XML content type is expected").WithErrorCode("UNSUPPORTED_MEDIA_TYPE")
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return ServerErrorWithoutStack(err, http.StatusRequestEntityTooLarge, "Request body too large")
+		}
+		return ServerErrorWithoutStack(err, http.StatusBadRequest, "Malformed request body").WithErrorCode("MALFORMED_BODY")
+	}
+	return BindParams(r, dst)
+}
+
+// DecodeXML decodes single XML document into v. Decoder is strict and documents with DTD (DOCTYPE or ENTITY
+// declarations) are rejected, so entity expansion and external entities can't be abused. Encodings UTF-8,
+// US-ASCII, ISO-8859-1 and windows-1252 are supported.
+func DecodeXML(body io.Reader, v interface{}) error {
+	return decodeXML(body, "", v)
+}
+
+// decodeXML decodes XML document, charset (of Content-Type header) overrides encoding of XML declaration
+func decodeXML(body io.Reader, charset string, v interface{}) error {
+	decoder, err := newXMLDecoder(body, charset)
+	if err != nil {
+		return err
+	}
+	root, err := xmlRootElement(decoder)
+	if err != nil {
+		return err
+	}
+	return decoder.DecodeElement(v, &root)
+}
+
+// newXMLDecoder returns strict decoder converting supported charsets to UTF-8, charset (of Content-Type header)
+// overrides encoding of XML declaration
+func newXMLDecoder(body io.Reader, charset string) (*xml.Decoder, error) {
+	charsetReader := xmlCharsetReader
+	if charset != "" {
+		var err error
+		if body, err = xmlCharsetReader(charset, body); err != nil {
+			return nil, err
+		}
+		// Body is converted to UTF-8 already
+		charsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+	decoder := xml.NewDecoder(body)
+	decoder.CharsetReader = charsetReader
+	decoder.Strict = true
+	return decoder, nil
+}
+
+// xmlRootElement reads prolog of document and returns start of root element, DTD is rejected
+func xmlRootElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return xml.StartElement{}, errors.New("XML document has no root element")
+			}
+			return xml.StartElement{}, err
+		}
+		switch t := token.(type) {
+		case xml.Directive:
+			return xml.StartElement{}, errors.New("XML document type declarations are not allowed")
+		case xml.StartElement:
+			return t, nil
+		}
+	}
+}
+
+// xmlCharsetReader converts supported single byte charsets to UTF-8
+func xmlCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1":
+		return &singleByteReader{r: input}, nil
+	case "windows-1252", "cp1252":
+		return &singleByteReader{r: input, table: &windows1252}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", label)
+}
+
+// windows1252 maps bytes 0x80 - 0x9f of windows-1252 to runes, other bytes are same as in ISO-8859-1
+var windows1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// singleByteReader converts ISO-8859-1 (table is nil) or windows-1252 input to UTF-8
+type singleByteReader struct {
+	r     io.Reader
+	table *[32]rune
+	buf   [512]byte
+	out   []byte
+	pos   int
+	err   error
+}
+
+// Read implements io.Reader
+func (s *singleByteReader) Read(p []byte) (int, error) {
+	for s.pos == len(s.out) {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.out, s.pos = s.out[:0], 0
+		var n int
+		n, s.err = s.r.Read(s.buf[:])
+		for _, b := range s.buf[:n] {
+			c := rune(b)
+			if s.table != nil && b >= 0x80 && b < 0xa0 {
+				c = s.table[b-0x80]
+			}
+			s.out = utf8.AppendRune(s.out, c)
+		}
+	}
+	n := copy(p, s.out[s.pos:])
+	s.pos += n
+	return n, nil
+}